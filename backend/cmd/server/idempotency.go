@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// Idempotent makes a route safe to retry. A request with an Idempotency-Key
+// header runs once; its successful response is stored, and a retry with the
+// same key, caller, method, path and body gets that response back (marked
+// Idempotent-Replayed: true). Reusing the key for a different request, or
+// from another caller, is a 422, so a stored response is never handed to
+// someone who couldn't have made the request. Failed or panicking requests
+// are not stored, so they can simply be retried. Requests without the
+// header are not affected.
+func Idempotent(idem service.IdempotencyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(headerIdempotencyKey)
+		if key == "" || idem == nil {
+			return c.Next()
+		}
+
+		record, err := idem.Begin(c.Context(), key, requestFingerprint(c))
+		if err != nil {
+			return err
+		}
+		if record != nil {
+			log.Info().Str("idempotency_key", key).Str("path", c.Path()).Msg("Replaying stored response")
+			c.Set(headerIdempotentReplayed, "true")
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.Status(*record.StatusCode).Send(record.Response)
+		}
+
+		release := func() {
+			if err := idem.Release(c.Context(), key); err != nil {
+				log.Warn().Err(err).Str("idempotency_key", key).Msg("Failed to release idempotency key")
+			}
+		}
+		// A panicking handler must not leave the key reserved; the recover
+		// middleware still turns the panic into a 500
+		defer func() {
+			if r := recover(); r != nil {
+				release()
+				panic(r)
+			}
+		}()
+
+		err = c.Next()
+		status := c.Response().StatusCode()
+		if err != nil || status < 200 || status >= 300 {
+			release()
+			return err
+		}
+
+		// The request has succeeded either way; a retry just won't be deduplicated
+		response := append([]byte(nil), c.Response().Body()...)
+		if err := idem.Complete(c.Context(), key, status, response); err != nil {
+			log.Warn().Err(err).Str("idempotency_key", key).Msg("Failed to store idempotent response")
+		}
+		return nil
+	}
+}
+
+// requestFingerprint identifies a request by the authenticated caller (actor
+// and shop scope), method, path and body
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(service.ActorFromContext(c.Context())))
+	h.Write([]byte{'\n'})
+	if scope := service.ShopScopeFromContext(c.Context()); scope.All() {
+		h.Write([]byte("all"))
+	} else {
+		for _, shopID := range scope.ShopIDs() {
+			h.Write([]byte(strconv.Itoa(shopID) + ","))
+		}
+	}
+	h.Write([]byte{'\n'})
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(c.Path()))
+	h.Write([]byte{'\n'})
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// purgeIdempotencyKeys deletes expired keys every interval until ctx ends
+func purgeIdempotencyKeys(ctx context.Context, idem service.IdempotencyService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := idem.PurgeExpired(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to purge expired idempotency keys")
+			} else if purged > 0 {
+				log.Info().Int64("purged_count", purged).Msg("Purged expired idempotency keys")
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/handlers"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
+)
+
+func TestIdempotent(t *testing.T) {
+	newApp := func(idem service.IdempotencyService, handler fiber.Handler) *fiber.App {
+		app := fiber.New(fiber.Config{ErrorHandler: handlers.ErrorHandler})
+		app.Post("/orders", Idempotent(idem), handler)
+		return app
+	}
+	created := func(c *fiber.Ctx) error {
+		return c.Status(http.StatusCreated).JSON(fiber.Map{"id": "1202001"})
+	}
+	post := func(app *fiber.App, key, body string) (*http.Response, string) {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(headerIdempotencyKey, key)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		respBody, _ := io.ReadAll(resp.Body)
+		return resp, string(respBody)
+	}
+
+	t.Run("Stores the first response", func(t *testing.T) {
+		idem := new(mocks.MockIdempotencyService)
+		idem.On("Begin", mock.Anything, "k1", mock.Anything).Return(nil, nil)
+		idem.On("Complete", mock.Anything, "k1", http.StatusCreated, []byte(`{"id":"1202001"}`)).Return(nil)
+
+		resp, body := post(newApp(idem, created), "k1", `{"customer_name":"Ann"}`)
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, `{"id":"1202001"}`, body)
+		assert.Empty(t, resp.Header.Get(headerIdempotentReplayed))
+		idem.AssertExpectations(t)
+	})
+
+	t.Run("Replays the stored response", func(t *testing.T) {
+		status := http.StatusCreated
+		idem := new(mocks.MockIdempotencyService)
+		idem.On("Begin", mock.Anything, "k1", mock.Anything).
+			Return(&models.IdempotencyRecord{Key: "k1", StatusCode: &status, Response: []byte(`{"id":"1202001"}`)}, nil)
+
+		handlerCalled := false
+		resp, body := post(newApp(idem, func(c *fiber.Ctx) error {
+			handlerCalled = true
+			return created(c)
+		}), "k1", `{"customer_name":"Ann"}`)
+
+		assert.False(t, handlerCalled)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, `{"id":"1202001"}`, body)
+		assert.Equal(t, "true", resp.Header.Get(headerIdempotentReplayed))
+		idem.AssertExpectations(t)
+	})
+
+	t.Run("Key reused with a different body", func(t *testing.T) {
+		idem := new(mocks.MockIdempotencyService)
+		idem.On("Begin", mock.Anything, "k1", mock.Anything).Return(nil, service.ErrIdempotencyKeyReused)
+
+		resp, body := post(newApp(idem, created), "k1", `{"customer_name":"Bob"}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		assert.Contains(t, body, "IDEMPOTENCY_KEY_REUSED")
+	})
+
+	t.Run("Failed request releases the key", func(t *testing.T) {
+		idem := new(mocks.MockIdempotencyService)
+		idem.On("Begin", mock.Anything, "k1", mock.Anything).Return(nil, nil)
+		idem.On("Release", mock.Anything, "k1").Return(nil)
+
+		resp, _ := post(newApp(idem, func(c *fiber.Ctx) error {
+			return errors.New("database unavailable")
+		}), "k1", `{}`)
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		idem.AssertExpectations(t)
+		idem.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Panicking request releases the key", func(t *testing.T) {
+		idem := new(mocks.MockIdempotencyService)
+		idem.On("Begin", mock.Anything, "k1", mock.Anything).Return(nil, nil)
+		idem.On("Release", mock.Anything, "k1").Return(nil)
+
+		app := fiber.New(fiber.Config{ErrorHandler: handlers.ErrorHandler})
+		app.Use(recover.New())
+		app.Post("/orders", Idempotent(idem), func(c *fiber.Ctx) error {
+			panic("nil pointer dereference")
+		})
+		resp, _ := post(app, "k1", `{}`)
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		idem.AssertExpectations(t)
+		idem.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("No key", func(t *testing.T) {
+		idem := new(mocks.MockIdempotencyService)
+
+		resp, _ := post(newApp(idem, created), "", `{}`)
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		idem.AssertNotCalled(t, "Begin", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	var fingerprints []string
+	app := fiber.New()
+	app.All("/*", func(c *fiber.Ctx) error {
+		fingerprints = append(fingerprints, requestFingerprint(c))
+		return nil
+	})
+
+	for _, r := range []struct{ method, path, body string }{
+		{http.MethodPost, "/orders", `{"a":1}`},
+		{http.MethodPost, "/orders", `{"a":1}`},
+		{http.MethodPost, "/orders", `{"a":2}`},
+		{http.MethodPut, "/orders", `{"a":1}`},
+		{http.MethodPost, "/orders/1202001/complete", `{"a":1}`},
+	} {
+		_, err := app.Test(httptest.NewRequest(r.method, r.path, strings.NewReader(r.body)))
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, fingerprints, 5)
+	assert.Equal(t, fingerprints[0], fingerprints[1])
+	for _, other := range fingerprints[2:] {
+		assert.NotEqual(t, fingerprints[0], other)
+	}
+}
+
+func TestRequestFingerprint_Caller(t *testing.T) {
+	fingerprint := func(actor string, scope *service.ShopScope) string {
+		var got string
+		app := fiber.New()
+		app.Post("/orders", func(c *fiber.Ctx) error {
+			if actor != "" {
+				c.Locals(service.ActorKey{}, actor)
+			}
+			if scope != nil {
+				c.Locals(service.ShopScopeKey{}, *scope)
+			}
+			got = requestFingerprint(c)
+			return nil
+		})
+		_, err := app.Test(httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"a":1}`)))
+		assert.NoError(t, err)
+		return got
+	}
+	fries, drinks := service.OnlyShops(1), service.OnlyShops(2)
+
+	// The same request from another user or shop can't replay the response
+	assert.Equal(t, fingerprint("cashier1", &fries), fingerprint("cashier1", &fries))
+	assert.NotEqual(t, fingerprint("cashier1", &fries), fingerprint("cashier2", &fries))
+	assert.NotEqual(t, fingerprint("cashier1", &fries), fingerprint("cashier1", &drinks))
+	assert.NotEqual(t, fingerprint("cashier1", &fries), fingerprint("cashier1", nil))
+	assert.NotEqual(t, fingerprint("cashier1", nil), fingerprint("", nil))
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+// Security log events, logged with the "event" field so they can be filtered
+const (
+	securityEventAuthFailed = "auth_failed"    // wrong password or invalid token
+	securityEventLockout    = "auth_lockout"   // an IP or account was locked out
+	securityEventBlocked    = "auth_blocked"   // request refused during a lockout
+	securityEventLogin      = "auth_logged_in" // successful login
+)
+
+// maxTrackedKeys bounds the attempt table; past it, forgotten entries are pruned
+const maxTrackedKeys = 10000
+
+// LockoutPolicy decides when repeated failures lock a key out
+type LockoutPolicy struct {
+	MaxFailures int           // failures allowed before the first lockout
+	BaseLockout time.Duration // first lockout; doubles with each further failure
+	MaxLockout  time.Duration // upper bound on a single lockout
+	ResetAfter  time.Duration // failures are forgotten after this long without one
+}
+
+// DefaultIPLockout is lenient because the fair's Wi-Fi puts many tablets and
+// phones behind the same address
+var DefaultIPLockout = LockoutPolicy{
+	MaxFailures: 20,
+	BaseLockout: time.Minute,
+	MaxLockout:  time.Hour,
+	ResetAfter:  time.Hour,
+}
+
+// DefaultAccountLockout protects a single username from password guessing
+var DefaultAccountLockout = LockoutPolicy{
+	MaxFailures: 5,
+	BaseLockout: 30 * time.Second,
+	MaxLockout:  30 * time.Minute,
+	ResetAfter:  time.Hour,
+}
+
+// attemptRecord is the failure history of one key
+type attemptRecord struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// AttemptLimiter counts failed attempts per key (an IP or a username) and
+// locks the key out for exponentially longer after MaxFailures. A nil
+// *AttemptLimiter never locks anything out.
+type AttemptLimiter struct {
+	policy  LockoutPolicy
+	mu      sync.Mutex
+	records map[string]*attemptRecord
+	now     func() time.Time
+}
+
+// NewAttemptLimiter creates a limiter with the given policy
+func NewAttemptLimiter(policy LockoutPolicy) *AttemptLimiter {
+	return &AttemptLimiter{
+		policy:  policy,
+		records: make(map[string]*attemptRecord),
+		now:     time.Now,
+	}
+}
+
+// Locked returns how long the key is still locked out for, or 0
+func (l *AttemptLimiter) Locked(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, ok := l.records[key]
+	if !ok {
+		return 0
+	}
+	now := l.now()
+	if l.forgotten(record, now) {
+		delete(l.records, key)
+		return 0
+	}
+	if remaining := record.lockedUntil.Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Fail records a failed attempt. It returns the number of failures so far and
+// the lockout that starts now (0 while under MaxFailures).
+func (l *AttemptLimiter) Fail(key string) (failures int, lockout time.Duration) {
+	if l == nil {
+		return 0, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	record, ok := l.records[key]
+	if !ok || l.forgotten(record, now) {
+		if len(l.records) >= maxTrackedKeys {
+			l.pruneLocked(now)
+		}
+		record = &attemptRecord{}
+		l.records[key] = record
+	}
+
+	record.failures++
+	record.lastFailure = now
+
+	lockout = l.lockoutFor(record.failures)
+	if lockout > 0 {
+		record.lockedUntil = now.Add(lockout)
+	}
+	return record.failures, lockout
+}
+
+// Reset forgets the key's failures, e.g. after a successful login
+func (l *AttemptLimiter) Reset(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.records, key)
+}
+
+// lockoutFor is BaseLockout doubled for every failure past MaxFailures
+func (l *AttemptLimiter) lockoutFor(failures int) time.Duration {
+	if failures < l.policy.MaxFailures {
+		return 0
+	}
+
+	lockout := l.policy.BaseLockout
+	for i := l.policy.MaxFailures; i < failures && lockout < l.policy.MaxLockout; i++ {
+		if lockout > math.MaxInt64/2 {
+			break
+		}
+		lockout *= 2
+	}
+	return min(lockout, l.policy.MaxLockout)
+}
+
+// forgotten reports whether a record has expired: not locked, and no failure
+// for ResetAfter
+func (l *AttemptLimiter) forgotten(record *attemptRecord, now time.Time) bool {
+	return !now.Before(record.lockedUntil) && now.Sub(record.lastFailure) >= l.policy.ResetAfter
+}
+
+// pruneLocked drops expired records. Caller holds l.mu.
+func (l *AttemptLimiter) pruneLocked(now time.Time) {
+	for key, record := range l.records {
+		if l.forgotten(record, now) {
+			delete(l.records, key)
+		}
+	}
+}
+
+// LoginGuard throttles credential guessing, per client IP for every
+// authenticated route and additionally per username on the login endpoint.
+// A nil *LoginGuard does no throttling.
+type LoginGuard struct {
+	ip      *AttemptLimiter
+	account *AttemptLimiter
+}
+
+// NewLoginGuard creates a guard with separate IP and account policies
+func NewLoginGuard(ip, account LockoutPolicy) *LoginGuard {
+	return &LoginGuard{
+		ip:      NewAttemptLimiter(ip),
+		account: NewAttemptLimiter(account),
+	}
+}
+
+// blocked responds 429 when the client IP (or account, when given) is locked
+// out. It reports whether the request was refused.
+func (g *LoginGuard) blocked(c *fiber.Ctx, username string) (bool, error) {
+	if g == nil {
+		return false, nil
+	}
+
+	wait := g.ip.Locked(c.IP())
+	if username != "" {
+		wait = max(wait, g.account.Locked(username))
+	}
+	if wait == 0 {
+		return false, nil
+	}
+
+	securityEvent(log.Warn(), securityEventBlocked, c, username).
+		Dur("retry_after", wait).
+		Msg("Authentication refused during lockout")
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return true, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error": "Too many failed attempts, try again later",
+		"code":  "TOO_MANY_ATTEMPTS",
+	})
+}
+
+// failed records a failed attempt for the client IP (and account, when given)
+func (g *LoginGuard) failed(c *fiber.Ctx, username string) {
+	if g == nil {
+		return
+	}
+
+	ip := c.IP()
+	failures, lockout := g.ip.Fail(ip)
+	securityEvent(log.Warn(), securityEventAuthFailed, c, username).
+		Int("ip_failures", failures).
+		Msg("Authentication failed")
+	if lockout > 0 {
+		securityEvent(log.Warn(), securityEventLockout, c, "").
+			Int("failures", failures).
+			Dur("lockout", lockout).
+			Msg("Client IP locked out")
+	}
+
+	if username == "" {
+		return
+	}
+	failures, lockout = g.account.Fail(username)
+	if lockout > 0 {
+		securityEvent(log.Warn(), securityEventLockout, c, username).
+			Int("failures", failures).
+			Dur("lockout", lockout).
+			Msg("Account locked out")
+	}
+}
+
+// LoginThrottle guards the login endpoint: locked-out IPs and usernames get
+// 429 before the password is checked, and wrong passwords count towards both.
+// A successful login clears the account's failures (the IP's are left to
+// expire, since other devices may share it).
+func LoginThrottle(guard *LoginGuard) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.LoginRequest
+		_ = json.Unmarshal(c.Body(), &req)
+		username := strings.ToLower(strings.TrimSpace(req.Username))
+
+		if refused, err := guard.blocked(c, username); refused {
+			return err
+		}
+
+		err := c.Next()
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			guard.failed(c, username)
+		case err == nil && c.Response().StatusCode() == fiber.StatusOK:
+			if guard != nil {
+				guard.account.Reset(username)
+			}
+			securityEvent(log.Info(), securityEventLogin, c, username).Msg("Login succeeded")
+		}
+		return err
+	}
+}
+
+// securityEvent starts a structured log entry for an authentication event
+func securityEvent(e *zerolog.Event, event string, c *fiber.Ctx, username string) *zerolog.Event {
+	e = e.Str("event", event).
+		Str("ip", c.IP()).
+		Str("method", c.Method()).
+		Str("path", c.Path())
+	if username != "" {
+		e = e.Str("username", username)
+	}
+	return e
+}
+
+// secretEqual compares two secrets in constant time. Both are hashed first so
+// the comparison does not leak the length of the expected secret either.
+func secretEqual(given, expected string) bool {
+	g := sha256.Sum256([]byte(given))
+	e := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(g[:], e[:]) == 1
+}
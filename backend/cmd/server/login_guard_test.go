@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/handlers"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
+)
+
+// fakeClock is a settable time source for limiters
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter(policy LockoutPolicy) (*AttemptLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)}
+	limiter := NewAttemptLimiter(policy)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestAttemptLimiter_ExponentialLockout(t *testing.T) {
+	limiter, clock := newTestLimiter(LockoutPolicy{
+		MaxFailures: 3,
+		BaseLockout: 10 * time.Second,
+		MaxLockout:  time.Minute,
+		ResetAfter:  time.Hour,
+	})
+
+	// Under the threshold nothing is locked
+	for i := 1; i < 3; i++ {
+		failures, lockout := limiter.Fail("10.0.0.1")
+		assert.Equal(t, i, failures)
+		assert.Zero(t, lockout)
+	}
+	assert.Zero(t, limiter.Locked("10.0.0.1"))
+
+	// Each failure from the threshold on doubles the lockout, up to the cap
+	wantLockouts := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for _, want := range wantLockouts {
+		_, lockout := limiter.Fail("10.0.0.1")
+		assert.Equal(t, want, lockout)
+		assert.Equal(t, want, limiter.Locked("10.0.0.1"))
+	}
+
+	// Other keys are unaffected
+	assert.Zero(t, limiter.Locked("10.0.0.2"))
+
+	// The lockout runs out, but the failures are remembered
+	clock.Advance(time.Minute)
+	assert.Zero(t, limiter.Locked("10.0.0.1"))
+	_, lockout := limiter.Fail("10.0.0.1")
+	assert.Equal(t, time.Minute, lockout)
+}
+
+func TestAttemptLimiter_ForgetsAndResets(t *testing.T) {
+	limiter, clock := newTestLimiter(LockoutPolicy{
+		MaxFailures: 2,
+		BaseLockout: time.Second,
+		MaxLockout:  time.Minute,
+		ResetAfter:  10 * time.Minute,
+	})
+
+	limiter.Fail("cashier1")
+	clock.Advance(10 * time.Minute)
+
+	// The earlier failure has expired, so this is the first again
+	failures, lockout := limiter.Fail("cashier1")
+	assert.Equal(t, 1, failures)
+	assert.Zero(t, lockout)
+
+	_, lockout = limiter.Fail("cashier1")
+	assert.Equal(t, time.Second, lockout)
+
+	limiter.Reset("cashier1")
+	assert.Zero(t, limiter.Locked("cashier1"))
+	failures, _ = limiter.Fail("cashier1")
+	assert.Equal(t, 1, failures)
+}
+
+func TestAttemptLimiter_Nil(t *testing.T) {
+	var limiter *AttemptLimiter
+	failures, lockout := limiter.Fail("key")
+	assert.Zero(t, failures)
+	assert.Zero(t, lockout)
+	assert.Zero(t, limiter.Locked("key"))
+	limiter.Reset("key")
+}
+
+func TestSecretEqual(t *testing.T) {
+	assert.True(t, secretEqual("staff_secret", "staff_secret"))
+	assert.False(t, secretEqual("staff_secre", "staff_secret"))
+	assert.False(t, secretEqual("Staff_secret", "staff_secret"))
+	assert.False(t, secretEqual("", "staff_secret"))
+}
+
+func TestStaffAuth_LocksOutIP(t *testing.T) {
+	guard := NewLoginGuard(
+		LockoutPolicy{MaxFailures: 3, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour},
+		DefaultAccountLockout,
+	)
+
+	app := fiber.New()
+	app.Get("/staff", StaffAuth(nil, guard, "staff_secret"), func(c *fiber.Ctx) error {
+		return c.SendString("success")
+	})
+
+	get := func(token string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/staff", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// A correct password doesn't clear the IP's failures
+	assert.Equal(t, http.StatusUnauthorized, get("guess1").StatusCode)
+	assert.Equal(t, http.StatusOK, get("staff_secret").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get("guess2").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get("guess3").StatusCode)
+
+	// Locked out: even the right password is refused until the lockout ends
+	resp := get("staff_secret")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get(fiber.HeaderRetryAfter))
+}
+
+func TestStaffAuth_ExpiredSessionsDontLockOutIP(t *testing.T) {
+	guard := NewLoginGuard(
+		LockoutPolicy{MaxFailures: 3, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour},
+		DefaultAccountLockout,
+	)
+	authService := new(mocks.MockAuthService)
+	authService.On("Authenticate", mock.Anything, "expired-token").Return(nil, service.ErrSessionExpired)
+	authService.On("Authenticate", mock.Anything, mock.Anything).Return(nil, service.ErrUnauthorized)
+
+	app := fiber.New()
+	app.Get("/staff", StaffAuth(authService, guard, "staff_secret"), func(c *fiber.Ctx) error {
+		return c.SendString("success")
+	})
+
+	get := func(token string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/staff", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// Tablets left logged in past their session aren't guessing
+	for range 5 {
+		assert.Equal(t, http.StatusUnauthorized, get("expired-token").StatusCode)
+	}
+	assert.Equal(t, http.StatusOK, get("staff_secret").StatusCode)
+
+	// Wrong passwords and forged tokens still count
+	assert.Equal(t, http.StatusUnauthorized, get("guess1").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get("forged-token").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get("guess2").StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, get("staff_secret").StatusCode)
+}
+
+func TestLoginThrottle(t *testing.T) {
+	guard := NewLoginGuard(
+		LockoutPolicy{MaxFailures: 7, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour},
+		LockoutPolicy{MaxFailures: 3, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour},
+	)
+
+	app := fiber.New(fiber.Config{ErrorHandler: handlers.ErrorHandler})
+	app.Post("/login", LoginThrottle(guard), func(c *fiber.Ctx) error {
+		var req models.LoginRequest
+		if err := c.BodyParser(&req); err != nil {
+			return err
+		}
+		if req.Password != "right-password" {
+			return service.ErrInvalidCredentials
+		}
+		return c.JSON(fiber.Map{"token": "session-token"})
+	})
+
+	login := func(username, password string) int {
+		body, _ := json.Marshal(models.LoginRequest{Username: username, Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// A success clears the account's failures
+	assert.Equal(t, http.StatusUnauthorized, login("cashier1", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, login("cashier1", "wrong"))
+	assert.Equal(t, http.StatusOK, login("cashier1", "right-password"))
+	assert.Equal(t, http.StatusUnauthorized, login("cashier1", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, login("cashier1", "wrong"))
+
+	// Third failure in a row locks the account, whatever the case of the name
+	assert.Equal(t, http.StatusUnauthorized, login("Cashier1", "wrong"))
+	assert.Equal(t, http.StatusTooManyRequests, login("cashier1", "right-password"))
+
+	// Other accounts from the same IP can still log in
+	assert.Equal(t, http.StatusOK, login("cashier2", "right-password"))
+
+	// Until the IP itself has failed too often (7 failures across accounts)
+	assert.Equal(t, http.StatusUnauthorized, login("cashier2", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, login("cashier2", "wrong"))
+	assert.Equal(t, http.StatusTooManyRequests, login("cashier3", "right-password"))
+}
@@ -2,12 +2,12 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
 	"syscall"
 	"time"
+	_ "time/tzdata" // business timezone must resolve even without system tzdata
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
@@ -18,6 +18,7 @@ import (
 	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
 	"github.com/tanasatit/barvidva-kasetfair/internal/service"
 	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+	"github.com/tanasatit/barvidva-kasetfair/pkg/promptpay"
 )
 
 func main() {
@@ -46,33 +47,87 @@ func main() {
 	db := initDatabase(databaseURL)
 	defer db.Close()
 
+	// Order ID layout: optional shop prefix and 3 (DDMMXXX) or 4 (DDMMXXXX) sequence digits
+	idScheme, err := utils.NewOrderIDScheme(os.Getenv("ORDER_ID_PREFIX"), getEnvInt("ORDER_ID_SEQUENCE_DIGITS", 3))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid order ID configuration")
+	}
+
 	// Initialize repositories
-	orderRepo := repository.NewOrderRepository(db)
+	orderRepo := repository.NewOrderRepository(db, idScheme)
 	menuRepo := repository.NewMenuRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	shopRepo := repository.NewShopRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	inventoryRepo := repository.NewInventoryRepository(db)
 
 	// Initialize cache (no-op for MVP)
 	cache := utils.NewNoOpCache()
 
+	// Business day: local timezone plus the hour after midnight at which a new day starts
+	clock, err := utils.NewBusinessClock(getEnv("BUSINESS_TIMEZONE", "Asia/Bangkok"), getEnvInt("BUSINESS_DAY_ROLLOVER_HOUR", 4))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid business day configuration")
+	}
+
+	// Order events feed the real-time streams (SSE) for POS and kitchen screens
+	orderEvents := service.NewOrderEventBroker(service.DefaultOrderEventHistory)
+
 	// Initialize services
-	orderService := service.NewOrderService(orderRepo, menuRepo, cache)
-	menuService := service.NewMenuService(menuRepo)
+	orderService := service.NewOrderService(orderRepo, menuRepo, cache, clock, orderEvents)
+	// PromptPay QR codes pay the order's shop, or PROMPTPAY_ID for shops without an account
+	promptPayAccount := os.Getenv("PROMPTPAY_ID")
+	if promptPayAccount != "" {
+		if _, err := promptpay.ParseTarget(promptPayAccount); err != nil {
+			log.Fatal().Err(err).Msg("Invalid PROMPTPAY_ID")
+		}
+	}
+	// With a payment provider configured, PromptPay payments are confirmed by
+	// its signed notifications instead of by eye
+	var paymentWebhookService service.PaymentWebhookService
+	if secret := os.Getenv("PAYMENT_WEBHOOK_SECRET"); secret != "" {
+		verifier := service.NewSignedPaymentVerifier(getEnv("PAYMENT_PROVIDER", "bank"), secret, repository.NewPaymentNotificationRepository(db))
+		orderService = service.WithPaymentVerification(orderService, verifier)
+		paymentWebhookService = service.NewPaymentWebhookService(orderService, orderRepo, shopRepo, verifier, promptPayAccount)
+	}
+	menuService := service.NewMenuService(menuRepo, shopRepo)
+	inventoryService := service.NewInventoryService(inventoryRepo, menuRepo)
+	shopService := service.NewShopService(shopRepo)
+	promptPayService := service.NewPromptPayService(orderRepo, shopRepo, promptPayAccount)
+	authService := service.NewAuthService(userRepo, initSessionSigner(), time.Duration(getEnvInt("SESSION_TTL_HOURS", 12))*time.Hour)
+	bootstrapAdmin(authService)
+	// Idempotency keys are remembered for IDEMPOTENCY_WINDOW_HOURS, long enough to cover any retry
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, clock, time.Duration(getEnvInt("IDEMPOTENCY_WINDOW_HOURS", 24))*time.Hour)
 
 	// Initialize handlers
 	orderHandler := handlers.NewOrderHandler(orderService)
 	menuHandler := handlers.NewMenuHandler(menuService)
-	statsHandler := handlers.NewStatsHandler(db)
+	statsHandler := handlers.NewStatsHandler(db, clock)
 	adminHandler := handlers.NewAdminHandler(orderRepo)
+	heartbeat := time.Duration(getEnvInt("SSE_HEARTBEAT_SECONDS", 15)) * time.Second
+	eventsHandler := handlers.NewEventsHandler(orderEvents, authService, heartbeat)
+	kitchenHandler := handlers.NewKitchenHandler(orderService, orderEvents, authService, heartbeat)
+	authHandler := handlers.NewAuthHandler(authService)
+	shopHandler := handlers.NewShopHandler(shopService)
+	inventoryHandler := handlers.NewInventoryHandler(inventoryService)
+	promptPayHandler := handlers.NewPromptPayHandler(promptPayService)
+	var paymentWebhookHandler *handlers.PaymentWebhookHandler
+	if paymentWebhookService != nil {
+		paymentWebhookHandler = handlers.NewPaymentWebhookHandler(paymentWebhookService)
+	}
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		ErrorHandler: customErrorHandler,
+		// Behind a proxy (e.g. Fly-Client-IP) so login lockouts see the real client IP
+		ProxyHeader: os.Getenv("PROXY_IP_HEADER"),
 	})
 
 	// Setup middleware
 	setupMiddleware(app)
 
 	// Setup routes
-	setupRoutes(app, db, orderHandler, menuHandler, statsHandler, adminHandler)
+	setupRoutes(app, db, orderHandler, menuHandler, statsHandler, adminHandler, eventsHandler, kitchenHandler, authHandler, shopHandler, inventoryHandler, promptPayHandler, paymentWebhookHandler, authService, idempotencyService)
 
 	// Setup context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -81,8 +136,9 @@ func main() {
 	// Start order expiry service
 	expiryMinutes := getEnvInt("ORDER_EXPIRY_MINUTES", 60)
 	checkIntervalSeconds := getEnvInt("EXPIRY_CHECK_INTERVAL_SECONDS", 60)
-	expiryService := service.NewExpiryService(orderRepo, expiryMinutes, time.Duration(checkIntervalSeconds)*time.Second)
+	expiryService := service.NewExpiryService(orderRepo, expiryMinutes, time.Duration(checkIntervalSeconds)*time.Second, clock, orderEvents)
 	go expiryService.Start(ctx)
+	go purgeIdempotencyKeys(ctx, idempotencyService, time.Hour)
 
 	// Get port from environment
 	port := os.Getenv("PORT")
@@ -97,7 +153,8 @@ func main() {
 		<-sigChan
 
 		log.Info().Msg("Received shutdown signal, shutting down gracefully...")
-		cancel() // Stop expiry service
+		cancel()            // Stop expiry service
+		orderEvents.Close() // End open event streams so shutdown doesn't wait on them
 
 		if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
 			log.Error().Err(err).Msg("Error during server shutdown")
@@ -112,6 +169,56 @@ func main() {
 	}
 }
 
+// initSessionSigner creates the signer for session tokens from SESSION_SECRET.
+// Without one a random secret is used, which logs everyone out on restart.
+func initSessionSigner() *utils.SessionSigner {
+	secret := os.Getenv("SESSION_SECRET")
+	if secret == "" {
+		log.Warn().Msg("SESSION_SECRET not set, sessions will not survive a restart")
+		var err error
+		secret, err = utils.NewRandomSessionSecret()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate session secret")
+		}
+	}
+
+	signer, err := utils.NewSessionSigner(secret)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid SESSION_SECRET")
+	}
+	return signer
+}
+
+// bootstrapAdmin creates the first admin account from ADMIN_USERNAME and
+// ADMIN_PASSWORD when the users table is empty
+func bootstrapAdmin(authService service.AuthService) {
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	username := getEnv("ADMIN_USERNAME", "admin")
+	created, err := authService.EnsureAdmin(ctx, username, password)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not create initial admin account")
+		return
+	}
+	if created {
+		log.Info().Str("username", username).Msg("Created initial admin account")
+	}
+}
+
+// getEnv reads a string from environment variable with a default value
+func getEnv(key, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return defaultVal
+}
+
 // getEnvInt reads an integer from environment variable with a default value
 func getEnvInt(key string, defaultVal int) int {
 	val := os.Getenv(key)
@@ -126,16 +233,8 @@ func getEnvInt(key string, defaultVal int) int {
 	return intVal
 }
 
-// customErrorHandler handles errors returned from handlers
+// customErrorHandler handles errors returned from handlers, mapping service
+// errors to a status and the shared JSON error envelope
 func customErrorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
-
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
-	}
-
-	return c.Status(code).JSON(fiber.Map{
-		"error": err.Error(),
-		"code":  fmt.Sprintf("HTTP_%d", code),
-	})
+	return handlers.ErrorHandler(c, err)
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"strings"
 
@@ -8,6 +9,9 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
 )
 
 // setupMiddleware configures all middleware for the Fiber app
@@ -22,63 +26,146 @@ func setupMiddleware(app *fiber.App) {
 
 	// CORS middleware - enables cross-origin requests
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:  "Origin,Content-Type,Accept,Authorization,Idempotency-Key",
+		ExposeHeaders: "Idempotent-Replayed",
 	}))
 }
 
-// StaffAuth creates middleware that validates staff password.
-// Uses Bearer token authentication: Authorization: Bearer <password>
-// Also accepts admin password for convenience (admin can access staff routes)
-func StaffAuth(password string) fiber.Handler {
-	adminPassword := os.Getenv("ADMIN_PASSWORD")
+// sharedCredential is a legacy shared password, the actor it is recorded as
+// and the role it is granted
+type sharedCredential struct {
+	password string
+	actor    string
+	role     models.Role
+}
+
+// StaffAuth creates middleware that accepts the session token of any active
+// user: Authorization: Bearer <token>. What the caller may then do is checked
+// per route with RequirePermission.
+// The shared STAFF_PASSWORD (as a cashier) and ADMIN_PASSWORD (as the owner)
+// are still accepted while set, so existing tablets keep working until every
+// cashier has an account.
+// Failed attempts count towards the client IP's lockout in guard.
+func StaffAuth(auth service.AuthService, guard *LoginGuard, password string) fiber.Handler {
+	return sessionAuth(auth, guard,
+		sharedCredential{password: password, actor: "staff", role: models.RoleCashier},
+		sharedCredential{password: os.Getenv("ADMIN_PASSWORD"), actor: "admin", role: models.RoleOwner},
+	)
+}
+
+// StaffWebSocketAuth validates the staff credential on a WebSocket handshake.
+// Browsers cannot set headers on a WebSocket request, so the same token
+// StaffAuth expects may also be passed as ?token=<token>.
+func StaffWebSocketAuth(auth service.AuthService, guard *LoginGuard, password string) fiber.Handler {
+	staffAuth := StaffAuth(auth, guard, password)
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" && c.Query("token") != "" {
+			c.Request().Header.Set("Authorization", "Bearer "+c.Query("token"))
+		}
+		return staffAuth(c)
+	}
+}
+
+// UserAuth creates middleware that only accepts session tokens, for routes
+// that act on the session itself (logout, current user)
+func UserAuth(auth service.AuthService, guard *LoginGuard) fiber.Handler {
+	return sessionAuth(auth, guard)
+}
+
+// sessionAuth authenticates the bearer token as a user session or one of the
+// shared passwords. The user, role and actor are stored in the request
+// context for RequirePermission, handlers and services.
+// Passwords are compared in constant time, and a client IP that keeps
+// guessing is locked out by guard. A genuine session token that has expired
+// or been revoked is refused without counting as a guess, since the whole
+// booth shares one IP.
+func sessionAuth(auth service.AuthService, guard *LoginGuard, shared ...sharedCredential) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		auth := c.Get("Authorization")
+		authHeader := c.Get("Authorization")
 
 		// Check for Bearer token format
-		if !strings.HasPrefix(auth, "Bearer ") {
+		if !strings.HasPrefix(authHeader, "Bearer ") {
 			return c.Status(401).JSON(fiber.Map{
 				"error": "Missing or invalid authorization header",
 				"code":  "UNAUTHORIZED",
 			})
 		}
 
-		token := strings.TrimPrefix(auth, "Bearer ")
-		// Accept both staff password and admin password
-		if token != password && token != adminPassword {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Invalid credentials",
-				"code":  "UNAUTHORIZED",
-			})
+		if refused, err := guard.blocked(c, ""); refused {
+			return err
 		}
 
-		return c.Next()
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+
+		for _, cred := range shared {
+			if cred.password != "" && secretEqual(token, cred.password) {
+				c.Locals(service.RoleKey{}, cred.role)
+				c.Locals(service.ActorKey{}, cred.actor)
+				return c.Next()
+			}
+		}
+
+		if auth != nil && token != "" {
+			user, err := auth.Authenticate(c.Context(), token)
+			if err == nil {
+				c.Locals(service.UserKey{}, user)
+				c.Locals(service.RoleKey{}, user.Role)
+				c.Locals(service.ActorKey{}, user.Username)
+				c.Locals(service.ShopScopeKey{}, service.ScopeForUser(user))
+				return c.Next()
+			}
+			if errors.Is(err, service.ErrSessionExpired) {
+				return c.Status(401).JSON(fiber.Map{
+					"error": "Session expired, please log in again",
+					"code":  "UNAUTHORIZED",
+				})
+			}
+			if !errors.Is(err, service.ErrUnauthorized) {
+				return err
+			}
+		}
+
+		guard.failed(c, "")
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Invalid credentials",
+			"code":  "UNAUTHORIZED",
+		})
 	}
 }
 
-// AdminAuth creates middleware that validates admin password.
-// Uses Bearer token authentication: Authorization: Bearer <password>
-func AdminAuth(password string) fiber.Handler {
+// RequirePermission creates middleware that only lets the request through
+// when the authenticated caller's role has every one of perms
+func RequirePermission(perms ...models.Permission) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		auth := c.Get("Authorization")
-
-		// Check for Bearer token format
-		if !strings.HasPrefix(auth, "Bearer ") {
+		role, ok := service.RoleFromContext(c.Context())
+		if !ok {
 			return c.Status(401).JSON(fiber.Map{
-				"error": "Missing or invalid authorization header",
+				"error": "Authentication required",
 				"code":  "UNAUTHORIZED",
 			})
 		}
 
-		token := strings.TrimPrefix(auth, "Bearer ")
-		if token != password {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Invalid credentials",
-				"code":  "UNAUTHORIZED",
-			})
+		for _, perm := range perms {
+			if !role.Can(perm) {
+				return c.Status(403).JSON(fiber.Map{
+					"error": "Insufficient permissions",
+					"code":  "FORBIDDEN",
+				})
+			}
 		}
+		return c.Next()
+	}
+}
 
+// Anonymous lets unauthenticated requests act with the given role, recording
+// changes under actor. Only used for the POS routes when POS_PUBLIC is set,
+// for counters that have not moved to staff logins yet.
+func Anonymous(actor string, role models.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(service.RoleKey{}, role)
+		c.Locals(service.ActorKey{}, actor)
 		return c.Next()
 	}
 }
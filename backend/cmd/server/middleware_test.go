@@ -8,6 +8,11 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
 )
 
 func TestStaffAuth(t *testing.T) {
@@ -72,7 +77,7 @@ func TestStaffAuth(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			app := fiber.New()
-			app.Use(StaffAuth(tt.password))
+			app.Use(StaffAuth(nil, nil, tt.password))
 			app.Get("/test", func(c *fiber.Ctx) error {
 				return c.SendString("success")
 			})
@@ -92,106 +97,241 @@ func TestStaffAuth(t *testing.T) {
 	}
 }
 
-func TestAdminAuth(t *testing.T) {
+func TestRequirePermission(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "admin_secret")
+
+	app := fiber.New()
+	staff := app.Group("/", StaffAuth(nil, nil, "staff_secret"))
+	staff.Put("/orders/mark-paid", RequirePermission(models.PermOrderMarkPaid), func(c *fiber.Ctx) error {
+		return c.SendString("paid")
+	})
+	staff.Delete("/orders", RequirePermission(models.PermOrdersDelete), func(c *fiber.Ctx) error {
+		return c.SendString("deleted")
+	})
+	app.Get("/unauthenticated", RequirePermission(models.PermOrderView), func(c *fiber.Ctx) error {
+		return c.SendString("queue")
+	})
+
 	tests := []struct {
 		name           string
-		password       string
-		authHeader     string
+		method         string
+		path           string
+		token          string
 		wantStatusCode int
-		wantBody       string
 	}{
-		{
-			name:           "Valid admin password",
-			password:       "test_admin_password",
-			authHeader:     "Bearer test_admin_password",
-			wantStatusCode: http.StatusOK,
-			wantBody:       "success",
-		},
-		{
-			name:           "Invalid password",
-			password:       "test_admin_password",
-			authHeader:     "Bearer wrong_password",
-			wantStatusCode: http.StatusUnauthorized,
-			wantBody:       "Invalid credentials",
-		},
-		{
-			name:           "Missing Bearer prefix",
-			password:       "test_admin_password",
-			authHeader:     "test_admin_password",
-			wantStatusCode: http.StatusUnauthorized,
-			wantBody:       "Missing or invalid authorization header",
-		},
-		{
-			name:           "Empty auth header",
-			password:       "test_admin_password",
-			authHeader:     "",
-			wantStatusCode: http.StatusUnauthorized,
-			wantBody:       "Missing or invalid authorization header",
-		},
+		{name: "Staff password can mark paid", method: http.MethodPut, path: "/orders/mark-paid", token: "staff_secret", wantStatusCode: http.StatusOK},
+		{name: "Staff password cannot delete orders", method: http.MethodDelete, path: "/orders", token: "staff_secret", wantStatusCode: http.StatusForbidden},
+		{name: "Admin password can delete orders", method: http.MethodDelete, path: "/orders", token: "admin_secret", wantStatusCode: http.StatusOK},
+		{name: "Wrong password", method: http.MethodPut, path: "/orders/mark-paid", token: "wrong", wantStatusCode: http.StatusUnauthorized},
+		{name: "No authentication middleware", method: http.MethodGet, path: "/unauthenticated", wantStatusCode: http.StatusUnauthorized},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			app := fiber.New()
-			app.Use(AdminAuth(tt.password))
-			app.Get("/test", func(c *fiber.Ctx) error {
-				return c.SendString("success")
-			})
-
-			req := httptest.NewRequest(http.MethodGet, "/test", nil)
-			if tt.authHeader != "" {
-				req.Header.Set("Authorization", tt.authHeader)
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
 			}
 
 			resp, err := app.Test(req)
 			assert.NoError(t, err)
 			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
-
-			body, _ := io.ReadAll(resp.Body)
-			assert.Contains(t, string(body), tt.wantBody)
 		})
 	}
 }
 
 func TestStaffAndAdminUseDifferentPasswords(t *testing.T) {
 	staffPassword := "staff_secret"
-	adminPassword := "admin_secret"
 
 	app := fiber.New()
-
-	// Staff route
-	staffGroup := app.Group("/staff", StaffAuth(staffPassword))
-	staffGroup.Get("/data", func(c *fiber.Ctx) error {
+	app.Get("/staff/data", StaffAuth(nil, nil, staffPassword), func(c *fiber.Ctx) error {
 		return c.SendString("staff data")
 	})
 
-	// Admin route
-	adminGroup := app.Group("/admin", AdminAuth(adminPassword))
-	adminGroup.Get("/data", func(c *fiber.Ctx) error {
-		return c.SendString("admin data")
-	})
-
 	// Test staff password on staff route - should work
 	req := httptest.NewRequest(http.MethodGet, "/staff/data", nil)
 	req.Header.Set("Authorization", "Bearer "+staffPassword)
 	resp, _ := app.Test(req)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 
-	// Test admin password on admin route - should work
-	req = httptest.NewRequest(http.MethodGet, "/admin/data", nil)
-	req.Header.Set("Authorization", "Bearer "+adminPassword)
-	resp, _ = app.Test(req)
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-
-	// Test staff password on admin route - should fail
-	req = httptest.NewRequest(http.MethodGet, "/admin/data", nil)
-	req.Header.Set("Authorization", "Bearer "+staffPassword)
-	resp, _ = app.Test(req)
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
-
-	// Test admin password on staff route - should fail
+	// Admin password is only accepted while ADMIN_PASSWORD is set
 	req = httptest.NewRequest(http.MethodGet, "/staff/data", nil)
-	req.Header.Set("Authorization", "Bearer "+adminPassword)
+	req.Header.Set("Authorization", "Bearer admin_secret")
 	resp, _ = app.Test(req)
 	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
+
+func TestStaffWebSocketAuth(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		authHeader     string
+		wantStatusCode int
+	}{
+		{name: "Token query param", url: "/ws?token=test_staff_password", wantStatusCode: http.StatusOK},
+		{name: "Authorization header", url: "/ws", authHeader: "Bearer test_staff_password", wantStatusCode: http.StatusOK},
+		{name: "Wrong token", url: "/ws?token=wrong_password", wantStatusCode: http.StatusUnauthorized},
+		{name: "Header takes precedence", url: "/ws?token=test_staff_password", authHeader: "Bearer wrong_password", wantStatusCode: http.StatusUnauthorized},
+		{name: "No credential", url: "/ws", wantStatusCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(StaffWebSocketAuth(nil, nil, "test_staff_password"))
+			app.Get("/ws", func(c *fiber.Ctx) error {
+				return c.SendString("success")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestAuthSetsActor(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "admin_secret")
+
+	app := fiber.New()
+	actor := func(c *fiber.Ctx) error {
+		return c.SendString(service.ActorFromContext(c.Context()))
+	}
+	app.Get("/staff", StaffAuth(nil, nil, "staff_secret"), actor)
+	app.Get("/pos", Anonymous("pos", models.RoleCashier), actor)
+	app.Get("/public", actor)
+
+	tests := []struct {
+		path      string
+		token     string
+		wantActor string
+	}{
+		{path: "/staff", token: "staff_secret", wantActor: "staff"},
+		{path: "/staff", token: "admin_secret", wantActor: "admin"},
+		{path: "/pos", wantActor: "pos"},
+		{path: "/public", wantActor: service.DefaultActor},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, tt.wantActor, string(body), tt.path)
+	}
+}
+
+func TestSessionAuth(t *testing.T) {
+	authService := new(mocks.MockAuthService)
+	authService.On("Authenticate", mock.Anything, "cashier-token").
+		Return(&models.User{ID: 1, Username: "cashier1", Role: models.RoleCashier, Active: true}, nil)
+	authService.On("Authenticate", mock.Anything, "owner-token").
+		Return(&models.User{ID: 2, Username: "owner", Role: models.RoleOwner, Active: true}, nil)
+	authService.On("Authenticate", mock.Anything, "kitchen-token").
+		Return(&models.User{ID: 3, Username: "kitchen1", Role: models.RoleKitchen, Active: true}, nil)
+	authService.On("Authenticate", mock.Anything, "expired-token").Return(nil, service.ErrSessionExpired)
+	authService.On("Authenticate", mock.Anything, mock.Anything).Return(nil, service.ErrUnauthorized)
+
+	app := fiber.New()
+	whoami := func(c *fiber.Ctx) error {
+		user, ok := service.UserFromContext(c.Context())
+		if !ok {
+			return c.SendString("no user")
+		}
+		return c.SendString(user.Username + " as " + service.ActorFromContext(c.Context()))
+	}
+	app.Get("/staff", StaffAuth(authService, nil, "staff_secret"), whoami)
+	app.Get("/admin", StaffAuth(authService, nil, "staff_secret"), RequirePermission(models.PermStatsView), whoami)
+	app.Put("/mark-paid", StaffAuth(authService, nil, "staff_secret"), RequirePermission(models.PermOrderMarkPaid), whoami)
+	app.Get("/queue", StaffAuth(authService, nil, "staff_secret"), RequirePermission(models.PermOrderView), whoami)
+	app.Get("/me", UserAuth(authService, nil), whoami)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		wantStatusCode int
+		wantBody       string
+	}{
+		{name: "Staff session on staff route", path: "/staff", token: "cashier-token", wantStatusCode: http.StatusOK, wantBody: "cashier1 as cashier1"},
+		{name: "Admin session on staff route", path: "/staff", token: "owner-token", wantStatusCode: http.StatusOK, wantBody: "owner as owner"},
+		{name: "Staff session on admin route", path: "/admin", token: "cashier-token", wantStatusCode: http.StatusForbidden, wantBody: "FORBIDDEN"},
+		{name: "Admin session on admin route", path: "/admin", token: "owner-token", wantStatusCode: http.StatusOK, wantBody: "owner as owner"},
+		{name: "Kitchen session can watch the queue", path: "/queue", token: "kitchen-token", wantStatusCode: http.StatusOK, wantBody: "kitchen1 as kitchen1"},
+		{name: "Kitchen session cannot mark paid", method: http.MethodPut, path: "/mark-paid", token: "kitchen-token", wantStatusCode: http.StatusForbidden, wantBody: "FORBIDDEN"},
+		{name: "Cashier session can mark paid", method: http.MethodPut, path: "/mark-paid", token: "cashier-token", wantStatusCode: http.StatusOK, wantBody: "cashier1 as cashier1"},
+		{name: "Shared password still accepted", path: "/staff", token: "staff_secret", wantStatusCode: http.StatusOK, wantBody: "no user"},
+		{name: "Invalid token", path: "/staff", token: "forged-token", wantStatusCode: http.StatusUnauthorized, wantBody: "Invalid credentials"},
+		{name: "Expired session", path: "/staff", token: "expired-token", wantStatusCode: http.StatusUnauthorized, wantBody: "Session expired"},
+		{name: "Session routes need a session", path: "/me", token: "staff_secret", wantStatusCode: http.StatusUnauthorized, wantBody: "Invalid credentials"},
+		{name: "Session route with session", path: "/me", token: "cashier-token", wantStatusCode: http.StatusOK, wantBody: "cashier1 as cashier1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			body, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(body), tt.wantBody)
+		})
+	}
+}
+
+func TestSessionAuthSetsShopScope(t *testing.T) {
+	authService := new(mocks.MockAuthService)
+	authService.On("Authenticate", mock.Anything, "cashier-token").
+		Return(&models.User{ID: 1, Username: "cashier1", Role: models.RoleCashier, Active: true, ShopIDs: []int{2}}, nil)
+	authService.On("Authenticate", mock.Anything, "owner-token").
+		Return(&models.User{ID: 2, Username: "owner", Role: models.RoleOwner, Active: true}, nil)
+
+	app := fiber.New()
+	app.Get("/staff", StaffAuth(authService, nil, "staff_secret"), func(c *fiber.Ctx) error {
+		scope := service.ShopScopeFromContext(c.Context())
+		if scope.All() {
+			return c.SendString("all")
+		}
+		return c.JSON(scope.ShopIDs())
+	})
+
+	tests := []struct {
+		token    string
+		wantBody string
+	}{
+		{token: "cashier-token", wantBody: "[2]"},
+		{token: "owner-token", wantBody: "all"},
+		{token: "staff_secret", wantBody: "all"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/staff", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
@@ -8,10 +8,12 @@ import (
 	"github.com/jmoiron/sqlx"
 
 	"github.com/tanasatit/barvidva-kasetfair/internal/handlers"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
 )
 
 // setupRoutes configures all API routes for the application
-func setupRoutes(app *fiber.App, db *sqlx.DB, orderHandler *handlers.OrderHandler, menuHandler *handlers.MenuHandler, statsHandler *handlers.StatsHandler, adminHandler *handlers.AdminHandler) {
+func setupRoutes(app *fiber.App, db *sqlx.DB, orderHandler *handlers.OrderHandler, menuHandler *handlers.MenuHandler, statsHandler *handlers.StatsHandler, adminHandler *handlers.AdminHandler, eventsHandler *handlers.EventsHandler, kitchenHandler *handlers.KitchenHandler, authHandler *handlers.AuthHandler, shopHandler *handlers.ShopHandler, inventoryHandler *handlers.InventoryHandler, promptPayHandler *handlers.PromptPayHandler, paymentWebhookHandler *handlers.PaymentWebhookHandler, authService service.AuthService, idempotencyService service.IdempotencyService) {
 	// Health check endpoint
 	app.Get("/health", func(c *fiber.Ctx) error {
 		// Check database
@@ -32,54 +34,122 @@ func setupRoutes(app *fiber.App, db *sqlx.DB, orderHandler *handlers.OrderHandle
 	// API v1 routes
 	api := app.Group("/api/v1")
 
+	// Order creation and status changes accept an Idempotency-Key header so
+	// tablets can safely retry requests whose response got lost
+	idempotent := Idempotent(idempotencyService)
+
 	// Public routes (no authentication required)
 	// Order routes - customers can create orders and view their order status
-	api.Post("/orders", orderHandler.CreateOrder)
+	api.Post("/orders", idempotent, orderHandler.CreateOrder)
 	api.Get("/orders/:id", orderHandler.GetOrder)
+	api.Get("/orders/:id/promptpay", promptPayHandler.GetQR)
+
+	// Payment notifications from the payment provider, authenticated by their
+	// signature rather than a staff login. Only when a provider is configured.
+	if paymentWebhookHandler != nil {
+		api.Post("/webhooks/payments", paymentWebhookHandler.HandleNotification)
+	}
 
 	// Menu routes - customers can view menu
 	api.Get("/menu", menuHandler.GetMenu)
 	api.Get("/categories", menuHandler.GetCategories)
+	api.Get("/shops", shopHandler.GetShops)
+
+	// Auth routes - staff log in with their own account to get a session token
+	// Repeated failures lock out the client IP (and, on login, the username)
+	guard := NewLoginGuard(DefaultIPLockout, DefaultAccountLockout)
+	api.Post("/auth/login", LoginThrottle(guard), authHandler.Login)
+	api.Post("/auth/logout", UserAuth(authService, guard), authHandler.Logout)
+	api.Get("/auth/me", UserAuth(authService, guard), authHandler.Me)
 
 	// Queue route - public so customers can see queue status
 	api.Get("/queue", orderHandler.GetQueue)
 
-	// POS routes - public for staff-only POS system (no auth for internal use)
-	// These are simplified endpoints for the POS workflow
-	api.Get("/pos/orders/pending", orderHandler.GetPendingPayment)
-	api.Get("/pos/orders/completed", orderHandler.GetCompletedOrders)
-	api.Put("/pos/orders/:id/mark-paid", orderHandler.VerifyPayment)
-	api.Put("/pos/orders/:id/complete", orderHandler.CompleteOrder)
-
-	// Staff routes (require staff authentication)
+	// Every staff route authenticates the caller (session token or a legacy
+	// shared password), then checks the permission the route needs, so e.g.
+	// a kitchen display can watch the queue but not mark orders paid
 	staffPassword := os.Getenv("STAFF_PASSWORD")
-	staff := api.Group("/staff", StaffAuth(staffPassword))
+	staffAuth := StaffAuth(authService, guard, staffPassword)
+
+	// POS routes - simplified endpoints for the POS workflow.
+	// POS_PUBLIC=true keeps them open (as a cashier) for counters that don't
+	// log in yet.
+	posAuth := staffAuth
+	if os.Getenv("POS_PUBLIC") == "true" {
+		posAuth = Anonymous("pos", models.RoleCashier)
+	}
+	pos := api.Group("/pos", posAuth)
+	pos.Post("/orders", RequirePermission(models.PermOrderCreate), idempotent, orderHandler.CreateOrder)
+	// Orders taken while offline are uploaded in batches, already paid or not
+	pos.Post("/orders/sync", RequirePermission(models.PermOrderCreate, models.PermOrderMarkPaid), orderHandler.SyncOrders)
+	pos.Get("/orders/pending", RequirePermission(models.PermOrderView), orderHandler.GetPendingPayment)
+	pos.Get("/orders/completed", RequirePermission(models.PermOrderView), orderHandler.GetCompletedOrders)
+	// Items can be added, removed or changed until the order is paid
+	pos.Put("/orders/:id/items", RequirePermission(models.PermOrderCreate), orderHandler.UpdateOrderItems)
+	pos.Put("/orders/:id/mark-paid", RequirePermission(models.PermOrderMarkPaid), idempotent, orderHandler.VerifyPayment)
+	pos.Put("/orders/:id/ready", RequirePermission(models.PermOrderPrepare), orderHandler.MarkReady)
+	pos.Put("/orders/:id/complete", RequirePermission(models.PermOrderPrepare), idempotent, orderHandler.CompleteOrder)
+	pos.Get("/events", RequirePermission(models.PermOrderView), eventsHandler.StreamOrderEvents)
+
+	// Staff routes
+	staff := api.Group("/staff", staffAuth)
 
 	// Staff order management
-	staff.Get("/orders/pending", orderHandler.GetPendingPayment)
-	staff.Get("/orders/completed", orderHandler.GetCompletedOrders)
-	staff.Put("/orders/:id/verify", orderHandler.VerifyPayment)
-	staff.Put("/orders/:id/complete", orderHandler.CompleteOrder)
-	staff.Delete("/orders/:id", orderHandler.CancelOrder)
-
-	// Admin routes (require admin authentication)
-	adminPassword := os.Getenv("ADMIN_PASSWORD")
-	admin := api.Group("/admin", AdminAuth(adminPassword))
+	staff.Get("/orders/pending", RequirePermission(models.PermOrderView), orderHandler.GetPendingPayment)
+	staff.Get("/orders/completed", RequirePermission(models.PermOrderView), orderHandler.GetCompletedOrders)
+	staff.Put("/orders/:id/items", RequirePermission(models.PermOrderCreate), orderHandler.UpdateOrderItems)
+	staff.Put("/orders/:id/verify", RequirePermission(models.PermOrderMarkPaid), idempotent, orderHandler.VerifyPayment)
+	staff.Put("/orders/:id/ready", RequirePermission(models.PermOrderPrepare), orderHandler.MarkReady)
+	staff.Put("/orders/:id/complete", RequirePermission(models.PermOrderPrepare), idempotent, orderHandler.CompleteOrder)
+	staff.Delete("/orders/:id", RequirePermission(models.PermOrderCancel), idempotent, orderHandler.CancelOrder)
+	staff.Get("/events", RequirePermission(models.PermOrderView), eventsHandler.StreamOrderEvents)
+
+	// Kitchen/counter display WebSocket (staff token via header or ?token=).
+	// Displays watch the queue and send mark-ready/complete commands.
+	api.Get("/ws/kitchen", StaffWebSocketAuth(authService, guard, staffPassword),
+		RequirePermission(models.PermOrderView, models.PermOrderPrepare),
+		kitchenHandler.RequireUpgrade, kitchenHandler.Connect())
+
+	// Admin routes
+	admin := api.Group("/admin", staffAuth)
 
 	// Admin stats
-	admin.Get("/stats", statsHandler.GetStats)
-	admin.Get("/stats/orders-by-hour", statsHandler.GetOrdersByHour)
-	admin.Get("/stats/popular-items", statsHandler.GetPopularItems)
-	admin.Get("/stats/daily-breakdown", statsHandler.GetDailyBreakdown)
+	statsView := RequirePermission(models.PermStatsView)
+	admin.Get("/stats", statsView, statsHandler.GetStats)
+	admin.Get("/stats/orders-by-hour", statsView, statsHandler.GetOrdersByHour)
+	admin.Get("/stats/popular-items", statsView, statsHandler.GetPopularItems)
+	admin.Get("/stats/daily-breakdown", statsView, statsHandler.GetDailyBreakdown)
 
 	// Admin menu management
-	admin.Get("/menu", menuHandler.GetMenu)
-	admin.Get("/menu/:id", menuHandler.GetMenuItem)
-	admin.Post("/menu", menuHandler.CreateMenuItem)
-	admin.Put("/menu/:id", menuHandler.UpdateMenuItem)
-	admin.Delete("/menu/:id", menuHandler.DeleteMenuItem)
+	menuEdit := RequirePermission(models.PermMenuEdit)
+	admin.Get("/menu", menuEdit, menuHandler.GetMenu)
+	admin.Get("/menu/:id", menuEdit, menuHandler.GetMenuItem)
+	admin.Post("/menu", menuEdit, menuHandler.CreateMenuItem)
+	admin.Put("/menu/:id", menuEdit, menuHandler.UpdateMenuItem)
+	admin.Delete("/menu/:id", menuEdit, menuHandler.DeleteMenuItem)
+
+	// Admin inventory - stock of menu items and ingredients
+	admin.Get("/inventory", menuEdit, inventoryHandler.GetInventory)
+	admin.Put("/inventory/items/:id", menuEdit, inventoryHandler.SetItemStock)
+	admin.Get("/inventory/ingredients", menuEdit, inventoryHandler.GetIngredients)
+	admin.Post("/inventory/ingredients", menuEdit, inventoryHandler.CreateIngredient)
+	admin.Put("/inventory/ingredients/:id", menuEdit, inventoryHandler.UpdateIngredient)
 
 	// Admin order management
-	admin.Get("/orders", adminHandler.GetAllOrders)
-	admin.Delete("/orders", adminHandler.DeleteOrders)
+	admin.Get("/orders", statsView, adminHandler.GetAllOrders)
+	admin.Delete("/orders", RequirePermission(models.PermOrdersDelete), adminHandler.DeleteOrders)
+	admin.Get("/orders/:id/history", statsView, orderHandler.GetOrderHistory)
+	admin.Post("/orders/:id/refund", RequirePermission(models.PermOrderRefund), idempotent, orderHandler.RefundOrder)
+
+	// Admin staff accounts
+	usersManage := RequirePermission(models.PermUsersManage)
+	admin.Get("/users", usersManage, authHandler.GetUsers)
+	admin.Post("/users", usersManage, authHandler.CreateUser)
+	admin.Put("/users/:id", usersManage, authHandler.UpdateUser)
+
+	// Admin shops
+	shopsManage := RequirePermission(models.PermShopsManage)
+	admin.Get("/shops", shopsManage, shopHandler.GetAllShops)
+	admin.Post("/shops", shopsManage, shopHandler.CreateShop)
+	admin.Put("/shops/:id", shopsManage, shopHandler.UpdateShop)
 }
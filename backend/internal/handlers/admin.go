@@ -7,6 +7,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
 )
 
 type AdminHandler struct {
@@ -34,10 +35,7 @@ func (h *AdminHandler) DeleteOrders(c *fiber.Ctx) error {
 		deleted, err := h.orderRepo.DeleteAllOrders(c.Context())
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to delete all orders")
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to delete orders",
-				"code":  "INTERNAL_ERROR",
-			})
+			return err
 		}
 
 		log.Info().Int64("deleted_count", deleted).Msg("Deleted all orders")
@@ -66,10 +64,7 @@ func (h *AdminHandler) DeleteOrders(c *fiber.Ctx) error {
 	deleted, err := h.orderRepo.DeleteOrders(c.Context(), req.OrderIDs)
 	if err != nil {
 		log.Error().Err(err).Int("count", len(req.OrderIDs)).Msg("Failed to delete orders")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete orders",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	log.Info().
@@ -84,16 +79,14 @@ func (h *AdminHandler) DeleteOrders(c *fiber.Ctx) error {
 }
 
 // GetAllOrders handles GET /api/v1/admin/orders
+// Only orders of the caller's shops are returned.
 func (h *AdminHandler) GetAllOrders(c *fiber.Ctx) error {
 	// Get all non-deleted orders (all statuses)
 	orders, err := h.orderRepo.GetByStatuses(c.Context(), nil)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get all orders")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get orders",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
-	return c.JSON(orders)
+	return c.JSON(service.ShopScopeFromContext(c.Context()).FilterOrders(orders))
 }
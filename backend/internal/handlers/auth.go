@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+type AuthHandler struct {
+	authService service.AuthService
+}
+
+func NewAuthHandler(authService service.AuthService) *AuthHandler {
+	return &AuthHandler{
+		authService: authService,
+	}
+}
+
+// Login handles POST /api/v1/auth/login
+// Returns a session token to send as "Authorization: Bearer <token>".
+func (h *AuthHandler) Login(c *fiber.Ctx) error {
+	var req models.LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	resp, err := h.authService.Login(c.Context(), &req)
+	if err != nil {
+		log.Warn().Err(err).Str("username", req.Username).Str("ip", c.IP()).Msg("Login failed")
+		return err
+	}
+
+	log.Info().Str("username", resp.User.Username).Str("role", string(resp.User.Role)).Msg("User logged in")
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// Logout handles POST /api/v1/auth/logout
+// Revokes the session of the token used for the request.
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	if err := h.authService.Logout(c.Context(), token); err != nil {
+		log.Error().Err(err).Msg("Failed to log out")
+		return err
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message": "Logged out successfully",
+	})
+}
+
+// Me handles GET /api/v1/auth/me
+func (h *AuthHandler) Me(c *fiber.Ctx) error {
+	user, ok := service.UserFromContext(c.Context())
+	if !ok {
+		return service.ErrUnauthorized
+	}
+	return c.Status(http.StatusOK).JSON(user)
+}
+
+// GetUsers handles GET /api/v1/admin/users
+func (h *AuthHandler) GetUsers(c *fiber.Ctx) error {
+	users, err := h.authService.GetUsers(c.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get users")
+		return err
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+	return c.Status(http.StatusOK).JSON(users)
+}
+
+// CreateUser handles POST /api/v1/admin/users
+func (h *AuthHandler) CreateUser(c *fiber.Ctx) error {
+	var req models.CreateUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	user, err := h.authService.CreateUser(c.Context(), &req)
+	if err != nil {
+		log.Error().Err(err).Str("username", req.Username).Msg("Failed to create user")
+		return err
+	}
+
+	log.Info().
+		Int("id", user.ID).
+		Str("username", user.Username).
+		Str("role", string(user.Role)).
+		Str("actor", service.ActorFromContext(c.Context())).
+		Msg("User created")
+
+	return c.Status(http.StatusCreated).JSON(user)
+}
+
+// UpdateUserRequest is the request body for updating a user. Either field
+// may be given on its own.
+type UpdateUserRequest struct {
+	Active  *bool  `json:"active"`
+	ShopIDs *[]int `json:"shop_ids"`
+}
+
+// UpdateUser handles PUT /api/v1/admin/users/:id
+// Disabling a user also ends all of their sessions; shop_ids replaces the
+// shops they work at.
+func (h *AuthHandler) UpdateUser(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	var req UpdateUserRequest
+	if err := c.BodyParser(&req); err != nil || (req.Active == nil && req.ShopIDs == nil) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "active or shop_ids is required",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	if req.ShopIDs != nil {
+		if err := h.authService.SetUserShops(c.Context(), id, *req.ShopIDs); err != nil {
+			log.Error().Err(err).Int("id", id).Msg("Failed to update user shops")
+			return err
+		}
+	}
+	if req.Active != nil {
+		if err := h.authService.SetUserActive(c.Context(), id, *req.Active); err != nil {
+			log.Error().Err(err).Int("id", id).Msg("Failed to update user")
+			return err
+		}
+	}
+
+	event := log.Info().
+		Int("id", id).
+		Str("actor", service.ActorFromContext(c.Context()))
+	if req.Active != nil {
+		event = event.Bool("active", *req.Active)
+	}
+	if req.ShopIDs != nil {
+		event = event.Ints("shop_ids", *req.ShopIDs)
+	}
+	event.Msg("User updated")
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"message": "User updated successfully",
+	})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
+)
+
+func TestAuthHandler_Login(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           interface{}
+		setupMock      func(*mocks.MockAuthService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "Successful login",
+			body: models.LoginRequest{Username: "cashier1", Password: "correct-horse"},
+			setupMock: func(svc *mocks.MockAuthService) {
+				svc.On("Login", mock.Anything, mock.AnythingOfType("*models.LoginRequest")).Return(&models.LoginResponse{
+					Token:     "signed-token",
+					ExpiresAt: time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC),
+					User:      models.User{ID: 1, Username: "cashier1", PasswordHash: "secret-hash", Role: models.RoleCashier},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"token":"signed-token"`,
+		},
+		{
+			name: "Wrong password",
+			body: models.LoginRequest{Username: "cashier1", Password: "wrong"},
+			setupMock: func(svc *mocks.MockAuthService) {
+				svc.On("Login", mock.Anything, mock.AnythingOfType("*models.LoginRequest")).Return(nil, service.ErrInvalidCredentials)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+			wantBody:       "INVALID_CREDENTIALS",
+		},
+		{
+			name:           "Invalid request body",
+			body:           "not json",
+			setupMock:      func(svc *mocks.MockAuthService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "INVALID_REQUEST",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockAuthService)
+			tt.setupMock(mockService)
+
+			handler := NewAuthHandler(mockService)
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Post("/auth/login", handler.Login)
+
+			var body []byte
+			if s, ok := tt.body.(string); ok {
+				body = []byte(s)
+			} else {
+				body, _ = json.Marshal(tt.body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(respBody), tt.wantBody)
+			// Password hashes never leave the server
+			assert.NotContains(t, string(respBody), "secret-hash")
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	mockService := new(mocks.MockAuthService)
+	mockService.On("Logout", mock.Anything, "signed-token").Return(nil)
+
+	handler := NewAuthHandler(mockService)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/auth/logout", handler.Logout)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer signed-token")
+
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestAuthHandler_CreateUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		setupMock      func(*mocks.MockAuthService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "Successful creation",
+			setupMock: func(svc *mocks.MockAuthService) {
+				svc.On("CreateUser", mock.Anything, mock.AnythingOfType("*models.CreateUserRequest")).
+					Return(&models.User{ID: 2, Username: "cashier2", Role: models.RoleCashier, Active: true}, nil)
+			},
+			wantStatusCode: http.StatusCreated,
+			wantBody:       `"username":"cashier2"`,
+		},
+		{
+			name: "Validation error",
+			setupMock: func(svc *mocks.MockAuthService) {
+				svc.On("CreateUser", mock.Anything, mock.AnythingOfType("*models.CreateUserRequest")).
+					Return(nil, service.NewValidationError("password", "password must be 8-72 characters"))
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `"field":"password"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockAuthService)
+			tt.setupMock(mockService)
+
+			handler := NewAuthHandler(mockService)
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Post("/admin/users", handler.CreateUser)
+
+			body, _ := json.Marshal(models.CreateUserRequest{Username: "cashier2", Password: "long-enough", Role: models.RoleCashier})
+			req := httptest.NewRequest(http.MethodPost, "/admin/users", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(respBody), tt.wantBody)
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+// ErrorResponse is the JSON body of every error response
+type ErrorResponse struct {
+	Error   string               `json:"error"`
+	Code    string               `json:"code"`
+	Details []service.FieldError `json:"details,omitempty"` // per-field problems for VALIDATION_ERROR
+}
+
+// errorMapping is how a service error is reported to clients
+type errorMapping struct {
+	target  error
+	status  int
+	code    string
+	message string // shown instead of the error text when set
+}
+
+// errorMappings is checked in order with errors.Is
+var errorMappings = []errorMapping{
+	{target: service.ErrOrderNotFound, status: http.StatusNotFound, code: "ORDER_NOT_FOUND", message: "Order not found"},
+	{target: service.ErrMenuItemNotFound, status: http.StatusNotFound, code: "MENU_ITEM_NOT_FOUND", message: "Menu item not found"},
+	{target: service.ErrShopNotFound, status: http.StatusNotFound, code: "SHOP_NOT_FOUND", message: "Shop not found"},
+	{target: service.ErrIngredientNotFound, status: http.StatusNotFound, code: "INGREDIENT_NOT_FOUND", message: "Ingredient not found"},
+	{target: service.ErrUserNotFound, status: http.StatusNotFound, code: "USER_NOT_FOUND", message: "User not found"},
+	{target: service.ErrInvalidCredentials, status: http.StatusUnauthorized, code: "INVALID_CREDENTIALS", message: "Invalid username or password"},
+	{target: service.ErrUnauthorized, status: http.StatusUnauthorized, code: "UNAUTHORIZED", message: "Invalid or expired session"},
+	{target: service.ErrForbidden, status: http.StatusForbidden, code: "FORBIDDEN"},
+	{target: service.ErrInvalidTransition, status: http.StatusBadRequest, code: "INVALID_STATUS"},
+	{target: service.ErrValidation, status: http.StatusBadRequest, code: "VALIDATION_ERROR"},
+	{target: service.ErrDuplicate, status: http.StatusConflict, code: "DUPLICATE"},
+	{target: service.ErrConflict, status: http.StatusConflict, code: "CONFLICT"},
+	{target: service.ErrPromptPayNotConfigured, status: http.StatusNotFound, code: "PROMPTPAY_NOT_CONFIGURED", message: "No PromptPay account is set up for this order"},
+	{target: service.ErrPaymentNotVerified, status: http.StatusUnprocessableEntity, code: "PAYMENT_NOT_VERIFIED"},
+	{target: service.ErrIdempotencyKeyReused, status: http.StatusUnprocessableEntity, code: "IDEMPOTENCY_KEY_REUSED", message: "Idempotency-Key was already used for a different request"},
+	{target: service.ErrRequestInProgress, status: http.StatusConflict, code: "REQUEST_IN_PROGRESS", message: "A request with this Idempotency-Key is still in progress"},
+}
+
+// ErrorHandler is the app's Fiber error handler. Handlers log and return
+// service errors as they are; this maps them to a status and code. Anything
+// unrecognised is a 500 whose details stay in the log.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	status, body := errorResponse(err)
+	return c.Status(status).JSON(body)
+}
+
+func errorResponse(err error) (int, ErrorResponse) {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code, ErrorResponse{Error: fiberErr.Message, Code: fmt.Sprintf("HTTP_%d", fiberErr.Code)}
+	}
+
+	for _, m := range errorMappings {
+		if !errors.Is(err, m.target) {
+			continue
+		}
+
+		body := ErrorResponse{Error: m.message, Code: m.code}
+		if body.Error == "" {
+			body.Error = userMessage(err, m.target)
+		}
+
+		var validationErr *service.ValidationError
+		if errors.As(err, &validationErr) {
+			body.Error = validationErr.Error()
+			body.Details = validationErr.Fields
+		}
+		return m.status, body
+	}
+
+	return http.StatusInternalServerError, ErrorResponse{Error: "Internal server error", Code: "INTERNAL_ERROR"}
+}
+
+// userMessage returns the text of the error that wrapped target, dropping the
+// "failed to ...:" context added on the way up through the layers
+func userMessage(err, target error) string {
+	msg := err.Error()
+	for e := err; e != nil && e != target; e = errors.Unwrap(e) {
+		if errors.Is(e, target) {
+			msg = e.Error()
+		}
+	}
+	return msg
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+func TestErrorHandler(t *testing.T) {
+	validationErr := service.NewValidationError("customer_name", "customer name must be 2-50 characters")
+	validationErr.Add("items", "order must contain at least one item")
+
+	tests := []struct {
+		name           string
+		err            error
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "Order not found",
+			err:            fmt.Errorf("failed to get order: %w", fmt.Errorf("%w: 1401001", service.ErrOrderNotFound)),
+			wantStatusCode: http.StatusNotFound,
+			wantBody:       `{"error":"Order not found","code":"ORDER_NOT_FOUND"}`,
+		},
+		{
+			name:           "Menu item not found",
+			err:            fmt.Errorf("%w: 9", service.ErrMenuItemNotFound),
+			wantStatusCode: http.StatusNotFound,
+			wantBody:       `{"error":"Menu item not found","code":"MENU_ITEM_NOT_FOUND"}`,
+		},
+		{
+			name:           "Invalid transition",
+			err:            fmt.Errorf("failed to cancel order: %w", &service.InvalidTransitionError{OrderID: "1401001", From: models.OrderStatusPaid, To: models.OrderStatusCancelled}),
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       `{"error":"cannot change order 1401001 from PAID to CANCELLED","code":"INVALID_STATUS"}`,
+		},
+		{
+			name:           "Validation error with field details",
+			err:            validationErr,
+			wantStatusCode: http.StatusBadRequest,
+			wantBody: `{"error":"validation failed: customer name must be 2-50 characters; order must contain at least one item","code":"VALIDATION_ERROR",` +
+				`"details":[{"field":"customer_name","message":"customer name must be 2-50 characters"},{"field":"items","message":"order must contain at least one item"}]}`,
+		},
+		{
+			name: "Out of stock",
+			err: fmt.Errorf("failed to create order: %w", &models.StockError{
+				ValidationError: service.NewValidationError("items[0].quantity", "item 0: only 1 of French Fries S left"),
+				Shortages:       []models.StockShortage{{ItemIndex: 0, MenuItemID: 1}},
+			}),
+			wantStatusCode: http.StatusBadRequest,
+			wantBody: `{"error":"validation failed: item 0: only 1 of French Fries S left","code":"VALIDATION_ERROR",` +
+				`"details":[{"field":"items[0].quantity","message":"item 0: only 1 of French Fries S left"}]}`,
+		},
+		{
+			name:           "Duplicate",
+			err:            fmt.Errorf("failed to create menu item: %w", fmt.Errorf("menu item with name 'Fries' %w", service.ErrDuplicate)),
+			wantStatusCode: http.StatusConflict,
+			wantBody:       `{"error":"menu item with name 'Fries' already exists","code":"DUPLICATE"}`,
+		},
+		{
+			name:           "Conflict",
+			err:            fmt.Errorf("failed to delete menu item: %w", fmt.Errorf("%w: menu item 3 is used in existing orders", service.ErrConflict)),
+			wantStatusCode: http.StatusConflict,
+			wantBody:       `{"error":"conflicts with existing data: menu item 3 is used in existing orders","code":"CONFLICT"}`,
+		},
+		{
+			name:           "Fiber error",
+			err:            fiber.ErrMethodNotAllowed,
+			wantStatusCode: http.StatusMethodNotAllowed,
+			wantBody:       `{"error":"Method Not Allowed","code":"HTTP_405"}`,
+		},
+		{
+			name:           "Unknown error hides details",
+			err:            errors.New("pq: connection refused"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       `{"error":"Internal server error","code":"INTERNAL_ERROR"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/test", func(c *fiber.Ctx) error {
+				return tt.err
+			})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			body, _ := io.ReadAll(resp.Body)
+			assert.JSONEq(t, tt.wantBody, string(body))
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+// sseRetryMillis tells EventSource clients how long to wait before reconnecting
+const sseRetryMillis = 3000
+
+type EventsHandler struct {
+	broker    *service.OrderEventBroker
+	auth      service.AuthService
+	heartbeat time.Duration
+}
+
+func NewEventsHandler(broker *service.OrderEventBroker, auth service.AuthService, heartbeat time.Duration) *EventsHandler {
+	return &EventsHandler{
+		broker:    broker,
+		auth:      auth,
+		heartbeat: heartbeat,
+	}
+}
+
+// StreamOrderEvents handles GET /api/v1/pos/events (Server-Sent Events)
+// Supports optional ?category= query param for filtering; events of orders
+// outside the caller's shops are never sent.
+// Resumes after the Last-Event-ID header (or ?last_event_id= for the first
+// connect, since EventSource cannot set headers); if the requested events are
+// gone a "resync" event tells the client to refetch its order lists.
+// The session of a logged-in user is checked again with every heartbeat; the
+// stream ends once it fails, and the reconnect then gets a 401.
+func (h *EventsHandler) StreamOrderEvents(c *fiber.Ctx) error {
+	category := c.Query("category")
+	scope := service.ShopScopeFromContext(c.Context())
+	session := newLiveSession(c, h.auth)
+
+	lastEventID := c.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	var lastID uint64
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid Last-Event-ID",
+				"code":  "INVALID_REQUEST",
+			})
+		}
+	}
+
+	sub, replay, resync := h.broker.Subscribe(category, lastID)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Unsubscribe()
+
+		fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+		if resync {
+			fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+		}
+		for _, event := range replay {
+			if !scope.ContainsOrder(&event.Order) {
+				continue
+			}
+			if err := writeOrderEvent(w, event); err != nil {
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event, ok := <-sub.Events:
+				if !ok {
+					// Dropped for falling behind, or server shutting down;
+					// the client reconnects with Last-Event-ID
+					return
+				}
+				if !scope.ContainsOrder(&event.Order) {
+					continue
+				}
+				if err := writeOrderEvent(w, event); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if err := session.check(context.Background()); err != nil {
+					log.Info().Err(err).Str("category", category).Msg("Closing order event stream: session check failed")
+					return
+				}
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			// A flush error means the client went away
+			if err := w.Flush(); err != nil {
+				log.Debug().Err(err).Str("category", category).Msg("Order event stream closed")
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// writeOrderEvent writes one event in SSE wire format
+func writeOrderEvent(w *bufio.Writer, event service.OrderEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Uint64("event_id", event.ID).Msg("Failed to encode order event")
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
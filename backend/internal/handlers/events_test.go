@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
+)
+
+func TestEventsHandler_StreamOrderEvents(t *testing.T) {
+	fries, drinks := "fries", "drinks"
+	friesShop, drinksShop := 1, 2
+	drinksOnly := service.OnlyShops(drinksShop)
+
+	tests := []struct {
+		name           string
+		url            string
+		lastEventID    string
+		scope          *service.ShopScope
+		wantStatusCode int
+		wantContains   []string
+		wantMissing    []string
+	}{
+		{
+			name:           "Replays events after Last-Event-ID",
+			url:            "/events",
+			lastEventID:    "1",
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{"retry: 3000", "id: 2\nevent: order.created", "id: 3\nevent: order.paid", `"id":"1401002"`},
+			wantMissing:    []string{"id: 1\n", "event: resync"},
+		},
+		{
+			name:           "Category filter",
+			url:            "/events?category=drinks",
+			lastEventID:    "1",
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{"id: 2\n"},
+			wantMissing:    []string{"id: 3\n"},
+		},
+		{
+			name:           "Only the caller's shops",
+			url:            "/events",
+			lastEventID:    "1",
+			scope:          &drinksOnly,
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{"id: 2\n"},
+			wantMissing:    []string{"id: 3\n"},
+		},
+		{
+			name:           "Query param resume",
+			url:            "/events?last_event_id=2",
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{"id: 3\n"},
+			wantMissing:    []string{"id: 2\n"},
+		},
+		{
+			name:           "Unknown event ID asks client to resync",
+			url:            "/events",
+			lastEventID:    "99",
+			wantStatusCode: http.StatusOK,
+			wantContains:   []string{"event: resync"},
+		},
+		{
+			name:           "Invalid Last-Event-ID",
+			url:            "/events",
+			lastEventID:    "abc",
+			wantStatusCode: http.StatusBadRequest,
+			wantContains:   []string{"INVALID_REQUEST"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := service.NewOrderEventBroker(10)
+			broker.Publish(service.OrderEventCreated, &models.Order{ID: "1401001", Category: &fries, ShopID: &friesShop})
+			broker.Publish(service.OrderEventCreated, &models.Order{ID: "1401002", Category: &drinks, ShopID: &drinksShop})
+			broker.Publish(service.OrderEventPaid, &models.Order{ID: "1401001", Category: &fries, ShopID: &friesShop})
+			// Closed broker ends the stream after replay so the response completes
+			broker.Close()
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			handler := NewEventsHandler(broker, nil, time.Minute)
+			app.Get("/events", func(c *fiber.Ctx) error {
+				if tt.scope != nil {
+					c.Locals(service.ShopScopeKey{}, *tt.scope)
+				}
+				return c.Next()
+			}, handler.StreamOrderEvents)
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			resp, err := app.Test(req, -1)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			body, _ := io.ReadAll(resp.Body)
+			for _, s := range tt.wantContains {
+				assert.Contains(t, string(body), s)
+			}
+			for _, s := range tt.wantMissing {
+				assert.NotContains(t, string(body), s)
+			}
+		})
+	}
+}
+
+func TestEventsHandler_StreamOrderEvents_SessionEnded(t *testing.T) {
+	cashier := &models.User{ID: 7, Username: "somchai", Role: models.RoleCashier, ShopIDs: []int{1}, Active: true}
+	auth := new(mocks.MockAuthService)
+	auth.On("Authenticate", mock.Anything, "tok").Return(cashier, nil).Twice()
+	auth.On("Authenticate", mock.Anything, "tok").Return(nil, service.ErrSessionExpired)
+
+	// The broker stays open: only the failed session check ends the stream
+	broker := service.NewOrderEventBroker(10)
+	defer broker.Close()
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	handler := NewEventsHandler(broker, auth, 10*time.Millisecond)
+	app.Get("/events", func(c *fiber.Ctx) error {
+		c.Locals(service.UserKey{}, cashier)
+		c.Locals(service.ShopScopeKey{}, service.ScopeForUser(cashier))
+		return c.Next()
+	}, handler.StreamOrderEvents)
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	resp, err := app.Test(req, 5000)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 2, strings.Count(string(body), ": heartbeat"))
+	auth.AssertNumberOfCalls(t, "Authenticate", 3)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+type InventoryHandler struct {
+	inventoryService service.InventoryService
+}
+
+func NewInventoryHandler(inventoryService service.InventoryService) *InventoryHandler {
+	return &InventoryHandler{
+		inventoryService: inventoryService,
+	}
+}
+
+// GetInventory handles GET /api/v1/admin/inventory
+// ?low_stock=true lists only what is running low
+func (h *InventoryHandler) GetInventory(c *fiber.Ctx) error {
+	inventory, err := h.inventoryService.GetInventory(c.Context(), c.Query("low_stock") == "true")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get inventory")
+		return err
+	}
+
+	return c.Status(http.StatusOK).JSON(inventory)
+}
+
+// SetItemStock handles PUT /api/v1/admin/inventory/items/:id
+func (h *InventoryHandler) SetItemStock(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid menu item ID",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	var req models.ItemStockRequest
+	if err := c.BodyParser(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to parse request body")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	stock, err := h.inventoryService.SetItemStock(c.Context(), id, &req)
+	if err != nil {
+		log.Error().Err(err).Int("id", id).Msg("Failed to set item stock")
+		return err
+	}
+
+	log.Info().
+		Int("id", id).
+		Interface("stock", stock.Stock).
+		Bool("available", stock.Available).
+		Msg("Item stock set")
+
+	return c.Status(http.StatusOK).JSON(stock)
+}
+
+// GetIngredients handles GET /api/v1/admin/inventory/ingredients
+func (h *InventoryHandler) GetIngredients(c *fiber.Ctx) error {
+	inventory, err := h.inventoryService.GetInventory(c.Context(), c.Query("low_stock") == "true")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get ingredients")
+		return err
+	}
+
+	return c.Status(http.StatusOK).JSON(inventory.Ingredients)
+}
+
+// CreateIngredient handles POST /api/v1/admin/inventory/ingredients
+func (h *InventoryHandler) CreateIngredient(c *fiber.Ctx) error {
+	var ingredient models.Ingredient
+	if err := c.BodyParser(&ingredient); err != nil {
+		log.Error().Err(err).Msg("Failed to parse request body")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	created, err := h.inventoryService.CreateIngredient(c.Context(), &ingredient)
+	if err != nil {
+		log.Error().Err(err).Str("name", ingredient.Name).Msg("Failed to create ingredient")
+		return err
+	}
+
+	log.Info().
+		Int("id", created.ID).
+		Str("name", created.Name).
+		Float64("stock", created.Stock).
+		Msg("Ingredient created")
+
+	return c.Status(http.StatusCreated).JSON(created)
+}
+
+// UpdateIngredient handles PUT /api/v1/admin/inventory/ingredients/:id
+func (h *InventoryHandler) UpdateIngredient(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid ingredient ID",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	var ingredient models.Ingredient
+	if err := c.BodyParser(&ingredient); err != nil {
+		log.Error().Err(err).Msg("Failed to parse request body")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+	ingredient.ID = id
+
+	updated, err := h.inventoryService.UpdateIngredient(c.Context(), &ingredient)
+	if err != nil {
+		log.Error().Err(err).Int("id", id).Msg("Failed to update ingredient")
+		return err
+	}
+
+	log.Info().
+		Int("id", updated.ID).
+		Str("name", updated.Name).
+		Float64("stock", updated.Stock).
+		Msg("Ingredient updated")
+
+	return c.Status(http.StatusOK).JSON(updated)
+}
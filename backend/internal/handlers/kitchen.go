@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+// Kitchen commands sent by displays
+const (
+	KitchenCommandCompleteOrder = "complete_order"
+	KitchenCommandMarkReady     = "mark_ready"
+	KitchenCommandRefreshQueue  = "refresh_queue"
+)
+
+// Kitchen messages sent to displays
+const (
+	KitchenMessageQueue = "queue"
+	KitchenMessageEvent = "event"
+	KitchenMessageAck   = "ack"
+	KitchenMessageError = "error"
+)
+
+// kitchenActor is recorded in the order history for commands sent by
+// displays connected with a shared password or without logging in
+const kitchenActor = "kitchen"
+
+// kitchenScopeLocal carries the caller's shop scope onto the WebSocket
+// connection, which only keeps string-keyed locals
+const kitchenScopeLocal = "shop_scope"
+
+// kitchenActorLocal carries the logged-in user onto the WebSocket
+// connection, to be recorded as the author of its commands
+const kitchenActorLocal = "actor"
+
+// kitchenSessionLocal carries the caller's login onto the WebSocket
+// connection, to be re-checked while it stays open
+const kitchenSessionLocal = "session"
+
+// kitchenWriteTimeout bounds each write so a stalled tablet can't block the connection
+const kitchenWriteTimeout = 10 * time.Second
+
+// KitchenCommand is a message from a kitchen or counter display
+type KitchenCommand struct {
+	// RequestID is echoed back in the reply so the display can match it
+	RequestID string `json:"request_id,omitempty"`
+	Type      string `json:"type"`
+	OrderID   string `json:"order_id,omitempty"`
+}
+
+// KitchenMessage is a message to a kitchen or counter display
+type KitchenMessage struct {
+	Type      string              `json:"type"`
+	RequestID string              `json:"request_id,omitempty"`
+	Queue     *[]models.Order     `json:"queue,omitempty"` // orders being prepared; pointer so an empty list is still sent
+	Ready     *[]models.Order     `json:"ready,omitempty"` // orders waiting for pickup, sent with Queue
+	Event     *service.OrderEvent `json:"event,omitempty"`
+	Order     *models.Order       `json:"order,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Code      string              `json:"code,omitempty"`
+}
+
+// KitchenHandler serves the bidirectional WebSocket used by kitchen and
+// counter displays: it pushes the queue and order events, and accepts
+// commands that are executed through OrderService. A display logged in as a
+// user is disconnected once that login is no longer valid.
+type KitchenHandler struct {
+	orderService service.OrderService
+	broker       *service.OrderEventBroker
+	auth         service.AuthService
+	pingInterval time.Duration
+}
+
+func NewKitchenHandler(orderService service.OrderService, broker *service.OrderEventBroker, auth service.AuthService, pingInterval time.Duration) *KitchenHandler {
+	return &KitchenHandler{
+		orderService: orderService,
+		broker:       broker,
+		auth:         auth,
+		pingInterval: pingInterval,
+	}
+}
+
+// RequireUpgrade rejects plain HTTP requests to the WebSocket endpoint
+func (h *KitchenHandler) RequireUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error": "WebSocket upgrade required",
+			"code":  "UPGRADE_REQUIRED",
+		})
+	}
+	c.Locals(kitchenScopeLocal, service.ShopScopeFromContext(c.Context()))
+	if user, ok := service.UserFromContext(c.Context()); ok {
+		c.Locals(kitchenActorLocal, user.Username)
+	}
+	if session := newLiveSession(c, h.auth); session != nil {
+		c.Locals(kitchenSessionLocal, session)
+	}
+	return c.Next()
+}
+
+// Connect handles GET /api/v1/ws/kitchen
+// Supports optional ?category= query param for filtering; the display only
+// ever sees and acts on orders of the caller's shops.
+// On connect the display receives the current queue, then every order event;
+// it may send complete_order, mark_ready and refresh_queue commands.
+// The session of a logged-in user is checked again on every ping and before
+// every command; once it fails the display gets an UNAUTHORIZED error and
+// the connection is closed (1008 policy violation).
+func (h *KitchenHandler) Connect() fiber.Handler {
+	return websocket.New(h.serve)
+}
+
+func (h *KitchenHandler) serve(conn *websocket.Conn) {
+	category := conn.Query("category")
+	scope, ok := conn.Locals(kitchenScopeLocal).(service.ShopScope)
+	if !ok {
+		scope = service.AllShops()
+	}
+	actor, ok := conn.Locals(kitchenActorLocal).(string)
+	if !ok {
+		actor = kitchenActor
+	}
+	session, _ := conn.Locals(kitchenSessionLocal).(*liveSession)
+	ctx := service.WithActor(service.WithShopScope(context.Background(), scope), actor)
+
+	sub, _, _ := h.broker.Subscribe(category, 0)
+	defer sub.Unsubscribe()
+
+	var writeMu sync.Mutex
+	send := func(msg KitchenMessage) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_ = conn.SetWriteDeadline(time.Now().Add(kitchenWriteTimeout))
+		return conn.WriteJSON(msg)
+	}
+
+	// disconnect unblocks the read loop below. conn.Close is not enough: the
+	// hijacked connection is only really closed once serve returns.
+	disconnect := func(code int, text string) {
+		writeMu.Lock()
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(kitchenWriteTimeout))
+		writeMu.Unlock()
+		_ = conn.SetReadDeadline(time.Now())
+	}
+	// sessionEnded tells the display why it is being disconnected
+	sessionEnded := func(requestID string, err error) {
+		log.Info().Err(err).Str("actor", actor).Msg("Closing kitchen display: session check failed")
+		_ = send(kitchenCommandError(KitchenCommand{RequestID: requestID}, err))
+		disconnect(websocket.ClosePolicyViolation, "session no longer valid")
+	}
+
+	// Subscribe before the snapshot so no event falls between the two
+	if err := send(h.queueMessage(ctx, category, "")); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(h.pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event, ok := <-sub.Events:
+				if !ok {
+					// Fell behind or server shutting down; the display reconnects
+					disconnect(websocket.CloseGoingAway, "")
+					return
+				}
+				if !scope.ContainsOrder(&event.Order) {
+					continue
+				}
+				if err := send(KitchenMessage{Type: KitchenMessageEvent, Event: &event}); err != nil {
+					disconnect(websocket.CloseGoingAway, "")
+					return
+				}
+			case <-ticker.C:
+				if err := session.check(ctx); err != nil {
+					sessionEnded("", err)
+					return
+				}
+				writeMu.Lock()
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(kitchenWriteTimeout))
+				writeMu.Unlock()
+				if err != nil {
+					disconnect(websocket.CloseGoingAway, "")
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var cmd KitchenCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			if send(KitchenMessage{Type: KitchenMessageError, Error: "Invalid command format", Code: "INVALID_REQUEST"}) != nil {
+				return
+			}
+			continue
+		}
+
+		if err := session.check(ctx); err != nil {
+			sessionEnded(cmd.RequestID, err)
+			return
+		}
+		if err := send(h.handleCommand(ctx, cmd, category)); err != nil {
+			return
+		}
+	}
+}
+
+// handleCommand executes a display command and builds the reply
+func (h *KitchenHandler) handleCommand(ctx context.Context, cmd KitchenCommand, category string) KitchenMessage {
+	switch cmd.Type {
+	case KitchenCommandRefreshQueue:
+		return h.queueMessage(ctx, category, cmd.RequestID)
+
+	case KitchenCommandCompleteOrder:
+		if cmd.OrderID == "" {
+			return kitchenError(cmd, "Order ID is required", "INVALID_REQUEST")
+		}
+		order, err := h.orderService.CompleteOrder(ctx, cmd.OrderID)
+		if err != nil {
+			log.Error().Err(err).Str("order_id", cmd.OrderID).Msg("Failed to complete order from kitchen display")
+			return kitchenCommandError(cmd, err)
+		}
+		log.Info().Str("order_id", order.ID).Msg("Order completed")
+		return KitchenMessage{Type: KitchenMessageAck, RequestID: cmd.RequestID, Order: order}
+
+	case KitchenCommandMarkReady:
+		if cmd.OrderID == "" {
+			return kitchenError(cmd, "Order ID is required", "INVALID_REQUEST")
+		}
+		order, err := h.orderService.MarkReady(ctx, cmd.OrderID)
+		if err != nil {
+			log.Error().Err(err).Str("order_id", cmd.OrderID).Msg("Failed to mark order ready from kitchen display")
+			return kitchenCommandError(cmd, err)
+		}
+		log.Info().Str("order_id", order.ID).Msg("Order ready for pickup")
+		return KitchenMessage{Type: KitchenMessageAck, RequestID: cmd.RequestID, Order: order}
+
+	default:
+		return kitchenError(cmd, "Unknown command: "+cmd.Type, "UNKNOWN_COMMAND")
+	}
+}
+
+// queueMessage loads the preparing and ready lists for the display's category
+func (h *KitchenHandler) queueMessage(ctx context.Context, category, requestID string) KitchenMessage {
+	var preparing, ready []models.Order
+	var err error
+
+	if category != "" {
+		preparing, err = h.orderService.GetQueueByCategory(ctx, category)
+		if err == nil {
+			ready, err = h.orderService.GetReadyByCategory(ctx, category)
+		}
+	} else {
+		preparing, err = h.orderService.GetQueue(ctx)
+		if err == nil {
+			ready, err = h.orderService.GetReady(ctx)
+		}
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("category", category).Msg("Failed to get queue")
+		return KitchenMessage{Type: KitchenMessageError, RequestID: requestID, Error: "Failed to get queue", Code: "INTERNAL_ERROR"}
+	}
+	if preparing == nil {
+		preparing = []models.Order{}
+	}
+	if ready == nil {
+		ready = []models.Order{}
+	}
+
+	return KitchenMessage{Type: KitchenMessageQueue, RequestID: requestID, Queue: &preparing, Ready: &ready}
+}
+
+// kitchenCommandError reports a service error with the same code the REST endpoints use
+func kitchenCommandError(cmd KitchenCommand, err error) KitchenMessage {
+	_, body := errorResponse(err)
+	return kitchenError(cmd, body.Error, body.Code)
+}
+
+func kitchenError(cmd KitchenCommand, message, code string) KitchenMessage {
+	return KitchenMessage{Type: KitchenMessageError, RequestID: cmd.RequestID, Error: message, Code: code}
+}
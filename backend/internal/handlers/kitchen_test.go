@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	fasthttpws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
+)
+
+// startKitchenServer serves the kitchen WebSocket on a random local port,
+// behind the given authentication middleware
+func startKitchenServer(t *testing.T, handler *KitchenHandler, auth ...fiber.Handler) string {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/ws", append(auth, handler.RequireUpgrade, handler.Connect())...)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	return "ws://" + ln.Addr().String() + "/ws"
+}
+
+func TestKitchenHandler_Connect(t *testing.T) {
+	queueNum := 1
+	svc := new(mocks.MockOrderService)
+	svc.On("GetQueue", mock.Anything).Return([]models.Order{
+		{ID: "1401001", Status: models.OrderStatusPaid, QueueNumber: &queueNum},
+	}, nil)
+	svc.On("GetReady", mock.Anything).Return([]models.Order{}, nil)
+	svc.On("MarkReady", mock.Anything, "1401001").
+		Return(&models.Order{ID: "1401001", Status: models.OrderStatusReady}, nil)
+	svc.On("MarkReady", mock.Anything, "1401002").
+		Return(nil, fmt.Errorf("failed to mark order ready: %w", &service.InvalidTransitionError{OrderID: "1401002", From: models.OrderStatusCompleted, To: models.OrderStatusReady}))
+	svc.On("CompleteOrder", mock.Anything, "1401001").
+		Return(&models.Order{ID: "1401001", Status: models.OrderStatusCompleted}, nil)
+	svc.On("CompleteOrder", mock.Anything, "1401999").
+		Return(nil, fmt.Errorf("failed to complete order: %w: 1401999", service.ErrOrderNotFound))
+
+	broker := service.NewOrderEventBroker(10)
+	url := startKitchenServer(t, NewKitchenHandler(svc, broker, nil, time.Minute))
+
+	conn, _, err := fasthttpws.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Queue snapshot on connect
+	var msg KitchenMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, KitchenMessageQueue, msg.Type)
+	require.NotNil(t, msg.Queue)
+	assert.Len(t, *msg.Queue, 1)
+	require.NotNil(t, msg.Ready)
+	assert.Len(t, *msg.Ready, 0)
+
+	// Order events are pushed
+	broker.Publish(service.OrderEventPaid, &models.Order{ID: "1401002", Status: models.OrderStatusPaid})
+	msg = KitchenMessage{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, KitchenMessageEvent, msg.Type)
+	assert.Equal(t, "1401002", msg.Event.Order.ID)
+
+	tests := []struct {
+		name     string
+		cmd      KitchenCommand
+		wantType string
+		wantCode string
+	}{
+		{
+			name:     "Mark ready",
+			cmd:      KitchenCommand{RequestID: "r0", Type: KitchenCommandMarkReady, OrderID: "1401001"},
+			wantType: KitchenMessageAck,
+		},
+		{
+			name:     "Mark ready in wrong status",
+			cmd:      KitchenCommand{RequestID: "r0b", Type: KitchenCommandMarkReady, OrderID: "1401002"},
+			wantType: KitchenMessageError,
+			wantCode: "INVALID_STATUS",
+		},
+		{
+			name:     "Complete order",
+			cmd:      KitchenCommand{RequestID: "r1", Type: KitchenCommandCompleteOrder, OrderID: "1401001"},
+			wantType: KitchenMessageAck,
+		},
+		{
+			name:     "Complete unknown order",
+			cmd:      KitchenCommand{RequestID: "r2", Type: KitchenCommandCompleteOrder, OrderID: "1401999"},
+			wantType: KitchenMessageError,
+			wantCode: "ORDER_NOT_FOUND",
+		},
+		{
+			name:     "Missing order ID",
+			cmd:      KitchenCommand{RequestID: "r3", Type: KitchenCommandCompleteOrder},
+			wantType: KitchenMessageError,
+			wantCode: "INVALID_REQUEST",
+		},
+		{
+			name:     "Refresh queue",
+			cmd:      KitchenCommand{RequestID: "r4", Type: KitchenCommandRefreshQueue},
+			wantType: KitchenMessageQueue,
+		},
+		{
+			name:     "Unknown command",
+			cmd:      KitchenCommand{RequestID: "r5", Type: "dance"},
+			wantType: KitchenMessageError,
+			wantCode: "UNKNOWN_COMMAND",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, conn.WriteJSON(tt.cmd))
+
+			var reply KitchenMessage
+			require.NoError(t, conn.ReadJSON(&reply))
+			assert.Equal(t, tt.wantType, reply.Type)
+			assert.Equal(t, tt.cmd.RequestID, reply.RequestID)
+			assert.Equal(t, tt.wantCode, reply.Code)
+		})
+	}
+
+	// Malformed JSON gets an error but keeps the connection open
+	require.NoError(t, conn.WriteMessage(fasthttpws.TextMessage, []byte("not json")))
+	msg = KitchenMessage{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "INVALID_REQUEST", msg.Code)
+
+	// Broker shutdown closes the connection
+	broker.Close()
+	_, _, err = conn.ReadMessage()
+	assert.True(t, fasthttpws.IsCloseError(err, fasthttpws.CloseGoingAway), "unexpected error: %v", err)
+}
+
+func TestKitchenHandler_CommandActor(t *testing.T) {
+	tests := []struct {
+		name      string
+		auth      fiber.Handler
+		wantActor string
+	}{
+		{
+			name: "Logged-in user",
+			auth: func(c *fiber.Ctx) error {
+				c.Locals(service.UserKey{}, &models.User{Username: "somchai", Role: models.RoleKitchen})
+				c.Locals(service.ActorKey{}, "somchai")
+				return c.Next()
+			},
+			wantActor: "somchai",
+		},
+		{
+			name: "Shared password",
+			auth: func(c *fiber.Ctx) error {
+				c.Locals(service.ActorKey{}, "staff")
+				return c.Next()
+			},
+			wantActor: kitchenActor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mocks.MockOrderService)
+			svc.On("GetQueue", mock.Anything).Return([]models.Order{}, nil)
+			svc.On("GetReady", mock.Anything).Return([]models.Order{}, nil)
+			svc.On("MarkReady", mock.Anything, "1401001").
+				Return(&models.Order{ID: "1401001", Status: models.OrderStatusReady}, nil)
+
+			broker := service.NewOrderEventBroker(10)
+			defer broker.Close()
+			conn, _, err := fasthttpws.DefaultDialer.Dial(startKitchenServer(t, NewKitchenHandler(svc, broker, nil, time.Minute), tt.auth), nil)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			var msg KitchenMessage
+			require.NoError(t, conn.ReadJSON(&msg))
+			require.NoError(t, conn.WriteJSON(KitchenCommand{Type: KitchenCommandMarkReady, OrderID: "1401001"}))
+			require.NoError(t, conn.ReadJSON(&msg))
+			assert.Equal(t, KitchenMessageAck, msg.Type)
+
+			ctx := svc.Calls[len(svc.Calls)-1].Arguments.Get(0).(context.Context)
+			assert.Equal(t, tt.wantActor, service.ActorFromContext(ctx))
+		})
+	}
+}
+
+func TestKitchenHandler_SessionEnded(t *testing.T) {
+	shop := 1
+	cashier := &models.User{ID: 7, Username: "somchai", Role: models.RoleCashier, ShopIDs: []int{shop}, Active: true}
+	loggedIn := func(c *fiber.Ctx) error {
+		c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer tok")
+		c.Locals(service.UserKey{}, cashier)
+		c.Locals(service.ActorKey{}, cashier.Username)
+		c.Locals(service.ShopScopeKey{}, service.ScopeForUser(cashier))
+		return c.Next()
+	}
+
+	tests := []struct {
+		name         string
+		pingInterval time.Duration
+		command      bool
+		user         *models.User
+		authErr      error
+	}{
+		{name: "Logged out before a command", pingInterval: time.Minute, command: true, authErr: service.ErrSessionExpired},
+		{name: "Deactivated while idle", pingInterval: 20 * time.Millisecond, authErr: service.ErrSessionExpired},
+		{name: "Moved to another shop", pingInterval: 20 * time.Millisecond, user: &models.User{ID: 7, Username: "somchai", Role: models.RoleCashier, ShopIDs: []int{2}, Active: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mocks.MockOrderService)
+			svc.On("GetQueue", mock.Anything).Return([]models.Order{}, nil)
+			svc.On("GetReady", mock.Anything).Return([]models.Order{}, nil)
+			auth := new(mocks.MockAuthService)
+			auth.On("Authenticate", mock.Anything, "tok").Return(tt.user, tt.authErr)
+
+			broker := service.NewOrderEventBroker(10)
+			defer broker.Close()
+			url := startKitchenServer(t, NewKitchenHandler(svc, broker, auth, tt.pingInterval), loggedIn)
+			conn, _, err := fasthttpws.DefaultDialer.Dial(url, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			var msg KitchenMessage
+			require.NoError(t, conn.ReadJSON(&msg))
+			assert.Equal(t, KitchenMessageQueue, msg.Type)
+
+			if tt.command {
+				require.NoError(t, conn.WriteJSON(KitchenCommand{RequestID: "r1", Type: KitchenCommandMarkReady, OrderID: "1401001"}))
+			}
+			msg = KitchenMessage{}
+			require.NoError(t, conn.ReadJSON(&msg))
+			assert.Equal(t, KitchenMessageError, msg.Type)
+			assert.Equal(t, "UNAUTHORIZED", msg.Code)
+
+			_, _, err = conn.ReadMessage()
+			assert.True(t, fasthttpws.IsCloseError(err, fasthttpws.ClosePolicyViolation), "unexpected error: %v", err)
+			svc.AssertNotCalled(t, "MarkReady", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestKitchenHandler_RequireUpgrade(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	handler := NewKitchenHandler(new(mocks.MockOrderService), service.NewOrderEventBroker(10), nil, time.Minute)
+	app.Get("/ws", handler.RequireUpgrade, handler.Connect())
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/ws", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
@@ -38,10 +37,7 @@ func (h *MenuHandler) GetMenu(c *fiber.Ctx) error {
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get menu items")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get menu items",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	return c.Status(http.StatusOK).JSON(items)
@@ -60,17 +56,8 @@ func (h *MenuHandler) GetMenuItem(c *fiber.Ctx) error {
 
 	item, err := h.menuService.GetByID(c.Context(), id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return c.Status(http.StatusNotFound).JSON(fiber.Map{
-				"error": "Menu item not found",
-				"code":  "MENU_ITEM_NOT_FOUND",
-			})
-		}
 		log.Error().Err(err).Int("id", id).Msg("Failed to get menu item")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get menu item",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	return c.Status(http.StatusOK).JSON(item)
@@ -91,24 +78,7 @@ func (h *MenuHandler) CreateMenuItem(c *fiber.Ctx) error {
 	createdItem, err := h.menuService.Create(c.Context(), &item)
 	if err != nil {
 		log.Error().Err(err).Str("name", item.Name).Msg("Failed to create menu item")
-
-		if strings.Contains(err.Error(), "already exists") {
-			return c.Status(http.StatusConflict).JSON(fiber.Map{
-				"error": err.Error(),
-				"code":  "DUPLICATE_NAME",
-			})
-		}
-		if strings.Contains(err.Error(), "must be") {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-				"error": err.Error(),
-				"code":  "VALIDATION_ERROR",
-			})
-		}
-
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create menu item",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	log.Info().
@@ -146,30 +116,7 @@ func (h *MenuHandler) UpdateMenuItem(c *fiber.Ctx) error {
 	updatedItem, err := h.menuService.Update(c.Context(), &item)
 	if err != nil {
 		log.Error().Err(err).Int("id", id).Msg("Failed to update menu item")
-
-		if strings.Contains(err.Error(), "not found") {
-			return c.Status(http.StatusNotFound).JSON(fiber.Map{
-				"error": "Menu item not found",
-				"code":  "MENU_ITEM_NOT_FOUND",
-			})
-		}
-		if strings.Contains(err.Error(), "already exists") {
-			return c.Status(http.StatusConflict).JSON(fiber.Map{
-				"error": err.Error(),
-				"code":  "DUPLICATE_NAME",
-			})
-		}
-		if strings.Contains(err.Error(), "must be") {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-				"error": err.Error(),
-				"code":  "VALIDATION_ERROR",
-			})
-		}
-
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update menu item",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	log.Info().
@@ -195,28 +142,7 @@ func (h *MenuHandler) DeleteMenuItem(c *fiber.Ctx) error {
 	err = h.menuService.Delete(c.Context(), id)
 	if err != nil {
 		log.Error().Err(err).Int("id", id).Msg("Failed to delete menu item")
-
-		if strings.Contains(err.Error(), "not found") {
-			return c.Status(http.StatusNotFound).JSON(fiber.Map{
-				"error": "Menu item not found",
-				"code":  "MENU_ITEM_NOT_FOUND",
-			})
-		}
-
-		// Check for foreign key constraint violation (menu item is used in orders)
-		if strings.Contains(err.Error(), "violates foreign key") ||
-			strings.Contains(err.Error(), "FOREIGN KEY") ||
-			strings.Contains(err.Error(), "referenced") {
-			return c.Status(http.StatusConflict).JSON(fiber.Map{
-				"error": "Cannot delete menu item because it is used in existing orders. Consider marking it as unavailable instead.",
-				"code":  "MENU_ITEM_IN_USE",
-			})
-		}
-
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete menu item",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	log.Info().
@@ -234,10 +160,7 @@ func (h *MenuHandler) GetCategories(c *fiber.Ctx) error {
 	categories, err := h.menuService.GetCategories(c.Context())
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get categories")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get categories",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	return c.Status(http.StatusOK).JSON(categories)
@@ -3,7 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +13,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
 	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
 )
 
@@ -58,7 +59,7 @@ func TestMenuHandler_GetMenu(t *testing.T) {
 
 			handler := NewMenuHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Get("/menu", handler.GetMenu)
 
 			req := httptest.NewRequest(http.MethodGet, "/menu"+tt.queryParam, nil)
@@ -102,7 +103,7 @@ func TestMenuHandler_GetMenuItem(t *testing.T) {
 			name:   "Item not found",
 			itemID: "999",
 			setupMock: func(svc *mocks.MockMenuService) {
-				svc.On("GetByID", mock.Anything, 999).Return(nil, errors.New("menu item not found"))
+				svc.On("GetByID", mock.Anything, 999).Return(nil, service.ErrMenuItemNotFound)
 			},
 			wantStatusCode: http.StatusNotFound,
 			wantBody:       "MENU_ITEM_NOT_FOUND",
@@ -123,7 +124,7 @@ func TestMenuHandler_GetMenuItem(t *testing.T) {
 
 			handler := NewMenuHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Get("/menu/:id", handler.GetMenuItem)
 
 			req := httptest.NewRequest(http.MethodGet, "/menu/"+tt.itemID, nil)
@@ -175,10 +176,10 @@ func TestMenuHandler_CreateMenuItem(t *testing.T) {
 			},
 			setupMock: func(svc *mocks.MockMenuService) {
 				svc.On("Create", mock.Anything, mock.AnythingOfType("*models.MenuItem")).
-					Return(nil, errors.New("menu item with name 'French Fries S' already exists"))
+					Return(nil, fmt.Errorf("menu item with name 'French Fries S' %w", service.ErrDuplicate))
 			},
 			wantStatusCode: http.StatusConflict,
-			wantBody:       "DUPLICATE_NAME",
+			wantBody:       "DUPLICATE",
 		},
 		{
 			name: "Validation error",
@@ -189,7 +190,7 @@ func TestMenuHandler_CreateMenuItem(t *testing.T) {
 			},
 			setupMock: func(svc *mocks.MockMenuService) {
 				svc.On("Create", mock.Anything, mock.AnythingOfType("*models.MenuItem")).
-					Return(nil, errors.New("name must be 2-100 characters"))
+					Return(nil, service.NewValidationError("name", "name must be 2-100 characters"))
 			},
 			wantStatusCode: http.StatusBadRequest,
 			wantBody:       "VALIDATION_ERROR",
@@ -210,7 +211,7 @@ func TestMenuHandler_CreateMenuItem(t *testing.T) {
 
 			handler := NewMenuHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Post("/menu", handler.CreateMenuItem)
 
 			var body []byte
@@ -273,7 +274,7 @@ func TestMenuHandler_UpdateMenuItem(t *testing.T) {
 			},
 			setupMock: func(svc *mocks.MockMenuService) {
 				svc.On("Update", mock.Anything, mock.AnythingOfType("*models.MenuItem")).
-					Return(nil, errors.New("menu item not found"))
+					Return(nil, service.ErrMenuItemNotFound)
 			},
 			wantStatusCode: http.StatusNotFound,
 			wantBody:       "MENU_ITEM_NOT_FOUND",
@@ -295,7 +296,7 @@ func TestMenuHandler_UpdateMenuItem(t *testing.T) {
 
 			handler := NewMenuHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Put("/menu/:id", handler.UpdateMenuItem)
 
 			var body []byte
@@ -341,7 +342,7 @@ func TestMenuHandler_DeleteMenuItem(t *testing.T) {
 			name:   "Item not found",
 			itemID: "999",
 			setupMock: func(svc *mocks.MockMenuService) {
-				svc.On("Delete", mock.Anything, 999).Return(errors.New("menu item not found"))
+				svc.On("Delete", mock.Anything, 999).Return(service.ErrMenuItemNotFound)
 			},
 			wantStatusCode: http.StatusNotFound,
 			wantBody:       "MENU_ITEM_NOT_FOUND",
@@ -362,7 +363,7 @@ func TestMenuHandler_DeleteMenuItem(t *testing.T) {
 
 			handler := NewMenuHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Delete("/menu/:id", handler.DeleteMenuItem)
 
 			req := httptest.NewRequest(http.MethodDelete, "/menu/"+tt.itemID, nil)
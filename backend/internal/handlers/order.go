@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"net/http"
-	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
@@ -33,20 +32,29 @@ func (h *OrderHandler) GetOrder(c *fiber.Ctx) error {
 
 	order, err := h.orderService.GetOrder(c.Context(), id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return c.Status(http.StatusNotFound).JSON(fiber.Map{
-				"error": "Order not found",
-				"code":  "ORDER_NOT_FOUND",
-			})
-		}
 		log.Error().Err(err).Str("order_id", id).Msg("Failed to get order")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get order",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
-	return c.Status(http.StatusOK).JSON(order)
+	return c.Status(http.StatusOK).JSON(publicOrder(*order))
+}
+
+// publicOrder strips what only staff may see from an order shown on public
+// routes: the payments ledger and refunds name staff and carry transaction
+// references and refund reasons, and order codes are easy to guess
+func publicOrder(order models.Order) models.Order {
+	order.Payments = nil
+	order.Refunds = nil
+	return order
+}
+
+// publicOrders applies publicOrder to a list, always returning an array
+func publicOrders(orders []models.Order) []models.Order {
+	public := make([]models.Order, 0, len(orders))
+	for _, order := range orders {
+		public = append(public, publicOrder(order))
+	}
+	return public
 }
 
 // GetPendingPayment handles GET /api/v1/staff/orders/pending
@@ -65,38 +73,46 @@ func (h *OrderHandler) GetPendingPayment(c *fiber.Ctx) error {
 
 	if err != nil {
 		log.Error().Err(err).Str("category", category).Msg("Failed to get pending payment orders")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get pending payment orders",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	return c.Status(http.StatusOK).JSON(orders)
 }
 
-// GetQueue handles GET /api/v1/queue or /api/v1/staff/queue
+// QueueResponse is the public queue board: orders being prepared and orders
+// waiting for pickup, without their payments and refunds
+type QueueResponse struct {
+	Preparing []models.Order `json:"preparing"`
+	Ready     []models.Order `json:"ready"`
+}
+
+// GetQueue handles GET /api/v1/queue
 // Supports optional ?category= query param for filtering
 func (h *OrderHandler) GetQueue(c *fiber.Ctx) error {
 	category := c.Query("category")
 
-	var orders []models.Order
+	var preparing, ready []models.Order
 	var err error
 
 	if category != "" {
-		orders, err = h.orderService.GetQueueByCategory(c.Context(), category)
+		preparing, err = h.orderService.GetQueueByCategory(c.Context(), category)
+		if err == nil {
+			ready, err = h.orderService.GetReadyByCategory(c.Context(), category)
+		}
 	} else {
-		orders, err = h.orderService.GetQueue(c.Context())
+		preparing, err = h.orderService.GetQueue(c.Context())
+		if err == nil {
+			ready, err = h.orderService.GetReady(c.Context())
+		}
 	}
 
 	if err != nil {
 		log.Error().Err(err).Str("category", category).Msg("Failed to get queue")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get queue",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
-	return c.Status(http.StatusOK).JSON(orders)
+	// Always send arrays so the board never has to handle null
+	return c.Status(http.StatusOK).JSON(QueueResponse{Preparing: publicOrders(preparing), Ready: publicOrders(ready)})
 }
 
 // GetCompletedOrders handles GET /api/v1/staff/orders/completed
@@ -115,18 +131,20 @@ func (h *OrderHandler) GetCompletedOrders(c *fiber.Ctx) error {
 
 	if err != nil {
 		log.Error().Err(err).Str("category", category).Msg("Failed to get completed orders")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get completed orders",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	return c.Status(http.StatusOK).JSON(orders)
 }
 
-// MarkPaidRequest is the request body for marking an order as paid
+// MarkPaidRequest is the request body for recording a payment. With no
+// amount the whole outstanding balance is paid; a smaller amount records a
+// partial payment and the order stays unpaid until the rest comes in.
 type MarkPaidRequest struct {
-	PaymentMethod string `json:"payment_method"` // "PROMPTPAY" or "CASH"
+	PaymentMethod string  `json:"payment_method"` // "PROMPTPAY" or "CASH"
+	Amount        float64 `json:"amount"`         // optional, defaults to the balance
+	Received      float64 `json:"received"`       // optional, cash handed over
+	Reference     string  `json:"reference"`      // optional, e.g. PromptPay transaction reference
 }
 
 // VerifyPayment handles PUT /api/v1/staff/orders/:id/verify
@@ -139,9 +157,9 @@ func (h *OrderHandler) VerifyPayment(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse optional payment method from request body
+	// Parse optional payment details from request body
 	var req MarkPaidRequest
-	_ = c.BodyParser(&req) // Ignore error - payment_method is optional for backwards compatibility
+	_ = c.BodyParser(&req) // Ignore error - the body is optional for backwards compatibility
 
 	var paymentMethod *models.PaymentMethod
 	if req.PaymentMethod != "" {
@@ -156,38 +174,69 @@ func (h *OrderHandler) VerifyPayment(c *fiber.Ctx) error {
 		paymentMethod = &pm
 	}
 
-	order, err := h.orderService.VerifyPayment(c.Context(), id, paymentMethod)
+	order, err := h.orderService.RecordPayment(c.Context(), id, &models.PaymentRequest{
+		Method:    paymentMethod,
+		Amount:    req.Amount,
+		Received:  req.Received,
+		Reference: req.Reference,
+	})
 	if err != nil {
 		log.Error().Err(err).Str("order_id", id).Msg("Failed to verify payment")
+		return err
+	}
 
-		if strings.Contains(err.Error(), "not found") {
-			return c.Status(http.StatusNotFound).JSON(fiber.Map{
-				"error": "Order not found",
-				"code":  "ORDER_NOT_FOUND",
-			})
-		}
-		if strings.Contains(err.Error(), "not in pending payment") {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-				"error": "Order is not in pending payment status",
-				"code":  "INVALID_STATUS",
-			})
-		}
-
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to verify payment",
-			"code":  "INTERNAL_ERROR",
-		})
+	if order.Status != models.OrderStatusPaid {
+		log.Info().
+			Str("order_id", order.ID).
+			Float64("balance", order.Balance()).
+			Msg("Partial payment received")
+		return c.Status(http.StatusOK).JSON(order)
 	}
 
 	pmStr := ""
 	if order.PaymentMethod != nil {
 		pmStr = string(*order.PaymentMethod)
 	}
+	event := log.Info().
+		Str("order_id", order.ID).
+		Str("payment_method", pmStr)
+	// Split orders are called out by their tickets' queue numbers
+	if order.QueueNumber != nil {
+		event = event.Int("queue_number", *order.QueueNumber)
+	}
+	var ticketQueueNumbers []int
+	for _, ticket := range order.Tickets {
+		if ticket.QueueNumber != nil {
+			ticketQueueNumbers = append(ticketQueueNumbers, *ticket.QueueNumber)
+		}
+	}
+	if len(ticketQueueNumbers) > 0 {
+		event = event.Ints("ticket_queue_numbers", ticketQueueNumbers)
+	}
+	event.Msg("Payment verified")
+
+	return c.Status(http.StatusOK).JSON(order)
+}
+
+// MarkReady handles PUT /api/v1/staff/orders/:id/ready
+func (h *OrderHandler) MarkReady(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Order ID is required",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	order, err := h.orderService.MarkReady(c.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Str("order_id", id).Msg("Failed to mark order ready")
+		return err
+	}
+
 	log.Info().
 		Str("order_id", order.ID).
-		Int("queue_number", *order.QueueNumber).
-		Str("payment_method", pmStr).
-		Msg("Payment verified")
+		Msg("Order ready for pickup")
 
 	return c.Status(http.StatusOK).JSON(order)
 }
@@ -205,29 +254,44 @@ func (h *OrderHandler) CompleteOrder(c *fiber.Ctx) error {
 	order, err := h.orderService.CompleteOrder(c.Context(), id)
 	if err != nil {
 		log.Error().Err(err).Str("order_id", id).Msg("Failed to complete order")
+		return err
+	}
 
-		if strings.Contains(err.Error(), "not found") {
-			return c.Status(http.StatusNotFound).JSON(fiber.Map{
-				"error": "Order not found",
-				"code":  "ORDER_NOT_FOUND",
-			})
-		}
-		if strings.Contains(err.Error(), "not in paid status") {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-				"error": "Order is not in paid status",
-				"code":  "INVALID_STATUS",
-			})
-		}
+	log.Info().
+		Str("order_id", order.ID).
+		Msg("Order completed")
 
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to complete order",
-			"code":  "INTERNAL_ERROR",
+	return c.Status(http.StatusOK).JSON(order)
+}
+
+// UpdateOrderItems handles PUT /api/v1/pos/orders/:id/items
+func (h *OrderHandler) UpdateOrderItems(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Order ID is required",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	var req models.UpdateOrderItemsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
 		})
 	}
 
+	order, err := h.orderService.UpdateOrderItems(c.Context(), id, &req)
+	if err != nil {
+		log.Error().Err(err).Str("order_id", id).Msg("Failed to update order items")
+		return err
+	}
+
 	log.Info().
 		Str("order_id", order.ID).
-		Msg("Order completed")
+		Float64("total_amount", order.TotalAmount).
+		Msg("Order items updated")
 
 	return c.Status(http.StatusOK).JSON(order)
 }
@@ -245,24 +309,7 @@ func (h *OrderHandler) CancelOrder(c *fiber.Ctx) error {
 	err := h.orderService.CancelOrder(c.Context(), id)
 	if err != nil {
 		log.Error().Err(err).Str("order_id", id).Msg("Failed to cancel order")
-
-		if strings.Contains(err.Error(), "not found") {
-			return c.Status(http.StatusNotFound).JSON(fiber.Map{
-				"error": "Order not found",
-				"code":  "ORDER_NOT_FOUND",
-			})
-		}
-		if strings.Contains(err.Error(), "can only cancel") {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-				"error": "Can only cancel orders with pending payment status",
-				"code":  "INVALID_STATUS",
-			})
-		}
-
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to cancel order",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	log.Info().
@@ -274,6 +321,39 @@ func (h *OrderHandler) CancelOrder(c *fiber.Ctx) error {
 	})
 }
 
+// RefundOrder handles POST /api/v1/admin/orders/:id/refund
+func (h *OrderHandler) RefundOrder(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Order ID is required",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	var req models.RefundRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	order, err := h.orderService.RefundOrder(c.Context(), id, &req)
+	if err != nil {
+		log.Error().Err(err).Str("order_id", id).Msg("Failed to refund order")
+		return err
+	}
+
+	log.Info().
+		Str("order_id", order.ID).
+		Str("status", string(order.Status)).
+		Float64("refunded", order.RefundedAmount()).
+		Msg("Order refunded")
+
+	return c.Status(http.StatusOK).JSON(order)
+}
+
 // CreateOrder handles POST /api/v1/orders
 func (h *OrderHandler) CreateOrder(c *fiber.Ctx) error {
 	var req models.CreateOrderRequest
@@ -295,27 +375,7 @@ func (h *OrderHandler) CreateOrder(c *fiber.Ctx) error {
 			Str("order_id", req.ID).
 			Str("customer_name", req.CustomerName).
 			Msg("Failed to create order")
-
-		// Check for validation errors
-		if strings.Contains(err.Error(), "validation failed") {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-				"error": err.Error(),
-				"code":  "VALIDATION_ERROR",
-			})
-		}
-
-		// Check for duplicate order
-		if strings.Contains(err.Error(), "order ID already exists") {
-			return c.Status(http.StatusConflict).JSON(fiber.Map{
-				"error": err.Error(),
-				"code":  "DUPLICATE_ORDER",
-			})
-		}
-
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create order",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	log.Info().
@@ -327,3 +387,59 @@ func (h *OrderHandler) CreateOrder(c *fiber.Ctx) error {
 
 	return c.Status(http.StatusCreated).JSON(order)
 }
+
+// SyncOrders handles POST /api/v1/pos/orders/sync
+// Uploads the orders a tablet took while offline; the response maps each
+// client_id to its server order or lists what has to be fixed first
+func (h *OrderHandler) SyncOrders(c *fiber.Ctx) error {
+	var req models.SyncOrdersRequest
+	if err := c.BodyParser(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to parse sync request body")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	resp, err := h.orderService.SyncOrders(c.Context(), &req)
+	if err != nil {
+		log.Error().Err(err).Int("order_count", len(req.Orders)).Msg("Failed to sync offline orders")
+		return err
+	}
+
+	counts := make(map[models.SyncStatus]int)
+	for _, result := range resp.Results {
+		counts[result.Status]++
+	}
+	log.Info().
+		Int("created", counts[models.SyncStatusCreated]).
+		Int("duplicate", counts[models.SyncStatusDuplicate]).
+		Int("conflict", counts[models.SyncStatusConflict]).
+		Int("invalid", counts[models.SyncStatusInvalid]).
+		Msg("Offline orders synced")
+
+	return c.Status(http.StatusOK).JSON(resp)
+}
+
+// GetOrderHistory handles GET /api/v1/admin/orders/:id/history
+func (h *OrderHandler) GetOrderHistory(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Order ID is required",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	history, err := h.orderService.GetOrderHistory(c.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Str("order_id", id).Msg("Failed to get order history")
+		return err
+	}
+
+	if history == nil {
+		history = []models.OrderStatusHistory{}
+	}
+
+	return c.Status(http.StatusOK).JSON(history)
+}
@@ -3,16 +3,18 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
 	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
 )
 
@@ -63,7 +65,7 @@ func TestOrderHandler_CreateOrder(t *testing.T) {
 			},
 			setupMock: func(svc *mocks.MockOrderService) {
 				svc.On("CreateOrder", mock.Anything, mock.AnythingOfType("*models.CreateOrderRequest")).
-					Return(nil, errors.New("validation failed: customer name must be 2-50 characters"))
+					Return(nil, service.NewValidationError("customer_name", "customer name must be 2-50 characters"))
 			},
 			wantStatusCode: http.StatusBadRequest,
 			wantBody:       "VALIDATION_ERROR",
@@ -80,10 +82,10 @@ func TestOrderHandler_CreateOrder(t *testing.T) {
 			},
 			setupMock: func(svc *mocks.MockOrderService) {
 				svc.On("CreateOrder", mock.Anything, mock.AnythingOfType("*models.CreateOrderRequest")).
-					Return(nil, errors.New("order ID already exists: 1401001"))
+					Return(nil, fmt.Errorf("order ID 1401001 %w", service.ErrDuplicate))
 			},
 			wantStatusCode: http.StatusConflict,
-			wantBody:       "DUPLICATE_ORDER",
+			wantBody:       "DUPLICATE",
 		},
 	}
 
@@ -94,7 +96,7 @@ func TestOrderHandler_CreateOrder(t *testing.T) {
 
 			handler := NewOrderHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Post("/orders", handler.CreateOrder)
 
 			var body []byte
@@ -119,6 +121,69 @@ func TestOrderHandler_CreateOrder(t *testing.T) {
 	}
 }
 
+func TestOrderHandler_SyncOrders(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      func(*mocks.MockOrderService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:        "Returns the mapping",
+			requestBody: `{"orders":[{"client_id":"c1","customer_name":"Ann","created_at":"2026-01-14T11:30:00+07:00","items":[{"menu_item_id":1,"price":40,"quantity":1}]}]}`,
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("SyncOrders", mock.Anything, mock.MatchedBy(func(req *models.SyncOrdersRequest) bool {
+					return len(req.Orders) == 1 && req.Orders[0].ClientID == "c1" && !req.Orders[0].CreatedAt.IsZero()
+				})).Return(&models.SyncOrdersResponse{Results: []models.SyncResult{
+					{ClientID: "c1", Status: models.SyncStatusCreated, OrderID: "1401001"},
+				}}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"client_id":"c1","status":"CREATED","order_id":"1401001"`,
+		},
+		{
+			name:           "Invalid JSON",
+			requestBody:    "invalid json",
+			setupMock:      func(svc *mocks.MockOrderService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "Invalid request format",
+		},
+		{
+			name:        "Invalid batch",
+			requestBody: `{"orders":[]}`,
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("SyncOrders", mock.Anything, mock.Anything).
+					Return(nil, service.NewValidationError("orders", "sync must contain at least one order"))
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "VALIDATION_ERROR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockOrderService)
+			tt.setupMock(mockService)
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Post("/orders/sync", NewOrderHandler(mockService).SyncOrders)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/sync", bytes.NewReader([]byte(tt.requestBody)))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(respBody), tt.wantBody)
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestOrderHandler_GetOrder(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -126,6 +191,7 @@ func TestOrderHandler_GetOrder(t *testing.T) {
 		setupMock      func(*mocks.MockOrderService)
 		wantStatusCode int
 		wantBody       string
+		notWantBody    []string
 	}{
 		{
 			name:    "Order found",
@@ -140,11 +206,27 @@ func TestOrderHandler_GetOrder(t *testing.T) {
 			wantStatusCode: http.StatusOK,
 			wantBody:       "1401001",
 		},
+		{
+			name:    "Payments and refunds are not shown",
+			orderID: "1401002",
+			setupMock: func(svc *mocks.MockOrderService) {
+				reference := "TX123"
+				svc.On("GetOrder", mock.Anything, "1401002").Return(&models.Order{
+					ID:       "1401002",
+					Status:   models.OrderStatusPaid,
+					Payments: []models.Payment{{Amount: 40, Reference: &reference, Actor: "cashier1"}},
+					Refunds:  []models.Refund{{Amount: 40, Reason: "out of fries", Actor: "owner"}},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "1401002",
+			notWantBody:    []string{"payments", "refunds", "TX123", "cashier1", "out of fries"},
+		},
 		{
 			name:    "Order not found",
 			orderID: "9999",
 			setupMock: func(svc *mocks.MockOrderService) {
-				svc.On("GetOrder", mock.Anything, "9999").Return(nil, errors.New("order not found"))
+				svc.On("GetOrder", mock.Anything, "9999").Return(nil, service.ErrOrderNotFound)
 			},
 			wantStatusCode: http.StatusNotFound,
 			wantBody:       "ORDER_NOT_FOUND",
@@ -158,7 +240,7 @@ func TestOrderHandler_GetOrder(t *testing.T) {
 
 			handler := NewOrderHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Get("/orders/:id", handler.GetOrder)
 
 			req := httptest.NewRequest(http.MethodGet, "/orders/"+tt.orderID, nil)
@@ -169,6 +251,9 @@ func TestOrderHandler_GetOrder(t *testing.T) {
 
 			respBody, _ := io.ReadAll(resp.Body)
 			assert.Contains(t, string(respBody), tt.wantBody)
+			for _, hidden := range tt.notWantBody {
+				assert.NotContains(t, string(respBody), hidden)
+			}
 
 			mockService.AssertExpectations(t)
 		})
@@ -180,6 +265,7 @@ func TestOrderHandler_VerifyPayment(t *testing.T) {
 		name           string
 		orderID        string
 		setupMock      func(*mocks.MockOrderService)
+		body           string
 		wantStatusCode int
 		wantBody       string
 	}{
@@ -188,7 +274,7 @@ func TestOrderHandler_VerifyPayment(t *testing.T) {
 			orderID: "1401001",
 			setupMock: func(svc *mocks.MockOrderService) {
 				queueNum := 1
-				svc.On("VerifyPayment", mock.Anything, "1401001", mock.Anything).Return(&models.Order{
+				svc.On("RecordPayment", mock.Anything, "1401001", mock.Anything).Return(&models.Order{
 					ID:          "1401001",
 					Status:      models.OrderStatusPaid,
 					QueueNumber: &queueNum,
@@ -197,11 +283,53 @@ func TestOrderHandler_VerifyPayment(t *testing.T) {
 			wantStatusCode: http.StatusOK,
 			wantBody:       "PAID",
 		},
+		{
+			name:    "Split order paid",
+			orderID: "1401002",
+			setupMock: func(svc *mocks.MockOrderService) {
+				one, two := 1, 2
+				svc.On("RecordPayment", mock.Anything, "1401002", mock.Anything).Return(&models.Order{
+					ID:     "1401002",
+					Status: models.OrderStatusPaid,
+					Tickets: []models.OrderTicket{
+						{ShopID: 1, Status: models.OrderStatusPaid, QueueNumber: &one},
+						{ShopID: 2, Status: models.OrderStatusPaid, QueueNumber: &two},
+					},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"queue_number":2`,
+		},
+		{
+			name:    "Partial payment",
+			orderID: "1401001",
+			body:    `{"payment_method":"CASH","amount":30,"received":50}`,
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("RecordPayment", mock.Anything, "1401001", mock.MatchedBy(func(req *models.PaymentRequest) bool {
+					return *req.Method == models.PaymentMethodCash && req.Amount == 30 && req.Received == 50
+				})).Return(&models.Order{
+					ID:          "1401001",
+					Status:      models.OrderStatusPendingPayment,
+					TotalAmount: 80,
+					Payments:    []models.Payment{{Amount: 30, Received: 50, Change: 20}},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "PENDING_PAYMENT",
+		},
+		{
+			name:           "Invalid payment method",
+			orderID:        "1401001",
+			body:           `{"payment_method":"CARD"}`,
+			setupMock:      func(svc *mocks.MockOrderService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "INVALID_REQUEST",
+		},
 		{
 			name:    "Order not found",
 			orderID: "9999",
 			setupMock: func(svc *mocks.MockOrderService) {
-				svc.On("VerifyPayment", mock.Anything, "9999", mock.Anything).Return(nil, errors.New("order not found"))
+				svc.On("RecordPayment", mock.Anything, "9999", mock.Anything).Return(nil, service.ErrOrderNotFound)
 			},
 			wantStatusCode: http.StatusNotFound,
 			wantBody:       "ORDER_NOT_FOUND",
@@ -210,7 +338,7 @@ func TestOrderHandler_VerifyPayment(t *testing.T) {
 			name:    "Invalid status",
 			orderID: "1401001",
 			setupMock: func(svc *mocks.MockOrderService) {
-				svc.On("VerifyPayment", mock.Anything, "1401001", mock.Anything).Return(nil, errors.New("not in pending payment status"))
+				svc.On("RecordPayment", mock.Anything, "1401001", mock.Anything).Return(nil, fmt.Errorf("failed to verify payment: %w", &service.InvalidTransitionError{OrderID: "1401001", From: models.OrderStatusPaid, To: models.OrderStatusPaid}))
 			},
 			wantStatusCode: http.StatusBadRequest,
 			wantBody:       "INVALID_STATUS",
@@ -224,10 +352,11 @@ func TestOrderHandler_VerifyPayment(t *testing.T) {
 
 			handler := NewOrderHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Put("/orders/:id/verify", handler.VerifyPayment)
 
-			req := httptest.NewRequest(http.MethodPut, "/orders/"+tt.orderID+"/verify", nil)
+			req := httptest.NewRequest(http.MethodPut, "/orders/"+tt.orderID+"/verify", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
 
 			resp, err := app.Test(req)
 			assert.NoError(t, err)
@@ -265,7 +394,7 @@ func TestOrderHandler_CompleteOrder(t *testing.T) {
 			name:    "Not in paid status",
 			orderID: "1401001",
 			setupMock: func(svc *mocks.MockOrderService) {
-				svc.On("CompleteOrder", mock.Anything, "1401001").Return(nil, errors.New("not in paid status"))
+				svc.On("CompleteOrder", mock.Anything, "1401001").Return(nil, fmt.Errorf("failed to complete order: %w", &service.InvalidTransitionError{OrderID: "1401001", From: models.OrderStatusPendingPayment, To: models.OrderStatusCompleted}))
 			},
 			wantStatusCode: http.StatusBadRequest,
 			wantBody:       "INVALID_STATUS",
@@ -279,7 +408,7 @@ func TestOrderHandler_CompleteOrder(t *testing.T) {
 
 			handler := NewOrderHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Put("/orders/:id/complete", handler.CompleteOrder)
 
 			req := httptest.NewRequest(http.MethodPut, "/orders/"+tt.orderID+"/complete", nil)
@@ -296,6 +425,132 @@ func TestOrderHandler_CompleteOrder(t *testing.T) {
 	}
 }
 
+func TestOrderHandler_MarkReady(t *testing.T) {
+	tests := []struct {
+		name           string
+		orderID        string
+		setupMock      func(*mocks.MockOrderService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:    "Successful mark ready",
+			orderID: "1401001",
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("MarkReady", mock.Anything, "1401001").Return(&models.Order{
+					ID:     "1401001",
+					Status: models.OrderStatusReady,
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "READY",
+		},
+		{
+			name:    "Not in paid status",
+			orderID: "1401001",
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("MarkReady", mock.Anything, "1401001").Return(nil, &service.InvalidTransitionError{OrderID: "1401001", From: models.OrderStatusCompleted, To: models.OrderStatusReady})
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "INVALID_STATUS",
+		},
+		{
+			name:    "Order not found",
+			orderID: "1401999",
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("MarkReady", mock.Anything, "1401999").Return(nil, fmt.Errorf("%w: 1401999", service.ErrOrderNotFound))
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantBody:       "ORDER_NOT_FOUND",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockOrderService)
+			tt.setupMock(mockService)
+
+			handler := NewOrderHandler(mockService)
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Put("/orders/:id/ready", handler.MarkReady)
+
+			req := httptest.NewRequest(http.MethodPut, "/orders/"+tt.orderID+"/ready", nil)
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(respBody), tt.wantBody)
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderHandler_UpdateOrderItems(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*mocks.MockOrderService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "Add a drink",
+			body: `{"items":[{"menu_item_id":1,"name":"French Fries S","price":40,"quantity":1},{"menu_item_id":7,"name":"Cola","price":25,"quantity":1}]}`,
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("UpdateOrderItems", mock.Anything, "1401001", mock.MatchedBy(func(req *models.UpdateOrderItemsRequest) bool {
+					return len(req.Items) == 2 && req.Items[1].MenuItemID == 7
+				})).Return(&models.Order{ID: "1401001", TotalAmount: 65, Status: models.OrderStatusPendingPayment}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"total_amount":65`,
+		},
+		{
+			name: "Already paid",
+			body: `{"items":[{"menu_item_id":1,"name":"French Fries S","price":40,"quantity":1}]}`,
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("UpdateOrderItems", mock.Anything, "1401001", mock.Anything).Return(nil, fmt.Errorf("%w: order 1401001 is PAID, only unpaid orders can be changed", service.ErrInvalidTransition))
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "INVALID_STATUS",
+		},
+		{
+			name:           "Invalid JSON",
+			body:           `{"items":`,
+			setupMock:      func(svc *mocks.MockOrderService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "INVALID_REQUEST",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockOrderService)
+			tt.setupMock(mockService)
+
+			handler := NewOrderHandler(mockService)
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Put("/orders/:id/items", handler.UpdateOrderItems)
+
+			req := httptest.NewRequest(http.MethodPut, "/orders/1401001/items", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(respBody), tt.wantBody)
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestOrderHandler_CancelOrder(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -317,7 +572,7 @@ func TestOrderHandler_CancelOrder(t *testing.T) {
 			name:    "Cannot cancel paid order",
 			orderID: "1401001",
 			setupMock: func(svc *mocks.MockOrderService) {
-				svc.On("CancelOrder", mock.Anything, "1401001").Return(errors.New("can only cancel orders with pending payment status"))
+				svc.On("CancelOrder", mock.Anything, "1401001").Return(&service.InvalidTransitionError{OrderID: "1401001", From: models.OrderStatusPaid, To: models.OrderStatusCancelled})
 			},
 			wantStatusCode: http.StatusBadRequest,
 			wantBody:       "INVALID_STATUS",
@@ -331,7 +586,7 @@ func TestOrderHandler_CancelOrder(t *testing.T) {
 
 			handler := NewOrderHandler(mockService)
 
-			app := fiber.New()
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 			app.Delete("/orders/:id", handler.CancelOrder)
 
 			req := httptest.NewRequest(http.MethodDelete, "/orders/"+tt.orderID, nil)
@@ -348,18 +603,160 @@ func TestOrderHandler_CancelOrder(t *testing.T) {
 	}
 }
 
+func TestOrderHandler_RefundOrder(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*mocks.MockOrderService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "Partial refund",
+			body: `{"reason":"out of fries","items":[{"order_item_id":1,"quantity":1}]}`,
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("RefundOrder", mock.Anything, "1401001", mock.MatchedBy(func(req *models.RefundRequest) bool {
+					return req.Reason == "out of fries" && len(req.Items) == 1 && req.Items[0].OrderItemID == 1
+				})).Return(&models.Order{
+					ID:      "1401001",
+					Status:  models.OrderStatusPaid,
+					Refunds: []models.Refund{{Amount: 40, Reason: "out of fries"}},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"refunds":[{`,
+		},
+		{
+			name: "Cannot refund unpaid order",
+			body: `{"reason":"customer left"}`,
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("RefundOrder", mock.Anything, "1401001", mock.Anything).Return(nil, &service.InvalidTransitionError{OrderID: "1401001", From: models.OrderStatusPendingPayment, To: models.OrderStatusRefunded})
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "INVALID_STATUS",
+		},
+		{
+			name: "Missing reason",
+			body: `{}`,
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("RefundOrder", mock.Anything, "1401001", mock.Anything).Return(nil, service.NewValidationError("reason", "reason must be 1-200 characters"))
+			},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "reason must be 1-200 characters",
+		},
+		{
+			name:           "Invalid JSON",
+			body:           `{"items":`,
+			setupMock:      func(svc *mocks.MockOrderService) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantBody:       "INVALID_REQUEST",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockOrderService)
+			tt.setupMock(mockService)
+
+			handler := NewOrderHandler(mockService)
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Post("/orders/:id/refund", handler.RefundOrder)
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/1401001/refund", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(respBody), tt.wantBody)
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderHandler_GetOrderHistory(t *testing.T) {
+	tests := []struct {
+		name           string
+		orderID        string
+		setupMock      func(*mocks.MockOrderService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:    "Order with transitions",
+			orderID: "1401001",
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("GetOrderHistory", mock.Anything, "1401001").Return([]models.OrderStatusHistory{
+					{OrderID: "1401001", FromStatus: models.OrderStatusPendingPayment, ToStatus: models.OrderStatusPaid, Actor: "pos", Reason: "payment verified"},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `"actor":"pos"`,
+		},
+		{
+			name:    "Order without transitions",
+			orderID: "1401002",
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("GetOrderHistory", mock.Anything, "1401002").Return(nil, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "[]",
+		},
+		{
+			name:    "Order not found",
+			orderID: "9999999",
+			setupMock: func(svc *mocks.MockOrderService) {
+				svc.On("GetOrderHistory", mock.Anything, "9999999").Return(nil, fmt.Errorf("%w: 9999999", service.ErrOrderNotFound))
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantBody:       "ORDER_NOT_FOUND",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockOrderService)
+			tt.setupMock(mockService)
+
+			handler := NewOrderHandler(mockService)
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/orders/:id/history", handler.GetOrderHistory)
+
+			req := httptest.NewRequest(http.MethodGet, "/orders/"+tt.orderID+"/history", nil)
+
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(respBody), tt.wantBody)
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestOrderHandler_GetQueue(t *testing.T) {
 	mockService := new(mocks.MockOrderService)
 
 	queueNum1, queueNum2 := 1, 2
+	reference := "TX123"
 	mockService.On("GetQueue", mock.Anything).Return([]models.Order{
-		{ID: "1401001", Status: models.OrderStatusPaid, QueueNumber: &queueNum1},
-		{ID: "1401002", Status: models.OrderStatusPaid, QueueNumber: &queueNum2},
+		{ID: "1401001", Status: models.OrderStatusPaid, QueueNumber: &queueNum1,
+			Payments: []models.Payment{{Amount: 40, Reference: &reference, Actor: "cashier1"}}},
+	}, nil)
+	mockService.On("GetReady", mock.Anything).Return([]models.Order{
+		{ID: "1401002", Status: models.OrderStatusReady, QueueNumber: &queueNum2},
 	}, nil)
 
 	handler := NewOrderHandler(mockService)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	app.Get("/queue", handler.GetQueue)
 
 	req := httptest.NewRequest(http.MethodGet, "/queue", nil)
@@ -368,9 +765,13 @@ func TestOrderHandler_GetQueue(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 
-	respBody, _ := io.ReadAll(resp.Body)
-	assert.Contains(t, string(respBody), "1401001")
-	assert.Contains(t, string(respBody), "1401002")
+	var queue QueueResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&queue))
+	assert.Len(t, queue.Preparing, 1)
+	assert.Equal(t, "1401001", queue.Preparing[0].ID)
+	assert.Len(t, queue.Ready, 1)
+	assert.Equal(t, "1401002", queue.Ready[0].ID)
+	assert.Empty(t, queue.Preparing[0].Payments, "the public board doesn't show the ledger")
 
 	mockService.AssertExpectations(t)
 }
@@ -385,7 +786,7 @@ func TestOrderHandler_GetPendingPayment(t *testing.T) {
 
 	handler := NewOrderHandler(mockService)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	app.Get("/pending", handler.GetPendingPayment)
 
 	req := httptest.NewRequest(http.MethodGet, "/pending", nil)
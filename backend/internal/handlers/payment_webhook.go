@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+// PaymentSignatureHeader carries the provider's signature of the body
+const PaymentSignatureHeader = "X-Signature"
+
+type PaymentWebhookHandler struct {
+	webhookService service.PaymentWebhookService
+}
+
+func NewPaymentWebhookHandler(webhookService service.PaymentWebhookService) *PaymentWebhookHandler {
+	return &PaymentWebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// HandleNotification handles POST /api/v1/webhooks/payments
+// Every authentic notification gets 200 with what became of it, so the
+// provider doesn't retry ones that matched no order.
+func (h *PaymentWebhookHandler) HandleNotification(c *fiber.Ctx) error {
+	match, err := h.webhookService.HandleNotification(c.Context(), c.Body(), c.Get(PaymentSignatureHeader))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to handle payment notification")
+		return err
+	}
+
+	event := log.Info()
+	if match.Status == models.PaymentMatchUnmatched || match.Status == models.PaymentMatchAmbiguous {
+		event = log.Warn()
+	}
+	event.
+		Str("reference", match.Reference).
+		Str("status", string(match.Status)).
+		Str("order_id", match.OrderID).
+		Msg("Payment notification received")
+
+	return c.Status(http.StatusOK).JSON(match)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
+)
+
+func TestPaymentWebhookHandler_HandleNotification(t *testing.T) {
+	body := `{"reference":"TX1","amount":80}`
+
+	tests := []struct {
+		name           string
+		setupMock      func(*mocks.MockPaymentWebhookService)
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name: "Matched",
+			setupMock: func(svc *mocks.MockPaymentWebhookService) {
+				svc.On("HandleNotification", mock.Anything, []byte(body), "abc123").Return(&models.PaymentMatch{
+					Reference: "TX1",
+					Status:    models.PaymentMatchMatched,
+					OrderID:   "1401001",
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "MATCHED",
+		},
+		{
+			name: "Unmatched is still accepted",
+			setupMock: func(svc *mocks.MockPaymentWebhookService) {
+				svc.On("HandleNotification", mock.Anything, []byte(body), "abc123").Return(&models.PaymentMatch{
+					Reference: "TX1",
+					Status:    models.PaymentMatchUnmatched,
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       "UNMATCHED",
+		},
+		{
+			name: "Bad signature",
+			setupMock: func(svc *mocks.MockPaymentWebhookService) {
+				svc.On("HandleNotification", mock.Anything, []byte(body), "abc123").Return(nil, service.ErrUnauthorized)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+			wantBody:       "UNAUTHORIZED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(mocks.MockPaymentWebhookService)
+			tt.setupMock(svc)
+
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Post("/webhooks/payments", NewPaymentWebhookHandler(svc).HandleNotification)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/payments", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(PaymentSignatureHeader, "abc123")
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(respBody), tt.wantBody)
+
+			svc.AssertExpectations(t)
+		})
+	}
+}
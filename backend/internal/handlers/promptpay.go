@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+type PromptPayHandler struct {
+	promptPayService service.PromptPayService
+}
+
+func NewPromptPayHandler(promptPayService service.PromptPayService) *PromptPayHandler {
+	return &PromptPayHandler{
+		promptPayService: promptPayService,
+	}
+}
+
+// GetQR handles GET /api/v1/orders/:id/promptpay
+// Returns the payload and PNG QR code as JSON, or with ?format=png just the
+// image (for use as an <img> src).
+func (h *PromptPayHandler) GetQR(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Order ID is required",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	qr, err := h.promptPayService.GetQR(c.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Str("order_id", id).Msg("Failed to generate PromptPay QR")
+		return err
+	}
+
+	// The QR is only valid while the balance stays the same
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	if c.Query("format") == "png" {
+		c.Set(fiber.HeaderContentType, "image/png")
+		return c.Status(http.StatusOK).Send(qr.PNG)
+	}
+	return c.Status(http.StatusOK).JSON(qr)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service/mocks"
+)
+
+func TestPromptPayHandler_GetQR(t *testing.T) {
+	qr := &models.PromptPayQR{
+		OrderID: "1401001",
+		Amount:  80,
+		Account: "0899999999",
+		Payload: "00020101021229370016A000000677010111011300668999999995802TH530376454058",
+		PNG:     []byte("\x89PNG"),
+	}
+
+	newApp := func(svc *mocks.MockPromptPayService) *fiber.App {
+		app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		app.Get("/orders/:id/promptpay", NewPromptPayHandler(svc).GetQR)
+		return app
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		svc := new(mocks.MockPromptPayService)
+		svc.On("GetQR", mock.Anything, "1401001").Return(qr, nil)
+
+		resp, err := newApp(svc).Test(httptest.NewRequest(http.MethodGet, "/orders/1401001/promptpay", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+		var got models.PromptPayQR
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+		assert.Equal(t, *qr, got)
+	})
+
+	t.Run("PNG", func(t *testing.T) {
+		svc := new(mocks.MockPromptPayService)
+		svc.On("GetQR", mock.Anything, "1401001").Return(qr, nil)
+
+		resp, err := newApp(svc).Test(httptest.NewRequest(http.MethodGet, "/orders/1401001/promptpay?format=png", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, qr.PNG, body)
+	})
+
+	t.Run("Not configured", func(t *testing.T) {
+		svc := new(mocks.MockPromptPayService)
+		svc.On("GetQR", mock.Anything, "1401001").Return(nil, service.ErrPromptPayNotConfigured)
+
+		resp, err := newApp(svc).Test(httptest.NewRequest(http.MethodGet, "/orders/1401001/promptpay", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(body), "PROMPTPAY_NOT_CONFIGURED")
+	})
+}
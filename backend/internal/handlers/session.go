@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+// liveSession re-checks the login behind a long-lived connection (the order
+// event stream or a kitchen display), which is otherwise only authenticated
+// when it opens
+type liveSession struct {
+	auth  service.AuthService
+	token string
+	role  models.Role
+	scope service.ShopScope
+}
+
+// newLiveSession captures the caller's session token, role and shops. It
+// returns nil for callers that did not log in as a user (shared passwords,
+// POS_PUBLIC), whose access can't change while they are connected.
+func newLiveSession(c *fiber.Ctx, auth service.AuthService) *liveSession {
+	user, ok := service.UserFromContext(c.Context())
+	if !ok || auth == nil {
+		return nil
+	}
+	return &liveSession{
+		auth:  auth,
+		token: strings.Clone(strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")),
+		role:  user.Role,
+		scope: service.ScopeForUser(user),
+	}
+}
+
+// check fails once the user has logged out, the session has expired or the
+// user was deactivated, or when their role or shops have changed, so the
+// connection is closed and the client reconnects with its current access
+func (s *liveSession) check(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	user, err := s.auth.Authenticate(ctx, s.token)
+	if err != nil {
+		return err
+	}
+	if user.Role != s.role || !service.ScopeForUser(user).Equal(s.scope) {
+		return service.ErrSessionExpired
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+)
+
+type ShopHandler struct {
+	shopService service.ShopService
+}
+
+func NewShopHandler(shopService service.ShopService) *ShopHandler {
+	return &ShopHandler{
+		shopService: shopService,
+	}
+}
+
+// GetShops handles GET /api/v1/shops
+// Returns the open shops.
+func (h *ShopHandler) GetShops(c *fiber.Ctx) error {
+	shops, err := h.shopService.GetActive(c.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get shops")
+		return err
+	}
+	return c.Status(http.StatusOK).JSON(shops)
+}
+
+// GetAllShops handles GET /api/v1/admin/shops
+func (h *ShopHandler) GetAllShops(c *fiber.Ctx) error {
+	shops, err := h.shopService.GetAll(c.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get shops")
+		return err
+	}
+	if shops == nil {
+		shops = []models.Shop{}
+	}
+	return c.Status(http.StatusOK).JSON(shops)
+}
+
+// CreateShop handles POST /api/v1/admin/shops
+func (h *ShopHandler) CreateShop(c *fiber.Ctx) error {
+	shop := models.Shop{Active: true}
+	if err := c.BodyParser(&shop); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	created, err := h.shopService.Create(c.Context(), &shop)
+	if err != nil {
+		log.Error().Err(err).Str("code", shop.Code).Msg("Failed to create shop")
+		return err
+	}
+
+	log.Info().
+		Int("id", created.ID).
+		Str("code", created.Code).
+		Str("actor", service.ActorFromContext(c.Context())).
+		Msg("Shop created")
+
+	return c.Status(http.StatusCreated).JSON(created)
+}
+
+// UpdateShop handles PUT /api/v1/admin/shops/:id
+func (h *ShopHandler) UpdateShop(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid shop ID",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+
+	var shop models.Shop
+	if err := c.BodyParser(&shop); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+			"code":  "INVALID_REQUEST",
+		})
+	}
+	shop.ID = id
+
+	updated, err := h.shopService.Update(c.Context(), &shop)
+	if err != nil {
+		log.Error().Err(err).Int("id", id).Msg("Failed to update shop")
+		return err
+	}
+
+	log.Info().
+		Int("id", updated.ID).
+		Bool("active", updated.Active).
+		Str("actor", service.ActorFromContext(c.Context())).
+		Msg("Shop updated")
+
+	return c.Status(http.StatusOK).JSON(updated)
+}
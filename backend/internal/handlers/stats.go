@@ -1,72 +1,146 @@
 package handlers
 
 import (
-	"net/http"
+	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/service"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
 )
 
 type StatsHandler struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	clock *utils.BusinessClock
 }
 
-func NewStatsHandler(db *sqlx.DB) *StatsHandler {
-	return &StatsHandler{db: db}
+func NewStatsHandler(db *sqlx.DB, clock *utils.BusinessClock) *StatsHandler {
+	return &StatsHandler{db: db, clock: clock}
 }
 
-// parseDateRange extracts start_date and end_date from query params
-// Defaults to today if not provided
-func parseDateRange(c *fiber.Ctx) (startDate, endDate string) {
-	today := time.Now().Format("2006-01-02")
+// parseDateRange extracts start_date and end_date from query params.
+// Dates are business dates (orders.business_date). Defaults to the current business day if not provided
+func (h *StatsHandler) parseDateRange(c *fiber.Ctx) (startDate, endDate string) {
+	today := h.clock.Today().Format("2006-01-02")
 	startDate = c.Query("start_date", today)
 	endDate = c.Query("end_date", today)
 	return startDate, endDate
 }
 
+// shopFilter limits a stats query to the caller's shops. It returns the
+// condition to AND into the WHERE clause (bound as the next argument) and
+// the extended arguments; unrestricted callers get TRUE.
+func shopFilter(c *fiber.Ctx, column string, args ...any) (string, []any) {
+	scope := service.ShopScopeFromContext(c.Context())
+	if scope.All() {
+		return "TRUE", args
+	}
+	args = append(args, pq.Array(scope.ShopIDs()))
+	return fmt.Sprintf("%s = ANY($%d)", column, len(args)), args
+}
+
+// orderShopFilter limits a stats query over orders to the caller's shops.
+// Split orders have no orders.shop_id, so an order is in scope when any of
+// its lines is. Besides the condition it returns a join giving share.ratio,
+// the part of each order's total made up by the caller's lines, so a shop is
+// only credited with its own lines' revenue. Unrestricted callers get TRUE
+// and the whole order.
+func orderShopFilter(c *fiber.Ctx, args ...any) (string, string, []any) {
+	scope := service.ShopScopeFromContext(c.Context())
+	if scope.All() {
+		return "TRUE", "CROSS JOIN (SELECT 1 AS ratio) share", args
+	}
+	args = append(args, pq.Array(scope.ShopIDs()))
+	n := len(args)
+	cond := fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM order_items oi
+			WHERE oi.order_id = orders.id AND oi.business_date = orders.business_date AND oi.shop_id = ANY($%d)
+		)`, n)
+	join := fmt.Sprintf(`LEFT JOIN LATERAL (
+			SELECT COALESCE(SUM(oi.price * oi.quantity) / NULLIF(orders.total_amount, 0), 0) AS ratio
+			FROM order_items oi
+			WHERE oi.order_id = orders.id AND oi.business_date = orders.business_date AND oi.shop_id = ANY($%d)
+		) share ON TRUE`, n)
+	return cond, join, args
+}
+
 // GetStats handles GET /api/v1/admin/stats?start_date=YYYY-MM-DD&end_date=YYYY-MM-DD
 func (h *StatsHandler) GetStats(c *fiber.Ctx) error {
-	startDate, endDate := parseDateRange(c)
+	startDate, endDate := h.parseDateRange(c)
 
 	var stats struct {
 		TotalOrders           int     `db:"total_orders"`
 		TotalRevenue          float64 `db:"total_revenue"`
 		PendingOrders         int     `db:"pending_orders"`
 		QueueLength           int     `db:"queue_length"`
+		ReadyOrders           int     `db:"ready_orders"`
 		CompletedOrders       int     `db:"completed_orders"`
 		CancelledOrders       int     `db:"cancelled_orders"`
 		AvgCompletionTimeMins float64 `db:"avg_completion_time_mins"`
+		AvgPrepTimeMins       float64 `db:"avg_prep_time_mins"`
+		AvgPickupWaitMins     float64 `db:"avg_pickup_wait_mins"`
 		PromptPayRevenue      float64 `db:"promptpay_revenue"`
 		CashRevenue           float64 `db:"cash_revenue"`
 		PromptPayCount        int     `db:"promptpay_count"`
 		CashCount             int     `db:"cash_count"`
+		RefundedOrders        int     `db:"refunded_orders"`
+		RefundTotal           float64 `db:"refund_total"`
 	}
 
+	// Revenue and the cash/PromptPay split come from the payments ledger, so
+	// an order paid partly in cash and partly by PromptPay counts towards
+	// both and the split always adds up to the total. Revenue is net of
+	// refunds, each taken off the method it was given back with; a fully
+	// refunded order adds nothing. A shop-scoped caller gets its share of
+	// the money of orders split with other shops.
+	shopCond, shareJoin, args := orderShopFilter(c, startDate, endDate)
 	query := `
 		SELECT
-			COUNT(*) FILTER (WHERE created_at::date >= $1 AND created_at::date <= $2) AS total_orders,
-			COALESCE(SUM(total_amount) FILTER (WHERE created_at::date >= $1 AND created_at::date <= $2 AND status IN ('PAID', 'COMPLETED')), 0) AS total_revenue,
-			COUNT(*) FILTER (WHERE status = 'PENDING_PAYMENT' AND created_at::date >= $1 AND created_at::date <= $2) AS pending_orders,
-			COUNT(*) FILTER (WHERE status = 'PAID' AND created_at::date >= $1 AND created_at::date <= $2) AS queue_length,
-			COUNT(*) FILTER (WHERE status = 'COMPLETED' AND created_at::date >= $1 AND created_at::date <= $2) AS completed_orders,
-			COUNT(*) FILTER (WHERE status = 'CANCELLED' AND created_at::date >= $1 AND created_at::date <= $2) AS cancelled_orders,
-			COALESCE(AVG(EXTRACT(EPOCH FROM (completed_at - paid_at)) / 60) FILTER (WHERE completed_at IS NOT NULL AND paid_at IS NOT NULL AND created_at::date >= $1 AND created_at::date <= $2), 0) AS avg_completion_time_mins,
-			COALESCE(SUM(total_amount) FILTER (WHERE created_at::date >= $1 AND created_at::date <= $2 AND status IN ('PAID', 'COMPLETED') AND payment_method = 'PROMPTPAY'), 0) AS promptpay_revenue,
-			COALESCE(SUM(total_amount) FILTER (WHERE created_at::date >= $1 AND created_at::date <= $2 AND status IN ('PAID', 'COMPLETED') AND payment_method = 'CASH'), 0) AS cash_revenue,
-			COUNT(*) FILTER (WHERE created_at::date >= $1 AND created_at::date <= $2 AND status IN ('PAID', 'COMPLETED') AND payment_method = 'PROMPTPAY') AS promptpay_count,
-			COUNT(*) FILTER (WHERE created_at::date >= $1 AND created_at::date <= $2 AND status IN ('PAID', 'COMPLETED') AND payment_method = 'CASH') AS cash_count
+			COUNT(*) FILTER (WHERE business_date >= $1 AND business_date <= $2) AS total_orders,
+			COALESCE(ROUND(SUM((COALESCE(ledger.total, 0) - COALESCE(refunded.total, 0)) * share.ratio) FILTER (WHERE business_date >= $1 AND business_date <= $2 AND status IN ('PAID', 'READY', 'COMPLETED', 'REFUNDED')), 2), 0) AS total_revenue,
+			COUNT(*) FILTER (WHERE status = 'PENDING_PAYMENT' AND business_date >= $1 AND business_date <= $2) AS pending_orders,
+			COUNT(*) FILTER (WHERE status = 'PAID' AND business_date >= $1 AND business_date <= $2) AS queue_length,
+			COUNT(*) FILTER (WHERE status = 'READY' AND business_date >= $1 AND business_date <= $2) AS ready_orders,
+			COUNT(*) FILTER (WHERE status = 'COMPLETED' AND business_date >= $1 AND business_date <= $2) AS completed_orders,
+			COUNT(*) FILTER (WHERE status = 'CANCELLED' AND business_date >= $1 AND business_date <= $2) AS cancelled_orders,
+			COALESCE(AVG(EXTRACT(EPOCH FROM (completed_at - paid_at)) / 60) FILTER (WHERE completed_at IS NOT NULL AND paid_at IS NOT NULL AND business_date >= $1 AND business_date <= $2), 0) AS avg_completion_time_mins,
+			COALESCE(AVG(EXTRACT(EPOCH FROM (ready_at - paid_at)) / 60) FILTER (WHERE ready_at IS NOT NULL AND paid_at IS NOT NULL AND business_date >= $1 AND business_date <= $2), 0) AS avg_prep_time_mins,
+			COALESCE(AVG(EXTRACT(EPOCH FROM (completed_at - ready_at)) / 60) FILTER (WHERE completed_at IS NOT NULL AND ready_at IS NOT NULL AND business_date >= $1 AND business_date <= $2), 0) AS avg_pickup_wait_mins,
+			COALESCE(ROUND(SUM((COALESCE(ledger.promptpay, 0) - COALESCE(refunded.promptpay, 0)) * share.ratio) FILTER (WHERE business_date >= $1 AND business_date <= $2 AND status IN ('PAID', 'READY', 'COMPLETED', 'REFUNDED')), 2), 0) AS promptpay_revenue,
+			COALESCE(ROUND(SUM((COALESCE(ledger.cash, 0) - COALESCE(refunded.cash, 0)) * share.ratio) FILTER (WHERE business_date >= $1 AND business_date <= $2 AND status IN ('PAID', 'READY', 'COMPLETED', 'REFUNDED')), 2), 0) AS cash_revenue,
+			COUNT(*) FILTER (WHERE business_date >= $1 AND business_date <= $2 AND status IN ('PAID', 'READY', 'COMPLETED') AND ledger.promptpay > 0) AS promptpay_count,
+			COUNT(*) FILTER (WHERE business_date >= $1 AND business_date <= $2 AND status IN ('PAID', 'READY', 'COMPLETED') AND ledger.cash > 0) AS cash_count,
+			COUNT(*) FILTER (WHERE status = 'REFUNDED' AND business_date >= $1 AND business_date <= $2) AS refunded_orders,
+			COALESCE(ROUND(SUM(refunded.total * share.ratio) FILTER (WHERE business_date >= $1 AND business_date <= $2), 2), 0) AS refund_total
 		FROM orders
+		` + shareJoin + `
+		LEFT JOIN LATERAL (
+			SELECT
+				SUM(p.amount) AS total,
+				SUM(p.amount) FILTER (WHERE p.method = 'PROMPTPAY') AS promptpay,
+				SUM(p.amount) FILTER (WHERE p.method = 'CASH') AS cash
+			FROM payments p
+			WHERE p.order_id = orders.id AND p.business_date = orders.business_date
+		) ledger ON TRUE
+		LEFT JOIN LATERAL (
+			SELECT
+				SUM(r.amount) AS total,
+				SUM(r.amount) FILTER (WHERE r.method = 'PROMPTPAY') AS promptpay,
+				SUM(r.amount) FILTER (WHERE r.method = 'CASH') AS cash
+			FROM refunds r
+			WHERE r.order_id = orders.id AND r.business_date = orders.business_date
+		) refunded ON TRUE
+		WHERE ` + shopCond + `
 	`
 
-	err := h.db.GetContext(c.Context(), &stats, query, startDate, endDate)
+	err := h.db.GetContext(c.Context(), &stats, query, args...)
 	if err != nil {
 		log.Error().Err(err).Str("start_date", startDate).Str("end_date", endDate).Msg("Failed to get stats")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get stats",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 
 	return c.JSON(fiber.Map{
@@ -74,13 +148,18 @@ func (h *StatsHandler) GetStats(c *fiber.Ctx) error {
 		"total_revenue":            stats.TotalRevenue,
 		"pending_orders":           stats.PendingOrders,
 		"queue_length":             stats.QueueLength,
+		"ready_orders":             stats.ReadyOrders,
 		"completed_orders":         stats.CompletedOrders,
 		"cancelled_orders":         stats.CancelledOrders,
 		"avg_completion_time_mins": stats.AvgCompletionTimeMins,
+		"avg_prep_time_mins":       stats.AvgPrepTimeMins,
+		"avg_pickup_wait_mins":     stats.AvgPickupWaitMins,
 		"promptpay_revenue":        stats.PromptPayRevenue,
 		"cash_revenue":             stats.CashRevenue,
 		"promptpay_count":          stats.PromptPayCount,
 		"cash_count":               stats.CashCount,
+		"refunded_orders":          stats.RefundedOrders,
+		"refund_total":             stats.RefundTotal,
 		"start_date":               startDate,
 		"end_date":                 endDate,
 	})
@@ -88,26 +167,34 @@ func (h *StatsHandler) GetStats(c *fiber.Ctx) error {
 
 // GetOrdersByHour handles GET /api/v1/admin/stats/orders-by-hour?start_date=YYYY-MM-DD&end_date=YYYY-MM-DD
 func (h *StatsHandler) GetOrdersByHour(c *fiber.Ctx) error {
-	startDate, endDate := parseDateRange(c)
+	startDate, endDate := h.parseDateRange(c)
 
+	// created_at is stored in UTC; report hours in the business timezone
+	shopCond, shareJoin, args := orderShopFilter(c, startDate, endDate, h.clock.Location().String())
 	query := `
 		SELECT
-			EXTRACT(HOUR FROM created_at)::int AS hour,
+			EXTRACT(HOUR FROM created_at AT TIME ZONE 'UTC' AT TIME ZONE $3)::int AS hour,
 			COUNT(*) AS count,
-			COALESCE(SUM(total_amount) FILTER (WHERE status IN ('PAID', 'COMPLETED')), 0) AS revenue
+			COALESCE(ROUND(SUM((COALESCE(ledger.total, 0) - COALESCE(refunded.total, 0)) * share.ratio) FILTER (WHERE status IN ('PAID', 'READY', 'COMPLETED', 'REFUNDED')), 2), 0) AS revenue
 		FROM orders
-		WHERE created_at::date >= $1 AND created_at::date <= $2
-		GROUP BY EXTRACT(HOUR FROM created_at)
+		` + shareJoin + `
+		LEFT JOIN LATERAL (
+			SELECT SUM(p.amount) AS total FROM payments p
+			WHERE p.order_id = orders.id AND p.business_date = orders.business_date
+		) ledger ON TRUE
+		LEFT JOIN LATERAL (
+			SELECT SUM(r.amount) AS total FROM refunds r
+			WHERE r.order_id = orders.id AND r.business_date = orders.business_date
+		) refunded ON TRUE
+		WHERE business_date >= $1 AND business_date <= $2 AND ` + shopCond + `
+		GROUP BY 1
 		ORDER BY hour
 	`
 
-	rows, err := h.db.QueryxContext(c.Context(), query, startDate, endDate)
+	rows, err := h.db.QueryxContext(c.Context(), query, args...)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get orders by hour")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get orders by hour",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 	defer rows.Close()
 
@@ -134,35 +221,44 @@ func (h *StatsHandler) GetOrdersByHour(c *fiber.Ctx) error {
 }
 
 // GetPopularItems handles GET /api/v1/admin/stats/popular-items?start_date=YYYY-MM-DD&end_date=YYYY-MM-DD
+// Each item lists how often each of its modifiers was picked.
 func (h *StatsHandler) GetPopularItems(c *fiber.Ctx) error {
-	startDate, endDate := parseDateRange(c)
+	startDate, endDate := h.parseDateRange(c)
 
+	// Refunded items are not counted as sold. Items sold in a bundle count
+	// too, with the revenue staying with the bundle; they are refunded with
+	// their bundle line.
+	shopCond, args := shopFilter(c, "oi.shop_id", startDate, endDate)
 	query := `
 		SELECT
 			oi.menu_item_id,
 			oi.name,
-			SUM(oi.quantity)::int AS quantity_sold,
-			SUM(oi.price * oi.quantity) AS revenue
+			SUM(oi.quantity - COALESCE(refunded.quantity, 0))::int AS quantity_sold,
+			SUM(oi.price * (oi.quantity - COALESCE(refunded.quantity, 0))) AS revenue
 		FROM order_items oi
-		JOIN orders o ON o.id = oi.order_id
-		WHERE o.created_at::date >= $1 AND o.created_at::date <= $2
-			AND o.status IN ('PAID', 'COMPLETED')
+		JOIN orders o ON o.id = oi.order_id AND o.business_date = oi.business_date
+		LEFT JOIN order_items bundle ON bundle.id = oi.bundle_item_id
+		LEFT JOIN LATERAL (
+			SELECT SUM(ri.quantity) * oi.quantity / COALESCE(bundle.quantity, oi.quantity) AS quantity
+			FROM refund_items ri WHERE ri.order_item_id = COALESCE(oi.bundle_item_id, oi.id)
+		) refunded ON TRUE
+		WHERE o.business_date >= $1 AND o.business_date <= $2
+			AND o.status IN ('PAID', 'READY', 'COMPLETED')
+			AND ` + shopCond + `
 		GROUP BY oi.menu_item_id, oi.name
 		ORDER BY quantity_sold DESC
 		LIMIT 10
 	`
 
-	rows, err := h.db.QueryxContext(c.Context(), query, startDate, endDate)
+	rows, err := h.db.QueryxContext(c.Context(), query, args...)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get popular items")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get popular items",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 	defer rows.Close()
 
 	var results []fiber.Map
+	var menuItemIDs []int
 	for rows.Next() {
 		var menuItemID, quantitySold int
 		var name string
@@ -176,11 +272,63 @@ func (h *StatsHandler) GetPopularItems(c *fiber.Ctx) error {
 			"name":          name,
 			"quantity_sold": quantitySold,
 			"revenue":       revenue,
+			"modifiers":     []fiber.Map{},
 		})
+		menuItemIDs = append(menuItemIDs, menuItemID)
 	}
 
 	if results == nil {
-		results = []fiber.Map{}
+		return c.JSON([]fiber.Map{})
+	}
+
+	// How often each modifier was picked with the items listed
+	modifierCond, modifierArgs := shopFilter(c, "oi.shop_id", startDate, endDate, pq.Array(menuItemIDs))
+	modifierQuery := `
+		SELECT
+			oi.menu_item_id,
+			m.group_name,
+			m.name,
+			SUM(oi.quantity - COALESCE(refunded.quantity, 0))::int AS quantity_sold,
+			SUM(m.price_delta * (oi.quantity - COALESCE(refunded.quantity, 0))) AS revenue
+		FROM order_item_modifiers m
+		JOIN order_items oi ON oi.id = m.order_item_id
+		JOIN orders o ON o.id = oi.order_id AND o.business_date = oi.business_date
+		LEFT JOIN LATERAL (
+			SELECT SUM(ri.quantity) AS quantity FROM refund_items ri WHERE ri.order_item_id = oi.id
+		) refunded ON TRUE
+		WHERE o.business_date >= $1 AND o.business_date <= $2
+			AND o.status IN ('PAID', 'READY', 'COMPLETED')
+			AND oi.menu_item_id = ANY($3)
+			AND ` + modifierCond + `
+		GROUP BY oi.menu_item_id, m.group_name, m.name
+		ORDER BY quantity_sold DESC
+	`
+
+	modifierRows, err := h.db.QueryxContext(c.Context(), modifierQuery, modifierArgs...)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get popular modifiers")
+		return err
+	}
+	defer modifierRows.Close()
+
+	for modifierRows.Next() {
+		var menuItemID, quantitySold int
+		var group, name string
+		var revenue float64
+		if err := modifierRows.Scan(&menuItemID, &group, &name, &quantitySold, &revenue); err != nil {
+			log.Error().Err(err).Msg("Failed to scan row")
+			continue
+		}
+		for _, result := range results {
+			if result["menu_item_id"] == menuItemID {
+				result["modifiers"] = append(result["modifiers"].([]fiber.Map), fiber.Map{
+					"group":         group,
+					"name":          name,
+					"quantity_sold": quantitySold,
+					"revenue":       revenue,
+				})
+			}
+		}
 	}
 
 	return c.JSON(results)
@@ -188,29 +336,36 @@ func (h *StatsHandler) GetPopularItems(c *fiber.Ctx) error {
 
 // GetDailyBreakdown handles GET /api/v1/admin/stats/daily-breakdown?start_date=YYYY-MM-DD&end_date=YYYY-MM-DD
 func (h *StatsHandler) GetDailyBreakdown(c *fiber.Ctx) error {
-	startDate, endDate := parseDateRange(c)
+	startDate, endDate := h.parseDateRange(c)
 
+	shopCond, shareJoin, args := orderShopFilter(c, startDate, endDate)
 	query := `
 		SELECT
-			created_at::date AS date,
+			business_date AS date,
 			COUNT(*) AS total_orders,
-			COALESCE(SUM(total_amount) FILTER (WHERE status IN ('PAID', 'COMPLETED')), 0) AS revenue,
+			COALESCE(ROUND(SUM((COALESCE(ledger.total, 0) - COALESCE(refunded.total, 0)) * share.ratio) FILTER (WHERE status IN ('PAID', 'READY', 'COMPLETED', 'REFUNDED')), 2), 0) AS revenue,
 			COUNT(*) FILTER (WHERE status = 'COMPLETED') AS completed,
 			COUNT(*) FILTER (WHERE status = 'CANCELLED') AS cancelled,
 			COALESCE(AVG(EXTRACT(EPOCH FROM (completed_at - paid_at)) / 60) FILTER (WHERE completed_at IS NOT NULL AND paid_at IS NOT NULL), 0) AS avg_completion_mins
 		FROM orders
-		WHERE created_at::date >= $1 AND created_at::date <= $2
-		GROUP BY created_at::date
+		` + shareJoin + `
+		LEFT JOIN LATERAL (
+			SELECT SUM(p.amount) AS total FROM payments p
+			WHERE p.order_id = orders.id AND p.business_date = orders.business_date
+		) ledger ON TRUE
+		LEFT JOIN LATERAL (
+			SELECT SUM(r.amount) AS total FROM refunds r
+			WHERE r.order_id = orders.id AND r.business_date = orders.business_date
+		) refunded ON TRUE
+		WHERE business_date >= $1 AND business_date <= $2 AND ` + shopCond + `
+		GROUP BY business_date
 		ORDER BY date
 	`
 
-	rows, err := h.db.QueryxContext(c.Context(), query, startDate, endDate)
+	rows, err := h.db.QueryxContext(c.Context(), query, args...)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get daily breakdown")
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get daily breakdown",
-			"code":  "INTERNAL_ERROR",
-		})
+		return err
 	}
 	defer rows.Close()
 
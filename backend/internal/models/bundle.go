@@ -0,0 +1,63 @@
+package models
+
+// BundleSlot is one part of a bundle (set meal), such as its main or its
+// drink. One of its options is picked per bundle, Quantity times; a slot
+// with a single option is a fixed part of the bundle.
+type BundleSlot struct {
+	ID       int            `json:"id" db:"id"`
+	BundleID int            `json:"bundle_id" db:"bundle_id"`
+	Name     string         `json:"name" db:"name"`
+	Quantity int            `json:"quantity" db:"quantity"`
+	Options  []BundleOption `json:"options" db:"-"`
+}
+
+// BundleOption is a menu item that can fill a bundle slot, for PriceDelta
+// on top of the bundle price. Name, Available, ShopID and Category are
+// those of the menu item and are ignored when the bundle is saved.
+type BundleOption struct {
+	SlotID     int     `json:"-" db:"slot_id"`
+	MenuItemID int     `json:"menu_item_id" db:"menu_item_id"`
+	Name       string  `json:"name" db:"name"`
+	PriceDelta float64 `json:"price_delta" db:"price_delta"`
+	Available  bool    `json:"available" db:"available"`
+	ShopID     *int    `json:"shop_id,omitempty" db:"shop_id"`
+	Category   *string `json:"category,omitempty" db:"category"`
+}
+
+// BundleChoice picks the menu item for a slot of a bundle ordered
+type BundleChoice struct {
+	SlotID     int `json:"slot_id"`
+	MenuItemID int `json:"menu_item_id"`
+}
+
+// IsBundle reports whether the item is a bundle of other menu items
+func (m *MenuItem) IsBundle() bool {
+	return len(m.BundleSlots) > 0
+}
+
+// PreparedItems lists the lines the shops prepare: bundle lines are
+// replaced by their components
+func (o *Order) PreparedItems() []OrderItem {
+	var items []OrderItem
+	for _, item := range o.Items {
+		if len(item.Components) > 0 {
+			items = append(items, item.Components...)
+		} else {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// FindOption returns the option of the bundle for the given menu item, or
+// nil when no slot offers it
+func (m *MenuItem) FindOption(menuItemID int) *BundleOption {
+	for i := range m.BundleSlots {
+		for j := range m.BundleSlots[i].Options {
+			if m.BundleSlots[i].Options[j].MenuItemID == menuItemID {
+				return &m.BundleSlots[i].Options[j]
+			}
+		}
+	}
+	return nil
+}
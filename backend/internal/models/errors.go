@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Domain errors. Repositories wrap these (with %w) so callers can match them
+// with errors.Is instead of comparing messages; the service package
+// re-exports them for handlers.
+var (
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrMenuItemNotFound = errors.New("menu item not found")
+	ErrShopNotFound     = errors.New("shop not found")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrValidation       = errors.New("validation failed")
+	ErrDuplicate        = errors.New("already exists")
+	ErrConflict         = errors.New("conflicts with existing data")
+	ErrForbidden        = errors.New("not allowed")
+
+	// No PromptPay account is set for the order's shop or the server
+	ErrPromptPayNotConfigured = errors.New("no PromptPay account configured")
+	// The payment provider doesn't know the transaction reference given
+	ErrPaymentNotVerified = errors.New("payment could not be verified")
+
+	// Inventory ingredient that doesn't exist (or belongs to another shop)
+	ErrIngredientNotFound = errors.New("ingredient not found")
+
+	// Idempotency-Key reused for a different request, or retried while the
+	// first request with it is still running
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+	ErrRequestInProgress    = errors.New("a request with this idempotency key is in progress")
+)
+
+// FieldError describes one invalid field in a request. Message is a complete
+// sentence so it can be shown on its own.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request. It matches
+// ErrValidation with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// NewValidationError creates a validation error for a single field
+func NewValidationError(field, message string) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: message}}}
+}
+
+// Add records another invalid field
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// HasErrors reports whether any field was recorded
+func (e *ValidationError) HasErrors() bool {
+	return len(e.Fields) > 0
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+	return ErrValidation.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
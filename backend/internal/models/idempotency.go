@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is a request made with an Idempotency-Key header: a
+// fingerprint of the request and, once it has succeeded, its response.
+type IdempotencyRecord struct {
+	Key         string    `db:"key"`
+	Fingerprint string    `db:"fingerprint"`
+	StatusCode  *int      `db:"status_code"` // nil while the first request is running
+	Response    []byte    `db:"response"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// Completed reports whether the response has been stored
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != nil
+}
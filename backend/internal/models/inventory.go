@@ -0,0 +1,188 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ingredient is stock shared by the menu items whose recipes use it, such
+// as potatoes or cups, counted in Unit
+type Ingredient struct {
+	ID                int       `json:"id" db:"id"`
+	Name              string    `json:"name" db:"name"`
+	Unit              string    `json:"unit" db:"unit"`
+	ShopID            *int      `json:"shop_id,omitempty" db:"shop_id"`
+	Stock             float64   `json:"stock" db:"stock"`
+	LowStockThreshold *float64  `json:"low_stock_threshold,omitempty" db:"low_stock_threshold"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RecipeItem is how much of an ingredient one of a menu item uses. Name and
+// Unit are those of the ingredient and are ignored when the recipe is set.
+type RecipeItem struct {
+	MenuItemID   int     `json:"-" db:"menu_item_id"`
+	IngredientID int     `json:"ingredient_id" db:"ingredient_id"`
+	Name         string  `json:"name,omitempty" db:"name"`
+	Unit         string  `json:"unit,omitempty" db:"unit"`
+	Quantity     float64 `json:"quantity" db:"quantity"`
+}
+
+// ItemStockRequest sets the stock of a menu item
+type ItemStockRequest struct {
+	Stock             *int         `json:"stock"` // null stops tracking the item's own stock
+	LowStockThreshold *int         `json:"low_stock_threshold"`
+	Recipe            []RecipeItem `json:"recipe"` // left out keeps the recipe, empty removes it
+}
+
+// Inventory lists the stock of the tracked menu items and the ingredients
+type Inventory struct {
+	Items       []ItemStock       `json:"items"`
+	Ingredients []IngredientStock `json:"ingredients"`
+}
+
+// ItemStock is the stock of a menu item that is tracked itself or through
+// its recipe. Reserved is held by unpaid orders; Remaining is what can
+// still be ordered and is nil when only the recipe is tracked.
+type ItemStock struct {
+	MenuItemID        int          `json:"menu_item_id" db:"menu_item_id"`
+	Name              string       `json:"name" db:"name"`
+	ShopID            *int         `json:"shop_id,omitempty" db:"shop_id"`
+	Available         bool         `json:"available" db:"available"`
+	Stock             *int         `json:"stock" db:"stock"`
+	LowStockThreshold *int         `json:"low_stock_threshold,omitempty" db:"low_stock_threshold"`
+	SoldOutAt         *time.Time   `json:"sold_out_at,omitempty" db:"sold_out_at"`
+	Reserved          int          `json:"reserved" db:"reserved"`
+	Remaining         *int         `json:"remaining" db:"-"`
+	LowStock          bool         `json:"low_stock" db:"-"`
+	Recipe            []RecipeItem `json:"recipe,omitempty" db:"-"`
+}
+
+// IngredientStock is the stock of an ingredient, with what unpaid orders
+// hold of it
+type IngredientStock struct {
+	Ingredient
+	Reserved  float64 `json:"reserved" db:"reserved"`
+	Remaining float64 `json:"remaining" db:"-"`
+	LowStock  bool    `json:"low_stock" db:"-"`
+}
+
+// StockLimits is what is left to order of the menu items on an order: the
+// remaining stock of those that are tracked, and of the ingredients in
+// their recipes
+type StockLimits struct {
+	Items       map[int]int          // by menu item ID
+	Ingredients map[int]float64      // by ingredient ID
+	Recipes     map[int][]RecipeItem // by menu item ID
+}
+
+// StockShortage is an order line needing more of a menu item, or of an
+// ingredient in its recipe, than is left
+type StockShortage struct {
+	ItemIndex  int
+	MenuItemID int
+}
+
+// StockError is returned for an order needing more than is left in stock. It
+// is handled like any other invalid order: it unwraps to a *ValidationError
+// reporting each short line as items[i].quantity.
+type StockError struct {
+	*ValidationError
+	Shortages []StockShortage
+}
+
+func (e *StockError) Unwrap() error {
+	return e.ValidationError
+}
+
+// Check checks there is enough left for the given order lines, bundle
+// components included. Shortages are reported on the first line that needs
+// the item or ingredient, as a *StockError.
+func (l *StockLimits) Check(items []OrderItem) error {
+	// What the order needs of each menu item, and the first line needing it
+	demand := make(map[int]int)
+	firstLine := make(map[int]int)
+	names := make(map[int]string)
+	var menuItemIDs []int
+	need := func(line int, item OrderItem) {
+		if _, ok := demand[item.MenuItemID]; !ok {
+			firstLine[item.MenuItemID] = line
+			menuItemIDs = append(menuItemIDs, item.MenuItemID)
+		}
+		demand[item.MenuItemID] += item.Quantity
+		if names[item.MenuItemID] == "" {
+			names[item.MenuItemID] = item.Name
+		}
+	}
+	for i, item := range items {
+		need(i, item)
+		for _, component := range item.Components {
+			need(i, component)
+		}
+	}
+
+	stockErr := &StockError{ValidationError: &ValidationError{}}
+	short := func(line, menuItemID int, message string) {
+		stockErr.Add(fmt.Sprintf("items[%d].quantity", line), message)
+		shortage := StockShortage{ItemIndex: line, MenuItemID: menuItemID}
+		for _, s := range stockErr.Shortages {
+			if s == shortage {
+				return
+			}
+		}
+		stockErr.Shortages = append(stockErr.Shortages, shortage)
+	}
+
+	ingredientDemand := make(map[int]int64) // in hundredths, like the stock
+	ingredientNeededBy := make(map[int]int) // the first menu item needing it
+	var ingredients []RecipeItem
+	for _, menuItemID := range menuItemIDs {
+		line := firstLine[menuItemID]
+		if remaining, ok := l.Items[menuItemID]; ok && demand[menuItemID] > remaining {
+			message := fmt.Sprintf("item %d: only %d left", line, max(remaining, 0))
+			if name := names[menuItemID]; name != "" {
+				message = fmt.Sprintf("item %d: only %d of %s left", line, max(remaining, 0), name)
+			}
+			short(line, menuItemID, message)
+		}
+
+		for _, recipeItem := range l.Recipes[menuItemID] {
+			if _, ok := ingredientDemand[recipeItem.IngredientID]; !ok {
+				ingredientNeededBy[recipeItem.IngredientID] = menuItemID
+				ingredients = append(ingredients, recipeItem)
+			}
+			ingredientDemand[recipeItem.IngredientID] += int64(demand[menuItemID]) * ToCents(recipeItem.Quantity)
+		}
+	}
+	for _, ingredient := range ingredients {
+		if ingredientDemand[ingredient.IngredientID] > ToCents(l.Ingredients[ingredient.IngredientID]) {
+			menuItemID := ingredientNeededBy[ingredient.IngredientID]
+			line := firstLine[menuItemID]
+			short(line, menuItemID, fmt.Sprintf("item %d: not enough %s left", line, ingredient.Name))
+		}
+	}
+
+	if stockErr.HasErrors() {
+		return stockErr
+	}
+	return nil
+}
+
+// Tally works out what remains and whether it is running low. Stock at or
+// below the threshold is low.
+func (s *ItemStock) Tally() {
+	s.Remaining, s.LowStock = nil, false
+	if s.Stock == nil {
+		return
+	}
+	remaining := max(*s.Stock-s.Reserved, 0)
+	s.Remaining = &remaining
+	s.LowStock = s.LowStockThreshold != nil && remaining <= *s.LowStockThreshold
+}
+
+// Tally works out what remains and whether it is running low. Stock at or
+// below the threshold is low.
+func (s *IngredientStock) Tally() {
+	s.Remaining = float64(max(ToCents(s.Stock)-ToCents(s.Reserved), 0)) / 100
+	s.LowStock = s.LowStockThreshold != nil && ToCents(s.Remaining) <= ToCents(*s.LowStockThreshold)
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStockLimits_Check(t *testing.T) {
+	potatoes := []RecipeItem{{IngredientID: 1, Name: "Potatoes", Unit: "kg", Quantity: 0.25}}
+
+	tests := []struct {
+		name      string
+		items     []OrderItem
+		limits    *StockLimits
+		wantField string
+		wantMsg   string
+		shortage  StockShortage
+	}{
+		{
+			name:   "Enough left",
+			items:  []OrderItem{{MenuItemID: 1, Quantity: 3}},
+			limits: &StockLimits{Items: map[int]int{1: 3}},
+		},
+		{
+			name:   "Orders within the stock left are taken",
+			items:  []OrderItem{{MenuItemID: 1, Name: "French Fries S", Quantity: 3}},
+			limits: &StockLimits{Items: map[int]int{1: 3}},
+		},
+		{
+			name:      "Orders for more are refused",
+			items:     []OrderItem{{MenuItemID: 1, Name: "French Fries S", Quantity: 3}},
+			limits:    &StockLimits{Items: map[int]int{1: 2}},
+			wantField: "items[0].quantity",
+			wantMsg:   "item 0: only 2 of French Fries S left",
+			shortage:  StockShortage{ItemIndex: 0, MenuItemID: 1},
+		},
+		{
+			name:      "Held by more than is in stock",
+			items:     []OrderItem{{MenuItemID: 1, Quantity: 1}},
+			limits:    &StockLimits{Items: map[int]int{1: -2}},
+			wantField: "items[0].quantity",
+			wantMsg:   "item 0: only 0 left",
+			shortage:  StockShortage{ItemIndex: 0, MenuItemID: 1},
+		},
+		{
+			name:   "Untracked items are not limited",
+			items:  []OrderItem{{MenuItemID: 1, Quantity: 100}},
+			limits: &StockLimits{},
+		},
+		{
+			name:      "More than is left",
+			items:     []OrderItem{{MenuItemID: 7, Quantity: 1}, {MenuItemID: 1, Quantity: 4}},
+			limits:    &StockLimits{Items: map[int]int{1: 3}},
+			wantField: "items[1].quantity",
+			wantMsg:   "item 1: only 3 left",
+			shortage:  StockShortage{ItemIndex: 1, MenuItemID: 1},
+		},
+		{
+			name:      "Lines of the same item add up",
+			items:     []OrderItem{{MenuItemID: 1, Quantity: 2}, {MenuItemID: 1, Quantity: 2}},
+			limits:    &StockLimits{Items: map[int]int{1: 3}},
+			wantField: "items[0].quantity",
+			wantMsg:   "item 0: only 3 left",
+			shortage:  StockShortage{ItemIndex: 0, MenuItemID: 1},
+		},
+		{
+			name: "Bundle components count",
+			items: []OrderItem{{MenuItemID: 20, Quantity: 2, Components: []OrderItem{
+				{MenuItemID: 2, Name: "French Fries M", Quantity: 2},
+			}}},
+			limits:    &StockLimits{Items: map[int]int{2: 1}},
+			wantField: "items[0].quantity",
+			wantMsg:   "item 0: only 1 of French Fries M left",
+			shortage:  StockShortage{ItemIndex: 0, MenuItemID: 2},
+		},
+		{
+			name:  "Ingredients used by several items",
+			items: []OrderItem{{MenuItemID: 1, Quantity: 2}, {MenuItemID: 2, Quantity: 1}},
+			limits: &StockLimits{
+				Ingredients: map[int]float64{1: 1},
+				Recipes:     map[int][]RecipeItem{1: potatoes, 2: {{IngredientID: 1, Name: "Potatoes", Quantity: 0.5}}},
+			},
+		},
+		{
+			name:  "Not enough of an ingredient",
+			items: []OrderItem{{MenuItemID: 1, Quantity: 5}},
+			limits: &StockLimits{
+				Ingredients: map[int]float64{1: 1},
+				Recipes:     map[int][]RecipeItem{1: potatoes},
+			},
+			wantField: "items[0].quantity",
+			wantMsg:   "item 0: not enough Potatoes left",
+			shortage:  StockShortage{ItemIndex: 0, MenuItemID: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.Check(tt.items)
+
+			if tt.wantField == "" {
+				require.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrValidation)
+			var verr *ValidationError
+			require.ErrorAs(t, err, &verr)
+			assert.Equal(t, []FieldError{{Field: tt.wantField, Message: tt.wantMsg}}, verr.Fields)
+			var stockErr *StockError
+			require.ErrorAs(t, err, &stockErr)
+			assert.Equal(t, []StockShortage{tt.shortage}, stockErr.Shortages)
+		})
+	}
+}
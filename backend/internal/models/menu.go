@@ -8,8 +8,20 @@ type MenuItem struct {
 	Name      string    `json:"name" db:"name" validate:"required,min=2,max=100"`
 	Price     float64   `json:"price" db:"price" validate:"required,gt=0,lte=10000"`
 	Category  *string   `json:"category,omitempty" db:"category"`
+	ShopID    *int      `json:"shop_id,omitempty" db:"shop_id"`
 	ImageURL  *string   `json:"image_url,omitempty" db:"image_url"`
 	Available bool      `json:"available" db:"available"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// ModifierGroups are the choices offered with the item, in menu order.
+	// Left out of an update, the item keeps the groups it has.
+	ModifierGroups []ModifierGroup `json:"modifier_groups,omitempty" db:"-"`
+	// BundleSlots make the item a bundle of other menu items, sold at its
+	// price. Left out of an update, the item keeps the slots it has.
+	BundleSlots []BundleSlot `json:"bundle_slots,omitempty" db:"-"`
+	// Stock is how many are left when the item's stock is tracked. It and
+	// the threshold are set through the inventory, not menu updates.
+	Stock             *int       `json:"stock,omitempty" db:"stock"`
+	LowStockThreshold *int       `json:"low_stock_threshold,omitempty" db:"low_stock_threshold"`
+	SoldOutAt         *time.Time `json:"sold_out_at,omitempty" db:"sold_out_at"` // made unavailable by running out
 }
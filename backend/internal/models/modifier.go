@@ -0,0 +1,58 @@
+package models
+
+// ModifierGroup is a choice offered with a menu item, such as size or
+// toppings. At least MinSelect and at most MaxSelect of its modifiers are
+// picked per order line; a required group has MinSelect of at least one.
+type ModifierGroup struct {
+	ID         int        `json:"id" db:"id"`
+	MenuItemID int        `json:"menu_item_id" db:"menu_item_id"`
+	Name       string     `json:"name" db:"name"`
+	Required   bool       `json:"required" db:"required"`
+	MinSelect  int        `json:"min_select" db:"min_select"`
+	MaxSelect  int        `json:"max_select" db:"max_select"`
+	Modifiers  []Modifier `json:"modifiers" db:"-"`
+}
+
+// Modifier is one option of a modifier group. PriceDelta is added to the
+// item's price when it is picked and may be negative.
+type Modifier struct {
+	ID         int     `json:"id" db:"id"`
+	GroupID    int     `json:"group_id" db:"group_id"`
+	Name       string  `json:"name" db:"name"`
+	PriceDelta float64 `json:"price_delta" db:"price_delta"`
+	Available  bool    `json:"available" db:"available"`
+}
+
+// OrderItemModifier is a modifier picked on an order line. Only ModifierID
+// is needed in requests; the group, name and price are filled in from the
+// menu and kept as they were when the order was taken.
+type OrderItemModifier struct {
+	OrderItemID int     `json:"-" db:"order_item_id"`
+	ModifierID  int     `json:"modifier_id" db:"modifier_id"`
+	Group       string  `json:"group,omitempty" db:"group_name"`
+	Name        string  `json:"name,omitempty" db:"name"`
+	PriceDelta  float64 `json:"price_delta" db:"price_delta"`
+}
+
+// FindModifier returns the item's modifier with the given ID and the group
+// it belongs to, or nils when the item has no such modifier
+func (m *MenuItem) FindModifier(id int) (*ModifierGroup, *Modifier) {
+	for i := range m.ModifierGroups {
+		group := &m.ModifierGroups[i]
+		for j := range group.Modifiers {
+			if group.Modifiers[j].ID == id {
+				return group, &group.Modifiers[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// PriceWith is the unit price of the item with the given modifiers
+func (m *MenuItem) PriceWith(modifiers []OrderItemModifier) float64 {
+	cents := ToCents(m.Price)
+	for _, modifier := range modifiers {
+		cents += ToCents(modifier.PriceDelta)
+	}
+	return float64(cents) / 100
+}
@@ -11,6 +11,7 @@ const (
 	OrderStatusReady          OrderStatus = "READY"
 	OrderStatusCompleted      OrderStatus = "COMPLETED"
 	OrderStatusCancelled      OrderStatus = "CANCELLED"
+	OrderStatusRefunded       OrderStatus = "REFUNDED" // paid, then given back in full
 )
 
 // PaymentMethod represents the method used for payment
@@ -21,38 +22,159 @@ const (
 	PaymentMethodCash      PaymentMethod = "CASH"
 )
 
-// Order represents a customer order
+// Order represents a customer order.
+// Orders are unique on (BusinessDate, ID); ID is the DDMMXXX code called out
+// at the counter and repeats every year, so BusinessDate carries the year.
 type Order struct {
-	ID            string         `json:"id" db:"id" validate:"required,len=7"`
+	ID            string         `json:"id" db:"id" validate:"required,min=7,max=11"`
 	CustomerName  string         `json:"customer_name" db:"customer_name" validate:"required,min=2,max=50"`
 	Items         []OrderItem    `json:"items" validate:"required,min=1,dive"`
 	TotalAmount   float64        `json:"total_amount" db:"total_amount" validate:"required,gt=0"`
 	Status        OrderStatus    `json:"status" db:"status"`
 	DateKey       int            `json:"date_key" db:"date_key" validate:"required,min=101,max=3112"`
+	BusinessDate  time.Time      `json:"business_date" db:"business_date"`
 	QueueNumber   *int           `json:"queue_number,omitempty" db:"queue_number"`
 	PaymentMethod *PaymentMethod `json:"payment_method,omitempty" db:"payment_method"`
 	Category      *string        `json:"category,omitempty" db:"category"`
+	ShopID        *int           `json:"shop_id,omitempty" db:"shop_id"`
 	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
 	PaidAt        *time.Time     `json:"paid_at,omitempty" db:"paid_at"`
+	ReadyAt       *time.Time     `json:"ready_at,omitempty" db:"ready_at"`
 	CompletedAt   *time.Time     `json:"completed_at,omitempty" db:"completed_at"`
+	RefundedAt    *time.Time     `json:"refunded_at,omitempty" db:"refunded_at"`
+	ClientID      *string        `json:"client_id,omitempty" db:"client_id"` // tablet UUID of an order synced after being taken offline
+	// Tickets splits an order with items from several shops into one ticket
+	// per shop. Empty for single-shop orders.
+	Tickets []OrderTicket `json:"tickets,omitempty" db:"-"`
+	// Payments is the order's ledger; it is PAID once they cover TotalAmount
+	Payments []Payment `json:"payments,omitempty" db:"-"`
+	// Refunds gives back all or part of what was paid; the order is
+	// REFUNDED once every item has been refunded
+	Refunds []Refund `json:"refunds,omitempty" db:"-"`
+}
+
+// HasTickets reports whether the order is split into per-shop tickets
+func (o *Order) HasTickets() bool {
+	return len(o.Tickets) > 0
+}
+
+// StatusFromTickets is the status a split order reaches through its tickets:
+// READY once every ticket is ready or picked up, COMPLETED once every ticket
+// is picked up. Otherwise the order keeps its status.
+func (o *Order) StatusFromTickets() OrderStatus {
+	if !o.HasTickets() {
+		return o.Status
+	}
+	completed, done := 0, 0
+	for _, ticket := range o.Tickets {
+		switch ticket.Status {
+		case OrderStatusCompleted:
+			completed++
+			done++
+		case OrderStatusReady:
+			done++
+		}
+	}
+	switch {
+	case completed == len(o.Tickets):
+		return OrderStatusCompleted
+	case done == len(o.Tickets):
+		return OrderStatusReady
+	}
+	return o.Status
+}
+
+// TicketView returns one of the order's tickets as an order of that shop:
+// the same code and customer, with the ticket's items, subtotal, status and
+// queue number. Kitchen and pickup lists show split orders this way.
+func (o *Order) TicketView(ticket OrderTicket) Order {
+	total := 0.0
+	for _, item := range ticket.Items {
+		total += item.Price * float64(item.Quantity)
+	}
+	shopID := ticket.ShopID
+	return Order{
+		ID:            o.ID,
+		CustomerName:  o.CustomerName,
+		Items:         ticket.Items,
+		TotalAmount:   total,
+		Status:        ticket.Status,
+		DateKey:       o.DateKey,
+		BusinessDate:  o.BusinessDate,
+		QueueNumber:   ticket.QueueNumber,
+		PaymentMethod: o.PaymentMethod,
+		Category:      ticket.Category,
+		ShopID:        &shopID,
+		CreatedAt:     o.CreatedAt,
+		PaidAt:        o.PaidAt,
+		ReadyAt:       ticket.ReadyAt,
+		CompletedAt:   ticket.CompletedAt,
+	}
+}
+
+// OrderTicket is one shop's part of an order spanning several shops. It has
+// its own queue number and moves through PAID, READY and COMPLETED on its
+// own; payment and cancellation apply to the whole order.
+type OrderTicket struct {
+	OrderID      string      `json:"order_id" db:"order_id"`
+	BusinessDate time.Time   `json:"-" db:"business_date"`
+	ShopID       int         `json:"shop_id" db:"shop_id"`
+	Category     *string     `json:"category,omitempty" db:"category"`
+	Status       OrderStatus `json:"status" db:"status"`
+	QueueNumber  *int        `json:"queue_number,omitempty" db:"queue_number"`
+	CreatedAt    time.Time   `json:"created_at" db:"created_at"`
+	ReadyAt      *time.Time  `json:"ready_at,omitempty" db:"ready_at"`
+	CompletedAt  *time.Time  `json:"completed_at,omitempty" db:"completed_at"`
+	Items        []OrderItem `json:"items" db:"-"`
 }
 
 // OrderItem represents an item in an order
 type OrderItem struct {
-	ID         int     `json:"id,omitempty" db:"id"`
-	OrderID    string  `json:"order_id,omitempty" db:"order_id"`
-	MenuItemID int     `json:"menu_item_id" db:"menu_item_id" validate:"required"`
-	Name       string  `json:"name" db:"name" validate:"required"`
-	Price      float64 `json:"price" db:"price" validate:"required,gt=0"`
-	Quantity   int     `json:"quantity" db:"quantity" validate:"required,min=1,max=100"`
+	ID           int       `json:"id,omitempty" db:"id"`
+	OrderID      string    `json:"order_id,omitempty" db:"order_id"`
+	BusinessDate time.Time `json:"-" db:"business_date"`
+	MenuItemID   int       `json:"menu_item_id" db:"menu_item_id" validate:"required"`
+	Name         string    `json:"name" db:"name" validate:"required"`
+	Price        float64   `json:"price" db:"price" validate:"required,gt=0"`
+	Quantity     int       `json:"quantity" db:"quantity" validate:"required,min=1,max=100"`
+	ShopID       *int      `json:"shop_id,omitempty" db:"shop_id"`
+	// Modifiers are the choices picked for the line; Price includes them
+	Modifiers []OrderItemModifier `json:"modifiers,omitempty" db:"-"`
+	// A bundle line is ordered with Choices for its slots and holds a
+	// Components line (priced 0) for each menu item in the bundle. Its Price
+	// is the bundle price plus any option's price delta.
+	Choices      []BundleChoice `json:"choices,omitempty" db:"-"`
+	Components   []OrderItem    `json:"components,omitempty" db:"-"`
+	BundleItemID *int           `json:"bundle_item_id,omitempty" db:"bundle_item_id"` // set on components: the bundle line they belong to
 }
 
 // CreateOrderRequest represents the request body for creating an order
-// Note: ID is optional - server generates sequential ID if not provided
+// Note: ID is optional - server generates sequential ID if not provided.
+// DateKey is optional - the server determines the business day and overrides
+// a client value that disagrees.
 type CreateOrderRequest struct {
 	ID           string      `json:"id,omitempty"`
 	CustomerName string      `json:"customer_name" validate:"required,min=2,max=50"`
 	Items        []OrderItem `json:"items" validate:"required,min=1,dive"`
-	DateKey      int         `json:"date_key" validate:"required,min=101,max=3112"`
+	DateKey      int         `json:"date_key,omitempty" validate:"omitempty,min=101,max=3112"`
 	Category     string      `json:"category,omitempty"`
 }
+
+// UpdateOrderItemsRequest replaces the items of an unpaid order: lines left
+// out are removed, new lines are added and quantities are set as given
+type UpdateOrderItemsRequest struct {
+	Items []OrderItem `json:"items" validate:"required,min=1,dive"`
+}
+
+// OrderStatusHistory is one recorded status transition of an order
+type OrderStatusHistory struct {
+	ID           int64       `json:"id" db:"id"`
+	OrderID      string      `json:"order_id" db:"order_id"`
+	BusinessDate time.Time   `json:"business_date" db:"business_date"`
+	FromStatus   OrderStatus `json:"from_status" db:"from_status"`
+	ToStatus     OrderStatus `json:"to_status" db:"to_status"`
+	Actor        string      `json:"actor" db:"actor"`
+	Reason       string      `json:"reason" db:"reason"`
+	ShopID       *int        `json:"shop_id,omitempty" db:"shop_id"` // set when only this shop's ticket changed
+	CreatedAt    time.Time   `json:"created_at" db:"created_at"`
+}
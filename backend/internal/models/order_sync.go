@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// MaxSyncOrders is the most orders accepted in one sync batch
+const MaxSyncOrders = 200
+
+// SyncOrder is an order a POS tablet took while offline. ClientID is a UUID
+// chosen by the tablet, so a batch sent twice creates each order once.
+type SyncOrder struct {
+	ClientID      string         `json:"client_id"`
+	CustomerName  string         `json:"customer_name"`
+	Items         []OrderItem    `json:"items"`
+	Category      string         `json:"category,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`               // when the order was taken, on the tablet's clock
+	PaymentMethod *PaymentMethod `json:"payment_method,omitempty"` // set when it was already paid at the counter
+}
+
+// SyncOrdersRequest is the request body for uploading offline orders
+type SyncOrdersRequest struct {
+	Orders []SyncOrder `json:"orders"`
+}
+
+// SyncStatus is the outcome of one synced order
+type SyncStatus string
+
+const (
+	SyncStatusCreated   SyncStatus = "CREATED"   // a new server order was created
+	SyncStatusDuplicate SyncStatus = "DUPLICATE" // already synced; OrderID is the existing order
+	SyncStatusConflict  SyncStatus = "CONFLICT"  // the menu or stock changed since the order was taken (see Conflicts), or it was created but not marked paid (OrderID set)
+	SyncStatusInvalid   SyncStatus = "INVALID"   // the order itself is malformed; see Error
+)
+
+// SyncConflictReason is why an order line no longer matches the menu
+type SyncConflictReason string
+
+const (
+	SyncConflictItemNotFound     SyncConflictReason = "ITEM_NOT_FOUND"
+	SyncConflictItemUnavailable  SyncConflictReason = "ITEM_UNAVAILABLE"
+	SyncConflictPriceChanged     SyncConflictReason = "PRICE_CHANGED"
+	SyncConflictModifiersChanged SyncConflictReason = "MODIFIERS_CHANGED" // a modifier picked is gone or unavailable, or the groups' limits changed
+	SyncConflictBundleChanged    SyncConflictReason = "BUNDLE_CHANGED"    // a bundle component chosen is gone or unavailable, or the slots changed
+	SyncConflictOutOfStock       SyncConflictReason = "OUT_OF_STOCK"      // more of the item, or of an ingredient, than is left
+)
+
+// SyncConflict is one order line that no longer matches the menu
+type SyncConflict struct {
+	ItemIndex    int                `json:"item_index"`
+	MenuItemID   int                `json:"menu_item_id"`
+	Reason       SyncConflictReason `json:"reason"`
+	ClientPrice  float64            `json:"client_price,omitempty"`
+	CurrentPrice float64            `json:"current_price,omitempty"`
+}
+
+// SyncResult maps a client order to the server order created for it (or
+// explains why none was)
+type SyncResult struct {
+	ClientID    string         `json:"client_id"`
+	Status      SyncStatus     `json:"status"`
+	OrderID     string         `json:"order_id,omitempty"`
+	QueueNumber *int           `json:"queue_number,omitempty"`
+	Order       *Order         `json:"order,omitempty"`
+	Conflicts   []SyncConflict `json:"conflicts,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// SyncOrdersResponse has one result per uploaded order, in request order
+type SyncOrdersResponse struct {
+	Results []SyncResult `json:"results"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Payment is one entry in the payments ledger: part (or all) of an order's
+// total, paid with one method. Cash payments record what the customer
+// handed over and the change given back.
+type Payment struct {
+	ID           int64          `json:"id" db:"id"`
+	OrderID      string         `json:"order_id" db:"order_id"`
+	BusinessDate time.Time      `json:"-" db:"business_date"`
+	Amount       float64        `json:"amount" db:"amount"`     // part of the order total covered
+	Method       *PaymentMethod `json:"method" db:"method"`     // nil for orders paid before methods were recorded
+	Received     float64        `json:"received" db:"received"` // handed over by the customer
+	Change       float64        `json:"change" db:"change_given"`
+	Reference    *string        `json:"reference,omitempty" db:"reference"`     // e.g. PromptPay transaction reference
+	VerifiedBy   *string        `json:"verified_by,omitempty" db:"verified_by"` // payment provider that confirmed the reference
+	Actor        string         `json:"actor" db:"actor"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+}
+
+// PaymentRequest records a payment towards an order
+type PaymentRequest struct {
+	Method    *PaymentMethod `json:"payment_method,omitempty"`
+	Amount    float64        `json:"amount,omitempty"`   // 0 pays the outstanding balance
+	Received  float64        `json:"received,omitempty"` // cash handed over; 0 means exactly Amount
+	Reference string         `json:"reference,omitempty"`
+
+	// VerifiedBy is set by the server, never the client: the payment
+	// provider that confirmed Reference
+	VerifiedBy string `json:"-"`
+}
+
+// PromptPayQR is a PromptPay QR code asking for an order's outstanding
+// balance, as computed by the server
+type PromptPayQR struct {
+	OrderID string  `json:"order_id"`
+	Amount  float64 `json:"amount"`
+	Account string  `json:"account"` // receiving phone number, national ID or e-wallet ID
+	Payload string  `json:"payload"` // EMVCo payload, for clients that render the QR themselves
+	PNG     []byte  `json:"png"`     // the QR code as a PNG image (base64 in JSON)
+}
+
+// AmountPaid is the sum of the order's payments
+func (o *Order) AmountPaid() float64 {
+	var cents int64
+	for _, p := range o.Payments {
+		cents += ToCents(p.Amount)
+	}
+	return float64(cents) / 100
+}
+
+// Balance is what is left to pay of the order's total, never negative
+func (o *Order) Balance() float64 {
+	return float64(max(ToCents(o.TotalAmount)-ToCents(o.AmountPaid()), 0)) / 100
+}
+
+// MainPaymentMethod is the method of the order's largest payment (the first
+// of equal ones), or nil when it has none. It is what orders.payment_method
+// shows for an order paid in several parts.
+func (o *Order) MainPaymentMethod() *PaymentMethod {
+	var main *Payment
+	for i := range o.Payments {
+		if main == nil || ToCents(o.Payments[i].Amount) > ToCents(main.Amount) {
+			main = &o.Payments[i]
+		}
+	}
+	if main == nil {
+		return nil
+	}
+	return main.Method
+}
+
+// ToCents converts an amount in baht to whole satang, so amounts can be
+// compared and added without floating point drift
+func ToCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// PaymentNotification is a payment reported by a bank or slip-verification
+// provider: money that arrived on one of the shop's PromptPay accounts
+type PaymentNotification struct {
+	Reference string    `json:"reference" db:"reference"`         // the provider's transaction reference
+	Amount    float64   `json:"amount" db:"amount"`               // in baht
+	OrderID   string    `json:"order_id,omitempty" db:"order_id"` // bill reference, when the payer's app sent one
+	Account   string    `json:"account,omitempty" db:"account"`   // PromptPay account the payment went to
+	PaidAt    time.Time `json:"paid_at" db:"paid_at"`
+}
+
+// PaymentMatchStatus is what became of a payment notification
+type PaymentMatchStatus string
+
+const (
+	PaymentMatchMatched   PaymentMatchStatus = "MATCHED"   // recorded as a payment of OrderID
+	PaymentMatchDuplicate PaymentMatchStatus = "DUPLICATE" // already recorded for OrderID
+	PaymentMatchUnmatched PaymentMatchStatus = "UNMATCHED" // no unpaid order paid to this account with this amount (and bill reference)
+	PaymentMatchAmbiguous PaymentMatchStatus = "AMBIGUOUS" // several unpaid orders with this amount
+)
+
+// PaymentMatch is the outcome of matching a payment notification to an order.
+// Unmatched and ambiguous payments are left for a cashier, who can record
+// them on the right order with the notification's reference.
+type PaymentMatch struct {
+	Reference string             `json:"reference"`
+	Status    PaymentMatchStatus `json:"status"`
+	OrderID   string             `json:"order_id,omitempty"`
+	Order     *Order             `json:"order,omitempty"` // the paid order for MATCHED
+}
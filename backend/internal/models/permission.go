@@ -0,0 +1,52 @@
+package models
+
+// Permission is a single action a role may perform
+type Permission string
+
+const (
+	PermOrderView     Permission = "order:view"   // order lists, live events, kitchen display
+	PermOrderCreate   Permission = "order:create" // take orders at the counter
+	PermOrderMarkPaid Permission = "order:mark_paid"
+	PermOrderPrepare  Permission = "order:prepare" // mark ready / completed
+	PermOrderCancel   Permission = "order:cancel"
+	PermOrderRefund   Permission = "order:refund" // give back money for paid orders
+	PermMenuEdit      Permission = "menu:edit"
+	PermStatsView     Permission = "stats:view" // dashboard, all orders, order history
+	PermOrdersDelete  Permission = "orders:delete"
+	PermUsersManage   Permission = "users:manage"
+	PermShopsManage   Permission = "shops:manage"
+)
+
+// rolePermissions is what each role may do. Each role includes everything
+// the one before it can do except kitchen, which only works the queue.
+var rolePermissions = map[Role][]Permission{
+	RoleKitchen: {
+		PermOrderView, PermOrderPrepare,
+	},
+	RoleCashier: {
+		PermOrderView, PermOrderCreate, PermOrderMarkPaid, PermOrderPrepare, PermOrderCancel,
+	},
+	RoleShopManager: {
+		PermOrderView, PermOrderCreate, PermOrderMarkPaid, PermOrderPrepare, PermOrderCancel,
+		PermMenuEdit, PermStatsView,
+	},
+	RoleOwner: {
+		PermOrderView, PermOrderCreate, PermOrderMarkPaid, PermOrderPrepare, PermOrderCancel,
+		PermOrderRefund, PermMenuEdit, PermStatsView, PermOrdersDelete, PermUsersManage, PermShopsManage,
+	},
+}
+
+// Can reports whether the role has the permission
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions lists what the role may do
+func (r Role) Permissions() []Permission {
+	return append([]Permission(nil), rolePermissions[r]...)
+}
@@ -0,0 +1,110 @@
+package models
+
+import "time"
+
+// Refund gives back money paid for an order, for some or all of its items
+type Refund struct {
+	ID           int64          `json:"id" db:"id"`
+	OrderID      string         `json:"order_id" db:"order_id"`
+	BusinessDate time.Time      `json:"-" db:"business_date"`
+	Amount       float64        `json:"amount" db:"amount"`
+	Method       *PaymentMethod `json:"method" db:"method"` // how the money was given back
+	Reason       string         `json:"reason" db:"reason"`
+	Actor        string         `json:"actor" db:"actor"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	Items        []RefundItem   `json:"items" db:"-"`
+}
+
+// RefundItem is how many of one order item a refund covers
+type RefundItem struct {
+	RefundID    int64   `json:"-" db:"refund_id"`
+	OrderItemID int     `json:"order_item_id" db:"order_item_id"`
+	Quantity    int     `json:"quantity" db:"quantity"`
+	Amount      float64 `json:"amount" db:"amount"`
+}
+
+// RefundRequest refunds a paid order, entirely or some of its items
+type RefundRequest struct {
+	Items  []RefundItemRequest `json:"items,omitempty"` // empty refunds everything not refunded yet
+	Reason string              `json:"reason"`
+	Method *PaymentMethod      `json:"payment_method,omitempty"` // defaults to how the order was mostly paid
+}
+
+// RefundItemRequest picks an order item to refund
+type RefundItemRequest struct {
+	OrderItemID int `json:"order_item_id"`
+	Quantity    int `json:"quantity,omitempty"` // 0 refunds all of it not refunded yet
+}
+
+// RefundedAmount is the sum of the order's refunds
+func (o *Order) RefundedAmount() float64 {
+	var cents int64
+	for _, r := range o.Refunds {
+		cents += ToCents(r.Amount)
+	}
+	return float64(cents) / 100
+}
+
+// RefundedQuantity is how many of an order item have been refunded
+func (o *Order) RefundedQuantity(orderItemID int) int {
+	quantity := 0
+	for _, r := range o.Refunds {
+		for _, item := range r.Items {
+			if item.OrderItemID == orderItemID {
+				quantity += item.Quantity
+			}
+		}
+	}
+	return quantity
+}
+
+// FullyRefunded reports whether every item of the order has been refunded
+func (o *Order) FullyRefunded() bool {
+	if len(o.Refunds) == 0 {
+		return false
+	}
+	for _, item := range o.Items {
+		if o.RefundedQuantity(item.ID) < item.Quantity {
+			return false
+		}
+	}
+	return true
+}
+
+// PartiallyRefunded reports whether some, but not all, of the order's items
+// have been refunded. Such an order keeps its status.
+func (o *Order) PartiallyRefunded() bool {
+	return len(o.Refunds) > 0 && !o.FullyRefunded()
+}
+
+// RefundRestock is what a refund gives back to stock, by menu item ID: the
+// refunded lines (bundle components included) that were never prepared,
+// i.e. whose order, or for a split order whose shop's ticket, is still PAID.
+// Stock is taken when an order is paid; food already made isn't returned.
+func (o *Order) RefundRestock(refund *Refund) map[int]int {
+	restock := make(map[int]int)
+	for _, refunded := range refund.Items {
+		for _, item := range o.Items {
+			if item.ID != refunded.OrderItemID || !o.unprepared(item) {
+				continue
+			}
+			restock[item.MenuItemID] += refunded.Quantity
+			for _, component := range item.Components {
+				restock[component.MenuItemID] += component.Quantity * refunded.Quantity / item.Quantity
+			}
+		}
+	}
+	return restock
+}
+
+// unprepared reports whether an order line hasn't been made yet
+func (o *Order) unprepared(item OrderItem) bool {
+	if item.ShopID != nil {
+		for _, ticket := range o.Tickets {
+			if ticket.ShopID == *item.ShopID {
+				return ticket.Status == OrderStatusPaid
+			}
+		}
+	}
+	return o.Status == OrderStatusPaid
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrder_RefundRestock(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	items := []OrderItem{
+		{ID: 1, MenuItemID: 1, Quantity: 2, ShopID: &friesShop},
+		{ID: 2, MenuItemID: 5, Quantity: 1, ShopID: &drinksShop},
+		{ID: 3, MenuItemID: 20, Quantity: 2, ShopID: &friesShop, Components: []OrderItem{
+			{ID: 4, MenuItemID: 1, Quantity: 2},
+			{ID: 5, MenuItemID: 6, Quantity: 4},
+		}},
+	}
+	everything := &Refund{Items: []RefundItem{
+		{OrderItemID: 1, Quantity: 2},
+		{OrderItemID: 2, Quantity: 1},
+		{OrderItemID: 3, Quantity: 1},
+	}}
+
+	tests := []struct {
+		name    string
+		order   Order
+		refund  *Refund
+		restock map[int]int
+	}{
+		{
+			name:    "Paid order not prepared yet",
+			order:   Order{Status: OrderStatusPaid, Items: items},
+			refund:  everything,
+			restock: map[int]int{1: 3, 5: 1, 20: 1, 6: 2},
+		},
+		{
+			name:   "Some of the items",
+			order:  Order{Status: OrderStatusPaid, Items: items},
+			refund: &Refund{Items: []RefundItem{{OrderItemID: 1, Quantity: 1}}},
+			// Only what was refunded
+			restock: map[int]int{1: 1},
+		},
+		{
+			name:    "Already prepared",
+			order:   Order{Status: OrderStatusReady, Items: items},
+			refund:  everything,
+			restock: map[int]int{},
+		},
+		{
+			name: "Split order with one shop's ticket ready",
+			order: Order{Status: OrderStatusPaid, Items: items, Tickets: []OrderTicket{
+				{ShopID: friesShop, Status: OrderStatusReady},
+				{ShopID: drinksShop, Status: OrderStatusPaid},
+			}},
+			refund:  everything,
+			restock: map[int]int{5: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.restock, tt.order.RefundRestock(tt.refund))
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Shop is a booth at the fair. Its code is the category used to group menu
+// items and orders, e.g. on the kitchen display filter.
+type Shop struct {
+	ID        int       `json:"id" db:"id"`
+	Code      string    `json:"code" db:"code"`
+	Name      string    `json:"name" db:"name"`
+	Active    bool      `json:"active" db:"active"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	// PromptPayID is the account customers' PromptPay payments go to (phone,
+	// national ID or e-wallet ID); nil uses the server-wide account
+	PromptPayID *string `json:"promptpay_id" db:"promptpay_id"`
+}
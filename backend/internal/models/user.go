@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Role is what a staff account is allowed to do; see rolePermissions
+type Role string
+
+const (
+	RoleCashier     Role = "cashier"
+	RoleKitchen     Role = "kitchen"
+	RoleShopManager Role = "shop-manager"
+	RoleOwner       Role = "owner"
+)
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// User is a staff account
+type User struct {
+	ID           int       `json:"id" db:"id"`
+	Username     string    `json:"username" db:"username"`
+	DisplayName  string    `json:"display_name" db:"display_name"`
+	PasswordHash string    `json:"-" db:"password_hash"`
+	Role         Role      `json:"role" db:"role"`
+	Active       bool      `json:"active" db:"active"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	// ShopIDs are the shops the user works at (from user_shops). Owners can
+	// act on every shop regardless.
+	ShopIDs []int `json:"shop_ids" db:"-"`
+}
+
+// Session is a login session. The token handed to the client is signed by
+// the server; the row only exists so it can be revoked early.
+type Session struct {
+	ID        string     `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// LoginRequest is the request body for logging in
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries the session token for the Authorization header
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      User      `json:"user"`
+}
+
+// CreateUserRequest is the request body for creating a staff account
+type CreateUserRequest struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Password    string `json:"password"`
+	Role        Role   `json:"role"`
+	ShopIDs     []int  `json:"shop_ids,omitempty"`
+}
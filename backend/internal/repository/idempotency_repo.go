@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, key, fingerprint string, now, expiresAt, staleBefore time.Time) (*models.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, statusCode int, response []byte) error
+	Release(ctx context.Context, key string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve claims key for a new request. It returns the record and true when
+// the key was free (never used, expired, or reserved before staleBefore by a
+// request that never finished, e.g. because the server crashed); otherwise
+// the existing record and false, so the caller can replay or reject the
+// request.
+func (r *idempotencyRepository) Reserve(ctx context.Context, key, fingerprint string, now, expiresAt, staleBefore time.Time) (*models.IdempotencyRecord, bool, error) {
+	var record models.IdempotencyRecord
+	query := `
+		INSERT INTO idempotency_keys (key, fingerprint, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+			status_code = NULL,
+			response = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= $3
+			OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at <= $5)
+		RETURNING *
+	`
+	err := r.db.GetContext(ctx, &record, query, key, fingerprint, now, expiresAt, staleBefore)
+	if err == nil {
+		return &record, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	// The key is taken and still valid
+	err = r.db.GetContext(ctx, &record, `SELECT * FROM idempotency_keys WHERE key = $1`, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Released by the first request in the meantime; the client can retry
+			return nil, false, models.ErrRequestInProgress
+		}
+		return nil, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return &record, false, nil
+}
+
+// Complete stores the response of the request that reserved key
+func (r *idempotencyRepository) Complete(ctx context.Context, key string, statusCode int, response []byte) error {
+	query := `UPDATE idempotency_keys SET status_code = $1, response = $2 WHERE key = $3`
+	if _, err := r.db.ExecContext(ctx, query, statusCode, response, key); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release frees a key whose request failed, so a retry runs it again
+func (r *idempotencyRepository) Release(ctx context.Context, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes keys past their window and returns how many
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
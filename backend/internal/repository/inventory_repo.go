@@ -0,0 +1,537 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+type InventoryRepository interface {
+	GetInventory(ctx context.Context) (*models.Inventory, error)
+	GetItemStock(ctx context.Context, menuItemID int) (*models.ItemStock, error)
+	SetItemStock(ctx context.Context, menuItemID int, req *models.ItemStockRequest) error
+	GetIngredient(ctx context.Context, id int) (*models.Ingredient, error)
+	CreateIngredient(ctx context.Context, ingredient *models.Ingredient) error
+	UpdateIngredient(ctx context.Context, ingredient *models.Ingredient) error
+}
+
+type inventoryRepository struct {
+	db *sqlx.DB
+}
+
+func NewInventoryRepository(db *sqlx.DB) InventoryRepository {
+	return &inventoryRepository{db: db}
+}
+
+// heldStock is a CTE of how many of each menu item unpaid orders hold,
+// leaving out the order $1 (none when empty). Bundle lines and their
+// components are rows of their own, so both are counted.
+const heldStock = `
+	held AS (
+		SELECT oi.menu_item_id, SUM(oi.quantity) AS quantity
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id AND o.business_date = oi.business_date
+		WHERE o.status = 'PENDING_PAYMENT' AND o.id <> $1
+		GROUP BY oi.menu_item_id
+	)`
+
+// itemStockQuery selects the stock of menu items with what unpaid orders
+// hold of them
+const itemStockQuery = `
+	WITH ` + heldStock + `
+	SELECT m.id AS menu_item_id, m.name, m.shop_id, m.available, m.stock, m.low_stock_threshold, m.sold_out_at,
+		COALESCE(h.quantity, 0) AS reserved
+	FROM menu_items m
+	LEFT JOIN held h ON h.menu_item_id = m.id
+`
+
+// GetInventory lists the tracked menu items and every ingredient
+func (r *inventoryRepository) GetInventory(ctx context.Context) (*models.Inventory, error) {
+	inventory := &models.Inventory{Items: []models.ItemStock{}, Ingredients: []models.IngredientStock{}}
+
+	query := itemStockQuery + `
+		WHERE m.stock IS NOT NULL OR EXISTS (SELECT 1 FROM recipe_items r WHERE r.menu_item_id = m.id)
+		ORDER BY m.id
+	`
+	if err := r.db.SelectContext(ctx, &inventory.Items, query, ""); err != nil {
+		return nil, fmt.Errorf("failed to get item stock: %w", err)
+	}
+	if err := r.loadRecipes(ctx, inventory.Items); err != nil {
+		return nil, err
+	}
+	for i := range inventory.Items {
+		inventory.Items[i].Tally()
+	}
+
+	query = `
+		WITH ` + heldStock + `
+		SELECT i.*, COALESCE(SUM(h.quantity * r.quantity), 0) AS reserved
+		FROM ingredients i
+		LEFT JOIN recipe_items r ON r.ingredient_id = i.id
+		LEFT JOIN held h ON h.menu_item_id = r.menu_item_id
+		GROUP BY i.id
+		ORDER BY i.id
+	`
+	if err := r.db.SelectContext(ctx, &inventory.Ingredients, query, ""); err != nil {
+		return nil, fmt.Errorf("failed to get ingredient stock: %w", err)
+	}
+	for i := range inventory.Ingredients {
+		inventory.Ingredients[i].Tally()
+	}
+
+	return inventory, nil
+}
+
+// GetItemStock retrieves the stock of a menu item, whether it is tracked or not
+func (r *inventoryRepository) GetItemStock(ctx context.Context, menuItemID int) (*models.ItemStock, error) {
+	var item models.ItemStock
+	err := r.db.GetContext(ctx, &item, itemStockQuery+` WHERE m.id = $2`, "", menuItemID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %d", models.ErrMenuItemNotFound, menuItemID)
+		}
+		return nil, fmt.Errorf("failed to get item stock: %w", err)
+	}
+
+	items := []models.ItemStock{item}
+	if err := r.loadRecipes(ctx, items); err != nil {
+		return nil, err
+	}
+	items[0].Tally()
+	return &items[0], nil
+}
+
+// loadRecipes fills in the recipe of each item
+func (r *inventoryRepository) loadRecipes(ctx context.Context, items []models.ItemStock) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.MenuItemID
+	}
+
+	recipes, err := getRecipes(ctx, r.db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].Recipe = recipes[items[i].MenuItemID]
+	}
+	return nil
+}
+
+// getRecipes retrieves the recipes of the given menu items, with the name
+// and unit of each ingredient
+func getRecipes(ctx context.Context, q sqlx.QueryerContext, menuItemIDs []int) (map[int][]models.RecipeItem, error) {
+	var rows []models.RecipeItem
+	query := `
+		SELECT r.menu_item_id, r.ingredient_id, i.name, i.unit, r.quantity
+		FROM recipe_items r
+		JOIN ingredients i ON i.id = r.ingredient_id
+		WHERE r.menu_item_id = ANY($1)
+		ORDER BY r.menu_item_id, i.name
+	`
+	if err := sqlx.SelectContext(ctx, q, &rows, query, pq.Array(menuItemIDs)); err != nil {
+		return nil, fmt.Errorf("failed to get recipes: %w", err)
+	}
+
+	recipes := make(map[int][]models.RecipeItem)
+	for _, row := range rows {
+		recipes[row.MenuItemID] = append(recipes[row.MenuItemID], row)
+	}
+	return recipes, nil
+}
+
+// SetItemStock sets a menu item's stock and low-stock threshold and, unless
+// req.Recipe is nil, replaces its recipe. The item is made unavailable if
+// it is now out of stock, or available again if it was sold out.
+func (r *inventoryRepository) SetItemStock(ctx context.Context, menuItemID int, req *models.ItemStockRequest) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `UPDATE menu_items SET stock = $1, low_stock_threshold = $2, updated_at = NOW() AT TIME ZONE 'UTC' WHERE id = $3`
+	result, err := tx.ExecContext(ctx, query, req.Stock, req.LowStockThreshold, menuItemID)
+	if err != nil {
+		return fmt.Errorf("failed to set item stock: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to set item stock: %w", err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: %d", models.ErrMenuItemNotFound, menuItemID)
+	}
+
+	if req.Recipe != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM recipe_items WHERE menu_item_id = $1`, menuItemID); err != nil {
+			return fmt.Errorf("failed to clear recipe: %w", err)
+		}
+		for i := range req.Recipe {
+			item := &req.Recipe[i]
+			item.MenuItemID = menuItemID
+			query := `INSERT INTO recipe_items (menu_item_id, ingredient_id, quantity) VALUES ($1, $2, $3)`
+			if _, err := tx.ExecContext(ctx, query, menuItemID, item.IngredientID, item.Quantity); err != nil {
+				if isPgError(err, pgForeignKeyViolation) {
+					return models.NewValidationError("recipe", fmt.Sprintf("ingredient %d does not exist", item.IngredientID))
+				}
+				if isPgError(err, pgUniqueViolation) {
+					return models.NewValidationError("recipe", fmt.Sprintf("ingredient %d is listed twice", item.IngredientID))
+				}
+				return fmt.Errorf("failed to add recipe item: %w", err)
+			}
+		}
+	}
+
+	if err := updateSoldOut(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetIngredient retrieves an ingredient by ID
+func (r *inventoryRepository) GetIngredient(ctx context.Context, id int) (*models.Ingredient, error) {
+	var ingredient models.Ingredient
+	query := `SELECT * FROM ingredients WHERE id = $1`
+	err := r.db.GetContext(ctx, &ingredient, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %d", models.ErrIngredientNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to get ingredient: %w", err)
+	}
+	return &ingredient, nil
+}
+
+// CreateIngredient inserts a new ingredient
+func (r *inventoryRepository) CreateIngredient(ctx context.Context, ingredient *models.Ingredient) error {
+	query := `
+		INSERT INTO ingredients (name, unit, shop_id, stock, low_stock_threshold)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+	err := r.db.QueryRowContext(ctx, query,
+		ingredient.Name,
+		ingredient.Unit,
+		ingredient.ShopID,
+		ingredient.Stock,
+		ingredient.LowStockThreshold,
+	).Scan(&ingredient.ID, &ingredient.CreatedAt, &ingredient.UpdatedAt)
+	if err != nil {
+		if isPgError(err, pgUniqueViolation) {
+			return fmt.Errorf("ingredient '%s' %w", ingredient.Name, models.ErrDuplicate)
+		}
+		if isPgError(err, pgForeignKeyViolation) {
+			return models.NewValidationError("shop_id", "shop does not exist")
+		}
+		return fmt.Errorf("failed to create ingredient: %w", err)
+	}
+	return nil
+}
+
+// UpdateIngredient changes an ingredient, typically its stock after a
+// restock or count. Items using it are made unavailable if it ran out, or
+// available again if it was restocked.
+func (r *inventoryRepository) UpdateIngredient(ctx context.Context, ingredient *models.Ingredient) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		UPDATE ingredients
+		SET name = $1, unit = $2, shop_id = $3, stock = $4, low_stock_threshold = $5, updated_at = NOW() AT TIME ZONE 'UTC'
+		WHERE id = $6
+		RETURNING created_at, updated_at
+	`
+	err = tx.QueryRowContext(ctx, query,
+		ingredient.Name,
+		ingredient.Unit,
+		ingredient.ShopID,
+		ingredient.Stock,
+		ingredient.LowStockThreshold,
+		ingredient.ID,
+	).Scan(&ingredient.CreatedAt, &ingredient.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %d", models.ErrIngredientNotFound, ingredient.ID)
+		}
+		if isPgError(err, pgUniqueViolation) {
+			return fmt.Errorf("ingredient '%s' %w", ingredient.Name, models.ErrDuplicate)
+		}
+		if isPgError(err, pgForeignKeyViolation) {
+			return models.NewValidationError("shop_id", "shop does not exist")
+		}
+		return fmt.Errorf("failed to update ingredient: %w", err)
+	}
+
+	if err := updateSoldOut(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// stockLimits retrieves what is left to order of the given menu items and
+// the ingredients of their recipes, after what unpaid orders hold. The order
+// excludeOrderID (e.g. one whose items are being changed) is left out.
+func stockLimits(ctx context.Context, q sqlx.QueryerContext, menuItemIDs []int, excludeOrderID string) (*models.StockLimits, error) {
+	limits := &models.StockLimits{
+		Items:       make(map[int]int),
+		Ingredients: make(map[int]float64),
+	}
+
+	var items []struct {
+		ID        int `db:"id"`
+		Remaining int `db:"remaining"`
+	}
+	query := `
+		WITH ` + heldStock + `
+		SELECT m.id, m.stock - COALESCE(h.quantity, 0) AS remaining
+		FROM menu_items m
+		LEFT JOIN held h ON h.menu_item_id = m.id
+		WHERE m.id = ANY($2) AND m.stock IS NOT NULL
+	`
+	if err := sqlx.SelectContext(ctx, q, &items, query, excludeOrderID, pq.Array(menuItemIDs)); err != nil {
+		return nil, fmt.Errorf("failed to get item stock: %w", err)
+	}
+	for _, item := range items {
+		limits.Items[item.ID] = item.Remaining
+	}
+
+	recipes, err := getRecipes(ctx, q, menuItemIDs)
+	if err != nil {
+		return nil, err
+	}
+	limits.Recipes = recipes
+	if len(recipes) == 0 {
+		return limits, nil
+	}
+
+	var ingredients []struct {
+		ID        int     `db:"id"`
+		Remaining float64 `db:"remaining"`
+	}
+	query = `
+		WITH ` + heldStock + `
+		SELECT i.id, i.stock - COALESCE(SUM(h.quantity * r.quantity), 0) AS remaining
+		FROM ingredients i
+		LEFT JOIN recipe_items r ON r.ingredient_id = i.id
+		LEFT JOIN held h ON h.menu_item_id = r.menu_item_id
+		WHERE i.id IN (SELECT ingredient_id FROM recipe_items WHERE menu_item_id = ANY($2))
+		GROUP BY i.id
+	`
+	if err := sqlx.SelectContext(ctx, q, &ingredients, query, excludeOrderID, pq.Array(menuItemIDs)); err != nil {
+		return nil, fmt.Errorf("failed to get ingredient stock: %w", err)
+	}
+	for _, ingredient := range ingredients {
+		limits.Ingredients[ingredient.ID] = ingredient.Remaining
+	}
+
+	return limits, nil
+}
+
+// orderedMenuItems lists the menu items on the given order lines, bundle
+// components included, each once
+func orderedMenuItems(items []models.OrderItem) []int {
+	var ids []int
+	add := func(id int) {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	for _, item := range items {
+		add(item.MenuItemID)
+		for _, component := range item.Components {
+			add(component.MenuItemID)
+		}
+	}
+	return ids
+}
+
+// lockStock locks the rows of the given menu items that track their stock,
+// and of the ingredients in their recipes, until the transaction ends.
+// Everything that checks or takes stock locks them first, always in the same
+// order, so two orders can't both be given the last of something.
+func lockStock(ctx context.Context, tx *sqlx.Tx, menuItemIDs []int) error {
+	query := `SELECT id FROM menu_items WHERE id = ANY($1) AND stock IS NOT NULL ORDER BY id FOR UPDATE`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(menuItemIDs)); err != nil {
+		return fmt.Errorf("failed to lock item stock: %w", err)
+	}
+	query = `
+		SELECT id FROM ingredients
+		WHERE id IN (SELECT ingredient_id FROM recipe_items WHERE menu_item_id = ANY($1))
+		ORDER BY id
+		FOR UPDATE
+	`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(menuItemIDs)); err != nil {
+		return fmt.Errorf("failed to lock ingredient stock: %w", err)
+	}
+	return nil
+}
+
+// checkStock checks there is enough stock left for the given order lines
+// after what other unpaid orders hold, returning a *models.StockError if
+// not. The stock stays locked until the transaction ends, so the order can
+// be saved before anyone else takes it. The order excludeOrderID is left
+// out, so an order being changed doesn't compete with itself.
+func checkStock(ctx context.Context, tx *sqlx.Tx, items []models.OrderItem, excludeOrderID string) error {
+	menuItemIDs := orderedMenuItems(items)
+	if len(menuItemIDs) == 0 {
+		return nil
+	}
+	if err := lockStock(ctx, tx, menuItemIDs); err != nil {
+		return err
+	}
+	limits, err := stockLimits(ctx, tx, menuItemIDs, excludeOrderID)
+	if err != nil {
+		return err
+	}
+	return limits.Check(items)
+}
+
+// soldStock is a CTE of what the order $1 of business date $2 takes of
+// each menu item, and used of each ingredient
+const soldStock = `
+	sold AS (
+		SELECT menu_item_id, SUM(quantity) AS quantity
+		FROM order_items
+		WHERE order_id = $1 AND business_date = $2
+		GROUP BY menu_item_id
+	), used AS (
+		SELECT r.ingredient_id, SUM(s.quantity * r.quantity) AS quantity
+		FROM sold s
+		JOIN recipe_items r ON r.menu_item_id = s.menu_item_id
+		GROUP BY r.ingredient_id
+	)`
+
+// takeStock takes the items of a paid order off the stock of the menu items
+// and of the ingredients in their recipes. Stock may have been counted down
+// by hand since the order was taken; if what is left no longer covers the
+// order, a validation error names what ran short and nothing is taken.
+func takeStock(ctx context.Context, tx *sqlx.Tx, order *models.Order) error {
+	menuItemIDs := orderedMenuItems(order.Items)
+	if len(menuItemIDs) == 0 {
+		return nil
+	}
+	if err := lockStock(ctx, tx, menuItemIDs); err != nil {
+		return err
+	}
+
+	var short []string
+	query := `
+		WITH ` + soldStock + `
+		SELECT m.name FROM menu_items m JOIN sold s ON s.menu_item_id = m.id WHERE m.stock < s.quantity
+		UNION ALL
+		SELECT i.name FROM ingredients i JOIN used u ON u.ingredient_id = i.id WHERE i.stock < u.quantity
+	`
+	if err := tx.SelectContext(ctx, &short, query, order.ID, order.BusinessDate); err != nil {
+		return fmt.Errorf("failed to check stock: %w", err)
+	}
+	if len(short) > 0 {
+		return models.NewValidationError("items", fmt.Sprintf("not enough %s left for order %s; change its items first", strings.Join(short, ", "), order.ID))
+	}
+
+	query = `
+		WITH ` + soldStock + `, items AS (
+			UPDATE menu_items m
+			SET stock = m.stock - s.quantity, updated_at = NOW() AT TIME ZONE 'UTC'
+			FROM sold s
+			WHERE m.id = s.menu_item_id AND m.stock IS NOT NULL
+		)
+		UPDATE ingredients i
+		SET stock = i.stock - u.quantity, updated_at = NOW() AT TIME ZONE 'UTC'
+		FROM used u
+		WHERE i.id = u.ingredient_id
+	`
+	if _, err := tx.ExecContext(ctx, query, order.ID, order.BusinessDate); err != nil {
+		return fmt.Errorf("failed to take stock: %w", err)
+	}
+	return updateSoldOut(ctx, tx)
+}
+
+// restockRefund puts the never-prepared items of a refund back into the
+// stock of the menu items and of the ingredients in their recipes, making
+// items that had sold out available again
+func restockRefund(ctx context.Context, tx *sqlx.Tx, order *models.Order, refund *models.Refund) error {
+	restock := order.RefundRestock(refund)
+	if len(restock) == 0 {
+		return nil
+	}
+
+	menuItemIDs := make([]int, 0, len(restock))
+	for id := range restock {
+		menuItemIDs = append(menuItemIDs, id)
+	}
+	slices.Sort(menuItemIDs)
+	quantities := make([]int, len(menuItemIDs))
+	for i, id := range menuItemIDs {
+		quantities[i] = restock[id]
+	}
+	if err := lockStock(ctx, tx, menuItemIDs); err != nil {
+		return err
+	}
+
+	query := `
+		WITH returned AS (
+			SELECT * FROM unnest($1::int[], $2::int[]) AS r(menu_item_id, quantity)
+		), used AS (
+			SELECT r.ingredient_id, SUM(ret.quantity * r.quantity) AS quantity
+			FROM returned ret
+			JOIN recipe_items r ON r.menu_item_id = ret.menu_item_id
+			GROUP BY r.ingredient_id
+		), items AS (
+			UPDATE menu_items m
+			SET stock = m.stock + ret.quantity, updated_at = NOW() AT TIME ZONE 'UTC'
+			FROM returned ret
+			WHERE m.id = ret.menu_item_id AND m.stock IS NOT NULL
+		)
+		UPDATE ingredients i
+		SET stock = i.stock + u.quantity, updated_at = NOW() AT TIME ZONE 'UTC'
+		FROM used u
+		WHERE i.id = u.ingredient_id
+	`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(menuItemIDs), pq.Array(quantities)); err != nil {
+		return fmt.Errorf("failed to restock refunded items: %w", err)
+	}
+	return updateSoldOut(ctx, tx)
+}
+
+// updateSoldOut makes the menu items that ran out of stock, or of an
+// ingredient of their recipe, unavailable, and makes items it made
+// unavailable before available again once they are back in stock. Items
+// switched off by hand are left alone.
+func updateSoldOut(ctx context.Context, tx *sqlx.Tx) error {
+	const outOfStock = `
+		(COALESCE(m.stock, 1) <= 0 OR EXISTS (
+			SELECT 1 FROM recipe_items r
+			JOIN ingredients i ON i.id = r.ingredient_id
+			WHERE r.menu_item_id = m.id AND i.stock < r.quantity
+		))`
+
+	query := `UPDATE menu_items m SET available = false, sold_out_at = NOW() AT TIME ZONE 'UTC' WHERE m.available AND ` + outOfStock
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to mark items sold out: %w", err)
+	}
+
+	query = `UPDATE menu_items m SET available = true, sold_out_at = NULL WHERE m.sold_out_at IS NOT NULL AND NOT ` + outOfStock
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to mark items back in stock: %w", err)
+	}
+	return nil
+}
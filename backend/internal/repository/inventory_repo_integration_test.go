@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/testutil"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+)
+
+func TestInventoryRepository_Stock(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewInventoryRepository(db)
+	orders := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	menu := NewMenuRepository(db)
+	ctx := context.Background()
+
+	potatoes := &models.Ingredient{Name: "Potatoes", Unit: "kg", Stock: 1}
+	require.NoError(t, repo.CreateIngredient(ctx, potatoes))
+
+	// French Fries S (1): 3 in stock, 0.25 kg of potatoes each
+	three, one := 3, 1
+	require.NoError(t, repo.SetItemStock(ctx, 1, &models.ItemStockRequest{
+		Stock:             &three,
+		LowStockThreshold: &one,
+		Recipe:            []models.RecipeItem{{IngredientID: potatoes.ID, Quantity: 0.25}},
+	}))
+
+	// An unpaid order holds stock without taking it
+	order := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	order.Items[0].Quantity = 2
+	require.NoError(t, orders.Create(ctx, order))
+
+	stock, err := repo.GetItemStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, *stock.Stock)
+	assert.Equal(t, 2, stock.Reserved)
+	assert.Equal(t, 1, *stock.Remaining)
+	assert.True(t, stock.LowStock)
+	require.Len(t, stock.Recipe, 1)
+	assert.Equal(t, "Potatoes", stock.Recipe[0].Name)
+
+	// Orders for more than is left are refused
+	tooMany := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	tooMany.Items[0].Quantity = 2
+	err = orders.Create(ctx, tooMany)
+	var stockErr *models.StockError
+	require.ErrorAs(t, err, &stockErr)
+	assert.ErrorIs(t, err, models.ErrValidation)
+	assert.ErrorContains(t, err, "only 1 of French Fries S left")
+	assert.Equal(t, []models.StockShortage{{ItemIndex: 0, MenuItemID: 1}}, stockErr.Shortages)
+	// Checking ahead of creating the order gives the same answer
+	assert.ErrorAs(t, orders.CheckStock(ctx, tooMany.Items), &stockErr)
+	assert.NoError(t, orders.CheckStock(ctx, []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1}}))
+
+	// The order being changed doesn't count against itself
+	edit := func(quantity int) ItemsEdit {
+		return ItemsEdit{Order: &models.Order{
+			TotalAmount: 40 * float64(quantity),
+			Items:       []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: quantity}},
+		}}
+	}
+	_, err = orders.UpdateItems(ctx, order.ID, edit(4))
+	assert.ErrorContains(t, err, "only 3 of French Fries S left")
+	_, err = orders.UpdateItems(ctx, order.ID, edit(3))
+	require.NoError(t, err)
+	_, err = orders.UpdateItems(ctx, order.ID, edit(2))
+	require.NoError(t, err)
+
+	// Paying takes the stock off
+	_, err = orders.TransitionStatus(ctx, order.ID, StatusChange{To: models.OrderStatusPaid})
+	require.NoError(t, err)
+
+	stock, err = repo.GetItemStock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, *stock.Stock)
+	assert.Equal(t, 0, stock.Reserved)
+	got, err := repo.GetIngredient(ctx, potatoes.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, got.Stock)
+
+	// Running out makes the item unavailable until it is restocked
+	last := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, orders.Create(ctx, last))
+	_, err = orders.TransitionStatus(ctx, last.ID, StatusChange{To: models.OrderStatusPaid})
+	require.NoError(t, err)
+
+	item, err := menu.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, *item.Stock)
+	assert.False(t, item.Available)
+	assert.NotNil(t, item.SoldOutAt)
+
+	ten := 10
+	require.NoError(t, repo.SetItemStock(ctx, 1, &models.ItemStockRequest{Stock: &ten}))
+	item, err = menu.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, item.Available)
+	assert.Nil(t, item.SoldOutAt)
+
+	// Stock counted down by hand below what an unpaid order needs is not
+	// taken silently: paying is refused until the order is changed
+	short := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, orders.Create(ctx, short))
+	got, err = repo.GetIngredient(ctx, potatoes.ID)
+	require.NoError(t, err)
+	got.Stock = 0.2
+	require.NoError(t, repo.UpdateIngredient(ctx, got))
+	_, err = orders.TransitionStatus(ctx, short.ID, StatusChange{To: models.OrderStatusPaid})
+	assert.ErrorIs(t, err, models.ErrValidation)
+	assert.ErrorContains(t, err, "not enough Potatoes left")
+	got, err = repo.GetIngredient(ctx, potatoes.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0.2, got.Stock)
+	_, err = orders.TransitionStatus(ctx, short.ID, StatusChange{To: models.OrderStatusCancelled})
+	require.NoError(t, err)
+
+	// Running out of an ingredient makes the item unavailable too
+	got.Stock = 0.1
+	require.NoError(t, repo.UpdateIngredient(ctx, got))
+	item, err = menu.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, item.Available)
+
+	inventory, err := repo.GetInventory(ctx)
+	require.NoError(t, err)
+	require.Len(t, inventory.Items, 1)
+	assert.Equal(t, 1, inventory.Items[0].MenuItemID)
+	require.Len(t, inventory.Ingredients, 1)
+	assert.Equal(t, 0.1, inventory.Ingredients[0].Remaining)
+}
+
+func TestInventoryRepository_RefundRestock(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewInventoryRepository(db)
+	orders := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	menu := NewMenuRepository(db)
+	ctx := context.Background()
+
+	potatoes := &models.Ingredient{Name: "Potatoes", Unit: "kg", Stock: 1}
+	require.NoError(t, repo.CreateIngredient(ctx, potatoes))
+	two := 2
+	require.NoError(t, repo.SetItemStock(ctx, 1, &models.ItemStockRequest{
+		Stock:  &two,
+		Recipe: []models.RecipeItem{{IngredientID: potatoes.ID, Quantity: 0.25}},
+	}))
+
+	// Paying for the last two sells the item out
+	order := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	order.Items[0].Quantity = 2
+	order.TotalAmount = 80
+	require.NoError(t, orders.Create(ctx, order))
+	paid, err := orders.TransitionStatus(ctx, order.ID, StatusChange{To: models.OrderStatusPaid})
+	require.NoError(t, err)
+	item, err := menu.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, item.Available)
+
+	// Refunding one before it was prepared puts it back on sale
+	cash := models.PaymentMethodCash
+	_, err = orders.TransitionStatus(ctx, order.ID, StatusChange{
+		To: models.OrderStatusRefunded,
+		Refund: &models.Refund{Amount: 40, Method: &cash, Reason: "customer left", Items: []models.RefundItem{
+			{OrderItemID: paid.Items[0].ID, Quantity: 1, Amount: 40},
+		}},
+	})
+	require.NoError(t, err)
+
+	item, err = menu.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, *item.Stock)
+	assert.True(t, item.Available)
+	got, err := repo.GetIngredient(ctx, potatoes.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0.75, got.Stock)
+
+	// Once prepared, refunded food is not returned to stock
+	_, err = orders.TransitionStatus(ctx, order.ID, StatusChange{To: models.OrderStatusReady})
+	require.NoError(t, err)
+	_, err = orders.TransitionStatus(ctx, order.ID, StatusChange{
+		To: models.OrderStatusRefunded,
+		Refund: &models.Refund{Amount: 40, Method: &cash, Reason: "dropped", Items: []models.RefundItem{
+			{OrderItemID: paid.Items[0].ID, Quantity: 1, Amount: 40},
+		}},
+	})
+	require.NoError(t, err)
+
+	item, err = menu.GetByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, *item.Stock)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/tanasatit/barvidva-kasetfair/internal/models"
 )
 
@@ -18,6 +19,8 @@ type MenuRepository interface {
 	Delete(ctx context.Context, id int) error
 	CheckDuplicateName(ctx context.Context, name string, excludeID int) (bool, error)
 	GetCategories(ctx context.Context) ([]string, error)
+	SetModifierGroups(ctx context.Context, itemID int, groups []models.ModifierGroup) error
+	SetBundleSlots(ctx context.Context, bundleID int, slots []models.BundleSlot) error
 }
 
 type menuRepository struct {
@@ -35,11 +38,15 @@ func (r *menuRepository) GetByID(ctx context.Context, id int) (*models.MenuItem,
 	err := r.db.GetContext(ctx, &item, query, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("menu item not found: %d", id)
+			return nil, fmt.Errorf("%w: %d", models.ErrMenuItemNotFound, id)
 		}
 		return nil, fmt.Errorf("failed to get menu item: %w", err)
 	}
-	return &item, nil
+	items := []models.MenuItem{item}
+	if err := r.loadChoices(ctx, items); err != nil {
+		return nil, err
+	}
+	return &items[0], nil
 }
 
 // GetAll retrieves all menu items
@@ -50,6 +57,9 @@ func (r *menuRepository) GetAll(ctx context.Context) ([]models.MenuItem, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all menu items: %w", err)
 	}
+	if err := r.loadChoices(ctx, items); err != nil {
+		return nil, err
+	}
 	return items, nil
 }
 
@@ -61,24 +71,31 @@ func (r *menuRepository) GetAvailable(ctx context.Context) ([]models.MenuItem, e
 	if err != nil {
 		return nil, fmt.Errorf("failed to get available menu items: %w", err)
 	}
+	if err := r.loadChoices(ctx, items); err != nil {
+		return nil, err
+	}
 	return items, nil
 }
 
 // Create inserts a new menu item
 func (r *menuRepository) Create(ctx context.Context, item *models.MenuItem) error {
 	query := `
-		INSERT INTO menu_items (name, price, category, image_url, available, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		INSERT INTO menu_items (name, price, category, shop_id, image_url, available, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
 		RETURNING id, created_at, updated_at
 	`
 	err := r.db.QueryRowContext(ctx, query,
 		item.Name,
 		item.Price,
 		item.Category,
+		item.ShopID,
 		item.ImageURL,
 		item.Available,
 	).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
 	if err != nil {
+		if isPgError(err, pgUniqueViolation) {
+			return fmt.Errorf("menu item with name '%s' %w", item.Name, models.ErrDuplicate)
+		}
 		return fmt.Errorf("failed to create menu item: %w", err)
 	}
 	return nil
@@ -88,21 +105,25 @@ func (r *menuRepository) Create(ctx context.Context, item *models.MenuItem) erro
 func (r *menuRepository) Update(ctx context.Context, item *models.MenuItem) error {
 	query := `
 		UPDATE menu_items
-		SET name = $1, price = $2, category = $3, image_url = $4, available = $5, updated_at = NOW()
-		WHERE id = $6
+		SET name = $1, price = $2, category = $3, shop_id = $4, image_url = $5, available = $6, updated_at = NOW()
+		WHERE id = $7
 		RETURNING updated_at
 	`
 	err := r.db.QueryRowContext(ctx, query,
 		item.Name,
 		item.Price,
 		item.Category,
+		item.ShopID,
 		item.ImageURL,
 		item.Available,
 		item.ID,
 	).Scan(&item.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("menu item not found: %d", item.ID)
+			return fmt.Errorf("%w: %d", models.ErrMenuItemNotFound, item.ID)
+		}
+		if isPgError(err, pgUniqueViolation) {
+			return fmt.Errorf("menu item with name '%s' %w", item.Name, models.ErrDuplicate)
 		}
 		return fmt.Errorf("failed to update menu item: %w", err)
 	}
@@ -114,6 +135,9 @@ func (r *menuRepository) Delete(ctx context.Context, id int) error {
 	query := `DELETE FROM menu_items WHERE id = $1`
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			return fmt.Errorf("%w: menu item %d is used in existing orders", models.ErrConflict, id)
+		}
 		return fmt.Errorf("failed to delete menu item: %w", err)
 	}
 
@@ -122,7 +146,7 @@ func (r *menuRepository) Delete(ctx context.Context, id int) error {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("menu item not found: %d", id)
+		return fmt.Errorf("%w: %d", models.ErrMenuItemNotFound, id)
 	}
 
 	return nil
@@ -150,3 +174,301 @@ func (r *menuRepository) GetCategories(ctx context.Context) ([]string, error) {
 	}
 	return categories, nil
 }
+
+// loadChoices fills in the modifier groups and bundle slots of the items
+func (r *menuRepository) loadChoices(ctx context.Context, items []models.MenuItem) error {
+	if err := r.loadModifierGroups(ctx, items); err != nil {
+		return err
+	}
+	return r.loadBundleSlots(ctx, items)
+}
+
+// loadModifierGroups fills in the modifier groups of the items, each with
+// its modifiers, in the order they were set
+func (r *menuRepository) loadModifierGroups(ctx context.Context, items []models.MenuItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	itemIDs := make([]int, len(items))
+	for i, item := range items {
+		itemIDs[i] = item.ID
+	}
+
+	var groups []models.ModifierGroup
+	groupsQuery := `
+		SELECT id, menu_item_id, name, required, min_select, max_select
+		FROM modifier_groups
+		WHERE menu_item_id = ANY($1)
+		ORDER BY position, id
+	`
+	if err := r.db.SelectContext(ctx, &groups, groupsQuery, pq.Array(itemIDs)); err != nil {
+		return fmt.Errorf("failed to get modifier groups: %w", err)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+	groupIDs := make([]int, len(groups))
+	for i, group := range groups {
+		groupIDs[i] = group.ID
+	}
+
+	var modifiers []models.Modifier
+	modifiersQuery := `
+		SELECT id, group_id, name, price_delta, available
+		FROM modifiers
+		WHERE group_id = ANY($1)
+		ORDER BY position, id
+	`
+	if err := r.db.SelectContext(ctx, &modifiers, modifiersQuery, pq.Array(groupIDs)); err != nil {
+		return fmt.Errorf("failed to get modifiers: %w", err)
+	}
+
+	for i := range groups {
+		groups[i].Modifiers = []models.Modifier{}
+		for _, modifier := range modifiers {
+			if modifier.GroupID == groups[i].ID {
+				groups[i].Modifiers = append(groups[i].Modifiers, modifier)
+			}
+		}
+	}
+	for i := range items {
+		for _, group := range groups {
+			if group.MenuItemID == items[i].ID {
+				items[i].ModifierGroups = append(items[i].ModifierGroups, group)
+			}
+		}
+	}
+	return nil
+}
+
+// SetModifierGroups replaces the modifier groups of a menu item. Groups and
+// modifiers given with an ID are updated in place, so tablets holding the
+// menu can keep ordering them; those without one are added and those left
+// out are removed. The IDs of added ones are set on groups.
+func (r *menuRepository) SetModifierGroups(ctx context.Context, itemID int, groups []models.ModifierGroup) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	keepGroups := []int{} // never NULL, which would keep every group
+	for _, group := range groups {
+		if group.ID != 0 {
+			keepGroups = append(keepGroups, group.ID)
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM modifier_groups WHERE menu_item_id = $1 AND NOT (id = ANY($2))`,
+		itemID, pq.Array(keepGroups))
+	if err != nil {
+		return fmt.Errorf("failed to remove modifier groups: %w", err)
+	}
+
+	for i := range groups {
+		group := &groups[i]
+		group.MenuItemID = itemID
+		if group.ID == 0 {
+			err = tx.GetContext(ctx, &group.ID, `
+				INSERT INTO modifier_groups (menu_item_id, name, required, min_select, max_select, position)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				RETURNING id
+			`, itemID, group.Name, group.Required, group.MinSelect, group.MaxSelect, i)
+		} else {
+			err = tx.GetContext(ctx, &group.ID, `
+				UPDATE modifier_groups
+				SET name = $3, required = $4, min_select = $5, max_select = $6, position = $7
+				WHERE id = $1 AND menu_item_id = $2
+				RETURNING id
+			`, group.ID, itemID, group.Name, group.Required, group.MinSelect, group.MaxSelect, i)
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return models.NewValidationError("modifier_groups", fmt.Sprintf("modifier group %d does not belong to this item", group.ID))
+			}
+			return fmt.Errorf("failed to save modifier group: %w", err)
+		}
+
+		if err := setModifiers(ctx, tx, group); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// setModifiers replaces the modifiers of a saved group the same way
+func setModifiers(ctx context.Context, tx *sqlx.Tx, group *models.ModifierGroup) error {
+	keep := []int{}
+	for _, modifier := range group.Modifiers {
+		if modifier.ID != 0 {
+			keep = append(keep, modifier.ID)
+		}
+	}
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM modifiers WHERE group_id = $1 AND NOT (id = ANY($2))`,
+		group.ID, pq.Array(keep))
+	if err != nil {
+		return fmt.Errorf("failed to remove modifiers: %w", err)
+	}
+
+	for i := range group.Modifiers {
+		modifier := &group.Modifiers[i]
+		modifier.GroupID = group.ID
+		if modifier.ID == 0 {
+			err = tx.GetContext(ctx, &modifier.ID, `
+				INSERT INTO modifiers (group_id, name, price_delta, available, position)
+				VALUES ($1, $2, $3, $4, $5)
+				RETURNING id
+			`, group.ID, modifier.Name, modifier.PriceDelta, modifier.Available, i)
+		} else {
+			err = tx.GetContext(ctx, &modifier.ID, `
+				UPDATE modifiers
+				SET name = $3, price_delta = $4, available = $5, position = $6
+				WHERE id = $1 AND group_id = $2
+				RETURNING id
+			`, modifier.ID, group.ID, modifier.Name, modifier.PriceDelta, modifier.Available, i)
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return models.NewValidationError("modifier_groups", fmt.Sprintf("modifier %d does not belong to group %s", modifier.ID, group.Name))
+			}
+			return fmt.Errorf("failed to save modifier: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadBundleSlots fills in the slots of the bundles among the items, each
+// with its options and the menu items they stand for
+func (r *menuRepository) loadBundleSlots(ctx context.Context, items []models.MenuItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	itemIDs := make([]int, len(items))
+	for i, item := range items {
+		itemIDs[i] = item.ID
+	}
+
+	var slots []models.BundleSlot
+	slotsQuery := `
+		SELECT id, bundle_id, name, quantity
+		FROM bundle_slots
+		WHERE bundle_id = ANY($1)
+		ORDER BY position, id
+	`
+	if err := r.db.SelectContext(ctx, &slots, slotsQuery, pq.Array(itemIDs)); err != nil {
+		return fmt.Errorf("failed to get bundle slots: %w", err)
+	}
+	if len(slots) == 0 {
+		return nil
+	}
+	slotIDs := make([]int, len(slots))
+	for i, slot := range slots {
+		slotIDs[i] = slot.ID
+	}
+
+	var options []models.BundleOption
+	optionsQuery := `
+		SELECT o.slot_id, o.menu_item_id, m.name, o.price_delta, m.available, m.shop_id, m.category
+		FROM bundle_options o
+		JOIN menu_items m ON m.id = o.menu_item_id
+		WHERE o.slot_id = ANY($1)
+		ORDER BY o.position, o.menu_item_id
+	`
+	if err := r.db.SelectContext(ctx, &options, optionsQuery, pq.Array(slotIDs)); err != nil {
+		return fmt.Errorf("failed to get bundle options: %w", err)
+	}
+
+	for i := range slots {
+		slots[i].Options = []models.BundleOption{}
+		for _, option := range options {
+			if option.SlotID == slots[i].ID {
+				slots[i].Options = append(slots[i].Options, option)
+			}
+		}
+	}
+	for i := range items {
+		for _, slot := range slots {
+			if slot.BundleID == items[i].ID {
+				items[i].BundleSlots = append(items[i].BundleSlots, slot)
+			}
+		}
+	}
+	return nil
+}
+
+// SetBundleSlots replaces the slots of a bundle. As with modifier groups,
+// slots given with an ID are updated in place, those without one are added
+// and those left out are removed; each slot's options are replaced.
+func (r *menuRepository) SetBundleSlots(ctx context.Context, bundleID int, slots []models.BundleSlot) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	keep := []int{} // never NULL, which would keep every slot
+	for _, slot := range slots {
+		if slot.ID != 0 {
+			keep = append(keep, slot.ID)
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM bundle_slots WHERE bundle_id = $1 AND NOT (id = ANY($2))`,
+		bundleID, pq.Array(keep))
+	if err != nil {
+		return fmt.Errorf("failed to remove bundle slots: %w", err)
+	}
+
+	optionQuery := `
+		INSERT INTO bundle_options (slot_id, menu_item_id, price_delta, position)
+		VALUES ($1, $2, $3, $4)
+	`
+	for i := range slots {
+		slot := &slots[i]
+		slot.BundleID = bundleID
+		if slot.ID == 0 {
+			err = tx.GetContext(ctx, &slot.ID, `
+				INSERT INTO bundle_slots (bundle_id, name, quantity, position)
+				VALUES ($1, $2, $3, $4)
+				RETURNING id
+			`, bundleID, slot.Name, slot.Quantity, i)
+		} else {
+			err = tx.GetContext(ctx, &slot.ID, `
+				UPDATE bundle_slots
+				SET name = $3, quantity = $4, position = $5
+				WHERE id = $1 AND bundle_id = $2
+				RETURNING id
+			`, slot.ID, bundleID, slot.Name, slot.Quantity, i)
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return models.NewValidationError("bundle_slots", fmt.Sprintf("bundle slot %d does not belong to this item", slot.ID))
+			}
+			return fmt.Errorf("failed to save bundle slot: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM bundle_options WHERE slot_id = $1`, slot.ID); err != nil {
+			return fmt.Errorf("failed to clear bundle options: %w", err)
+		}
+		for j := range slot.Options {
+			option := &slot.Options[j]
+			option.SlotID = slot.ID
+			if _, err := tx.ExecContext(ctx, optionQuery, slot.ID, option.MenuItemID, option.PriceDelta, j); err != nil {
+				if isPgError(err, pgForeignKeyViolation) {
+					return models.NewValidationError("bundle_slots", fmt.Sprintf("menu item %d does not exist", option.MenuItemID))
+				}
+				return fmt.Errorf("failed to add bundle option: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/testutil"
+)
+
+func TestMenuRepository_ModifierGroups(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewMenuRepository(db)
+	ctx := context.Background()
+
+	item := &models.MenuItem{Name: "Iced Latte", Price: 55, Available: true}
+	require.NoError(t, repo.Create(ctx, item))
+
+	groups := []models.ModifierGroup{
+		{Name: "Size", Required: true, MinSelect: 1, MaxSelect: 1, Modifiers: []models.Modifier{
+			{Name: "Regular", Available: true},
+			{Name: "Large", PriceDelta: 15, Available: true},
+		}},
+		{Name: "Toppings", MaxSelect: 2, Modifiers: []models.Modifier{
+			{Name: "Pearls", PriceDelta: 10, Available: true},
+		}},
+	}
+	require.NoError(t, repo.SetModifierGroups(ctx, item.ID, groups))
+	assert.NotZero(t, groups[0].ID)
+	assert.NotZero(t, groups[0].Modifiers[1].ID)
+
+	got, err := repo.GetByID(ctx, item.ID)
+	require.NoError(t, err)
+	require.Len(t, got.ModifierGroups, 2)
+	assert.Equal(t, "Size", got.ModifierGroups[0].Name)
+	assert.Equal(t, []string{"Regular", "Large"}, []string{got.ModifierGroups[0].Modifiers[0].Name, got.ModifierGroups[0].Modifiers[1].Name})
+	assert.Equal(t, 15.0, got.ModifierGroups[0].Modifiers[1].PriceDelta)
+
+	// Groups and modifiers keep their IDs when changed; left out ones go
+	large := groups[0].Modifiers[1]
+	large.PriceDelta = 20
+	changed := []models.ModifierGroup{{ID: groups[0].ID, Name: "Size", Required: true, MinSelect: 1, MaxSelect: 1, Modifiers: []models.Modifier{large}}}
+	require.NoError(t, repo.SetModifierGroups(ctx, item.ID, changed))
+
+	got, err = repo.GetByID(ctx, item.ID)
+	require.NoError(t, err)
+	require.Len(t, got.ModifierGroups, 1)
+	require.Len(t, got.ModifierGroups[0].Modifiers, 1)
+	assert.Equal(t, large.ID, got.ModifierGroups[0].Modifiers[0].ID)
+	assert.Equal(t, 20.0, got.ModifierGroups[0].Modifiers[0].PriceDelta)
+
+	// Another item's group cannot be taken over
+	other := &models.MenuItem{Name: "Iced Tea", Price: 35, Available: true}
+	require.NoError(t, repo.Create(ctx, other))
+	err = repo.SetModifierGroups(ctx, other.ID, changed)
+	assert.ErrorIs(t, err, models.ErrValidation)
+
+	// Listings carry the groups too
+	all, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	for _, listed := range all {
+		if listed.ID == item.ID {
+			assert.Len(t, listed.ModifierGroups, 1)
+		} else {
+			assert.Empty(t, listed.ModifierGroups)
+		}
+	}
+}
+
+func TestMenuRepository_BundleSlots(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewMenuRepository(db)
+	ctx := context.Background()
+
+	set := &models.MenuItem{Name: "Fries Set", Price: 75, Available: true}
+	require.NoError(t, repo.Create(ctx, set))
+
+	slots := []models.BundleSlot{
+		{Name: "Main", Quantity: 1, Options: []models.BundleOption{{MenuItemID: 2}}},
+		{Name: "Extra", Quantity: 2, Options: []models.BundleOption{{MenuItemID: 1}, {MenuItemID: 3, PriceDelta: 20}}},
+	}
+	require.NoError(t, repo.SetBundleSlots(ctx, set.ID, slots))
+	assert.NotZero(t, slots[0].ID)
+
+	// Options show the menu items they stand for
+	got, err := repo.GetByID(ctx, set.ID)
+	require.NoError(t, err)
+	require.True(t, got.IsBundle())
+	require.Len(t, got.BundleSlots, 2)
+	assert.Equal(t, "French Fries M", got.BundleSlots[0].Options[0].Name)
+	assert.True(t, got.BundleSlots[0].Options[0].Available)
+	assert.Equal(t, 2, got.BundleSlots[1].Quantity)
+	assert.Equal(t, 20.0, got.BundleSlots[1].Options[1].PriceDelta)
+
+	// Slots keep their IDs; options are replaced
+	changed := []models.BundleSlot{{ID: slots[1].ID, Name: "Extra", Quantity: 1, Options: []models.BundleOption{{MenuItemID: 3}}}}
+	require.NoError(t, repo.SetBundleSlots(ctx, set.ID, changed))
+
+	got, err = repo.GetByID(ctx, set.ID)
+	require.NoError(t, err)
+	require.Len(t, got.BundleSlots, 1)
+	assert.Equal(t, slots[1].ID, got.BundleSlots[0].ID)
+	require.Len(t, got.BundleSlots[0].Options, 1)
+	assert.Equal(t, 3, got.BundleSlots[0].Options[0].MenuItemID)
+
+	// Options must be menu items
+	err = repo.SetBundleSlots(ctx, set.ID, []models.BundleSlot{{Name: "Main", Quantity: 1, Options: []models.BundleOption{{MenuItemID: 999}}}})
+	assert.ErrorIs(t, err, models.ErrValidation)
+}
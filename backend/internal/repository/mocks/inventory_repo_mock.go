@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// MockInventoryRepository is a mock implementation of InventoryRepository
+type MockInventoryRepository struct {
+	mock.Mock
+}
+
+func (m *MockInventoryRepository) GetInventory(ctx context.Context) (*models.Inventory, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Inventory), args.Error(1)
+}
+
+func (m *MockInventoryRepository) GetItemStock(ctx context.Context, menuItemID int) (*models.ItemStock, error) {
+	args := m.Called(ctx, menuItemID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ItemStock), args.Error(1)
+}
+
+func (m *MockInventoryRepository) SetItemStock(ctx context.Context, menuItemID int, req *models.ItemStockRequest) error {
+	args := m.Called(ctx, menuItemID, req)
+	return args.Error(0)
+}
+
+func (m *MockInventoryRepository) GetIngredient(ctx context.Context, id int) (*models.Ingredient, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Ingredient), args.Error(1)
+}
+
+func (m *MockInventoryRepository) CreateIngredient(ctx context.Context, ingredient *models.Ingredient) error {
+	args := m.Called(ctx, ingredient)
+	return args.Error(0)
+}
+
+func (m *MockInventoryRepository) UpdateIngredient(ctx context.Context, ingredient *models.Ingredient) error {
+	args := m.Called(ctx, ingredient)
+	return args.Error(0)
+}
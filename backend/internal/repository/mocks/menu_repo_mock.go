@@ -63,3 +63,13 @@ func (m *MockMenuRepository) GetCategories(ctx context.Context) ([]string, error
 	}
 	return args.Get(0).([]string), args.Error(1)
 }
+
+func (m *MockMenuRepository) SetModifierGroups(ctx context.Context, itemID int, groups []models.ModifierGroup) error {
+	args := m.Called(ctx, itemID, groups)
+	return args.Error(0)
+}
+
+func (m *MockMenuRepository) SetBundleSlots(ctx context.Context, bundleID int, slots []models.BundleSlot) error {
+	args := m.Called(ctx, bundleID, slots)
+	return args.Error(0)
+}
@@ -6,11 +6,17 @@ import (
 
 	"github.com/stretchr/testify/mock"
 	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
 )
 
 // MockOrderRepository is a mock implementation of OrderRepository
 type MockOrderRepository struct {
 	mock.Mock
+
+	// StatusChanges records every change passed to TransitionStatus
+	StatusChanges []repository.StatusChange
+	// ItemsEdits records every edit passed to UpdateItems
+	ItemsEdits []repository.ItemsEdit
 }
 
 func (m *MockOrderRepository) Create(ctx context.Context, order *models.Order) error {
@@ -18,6 +24,11 @@ func (m *MockOrderRepository) Create(ctx context.Context, order *models.Order) e
 	return args.Error(0)
 }
 
+func (m *MockOrderRepository) CheckStock(ctx context.Context, items []models.OrderItem) error {
+	args := m.Called(ctx, items)
+	return args.Error(0)
+}
+
 func (m *MockOrderRepository) GetByID(ctx context.Context, id string) (*models.Order, error) {
 	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
@@ -26,16 +37,27 @@ func (m *MockOrderRepository) GetByID(ctx context.Context, id string) (*models.O
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
+func (m *MockOrderRepository) GetByClientID(ctx context.Context, clientID string) (*models.Order, error) {
+	args := m.Called(ctx, clientID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) GetByPaymentReference(ctx context.Context, provider, reference string) (*models.Order, error) {
+	args := m.Called(ctx, provider, reference)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
 func (m *MockOrderRepository) CheckDuplicateID(ctx context.Context, id string) (bool, error) {
 	args := m.Called(ctx, id)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockOrderRepository) GetNextSequence(ctx context.Context, day int) (int, error) {
-	args := m.Called(ctx, day)
-	return args.Int(0), args.Error(1)
-}
-
 func (m *MockOrderRepository) GetByStatus(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
 	args := m.Called(ctx, status)
 	if args.Get(0) == nil {
@@ -52,29 +74,88 @@ func (m *MockOrderRepository) GetByStatuses(ctx context.Context, statuses []mode
 	return args.Get(0).([]models.Order), args.Error(1)
 }
 
-func (m *MockOrderRepository) UpdateStatus(ctx context.Context, id string, status models.OrderStatus) error {
-	args := m.Called(ctx, id, status)
-	return args.Error(0)
-}
+// TransitionStatus matches on the target status. The order returned by the
+// expectation is treated as the current row: change.Check and change.Tickets
+// run against it, like the real repository does under the row lock. On
+// success the order given as an optional third return value is returned,
+// or else a copy of the current row with the new status. Payments, refunds
+// and tickets are left to the test to set up.
+func (m *MockOrderRepository) TransitionStatus(ctx context.Context, id string, change repository.StatusChange) (*models.Order, error) {
+	m.StatusChanges = append(m.StatusChanges, change)
+	args := m.Called(ctx, id, change.To)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
 
-func (m *MockOrderRepository) VerifyPayment(ctx context.Context, id string, queueNumber int, paymentMethod *models.PaymentMethod) error {
-	args := m.Called(ctx, id, queueNumber, paymentMethod)
-	return args.Error(0)
+	current := args.Get(0).(*models.Order)
+	if change.Check != nil {
+		if err := change.Check(current); err != nil {
+			return nil, err
+		}
+	}
+	if change.Tickets != nil && current.HasTickets() {
+		if _, err := change.Tickets(current); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 2 {
+		return args.Get(2).(*models.Order), nil
+	}
+	updated := *current
+	updated.Status = change.To
+	return &updated, nil
 }
 
-func (m *MockOrderRepository) CompleteOrder(ctx context.Context, id string) error {
+// UpdateItems treats the order returned by the expectation as the current
+// row: edit.Check runs against it and on success a copy with the new items,
+// total, tickets, category and shop is returned
+func (m *MockOrderRepository) UpdateItems(ctx context.Context, id string, edit repository.ItemsEdit) (*models.Order, error) {
+	m.ItemsEdits = append(m.ItemsEdits, edit)
 	args := m.Called(ctx, id)
-	return args.Error(0)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	current := args.Get(0).(*models.Order)
+	if edit.Check != nil {
+		if err := edit.Check(current); err != nil {
+			return nil, err
+		}
+	}
+
+	updated := *current
+	updated.Items = edit.Order.Items
+	updated.TotalAmount = edit.Order.TotalAmount
+	updated.Tickets = edit.Order.Tickets
+	updated.Category = edit.Order.Category
+	updated.ShopID = edit.Order.ShopID
+	for i := range updated.Tickets {
+		updated.Tickets[i].Status = updated.Status
+	}
+	return &updated, nil
 }
 
-func (m *MockOrderRepository) GetNextQueueNumber(ctx context.Context, day int) (int, error) {
-	args := m.Called(ctx, day)
-	return args.Int(0), args.Error(1)
+func (m *MockOrderRepository) GetStatusHistory(ctx context.Context, id string) ([]models.OrderStatusHistory, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OrderStatusHistory), args.Error(1)
 }
 
-func (m *MockOrderRepository) ExpireOldOrders(ctx context.Context, cutoff time.Time) (int64, error) {
-	args := m.Called(ctx, cutoff)
-	return args.Get(0).(int64), args.Error(1)
+func (m *MockOrderRepository) ExpireOldOrders(ctx context.Context, cutoff time.Time, businessDate time.Time) ([]models.Order, error) {
+	args := m.Called(ctx, cutoff, businessDate)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Order), args.Error(1)
 }
 
 func (m *MockOrderRepository) DeleteOrders(ctx context.Context, orderIDs []string) (int64, error) {
@@ -0,0 +1,26 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// MockPaymentNotificationRepository is a mock implementation of PaymentNotificationRepository
+type MockPaymentNotificationRepository struct {
+	mock.Mock
+}
+
+func (m *MockPaymentNotificationRepository) Save(ctx context.Context, provider string, notification *models.PaymentNotification) error {
+	args := m.Called(ctx, provider, notification)
+	return args.Error(0)
+}
+
+func (m *MockPaymentNotificationRepository) GetByReference(ctx context.Context, provider, reference string) (*models.PaymentNotification, error) {
+	args := m.Called(ctx, provider, reference)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentNotification), args.Error(1)
+}
@@ -0,0 +1,47 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// MockShopRepository is a mock implementation of ShopRepository
+type MockShopRepository struct {
+	mock.Mock
+}
+
+func (m *MockShopRepository) GetByID(ctx context.Context, id int) (*models.Shop, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Shop), args.Error(1)
+}
+
+func (m *MockShopRepository) GetByCode(ctx context.Context, code string) (*models.Shop, error) {
+	args := m.Called(ctx, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Shop), args.Error(1)
+}
+
+func (m *MockShopRepository) GetAll(ctx context.Context) ([]models.Shop, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Shop), args.Error(1)
+}
+
+func (m *MockShopRepository) Create(ctx context.Context, shop *models.Shop) error {
+	args := m.Called(ctx, shop)
+	return args.Error(0)
+}
+
+func (m *MockShopRepository) Update(ctx context.Context, shop *models.Shop) error {
+	args := m.Called(ctx, shop)
+	return args.Error(0)
+}
@@ -8,88 +8,223 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
 )
 
 type OrderRepository interface {
 	Create(ctx context.Context, order *models.Order) error
+	CheckStock(ctx context.Context, items []models.OrderItem) error
 	GetByID(ctx context.Context, id string) (*models.Order, error)
+	GetByClientID(ctx context.Context, clientID string) (*models.Order, error)
+	GetByPaymentReference(ctx context.Context, provider, reference string) (*models.Order, error)
 	CheckDuplicateID(ctx context.Context, id string) (bool, error)
-	GetNextSequence(ctx context.Context, dateKey int) (int, error)
 	GetByStatus(ctx context.Context, status models.OrderStatus) ([]models.Order, error)
 	GetByStatusAndCategory(ctx context.Context, status models.OrderStatus, category string) ([]models.Order, error)
 	GetByStatuses(ctx context.Context, statuses []models.OrderStatus) ([]models.Order, error)
-	UpdateStatus(ctx context.Context, id string, status models.OrderStatus) error
-	VerifyPayment(ctx context.Context, id string, queueNumber int, paymentMethod *models.PaymentMethod) error
-	CompleteOrder(ctx context.Context, id string) error
-	GetNextQueueNumber(ctx context.Context, dateKey int) (int, error)
-	ExpireOldOrders(ctx context.Context, cutoff time.Time) (int64, error)
+	TransitionStatus(ctx context.Context, id string, change StatusChange) (*models.Order, error)
+	UpdateItems(ctx context.Context, id string, edit ItemsEdit) (*models.Order, error)
+	GetStatusHistory(ctx context.Context, id string) ([]models.OrderStatusHistory, error)
+	ExpireOldOrders(ctx context.Context, cutoff time.Time, businessDate time.Time) ([]models.Order, error)
 	DeleteOrders(ctx context.Context, orderIDs []string) (int64, error)
 	DeleteAllOrders(ctx context.Context) (int64, error)
 	GetCategories(ctx context.Context) ([]string, error)
 }
 
 type orderRepository struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	idScheme utils.OrderIDScheme
 }
 
-func NewOrderRepository(db *sqlx.DB) OrderRepository {
-	return &orderRepository{db: db}
+// NewOrderRepository creates an order repository that issues IDs using idScheme
+func NewOrderRepository(db *sqlx.DB, idScheme utils.OrderIDScheme) OrderRepository {
+	return &orderRepository{db: db, idScheme: idScheme}
 }
 
-// Create inserts a new order with its items in a transaction
+// Create inserts a new order with its items in a transaction.
+// The order ID is allocated here from the per-day counter in order_sequences,
+// so order.ID is overwritten with the value generated by the repository's ID scheme.
+// An order for more than is left in stock is refused with a *models.StockError.
 func (r *orderRepository) Create(ctx context.Context, order *models.Order) error {
-	tx, err := r.db.BeginTxx(ctx, nil)
+	return r.inTx(ctx, func(tx *sqlx.Tx) error {
+		// Refuse orders for more than is left, holding the stock until the
+		// order is saved
+		if err := checkStock(ctx, tx, order.Items, ""); err != nil {
+			return err
+		}
+
+		// Allocate the next sequence for this day. The row lock taken by the
+		// upsert is held until commit, so concurrent creates are serialized here.
+		sequence, err := r.nextSequence(ctx, tx, order.BusinessDate)
+		if err != nil {
+			return err
+		}
+
+		orderID, err := r.idScheme.Generate(order.BusinessDate.Day(), int(order.BusinessDate.Month()), sequence)
+		if err != nil {
+			return fmt.Errorf("failed to generate order ID: %w", err)
+		}
+		order.ID = orderID
+
+		// Insert order
+		query := `
+			INSERT INTO orders (id, customer_name, total_amount, status, date_key, business_date, category, shop_id, created_at, client_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`
+		_, err = tx.ExecContext(ctx, query,
+			order.ID,
+			order.CustomerName,
+			order.TotalAmount,
+			order.Status,
+			order.DateKey,
+			order.BusinessDate,
+			order.Category,
+			order.ShopID,
+			order.CreatedAt,
+			order.ClientID,
+		)
+		if err != nil {
+			if isPgError(err, pgUniqueViolation) {
+				if order.ClientID != nil {
+					return fmt.Errorf("order %s or client ID %s %w", order.ID, *order.ClientID, models.ErrDuplicate)
+				}
+				return fmt.Errorf("order ID %s %w", order.ID, models.ErrDuplicate)
+			}
+			return fmt.Errorf("failed to insert order: %w", err)
+		}
+
+		if err := r.insertItems(ctx, tx, order); err != nil {
+			return err
+		}
+		return r.insertTickets(ctx, tx, order)
+	})
+}
+
+// CheckStock checks there is enough stock left for the given order lines
+// after what unpaid orders hold, returning a *models.StockError if not. It
+// locks nothing, so stock can still run out before the order is created;
+// Create checks again.
+func (r *orderRepository) CheckStock(ctx context.Context, items []models.OrderItem) error {
+	menuItemIDs := orderedMenuItems(items)
+	if len(menuItemIDs) == 0 {
+		return nil
+	}
+	limits, err := stockLimits(ctx, r.db, menuItemIDs, "")
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return err
 	}
-	defer func() {
-		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
-			log.Println("rollback failed:", err)
+	return limits.Check(items)
+}
+
+// insertItems inserts the order's items with the modifiers picked on them.
+// The components of a bundle line are inserted after it, pointing back at it.
+func (r *orderRepository) insertItems(ctx context.Context, tx *sqlx.Tx, order *models.Order) error {
+	for i := range order.Items {
+		item := &order.Items[i]
+		if err := r.insertItem(ctx, tx, order, item, nil); err != nil {
+			return err
 		}
-	}()
+		for j := range item.Components {
+			if err := r.insertItem(ctx, tx, order, &item.Components[j], &item.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-	// Insert order
-	query := `
-		INSERT INTO orders (id, customer_name, total_amount, status, date_key, category, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+// insertItem inserts one line of an order and its modifiers, setting its ID
+func (r *orderRepository) insertItem(ctx context.Context, tx *sqlx.Tx, order *models.Order, item *models.OrderItem, bundleItemID *int) error {
+	itemQuery := `
+		INSERT INTO order_items (order_id, business_date, menu_item_id, name, price, quantity, shop_id, bundle_item_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	modifierQuery := `
+		INSERT INTO order_item_modifiers (order_item_id, modifier_id, group_name, name, price_delta)
+		VALUES ($1, $2, $3, $4, $5)
 	`
-	_, err = tx.ExecContext(ctx, query,
+	item.OrderID = order.ID
+	item.BusinessDate = order.BusinessDate
+	item.BundleItemID = bundleItemID
+	err := tx.GetContext(ctx, &item.ID, itemQuery,
 		order.ID,
-		order.CustomerName,
-		order.TotalAmount,
-		order.Status,
-		order.DateKey,
-		order.Category,
-		order.CreatedAt,
+		order.BusinessDate,
+		item.MenuItemID,
+		item.Name,
+		item.Price,
+		item.Quantity,
+		item.ShopID,
+		bundleItemID,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert order: %w", err)
+		return fmt.Errorf("failed to insert order item: %w", err)
 	}
 
-	// Insert order items
-	itemQuery := `
-		INSERT INTO order_items (order_id, menu_item_id, name, price, quantity)
-		VALUES ($1, $2, $3, $4, $5)
+	for j := range item.Modifiers {
+		modifier := &item.Modifiers[j]
+		modifier.OrderItemID = item.ID
+		_, err := tx.ExecContext(ctx, modifierQuery,
+			item.ID,
+			modifier.ModifierID,
+			modifier.Group,
+			modifier.Name,
+			modifier.PriceDelta,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert order item modifier: %w", err)
+		}
+	}
+	return nil
+}
+
+// insertTickets inserts the per-shop tickets of an order spanning several
+// shops, with the order's status
+func (r *orderRepository) insertTickets(ctx context.Context, tx *sqlx.Tx, order *models.Order) error {
+	ticketQuery := `
+		INSERT INTO order_tickets (order_id, business_date, shop_id, category, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
-	for _, item := range order.Items {
-		_, err = tx.ExecContext(ctx, itemQuery,
+	for i := range order.Tickets {
+		ticket := &order.Tickets[i]
+		ticket.OrderID = order.ID
+		ticket.BusinessDate = order.BusinessDate
+		ticket.Status = order.Status
+		ticket.CreatedAt = order.CreatedAt
+		for j := range ticket.Items {
+			ticket.Items[j].OrderID = order.ID
+			ticket.Items[j].BusinessDate = order.BusinessDate
+		}
+		_, err := tx.ExecContext(ctx, ticketQuery,
 			order.ID,
-			item.MenuItemID,
-			item.Name,
-			item.Price,
-			item.Quantity,
+			order.BusinessDate,
+			ticket.ShopID,
+			ticket.Category,
+			ticket.Status,
+			ticket.CreatedAt,
 		)
 		if err != nil {
-			return fmt.Errorf("failed to insert order item: %w", err)
+			return fmt.Errorf("failed to insert order ticket: %w", err)
 		}
 	}
+	return nil
+}
 
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+// nextSequence increments and returns the order counter for a business date.
+// Must be called inside the transaction that inserts the order.
+func (r *orderRepository) nextSequence(ctx context.Context, tx *sqlx.Tx, businessDate time.Time) (int, error) {
+	var sequence int
+	query := `
+		INSERT INTO order_sequences (business_date, last_seq)
+		VALUES ($1, 1)
+		ON CONFLICT (business_date) DO UPDATE SET last_seq = order_sequences.last_seq + 1
+		RETURNING last_seq
+	`
+	if err := tx.GetContext(ctx, &sequence, query, businessDate); err != nil {
+		return 0, fmt.Errorf("failed to get next sequence: %w", err)
 	}
-
-	return nil
+	return sequence, nil
 }
 
 // CheckDuplicateID checks if an order ID already exists
@@ -103,68 +238,93 @@ func (r *orderRepository) CheckDuplicateID(ctx context.Context, id string) (bool
 	return exists, nil
 }
 
-// GetNextSequence gets the next sequence number for a given date key (DDMM format)
-func (r *orderRepository) GetNextSequence(ctx context.Context, dateKey int) (int, error) {
-	var maxSeq sql.NullInt64
-	query := `
-		SELECT MAX(CAST(SUBSTRING(id, 5) AS INTEGER))
-		FROM orders
-		WHERE date_key = $1
-	`
-	err := r.db.GetContext(ctx, &maxSeq, query, dateKey)
-	if err != nil && err != sql.ErrNoRows {
-		return 0, fmt.Errorf("failed to get next sequence: %w", err)
+// GetByID retrieves an order with its items.
+// Order codes repeat every year, so the most recent business date wins.
+func (r *orderRepository) GetByID(ctx context.Context, id string) (*models.Order, error) {
+	var order models.Order
+	query := `SELECT * FROM orders WHERE id = $1 ORDER BY business_date DESC LIMIT 1`
+	err := r.db.GetContext(ctx, &order, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", models.ErrOrderNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	if !maxSeq.Valid {
-		return 1, nil
+	// Get order items and tickets
+	if err := r.loadDetails(ctx, r.db, &order); err != nil {
+		return nil, err
 	}
 
-	return int(maxSeq.Int64) + 1, nil
+	return &order, nil
 }
 
-// GetByID retrieves an order with its items
-func (r *orderRepository) GetByID(ctx context.Context, id string) (*models.Order, error) {
+// GetByClientID retrieves the order synced from a tablet under clientID
+func (r *orderRepository) GetByClientID(ctx context.Context, clientID string) (*models.Order, error) {
 	var order models.Order
-	query := `SELECT * FROM orders WHERE id = $1`
-	err := r.db.GetContext(ctx, &order, query, id)
+	query := `SELECT * FROM orders WHERE client_id = $1`
+	err := r.db.GetContext(ctx, &order, query, clientID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("order not found: %s", id)
+			return nil, fmt.Errorf("%w: client ID %s", models.ErrOrderNotFound, clientID)
 		}
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	// Get order items
-	var items []models.OrderItem
-	itemsQuery := `SELECT * FROM order_items WHERE order_id = $1`
-	err = r.db.SelectContext(ctx, &items, itemsQuery, id)
+	if err := r.loadDetails(ctx, r.db, &order); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// GetByPaymentReference retrieves the order paid with a transaction that the
+// payment provider confirmed
+func (r *orderRepository) GetByPaymentReference(ctx context.Context, provider, reference string) (*models.Order, error) {
+	var order models.Order
+	query := `
+		SELECT o.* FROM orders o
+		JOIN payments p ON p.order_id = o.id AND p.business_date = o.business_date
+		WHERE p.verified_by = $1 AND p.reference = $2
+	`
+	err := r.db.GetContext(ctx, &order, query, provider, reference)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order items: %w", err)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: payment %s", models.ErrOrderNotFound, reference)
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if err := r.loadDetails(ctx, r.db, &order); err != nil {
+		return nil, err
 	}
-	order.Items = items
 
 	return &order, nil
 }
 
-// GetByStatus retrieves all orders with a specific status
+// GetByStatus retrieves all orders with a specific status. Orders split into
+// tickets are also included when one of their tickets has the status.
 func (r *orderRepository) GetByStatus(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
 	var orders []models.Order
-	query := `SELECT * FROM orders WHERE status = $1 ORDER BY created_at ASC`
+	query := `
+		SELECT * FROM orders o
+		WHERE o.status = $1
+			OR EXISTS (
+				SELECT 1 FROM order_tickets t
+				WHERE t.business_date = o.business_date AND t.order_id = o.id AND t.status = $1
+			)
+		ORDER BY created_at ASC
+	`
 	err := r.db.SelectContext(ctx, &orders, query, status)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get orders by status: %w", err)
 	}
 
-	// Get items for each order
+	// Get items and tickets for each order
 	for i := range orders {
-		var items []models.OrderItem
-		itemsQuery := `SELECT * FROM order_items WHERE order_id = $1`
-		err = r.db.SelectContext(ctx, &items, itemsQuery, orders[i].ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get order items: %w", err)
+		if err := r.loadDetails(ctx, r.db, &orders[i]); err != nil {
+			return nil, err
 		}
-		orders[i].Items = items
 	}
 
 	return orders, nil
@@ -193,133 +353,619 @@ func (r *orderRepository) GetByStatuses(ctx context.Context, statuses []models.O
 		return nil, fmt.Errorf("failed to get orders by statuses: %w", err)
 	}
 
-	// Get items for each order
+	// Get items and tickets for each order
 	for i := range orders {
-		var items []models.OrderItem
-		itemsQuery := `SELECT * FROM order_items WHERE order_id = $1`
-		err = r.db.SelectContext(ctx, &items, itemsQuery, orders[i].ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get order items: %w", err)
+		if err := r.loadDetails(ctx, r.db, &orders[i]); err != nil {
+			return nil, err
 		}
-		orders[i].Items = items
 	}
 
 	return orders, nil
 }
 
-// UpdateStatus updates the status of an order
-func (r *orderRepository) UpdateStatus(ctx context.Context, id string, status models.OrderStatus) error {
-	query := `UPDATE orders SET status = $1 WHERE id = $2`
-	result, err := r.db.ExecContext(ctx, query, status, id)
+// StatusChange describes a status transition applied by TransitionStatus.
+// The rules for which transitions are allowed live in the service layer and
+// are passed in as Check, which runs against the locked row.
+type StatusChange struct {
+	// To is the new status
+	To models.OrderStatus
+	// Check validates the transition against the current (locked) order
+	Check func(current *models.Order) error
+	// Tickets picks the shops whose tickets move to READY or COMPLETED when
+	// the order is split into tickets; the order itself then follows its
+	// tickets. Without it every ticket moves with the order.
+	Tickets func(current *models.Order) ([]int, error)
+	// Payment is added to the order's ledger after Check passes (Check may
+	// fill in its amounts from the locked order). The order only moves to
+	// PAID once its payments cover the total; until then it is returned
+	// unchanged with the new payment.
+	Payment *models.Payment
+	// Refund is added to the order's refunds after Check passes (Check fills
+	// in its amount and items from the locked order). The order only moves
+	// to REFUNDED once every item is refunded; until then it is returned
+	// unchanged with the new refund.
+	Refund *models.Refund
+	// Actor and Reason are written to order_status_history
+	Actor  string
+	Reason string
+}
+
+// TransitionStatus moves the most recent order with the given code to a new status.
+// The order row is locked, change.Check is run against it, status-specific
+// fields are set (queue number and paid_at for PAID, ready_at for READY,
+// completed_at for COMPLETED) and the transition is recorded in
+// order_status_history, all in one transaction.
+// For an order split into tickets, paying or cancelling moves every ticket
+// (each paid ticket gets its own queue number), while READY and COMPLETED
+// move the tickets chosen by change.Tickets.
+// Moving to PAID with change.Payment records the payment first, and only
+// completes the move once the ledger covers the order's total; likewise
+// moving to REFUNDED with change.Refund records the refund, puts the refunded
+// items that were not prepared yet back into stock, and only completes the
+// move once every item is refunded (setting refunded_at).
+// Returns the updated order with its items, tickets, payments and refunds.
+func (r *orderRepository) TransitionStatus(ctx context.Context, id string, change StatusChange) (*models.Order, error) {
+	var order models.Order
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		current, err := r.lockOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := r.loadDetails(ctx, tx, current); err != nil {
+			return err
+		}
+		if change.Check != nil {
+			if err := change.Check(current); err != nil {
+				return err
+			}
+		}
+
+		if change.Payment != nil {
+			if err := r.insertPayment(ctx, tx, current, change.Payment, change.Actor); err != nil {
+				return err
+			}
+			current.Payments = append(current.Payments, *change.Payment)
+			if current.Balance() > 0 {
+				order = *current
+				return nil
+			}
+		}
+
+		if change.Refund != nil {
+			if err := r.insertRefund(ctx, tx, current, change.Refund, change.Actor); err != nil {
+				return err
+			}
+			// Items refunded before they were prepared go back into stock
+			if err := restockRefund(ctx, tx, current, change.Refund); err != nil {
+				return err
+			}
+			current.Refunds = append(current.Refunds, *change.Refund)
+			if !current.FullyRefunded() {
+				order = *current
+				return nil
+			}
+		}
+
+		to := change.To
+		ticketsMoved := false
+		if current.HasTickets() && change.Tickets != nil &&
+			(to == models.OrderStatusReady || to == models.OrderStatusCompleted) {
+			shopIDs, err := change.Tickets(current)
+			if err != nil {
+				return err
+			}
+			for _, shopID := range shopIDs {
+				ticket := findTicket(current, shopID)
+				if ticket == nil {
+					return fmt.Errorf("%w: %s has no ticket for shop %d", models.ErrOrderNotFound, id, shopID)
+				}
+				if err := r.setTicketStatus(ctx, tx, current, shopID, to); err != nil {
+					return err
+				}
+				if err := r.recordHistory(ctx, tx, current, ticket.Status, to, &shopID, change); err != nil {
+					return err
+				}
+			}
+			if err := r.loadDetails(ctx, tx, current); err != nil {
+				return err
+			}
+			ticketsMoved = true
+
+			// The order follows once all of its tickets have moved
+			to = current.StatusFromTickets()
+			if to == current.Status {
+				order = *current
+				return nil
+			}
+		}
+
+		var query string
+		args := []interface{}{to, id, current.BusinessDate}
+
+		switch to {
+		case models.OrderStatusPaid:
+			// Stock held while the order was unpaid is taken off for good
+			if err := takeStock(ctx, tx, current); err != nil {
+				return err
+			}
+			// Queue numbers come from the per-day counter in the same transaction,
+			// so concurrent cashiers can never hand out the same number. Split
+			// orders are called out by their tickets' numbers instead.
+			var queueNumber *int
+			if !current.HasTickets() {
+				n, err := r.nextQueueNumber(ctx, tx, current.BusinessDate)
+				if err != nil {
+					return err
+				}
+				queueNumber = &n
+			}
+			query = `UPDATE orders SET status = $1, queue_number = $4, paid_at = NOW() AT TIME ZONE 'UTC', payment_method = $5`
+			args = append(args, queueNumber, current.MainPaymentMethod())
+		case models.OrderStatusReady:
+			query = `UPDATE orders SET status = $1, ready_at = NOW() AT TIME ZONE 'UTC'`
+		case models.OrderStatusCompleted:
+			query = `UPDATE orders SET status = $1, completed_at = NOW() AT TIME ZONE 'UTC'`
+		case models.OrderStatusRefunded:
+			query = `UPDATE orders SET status = $1, refunded_at = NOW() AT TIME ZONE 'UTC'`
+		default:
+			query = `UPDATE orders SET status = $1`
+		}
+		query += ` WHERE id = $2 AND business_date = $3 RETURNING *`
+
+		if err := tx.GetContext(ctx, &order, query, args...); err != nil {
+			return fmt.Errorf("failed to update order status: %w", err)
+		}
+
+		// Whole-order moves take every ticket along
+		if !ticketsMoved {
+			for _, ticket := range current.Tickets {
+				if err := r.setTicketStatus(ctx, tx, current, ticket.ShopID, to); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := r.recordHistory(ctx, tx, current, current.Status, to, nil, change); err != nil {
+			return err
+		}
+
+		return r.loadDetails(ctx, tx, &order)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return &order, nil
+}
+
+// ItemsEdit replaces the items of an order that hasn't been paid yet
+type ItemsEdit struct {
+	// Check validates the edit against the current (locked) order
+	Check func(current *models.Order) error
+	// Order holds the new items, total, tickets, category and shop; the
+	// rest of the order is kept
+	Order *models.Order
+	// Actor is written to order_status_history, with the reason Describe
+	// gives for the current items being replaced
+	Actor    string
+	Describe func(current *models.Order) string
+}
+
+// UpdateItems replaces the items of the most recent order with the given
+// code. The order row is locked and edit.Check is run against it; the items,
+// total, category, shop and tickets are then replaced and the edit is
+// recorded in order_status_history (the status stays the same), all in one
+// transaction. New items needing more than is left in stock are refused with
+// a *models.StockError. Returns the updated order with its items, tickets and
+// payments.
+func (r *orderRepository) UpdateItems(ctx context.Context, id string, edit ItemsEdit) (*models.Order, error) {
+	var order models.Order
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		current, err := r.lockOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := r.loadDetails(ctx, tx, current); err != nil {
+			return err
+		}
+		if edit.Check != nil {
+			if err := edit.Check(current); err != nil {
+				return err
+			}
+		}
+		// What the order holds already is available to it
+		if err := checkStock(ctx, tx, edit.Order.Items, current.ID); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE orders SET total_amount = $3, category = $4, shop_id = $5
+			WHERE id = $1 AND business_date = $2
+			RETURNING *
+		`
+		if err := tx.GetContext(ctx, &order, query, current.ID, current.BusinessDate, edit.Order.TotalAmount, edit.Order.Category, edit.Order.ShopID); err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM order_items WHERE order_id = $1 AND business_date = $2`, current.ID, current.BusinessDate); err != nil {
+			return fmt.Errorf("failed to delete order items: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM order_tickets WHERE order_id = $1 AND business_date = $2`, current.ID, current.BusinessDate); err != nil {
+			return fmt.Errorf("failed to delete order tickets: %w", err)
+		}
+		order.Items = edit.Order.Items
+		order.Tickets = edit.Order.Tickets
+		if err := r.insertItems(ctx, tx, &order); err != nil {
+			return err
+		}
+		if err := r.insertTickets(ctx, tx, &order); err != nil {
+			return err
+		}
+
+		reason := ""
+		if edit.Describe != nil {
+			reason = edit.Describe(current)
+		}
+		change := StatusChange{Actor: edit.Actor, Reason: reason}
+		if err := r.recordHistory(ctx, tx, current, current.Status, current.Status, nil, change); err != nil {
+			return err
+		}
+
+		return r.loadDetails(ctx, tx, &order)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("order not found: %s", id)
+		return nil, err
 	}
 
-	return nil
+	return &order, nil
 }
 
-// VerifyPayment marks an order as paid and assigns a queue number
-func (r *orderRepository) VerifyPayment(ctx context.Context, id string, queueNumber int, paymentMethod *models.PaymentMethod) error {
+// insertPayment adds a payment to the order's ledger, filling in its ID,
+// order and time
+func (r *orderRepository) insertPayment(ctx context.Context, tx *sqlx.Tx, order *models.Order, payment *models.Payment, actor string) error {
+	payment.OrderID = order.ID
+	payment.BusinessDate = order.BusinessDate
+	payment.Actor = actor
 	query := `
-		UPDATE orders
-		SET status = $1, queue_number = $2, paid_at = NOW(), payment_method = $3
-		WHERE id = $4 AND status = $5
+		INSERT INTO payments (order_id, business_date, amount, method, received, change_given, reference, verified_by, actor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
 	`
-	result, err := r.db.ExecContext(ctx, query, models.OrderStatusPaid, queueNumber, paymentMethod, id, models.OrderStatusPendingPayment)
+	err := tx.QueryRowContext(ctx, query,
+		payment.OrderID,
+		payment.BusinessDate,
+		payment.Amount,
+		payment.Method,
+		payment.Received,
+		payment.Change,
+		payment.Reference,
+		payment.VerifiedBy,
+		payment.Actor,
+	).Scan(&payment.ID, &payment.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to verify payment: %w", err)
+		if isPgError(err, pgUniqueViolation) {
+			return fmt.Errorf("payment %s %w", *payment.Reference, models.ErrDuplicate)
+		}
+		return fmt.Errorf("failed to record payment: %w", err)
 	}
+	return nil
+}
 
-	rowsAffected, err := result.RowsAffected()
+// insertRefund adds a refund and its items to the order, filling in its ID,
+// order and time
+func (r *orderRepository) insertRefund(ctx context.Context, tx *sqlx.Tx, order *models.Order, refund *models.Refund, actor string) error {
+	refund.OrderID = order.ID
+	refund.BusinessDate = order.BusinessDate
+	refund.Actor = actor
+	query := `
+		INSERT INTO refunds (order_id, business_date, amount, method, reason, actor)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	err := tx.QueryRowContext(ctx, query,
+		refund.OrderID,
+		refund.BusinessDate,
+		refund.Amount,
+		refund.Method,
+		refund.Reason,
+		refund.Actor,
+	).Scan(&refund.ID, &refund.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to record refund: %w", err)
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("order not found or not in pending payment status: %s", id)
+
+	itemQuery := `INSERT INTO refund_items (refund_id, order_item_id, quantity, amount) VALUES ($1, $2, $3, $4)`
+	for i := range refund.Items {
+		refund.Items[i].RefundID = refund.ID
+		item := refund.Items[i]
+		if _, err := tx.ExecContext(ctx, itemQuery, item.RefundID, item.OrderItemID, item.Quantity, item.Amount); err != nil {
+			return fmt.Errorf("failed to record refund item: %w", err)
+		}
 	}
+	return nil
+}
+
+// setTicketStatus moves one ticket of an order, setting the same
+// status-specific fields as the order (a queue number when paid)
+func (r *orderRepository) setTicketStatus(ctx context.Context, tx *sqlx.Tx, order *models.Order, shopID int, to models.OrderStatus) error {
+	var query string
+	args := []interface{}{to, order.ID, order.BusinessDate, shopID}
 
+	switch to {
+	case models.OrderStatusPaid:
+		queueNumber, err := r.nextQueueNumber(ctx, tx, order.BusinessDate)
+		if err != nil {
+			return err
+		}
+		query = `UPDATE order_tickets SET status = $1, queue_number = $5`
+		args = append(args, queueNumber)
+	case models.OrderStatusReady:
+		query = `UPDATE order_tickets SET status = $1, ready_at = NOW() AT TIME ZONE 'UTC'`
+	case models.OrderStatusCompleted:
+		query = `UPDATE order_tickets SET status = $1, completed_at = NOW() AT TIME ZONE 'UTC'`
+	default:
+		query = `UPDATE order_tickets SET status = $1`
+	}
+	query += ` WHERE order_id = $2 AND business_date = $3 AND shop_id = $4`
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update ticket status: %w", err)
+	}
 	return nil
 }
 
-// CompleteOrder marks an order as completed
-func (r *orderRepository) CompleteOrder(ctx context.Context, id string) error {
+// recordHistory writes one transition to order_status_history. shopID is set
+// when only that shop's ticket changed.
+func (r *orderRepository) recordHistory(ctx context.Context, tx *sqlx.Tx, order *models.Order, from, to models.OrderStatus, shopID *int, change StatusChange) error {
 	query := `
-		UPDATE orders
-		SET status = $1, completed_at = NOW()
-		WHERE id = $2 AND status = $3
+		INSERT INTO order_status_history (order_id, business_date, from_status, to_status, actor, reason, shop_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
-	result, err := r.db.ExecContext(ctx, query, models.OrderStatusCompleted, id, models.OrderStatusPaid)
-	if err != nil {
-		return fmt.Errorf("failed to complete order: %w", err)
+	if _, err := tx.ExecContext(ctx, query, order.ID, order.BusinessDate, from, to, change.Actor, change.Reason, shopID); err != nil {
+		return fmt.Errorf("failed to record status history: %w", err)
 	}
+	return nil
+}
 
-	rowsAffected, err := result.RowsAffected()
+// findTicket returns the order's ticket for a shop, or nil
+func findTicket(order *models.Order, shopID int) *models.OrderTicket {
+	for i := range order.Tickets {
+		if order.Tickets[i].ShopID == shopID {
+			return &order.Tickets[i]
+		}
+	}
+	return nil
+}
+
+// GetStatusHistory returns the recorded transitions of the most recent order
+// with the given code, oldest first
+func (r *orderRepository) GetStatusHistory(ctx context.Context, id string) ([]models.OrderStatusHistory, error) {
+	order, err := r.GetByID(ctx, id)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return nil, err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("order not found or not in paid status: %s", id)
+
+	var history []models.OrderStatusHistory
+	query := `
+		SELECT * FROM order_status_history
+		WHERE order_id = $1 AND business_date = $2
+		ORDER BY id
+	`
+	if err := r.db.SelectContext(ctx, &history, query, order.ID, order.BusinessDate); err != nil {
+		return nil, fmt.Errorf("failed to get status history: %w", err)
 	}
 
-	return nil
+	return history, nil
+}
+
+// lockOrder loads the most recent order with the given code using FOR UPDATE
+// so its status cannot change until the surrounding transaction finishes
+func (r *orderRepository) lockOrder(ctx context.Context, tx *sqlx.Tx, id string) (*models.Order, error) {
+	var order models.Order
+	query := `SELECT * FROM orders WHERE id = $1 ORDER BY business_date DESC LIMIT 1 FOR UPDATE`
+	err := tx.GetContext(ctx, &order, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", models.ErrOrderNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to lock order: %w", err)
+	}
+	return &order, nil
 }
 
-// GetNextQueueNumber gets the next queue number for a given date key (DDMM format)
-func (r *orderRepository) GetNextQueueNumber(ctx context.Context, dateKey int) (int, error) {
-	var maxQueue sql.NullInt64
+// nextQueueNumber increments and returns the queue counter for a business date.
+// Must be called inside the transaction that marks the order as paid.
+func (r *orderRepository) nextQueueNumber(ctx context.Context, tx *sqlx.Tx, businessDate time.Time) (int, error) {
+	var queueNumber int
 	query := `
-		SELECT MAX(queue_number)
-		FROM orders
-		WHERE date_key = $1 AND queue_number IS NOT NULL
+		INSERT INTO order_sequences (business_date, last_queue)
+		VALUES ($1, 1)
+		ON CONFLICT (business_date) DO UPDATE SET last_queue = order_sequences.last_queue + 1
+		RETURNING last_queue
 	`
-	err := r.db.GetContext(ctx, &maxQueue, query, dateKey)
-	if err != nil && err != sql.ErrNoRows {
+	if err := tx.GetContext(ctx, &queueNumber, query, businessDate); err != nil {
 		return 0, fmt.Errorf("failed to get next queue number: %w", err)
 	}
+	return queueNumber, nil
+}
 
-	if !maxQueue.Valid {
-		return 1, nil
+// getItems loads the items of an order, with their modifiers and bundle
+// components, using either the pool or a transaction
+func (r *orderRepository) getItems(ctx context.Context, q sqlx.QueryerContext, order *models.Order) ([]models.OrderItem, error) {
+	var items []models.OrderItem
+	itemsQuery := `SELECT * FROM order_items WHERE order_id = $1 AND business_date = $2 ORDER BY id`
+	if err := sqlx.SelectContext(ctx, q, &items, itemsQuery, order.ID, order.BusinessDate); err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	if len(items) == 0 {
+		return items, nil
 	}
 
-	return int(maxQueue.Int64) + 1, nil
+	itemIDs := make([]int, len(items))
+	for i, item := range items {
+		itemIDs[i] = item.ID
+	}
+	var modifiers []models.OrderItemModifier
+	modifiersQuery := `SELECT * FROM order_item_modifiers WHERE order_item_id = ANY($1) ORDER BY order_item_id, modifier_id`
+	if err := sqlx.SelectContext(ctx, q, &modifiers, modifiersQuery, pq.Array(itemIDs)); err != nil {
+		return nil, fmt.Errorf("failed to get order item modifiers: %w", err)
+	}
+	for i := range items {
+		for _, modifier := range modifiers {
+			if modifier.OrderItemID == items[i].ID {
+				items[i].Modifiers = append(items[i].Modifiers, modifier)
+			}
+		}
+	}
+
+	// Components come after their bundle line and are listed under it
+	var lines []models.OrderItem
+	for _, item := range items {
+		if item.BundleItemID == nil {
+			lines = append(lines, item)
+			continue
+		}
+		for i := range lines {
+			if lines[i].ID == *item.BundleItemID {
+				lines[i].Components = append(lines[i].Components, item)
+			}
+		}
+	}
+	return lines, nil
 }
 
-// ExpireOldOrders cancels all orders in PENDING_PAYMENT status that were created before the cutoff time.
-// Returns the number of orders that were expired.
-func (r *orderRepository) ExpireOldOrders(ctx context.Context, cutoff time.Time) (int64, error) {
-	query := `
-		UPDATE orders
-		SET status = $1
-		WHERE status = $2 AND created_at < $3
-	`
-	result, err := r.db.ExecContext(ctx, query, models.OrderStatusCancelled, models.OrderStatusPendingPayment, cutoff)
+// loadDetails fills in the items, tickets, payments and refunds of an order using
+// either the pool or a transaction. Each ticket gets the items of its shop,
+// bundle components included.
+func (r *orderRepository) loadDetails(ctx context.Context, q sqlx.QueryerContext, order *models.Order) error {
+	items, err := r.getItems(ctx, q, order)
 	if err != nil {
-		return 0, fmt.Errorf("failed to expire old orders: %w", err)
+		return err
 	}
+	order.Items = items
 
-	rowsAffected, err := result.RowsAffected()
+	var tickets []models.OrderTicket
+	ticketsQuery := `SELECT * FROM order_tickets WHERE order_id = $1 AND business_date = $2 ORDER BY shop_id`
+	if err := sqlx.SelectContext(ctx, q, &tickets, ticketsQuery, order.ID, order.BusinessDate); err != nil {
+		return fmt.Errorf("failed to get order tickets: %w", err)
+	}
+	for i := range tickets {
+		for _, item := range order.PreparedItems() {
+			if item.ShopID != nil && *item.ShopID == tickets[i].ShopID {
+				tickets[i].Items = append(tickets[i].Items, item)
+			}
+		}
+	}
+	order.Tickets = tickets
+
+	var payments []models.Payment
+	paymentsQuery := `SELECT * FROM payments WHERE order_id = $1 AND business_date = $2 ORDER BY id`
+	if err := sqlx.SelectContext(ctx, q, &payments, paymentsQuery, order.ID, order.BusinessDate); err != nil {
+		return fmt.Errorf("failed to get payments: %w", err)
+	}
+	order.Payments = payments
+
+	var refunds []models.Refund
+	refundsQuery := `SELECT * FROM refunds WHERE order_id = $1 AND business_date = $2 ORDER BY id`
+	if err := sqlx.SelectContext(ctx, q, &refunds, refundsQuery, order.ID, order.BusinessDate); err != nil {
+		return fmt.Errorf("failed to get refunds: %w", err)
+	}
+	if len(refunds) > 0 {
+		var refundItems []models.RefundItem
+		refundItemsQuery := `
+			SELECT ri.* FROM refund_items ri
+			JOIN refunds rf ON rf.id = ri.refund_id
+			WHERE rf.order_id = $1 AND rf.business_date = $2
+			ORDER BY ri.refund_id, ri.order_item_id
+		`
+		if err := sqlx.SelectContext(ctx, q, &refundItems, refundItemsQuery, order.ID, order.BusinessDate); err != nil {
+			return fmt.Errorf("failed to get refund items: %w", err)
+		}
+		for i := range refunds {
+			for _, item := range refundItems {
+				if item.RefundID == refunds[i].ID {
+					refunds[i].Items = append(refunds[i].Items, item)
+				}
+			}
+		}
+	}
+	order.Refunds = refunds
+
+	return nil
+}
+
+// inTx runs fn inside a transaction, committing on success and rolling back on error
+func (r *orderRepository) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Println("rollback failed:", err)
+		}
+	}()
 
-	return rowsAffected, nil
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireOldOrders cancels all orders in PENDING_PAYMENT status that were created before the cutoff time
+// or belong to a business day before businessDate, along with their tickets, recording each in order_status_history.
+// Orders with part of their total paid are left alone so the payments are not stranded.
+// Returns the orders that were expired (without items).
+func (r *orderRepository) ExpireOldOrders(ctx context.Context, cutoff time.Time, businessDate time.Time) ([]models.Order, error) {
+	var orders []models.Order
+	query := `
+		WITH expired AS (
+			UPDATE orders
+			SET status = $1
+			WHERE status = $2 AND (created_at < $3 OR business_date < $4)
+				AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.business_date = orders.business_date AND p.order_id = orders.id)
+			RETURNING *
+		), tickets AS (
+			UPDATE order_tickets t
+			SET status = $1
+			FROM expired e
+			WHERE t.business_date = e.business_date AND t.order_id = e.id
+		), history AS (
+			INSERT INTO order_status_history (order_id, business_date, from_status, to_status, actor, reason)
+			SELECT id, business_date, $2, $1, 'system',
+				CASE WHEN business_date < $4 THEN 'expired: unpaid at end of business day' ELSE 'expired: unpaid too long' END
+			FROM expired
+		)
+		SELECT * FROM expired
+	`
+	err := r.db.SelectContext(ctx, &orders, query, models.OrderStatusCancelled, models.OrderStatusPendingPayment, cutoff, businessDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire old orders: %w", err)
+	}
+
+	return orders, nil
 }
 
-// DeleteOrders deletes orders by their IDs
+// DeleteOrders deletes orders by their IDs (the most recent order for each code)
 func (r *orderRepository) DeleteOrders(ctx context.Context, orderIDs []string) (int64, error) {
 	if len(orderIDs) == 0 {
 		return 0, nil
 	}
 
-	query, args, err := sqlx.In(`DELETE FROM orders WHERE id IN (?)`, orderIDs)
+	query, args, err := sqlx.In(`
+		DELETE FROM orders
+		WHERE (business_date, id) IN (
+			SELECT DISTINCT ON (id) business_date, id
+			FROM orders
+			WHERE id IN (?)
+			ORDER BY id, business_date DESC
+		)
+	`, orderIDs)
 	if err != nil {
 		return 0, fmt.Errorf("failed to build query: %w", err)
 	}
@@ -338,39 +984,59 @@ func (r *orderRepository) DeleteOrders(ctx context.Context, orderIDs []string) (
 	return rowsAffected, nil
 }
 
-// DeleteAllOrders deletes all orders from the database
+// DeleteAllOrders deletes all orders from the database and resets the
+// per-day order sequences so numbering starts again from 001
 func (r *orderRepository) DeleteAllOrders(ctx context.Context) (int64, error) {
-	result, err := r.db.ExecContext(ctx, `DELETE FROM orders`)
-	if err != nil {
-		return 0, fmt.Errorf("failed to delete all orders: %w", err)
-	}
+	var rowsAffected int64
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM orders`)
+		if err != nil {
+			return fmt.Errorf("failed to delete all orders: %w", err)
+		}
 
-	rowsAffected, err := result.RowsAffected()
+		rowsAffected, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM order_sequences`); err != nil {
+			return fmt.Errorf("failed to reset order sequences: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+		return 0, err
 	}
 
 	return rowsAffected, nil
 }
 
-// GetByStatusAndCategory retrieves all orders with a specific status and category
+// GetByStatusAndCategory retrieves all orders with a specific status and
+// category. Orders split into tickets are also included when one of their
+// tickets has both.
 func (r *orderRepository) GetByStatusAndCategory(ctx context.Context, status models.OrderStatus, category string) ([]models.Order, error) {
 	var orders []models.Order
-	query := `SELECT * FROM orders WHERE status = $1 AND category = $2 ORDER BY created_at ASC`
+	query := `
+		SELECT * FROM orders o
+		WHERE (o.status = $1 AND o.category = $2)
+			OR EXISTS (
+				SELECT 1 FROM order_tickets t
+				WHERE t.business_date = o.business_date AND t.order_id = o.id
+					AND t.status = $1 AND t.category = $2
+			)
+		ORDER BY created_at ASC
+	`
 	err := r.db.SelectContext(ctx, &orders, query, status, category)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get orders by status and category: %w", err)
 	}
 
-	// Get items for each order
+	// Get items and tickets for each order
 	for i := range orders {
-		var items []models.OrderItem
-		itemsQuery := `SELECT * FROM order_items WHERE order_id = $1`
-		err = r.db.SelectContext(ctx, &items, itemsQuery, orders[i].ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get order items: %w", err)
+		if err := r.loadDetails(ctx, r.db, &orders[i]); err != nil {
+			return nil, err
 		}
-		orders[i].Items = items
 	}
 
 	return orders, nil
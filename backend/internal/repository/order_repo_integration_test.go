@@ -0,0 +1,433 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/testutil"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+)
+
+func newTestOrder(businessDate time.Time) *models.Order {
+	return &models.Order{
+		CustomerName: "John Doe",
+		Items:        []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1}},
+		TotalAmount:  40,
+		Status:       models.OrderStatusPendingPayment,
+		DateKey:      utils.GetDateKey(businessDate),
+		BusinessDate: businessDate,
+		CreatedAt:    time.Now().UTC(),
+	}
+}
+
+func TestOrderRepository_SameCodeAcrossYears(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	ctx := context.Background()
+
+	thisYear := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, repo.Create(ctx, thisYear))
+
+	nextYear := newTestOrder(time.Date(2027, 1, 14, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, repo.Create(ctx, nextYear))
+
+	// Same DDMMXXX code, different business dates
+	assert.Equal(t, "1401001", thisYear.ID)
+	assert.Equal(t, "1401001", nextYear.ID)
+
+	// Lookups by code resolve to the latest business date
+	got, err := repo.GetByID(ctx, "1401001")
+	require.NoError(t, err)
+	assert.True(t, got.BusinessDate.Equal(nextYear.BusinessDate))
+	assert.Len(t, got.Items, 1)
+
+	// Queue numbers are counted per business date too
+	paid, err := repo.TransitionStatus(ctx, "1401001", StatusChange{To: models.OrderStatusPaid})
+	require.NoError(t, err)
+	assert.Equal(t, 1, *paid.QueueNumber)
+	assert.True(t, paid.BusinessDate.Equal(nextYear.BusinessDate))
+
+	// Last year's order is untouched
+	var status models.OrderStatus
+	require.NoError(t, db.Get(&status, `SELECT status FROM orders WHERE id = $1 AND business_date = $2`, "1401001", thisYear.BusinessDate))
+	assert.Equal(t, models.OrderStatusPendingPayment, status)
+}
+
+func TestOrderRepository_TransitionStatus(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	ctx := context.Background()
+
+	order := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, repo.Create(ctx, order))
+
+	// A failing check leaves the order untouched and records nothing
+	errRejected := errors.New("rejected")
+	_, err := repo.TransitionStatus(ctx, order.ID, StatusChange{
+		To:    models.OrderStatusReady,
+		Check: func(current *models.Order) error { return errRejected },
+	})
+	assert.ErrorIs(t, err, errRejected)
+
+	// A partial payment is recorded, but the order stays unpaid
+	cash, promptPay := models.PaymentMethodCash, models.PaymentMethodPromptPay
+	partial, err := repo.TransitionStatus(ctx, order.ID, StatusChange{
+		To:      models.OrderStatusPaid,
+		Payment: &models.Payment{Amount: 15, Method: &promptPay, Received: 15},
+		Actor:   "cashier-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPendingPayment, partial.Status)
+	assert.Nil(t, partial.QueueNumber)
+	require.Len(t, partial.Payments, 1)
+	assert.Equal(t, 25.0, partial.Balance())
+
+	paid, err := repo.TransitionStatus(ctx, order.ID, StatusChange{
+		To:      models.OrderStatusPaid,
+		Payment: &models.Payment{Amount: 25, Method: &cash, Received: 100, Change: 75},
+		Actor:   "cashier-1",
+		Reason:  "payment verified",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, *paid.QueueNumber)
+	assert.Equal(t, models.PaymentMethodCash, *paid.PaymentMethod)
+	assert.NotNil(t, paid.PaidAt)
+	require.Len(t, paid.Payments, 2)
+	assert.Equal(t, 75.0, paid.Payments[1].Change)
+	assert.Equal(t, "cashier-1", paid.Payments[1].Actor)
+
+	ready, err := repo.TransitionStatus(ctx, order.ID, StatusChange{To: models.OrderStatusReady, Actor: "kitchen"})
+	require.NoError(t, err)
+	assert.NotNil(t, ready.ReadyAt)
+	assert.Len(t, ready.Items, 1)
+
+	completed, err := repo.TransitionStatus(ctx, order.ID, StatusChange{To: models.OrderStatusCompleted, Actor: "kitchen"})
+	require.NoError(t, err)
+	assert.NotNil(t, completed.CompletedAt)
+
+	history, err := repo.GetStatusHistory(ctx, order.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, models.OrderStatusPendingPayment, history[0].FromStatus)
+	assert.Equal(t, models.OrderStatusPaid, history[0].ToStatus)
+	assert.Equal(t, "cashier-1", history[0].Actor)
+	assert.Equal(t, "payment verified", history[0].Reason)
+	assert.Equal(t, models.OrderStatusReady, history[1].ToStatus)
+	assert.Equal(t, models.OrderStatusCompleted, history[2].ToStatus)
+
+	_, err = repo.TransitionStatus(ctx, "1401999", StatusChange{To: models.OrderStatusPaid})
+	assert.ErrorContains(t, err, "order not found")
+}
+
+func TestOrderRepository_UpdateItems(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	ctx := context.Background()
+
+	order := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, repo.Create(ctx, order))
+
+	// A failing check leaves the items untouched
+	errRejected := errors.New("rejected")
+	_, err := repo.UpdateItems(ctx, order.ID, ItemsEdit{
+		Check: func(current *models.Order) error { return errRejected },
+		Order: &models.Order{},
+	})
+	assert.ErrorIs(t, err, errRejected)
+
+	edited := &models.Order{
+		TotalAmount: 105,
+		Items: []models.OrderItem{
+			{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 2},
+			{MenuItemID: 2, Name: "Coke", Price: 25, Quantity: 1, Modifiers: []models.OrderItemModifier{
+				{ModifierID: 7, Group: "Ice", Name: "No ice", PriceDelta: 0},
+			}},
+		},
+	}
+	updated, err := repo.UpdateItems(ctx, order.ID, ItemsEdit{
+		Order:    edited,
+		Actor:    "cashier-1",
+		Describe: func(current *models.Order) string { return "added a coke" },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, order.ID, updated.ID)
+	assert.Equal(t, 105.0, updated.TotalAmount)
+	assert.Equal(t, models.OrderStatusPendingPayment, updated.Status)
+	require.Len(t, updated.Items, 2)
+	assert.Equal(t, "Coke", updated.Items[1].Name)
+	require.Len(t, updated.Items[1].Modifiers, 1)
+	assert.Equal(t, "No ice", updated.Items[1].Modifiers[0].Name)
+	assert.Equal(t, updated.Items[1].ID, updated.Items[1].Modifiers[0].OrderItemID)
+
+	// The edit keeps the order's code and sequence
+	var sequence int
+	require.NoError(t, db.Get(&sequence, `SELECT last_seq FROM order_sequences WHERE business_date = $1`, order.BusinessDate))
+	assert.Equal(t, 1, sequence)
+
+	history, err := repo.GetStatusHistory(ctx, order.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, models.OrderStatusPendingPayment, history[0].FromStatus)
+	assert.Equal(t, models.OrderStatusPendingPayment, history[0].ToStatus)
+	assert.Equal(t, "added a coke", history[0].Reason)
+	assert.Equal(t, "cashier-1", history[0].Actor)
+}
+
+func TestOrderRepository_Bundles(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	ctx := context.Background()
+
+	order := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	order.Items = []models.OrderItem{
+		{MenuItemID: 3, Name: "Fries Set", Price: 75, Quantity: 2, Components: []models.OrderItem{
+			{MenuItemID: 1, Name: "French Fries S", Quantity: 2},
+			{MenuItemID: 2, Name: "French Fries M", Quantity: 2},
+		}},
+		{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1},
+	}
+	order.TotalAmount = 190
+	require.NoError(t, repo.Create(ctx, order))
+
+	got, err := repo.GetByID(ctx, order.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Items, 2)
+	bundle := got.Items[0]
+	require.Len(t, bundle.Components, 2)
+	assert.Equal(t, &bundle.ID, bundle.Components[0].BundleItemID)
+	assert.Equal(t, 0.0, bundle.Components[0].Price)
+	assert.Empty(t, got.Items[1].Components)
+	assert.Len(t, got.PreparedItems(), 3)
+}
+
+func TestOrderRepository_ExpireOldOrders_RecordsHistory(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	ctx := context.Background()
+
+	yesterday := newTestOrder(time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, repo.Create(ctx, yesterday))
+	today := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, repo.Create(ctx, today))
+
+	// Part of this one is paid, so it is kept rather than stranding the payment
+	partlyPaid := newTestOrder(time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, repo.Create(ctx, partlyPaid))
+	cash := models.PaymentMethodCash
+	_, err := repo.TransitionStatus(ctx, partlyPaid.ID, StatusChange{
+		To:      models.OrderStatusPaid,
+		Payment: &models.Payment{Amount: 15, Method: &cash, Received: 15},
+	})
+	require.NoError(t, err)
+
+	// Only the previous day's order is expired; today's is still fresh
+	expired, err := repo.ExpireOldOrders(ctx, time.Now().UTC().Add(-time.Hour), today.BusinessDate)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, yesterday.ID, expired[0].ID)
+	assert.Equal(t, models.OrderStatusCancelled, expired[0].Status)
+
+	kept, err := repo.GetByID(ctx, partlyPaid.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPendingPayment, kept.Status)
+
+	history, err := repo.GetStatusHistory(ctx, yesterday.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "system", history[0].Actor)
+	assert.Equal(t, "expired: unpaid at end of business day", history[0].Reason)
+}
+
+func TestOrderRepository_ClientID(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	ctx := context.Background()
+
+	clientID := "8f14e45f-ceea-467f-a0e6-1b5c2f0a9d31"
+	order := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	order.ClientID = &clientID
+	require.NoError(t, repo.Create(ctx, order))
+
+	got, err := repo.GetByClientID(ctx, clientID)
+	require.NoError(t, err)
+	assert.Equal(t, order.ID, got.ID)
+	assert.Len(t, got.Items, 1)
+
+	// The same client order can't be created twice
+	again := newTestOrder(order.BusinessDate)
+	again.ClientID = &clientID
+	assert.ErrorIs(t, repo.Create(ctx, again), models.ErrDuplicate)
+
+	_, err = repo.GetByClientID(ctx, "unknown")
+	assert.ErrorIs(t, err, models.ErrOrderNotFound)
+}
+
+func TestOrderRepository_VerifiedPaymentReference(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	ctx := context.Background()
+
+	first := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, repo.Create(ctx, first))
+	second := newTestOrder(first.BusinessDate)
+	require.NoError(t, repo.Create(ctx, second))
+
+	promptPay := models.PaymentMethodPromptPay
+	reference, provider := "TX1", "bank"
+	payment := func() *models.Payment {
+		return &models.Payment{Amount: 40, Method: &promptPay, Received: 40, Reference: &reference, VerifiedBy: &provider}
+	}
+
+	_, err := repo.TransitionStatus(ctx, first.ID, StatusChange{To: models.OrderStatusPaid, Payment: payment(), Actor: "webhook:bank"})
+	require.NoError(t, err)
+
+	got, err := repo.GetByPaymentReference(ctx, provider, reference)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, got.ID)
+	assert.Equal(t, provider, *got.Payments[0].VerifiedBy)
+
+	// The same confirmed transaction can't pay another order
+	_, err = repo.TransitionStatus(ctx, second.ID, StatusChange{To: models.OrderStatusPaid, Payment: payment(), Actor: "cashier-1"})
+	assert.ErrorIs(t, err, models.ErrDuplicate)
+
+	_, err = repo.GetByPaymentReference(ctx, provider, "TX2")
+	assert.ErrorIs(t, err, models.ErrOrderNotFound)
+}
+
+func TestOrderRepository_Refunds(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	ctx := context.Background()
+
+	order := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	order.Items = []models.OrderItem{
+		{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 2},
+		{MenuItemID: 2, Name: "Coke", Price: 20, Quantity: 1},
+	}
+	order.TotalAmount = 100
+	require.NoError(t, repo.Create(ctx, order))
+
+	cash := models.PaymentMethodCash
+	paid, err := repo.TransitionStatus(ctx, order.ID, StatusChange{
+		To:      models.OrderStatusPaid,
+		Payment: &models.Payment{Amount: 100, Method: &cash, Received: 100},
+	})
+	require.NoError(t, err)
+	fries, coke := paid.Items[0], paid.Items[1]
+
+	// Refunding some of the items keeps the order's status
+	partial, err := repo.TransitionStatus(ctx, order.ID, StatusChange{
+		To: models.OrderStatusRefunded,
+		Refund: &models.Refund{Amount: 40, Method: &cash, Reason: "out of fries", Items: []models.RefundItem{
+			{OrderItemID: fries.ID, Quantity: 1, Amount: 40},
+		}},
+		Actor: "owner",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPaid, partial.Status)
+	assert.True(t, partial.PartiallyRefunded())
+	require.Len(t, partial.Refunds, 1)
+	assert.Equal(t, "owner", partial.Refunds[0].Actor)
+
+	got, err := repo.GetByID(ctx, order.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Refunds, 1)
+	require.Len(t, got.Refunds[0].Items, 1)
+	assert.Equal(t, 1, got.RefundedQuantity(fries.ID))
+
+	// The rest moves it to REFUNDED
+	refunded, err := repo.TransitionStatus(ctx, order.ID, StatusChange{
+		To: models.OrderStatusRefunded,
+		Refund: &models.Refund{Amount: 60, Method: &cash, Reason: "customer left", Items: []models.RefundItem{
+			{OrderItemID: fries.ID, Quantity: 1, Amount: 40},
+			{OrderItemID: coke.ID, Quantity: 1, Amount: 20},
+		}},
+		Actor:  "owner",
+		Reason: "refunded: customer left",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusRefunded, refunded.Status)
+	assert.NotNil(t, refunded.RefundedAt)
+	assert.Equal(t, 100.0, refunded.RefundedAmount())
+
+	history, err := repo.GetStatusHistory(ctx, order.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, models.OrderStatusRefunded, history[1].ToStatus)
+	assert.Equal(t, "refunded: customer left", history[1].Reason)
+}
+
+func TestOrderRepository_SplitTickets(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewOrderRepository(db, utils.DefaultOrderIDScheme)
+	shops := NewShopRepository(db)
+	ctx := context.Background()
+
+	// "Fries" is seeded by migrations 001 and 015; add a second shop
+	fries, err := shops.GetByCode(ctx, "Fries")
+	require.NoError(t, err)
+	drinks := &models.Shop{Code: "Drinks", Name: "Drinks", Active: true}
+	require.NoError(t, shops.Create(ctx, drinks))
+	cola := &models.MenuItem{Name: "Cola", Price: 25, Category: &drinks.Code, ShopID: &drinks.ID, Available: true}
+	require.NoError(t, NewMenuRepository(db).Create(ctx, cola))
+
+	friesItem := models.OrderItem{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1, ShopID: &fries.ID}
+	colaItem := models.OrderItem{MenuItemID: cola.ID, Name: "Cola", Price: 25, Quantity: 1, ShopID: &drinks.ID}
+	order := newTestOrder(time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC))
+	order.Items = []models.OrderItem{friesItem, colaItem}
+	order.TotalAmount = 65
+	order.Tickets = []models.OrderTicket{
+		{ShopID: fries.ID, Category: &fries.Code, Items: []models.OrderItem{friesItem}},
+		{ShopID: drinks.ID, Category: &drinks.Code, Items: []models.OrderItem{colaItem}},
+	}
+	require.NoError(t, repo.Create(ctx, order))
+
+	// Paying moves every ticket, each with its own queue number
+	cash := models.PaymentMethodCash
+	paid, err := repo.TransitionStatus(ctx, order.ID, StatusChange{
+		To:      models.OrderStatusPaid,
+		Payment: &models.Payment{Amount: 65, Method: &cash, Received: 65},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, paid.QueueNumber)
+	require.Len(t, paid.Tickets, 2)
+	for _, ticket := range paid.Tickets {
+		assert.Equal(t, models.OrderStatusPaid, ticket.Status)
+		require.NotNil(t, ticket.QueueNumber)
+	}
+	assert.NotEqual(t, *paid.Tickets[0].QueueNumber, *paid.Tickets[1].QueueNumber)
+
+	// READY moves only the picked tickets; the order waits for the rest
+	only := func(shopID int) func(*models.Order) ([]int, error) {
+		return func(*models.Order) ([]int, error) { return []int{shopID}, nil }
+	}
+	ready, err := repo.TransitionStatus(ctx, order.ID, StatusChange{To: models.OrderStatusReady, Tickets: only(fries.ID)})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPaid, ready.Status)
+	assert.Equal(t, models.OrderStatusReady, findTicket(ready, fries.ID).Status)
+	assert.Equal(t, models.OrderStatusPaid, findTicket(ready, drinks.ID).Status)
+
+	ready, err = repo.TransitionStatus(ctx, order.ID, StatusChange{To: models.OrderStatusReady, Tickets: only(drinks.ID)})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusReady, ready.Status)
+	assert.NotNil(t, ready.ReadyAt)
+
+	// A shop without a ticket on the order is refused
+	_, err = repo.TransitionStatus(ctx, order.ID, StatusChange{To: models.OrderStatusCompleted, Tickets: only(9999)})
+	assert.ErrorIs(t, err, models.ErrOrderNotFound)
+
+	history, err := repo.GetStatusHistory(ctx, order.ID)
+	require.NoError(t, err)
+	var ticketChanges int
+	for _, h := range history {
+		if h.ShopID != nil {
+			ticketChanges++
+		}
+	}
+	assert.Equal(t, 2, ticketChanges)
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+type PaymentNotificationRepository interface {
+	Save(ctx context.Context, provider string, notification *models.PaymentNotification) error
+	GetByReference(ctx context.Context, provider, reference string) (*models.PaymentNotification, error)
+}
+
+type paymentNotificationRepository struct {
+	db *sqlx.DB
+}
+
+func NewPaymentNotificationRepository(db *sqlx.DB) PaymentNotificationRepository {
+	return &paymentNotificationRepository{db: db}
+}
+
+// Save keeps a notification from provider. A redelivered notification
+// (same reference) keeps the copy saved first.
+func (r *paymentNotificationRepository) Save(ctx context.Context, provider string, notification *models.PaymentNotification) error {
+	query := `
+		INSERT INTO payment_notifications (provider, reference, amount, order_id, account, paid_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6)
+		ON CONFLICT (provider, reference) DO NOTHING
+	`
+	var paidAt *time.Time
+	if !notification.PaidAt.IsZero() {
+		utc := notification.PaidAt.UTC()
+		paidAt = &utc
+	}
+	_, err := r.db.ExecContext(ctx, query,
+		provider,
+		notification.Reference,
+		notification.Amount,
+		notification.OrderID,
+		notification.Account,
+		paidAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save payment notification: %w", err)
+	}
+	return nil
+}
+
+// GetByReference finds the notification provider sent for a transaction
+func (r *paymentNotificationRepository) GetByReference(ctx context.Context, provider, reference string) (*models.PaymentNotification, error) {
+	var notification models.PaymentNotification
+	query := `
+		SELECT reference, amount, COALESCE(order_id, '') AS order_id, COALESCE(account, '') AS account,
+			COALESCE(paid_at, received_at) AS paid_at
+		FROM payment_notifications
+		WHERE provider = $1 AND reference = $2
+	`
+	err := r.db.GetContext(ctx, &notification, query, provider, reference)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s has no payment %s", models.ErrPaymentNotVerified, provider, reference)
+		}
+		return nil, fmt.Errorf("failed to get payment notification: %w", err)
+	}
+	return &notification, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/testutil"
+)
+
+func TestPaymentNotificationRepository(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewPaymentNotificationRepository(db)
+	ctx := context.Background()
+
+	paidAt := time.Date(2026, 2, 21, 5, 30, 0, 0, time.UTC)
+	require.NoError(t, repo.Save(ctx, "bank", &models.PaymentNotification{
+		Reference: "TX1", Amount: 80, Account: "0812345678", PaidAt: paidAt,
+	}))
+
+	// A redelivery keeps the first copy
+	require.NoError(t, repo.Save(ctx, "bank", &models.PaymentNotification{Reference: "TX1", Amount: 8000}))
+
+	got, err := repo.GetByReference(ctx, "bank", "TX1")
+	require.NoError(t, err)
+	assert.Equal(t, 80.0, got.Amount)
+	assert.Equal(t, "0812345678", got.Account)
+	assert.Empty(t, got.OrderID)
+	assert.True(t, got.PaidAt.Equal(paidAt))
+
+	// References are per provider
+	_, err = repo.GetByReference(ctx, "slipcheck", "TX1")
+	assert.ErrorIs(t, err, models.ErrPaymentNotVerified)
+	_, err = repo.GetByReference(ctx, "bank", "TX2")
+	assert.ErrorIs(t, err, models.ErrPaymentNotVerified)
+}
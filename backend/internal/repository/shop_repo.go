@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+type ShopRepository interface {
+	GetByID(ctx context.Context, id int) (*models.Shop, error)
+	GetByCode(ctx context.Context, code string) (*models.Shop, error)
+	GetAll(ctx context.Context) ([]models.Shop, error)
+	Create(ctx context.Context, shop *models.Shop) error
+	Update(ctx context.Context, shop *models.Shop) error
+}
+
+type shopRepository struct {
+	db *sqlx.DB
+}
+
+func NewShopRepository(db *sqlx.DB) ShopRepository {
+	return &shopRepository{db: db}
+}
+
+// GetByID retrieves a shop by ID
+func (r *shopRepository) GetByID(ctx context.Context, id int) (*models.Shop, error) {
+	var shop models.Shop
+	query := `SELECT * FROM shops WHERE id = $1`
+	err := r.db.GetContext(ctx, &shop, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %d", models.ErrShopNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to get shop: %w", err)
+	}
+	return &shop, nil
+}
+
+// GetByCode retrieves a shop by its code (the category of its menu items)
+func (r *shopRepository) GetByCode(ctx context.Context, code string) (*models.Shop, error) {
+	var shop models.Shop
+	query := `SELECT * FROM shops WHERE code = $1`
+	err := r.db.GetContext(ctx, &shop, query, code)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", models.ErrShopNotFound, code)
+		}
+		return nil, fmt.Errorf("failed to get shop: %w", err)
+	}
+	return &shop, nil
+}
+
+// GetAll retrieves all shops
+func (r *shopRepository) GetAll(ctx context.Context) ([]models.Shop, error) {
+	var shops []models.Shop
+	query := `SELECT * FROM shops ORDER BY id`
+	err := r.db.SelectContext(ctx, &shops, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shops: %w", err)
+	}
+	return shops, nil
+}
+
+// Create inserts a new shop
+func (r *shopRepository) Create(ctx context.Context, shop *models.Shop) error {
+	query := `
+		INSERT INTO shops (code, name, active, promptpay_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+	err := r.db.QueryRowContext(ctx, query, shop.Code, shop.Name, shop.Active, shop.PromptPayID).
+		Scan(&shop.ID, &shop.CreatedAt, &shop.UpdatedAt)
+	if err != nil {
+		if isPgError(err, pgUniqueViolation) {
+			return fmt.Errorf("shop '%s' %w", shop.Code, models.ErrDuplicate)
+		}
+		return fmt.Errorf("failed to create shop: %w", err)
+	}
+	return nil
+}
+
+// Update changes a shop's name, PromptPay account and whether it is open.
+// The code is fixed because menu items and orders carry it as their category.
+func (r *shopRepository) Update(ctx context.Context, shop *models.Shop) error {
+	query := `
+		UPDATE shops
+		SET name = $1, active = $2, promptpay_id = $3, updated_at = NOW() AT TIME ZONE 'UTC'
+		WHERE id = $4
+		RETURNING code, created_at, updated_at
+	`
+	err := r.db.QueryRowContext(ctx, query, shop.Name, shop.Active, shop.PromptPayID, shop.ID).
+		Scan(&shop.Code, &shop.CreatedAt, &shop.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %d", models.ErrShopNotFound, shop.ID)
+		}
+		return fmt.Errorf("failed to update shop: %w", err)
+	}
+	return nil
+}
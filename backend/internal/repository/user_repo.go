@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+type UserRepository interface {
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	GetAll(ctx context.Context) ([]models.User, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, user *models.User) error
+	SetActive(ctx context.Context, id int, active bool) error
+	GetShopIDs(ctx context.Context, userID int) ([]int, error)
+	SetShops(ctx context.Context, userID int, shopIDs []int) error
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	RevokeSession(ctx context.Context, id string, at time.Time) error
+	RevokeUserSessions(ctx context.Context, userID int, at time.Time) error
+}
+
+type userRepository struct {
+	db *sqlx.DB
+}
+
+func NewUserRepository(db *sqlx.DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+// GetByID retrieves a user by ID
+func (r *userRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	var user models.User
+	query := `SELECT * FROM users WHERE id = $1`
+	err := r.db.GetContext(ctx, &user, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %d", models.ErrUserNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetByUsername retrieves a user by login name
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	query := `SELECT * FROM users WHERE username = $1`
+	err := r.db.GetContext(ctx, &user, query, username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", models.ErrUserNotFound, username)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetAll retrieves all users
+func (r *userRepository) GetAll(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	query := `SELECT * FROM users ORDER BY id`
+	err := r.db.SelectContext(ctx, &users, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	return users, nil
+}
+
+// Count returns the number of users
+func (r *userRepository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM users`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// Create inserts a new user
+func (r *userRepository) Create(ctx context.Context, user *models.User) error {
+	query := `
+		INSERT INTO users (username, display_name, password_hash, role, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+	err := r.db.QueryRowContext(ctx, query,
+		user.Username,
+		user.DisplayName,
+		user.PasswordHash,
+		user.Role,
+		user.Active,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if isPgError(err, pgUniqueViolation) {
+			return fmt.Errorf("user '%s' %w", user.Username, models.ErrDuplicate)
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// SetActive enables or disables a user
+func (r *userRepository) SetActive(ctx context.Context, id int, active bool) error {
+	query := `UPDATE users SET active = $1, updated_at = NOW() AT TIME ZONE 'UTC' WHERE id = $2`
+	result, err := r.db.ExecContext(ctx, query, active, id)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %d", models.ErrUserNotFound, id)
+	}
+	return nil
+}
+
+// GetShopIDs returns the shops a user works at
+func (r *userRepository) GetShopIDs(ctx context.Context, userID int) ([]int, error) {
+	shopIDs := []int{}
+	query := `SELECT shop_id FROM user_shops WHERE user_id = $1 ORDER BY shop_id`
+	if err := r.db.SelectContext(ctx, &shopIDs, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to get user shops: %w", err)
+	}
+	return shopIDs, nil
+}
+
+// SetShops replaces the shops a user works at
+func (r *userRepository) SetShops(ctx context.Context, userID int, shopIDs []int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_shops WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to clear user shops: %w", err)
+	}
+	for _, shopID := range shopIDs {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO user_shops (user_id, shop_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			userID, shopID)
+		if err != nil {
+			if isPgError(err, pgForeignKeyViolation) {
+				return models.NewValidationError("shop_ids", fmt.Sprintf("shop %d does not exist", shopID))
+			}
+			return fmt.Errorf("failed to add user shop: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateSession records a new login session
+func (r *userRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO user_sessions (id, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING created_at
+	`
+	err := r.db.QueryRowContext(ctx, query, session.ID, session.UserID, session.ExpiresAt).Scan(&session.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// GetSession retrieves a session by ID
+func (r *userRepository) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	var session models.Session
+	query := `SELECT * FROM user_sessions WHERE id = $1`
+	err := r.db.GetContext(ctx, &session, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", models.ErrSessionNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return &session, nil
+}
+
+// RevokeSession ends a session before it expires (logout)
+func (r *userRepository) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	query := `UPDATE user_sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, at, id); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions ends every open session of a user
+func (r *userRepository) RevokeUserSessions(ctx context.Context, userID int, at time.Time) error {
+	query := `UPDATE user_sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, at, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
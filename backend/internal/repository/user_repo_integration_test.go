@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/testutil"
+)
+
+func TestUserRepository_CreateAndSessions(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	user := &models.User{Username: "cashier1", PasswordHash: "hash", Role: models.RoleCashier, Active: true}
+	require.NoError(t, repo.Create(ctx, user))
+	assert.NotZero(t, user.ID)
+
+	// Usernames are unique
+	err := repo.Create(ctx, &models.User{Username: "cashier1", PasswordHash: "hash", Role: models.RoleCashier})
+	assert.True(t, errors.Is(err, models.ErrDuplicate))
+
+	got, err := repo.GetByUsername(ctx, "cashier1")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+
+	_, err = repo.GetByUsername(ctx, "nobody")
+	assert.True(t, errors.Is(err, models.ErrUserNotFound))
+
+	session := &models.Session{ID: "session-1", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour).UTC()}
+	require.NoError(t, repo.CreateSession(ctx, session))
+
+	stored, err := repo.GetSession(ctx, "session-1")
+	require.NoError(t, err)
+	assert.Nil(t, stored.RevokedAt)
+
+	// Disabling a user is followed by revoking every session
+	require.NoError(t, repo.SetActive(ctx, user.ID, false))
+	require.NoError(t, repo.RevokeUserSessions(ctx, user.ID, time.Now().UTC()))
+
+	stored, err = repo.GetSession(ctx, "session-1")
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	count, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+)
+
+// Authentication errors
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUnauthorized       = errors.New("authentication required")
+	// ErrSessionExpired is returned for a genuine session token that has
+	// expired or been revoked. It is not a guess, so it isn't counted
+	// towards lockouts.
+	ErrSessionExpired = fmt.Errorf("%w: session expired or revoked", ErrUnauthorized)
+)
+
+// DefaultSessionTTL is how long a login lasts: a full day at the booth
+const DefaultSessionTTL = 12 * time.Hour
+
+// minPasswordLength is the shortest password accepted for new accounts
+const minPasswordLength = 8
+
+// passwordHashCost is the bcrypt cost for new password hashes
+var passwordHashCost = bcrypt.DefaultCost
+
+type AuthService interface {
+	Login(ctx context.Context, req *models.LoginRequest) (*models.LoginResponse, error)
+	Logout(ctx context.Context, token string) error
+	Authenticate(ctx context.Context, token string) (*models.User, error)
+	CreateUser(ctx context.Context, req *models.CreateUserRequest) (*models.User, error)
+	GetUsers(ctx context.Context) ([]models.User, error)
+	SetUserActive(ctx context.Context, id int, active bool) error
+	SetUserShops(ctx context.Context, id int, shopIDs []int) error
+	EnsureAdmin(ctx context.Context, username, password string) (bool, error)
+}
+
+type authService struct {
+	userRepo repository.UserRepository
+	signer   *utils.SessionSigner
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+func NewAuthService(userRepo repository.UserRepository, signer *utils.SessionSigner, ttl time.Duration) AuthService {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	return &authService{
+		userRepo: userRepo,
+		signer:   signer,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// Login checks the username and password and opens a new session
+func (s *authService) Login(ctx context.Context, req *models.LoginRequest) (*models.LoginResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByUsername(ctx, strings.TrimSpace(req.Username))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			// Spend the same time as a wrong password so unknown usernames
+			// can't be told apart by timing
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(req.Password))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.Active {
+		return nil, ErrInvalidCredentials
+	}
+
+	sessionID, err := utils.NewSessionID()
+	if err != nil {
+		return nil, err
+	}
+	session := &models.Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		ExpiresAt: s.now().Add(s.ttl).UTC().Truncate(time.Second),
+	}
+	if err := s.userRepo.CreateSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	token := s.signer.Sign(utils.SessionClaims{
+		SessionID: session.ID,
+		UserID:    user.ID,
+		ExpiresAt: session.ExpiresAt,
+	})
+
+	return &models.LoginResponse{Token: token, ExpiresAt: session.ExpiresAt, User: *user}, nil
+}
+
+// Logout revokes the session the token belongs to
+func (s *authService) Logout(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	claims, err := s.signer.Verify(token, s.now())
+	if err != nil {
+		return ErrUnauthorized
+	}
+
+	if err := s.userRepo.RevokeSession(ctx, claims.SessionID, s.now().UTC()); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// Authenticate resolves a session token to its user. The token must be
+// correctly signed, unexpired, not revoked and belong to an active user.
+// A forged or malformed token is ErrUnauthorized; a correctly signed one
+// that is no longer valid is ErrSessionExpired.
+func (s *authService) Authenticate(ctx context.Context, token string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	claims, err := s.signer.Verify(token, s.now())
+	if err != nil {
+		if errors.Is(err, utils.ErrTokenExpired) {
+			return nil, ErrSessionExpired
+		}
+		return nil, ErrUnauthorized
+	}
+
+	session, err := s.userRepo.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, ErrSessionExpired
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session.RevokedAt != nil || session.UserID != claims.UserID {
+		return nil, ErrSessionExpired
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrSessionExpired
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.Active {
+		return nil, ErrSessionExpired
+	}
+
+	if user.ShopIDs, err = s.userRepo.GetShopIDs(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("failed to get user shops: %w", err)
+	}
+
+	return user, nil
+}
+
+// CreateUser creates a staff account with a hashed password
+func (s *authService) CreateUser(ctx context.Context, req *models.CreateUserRequest) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	username := strings.TrimSpace(req.Username)
+
+	verr := &ValidationError{}
+	if len(username) < 2 || len(username) > 50 {
+		verr.Add("username", "username must be 2-50 characters")
+	}
+	if len(req.Password) < minPasswordLength || len(req.Password) > 72 {
+		verr.Add("password", fmt.Sprintf("password must be %d-72 characters", minPasswordLength))
+	}
+	if !req.Role.Valid() {
+		verr.Add("role", "role is not valid")
+	}
+	if verr.HasErrors() {
+		return nil, verr
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), passwordHashCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &models.User{
+		Username:     username,
+		DisplayName:  strings.TrimSpace(req.DisplayName),
+		PasswordHash: string(hash),
+		Role:         req.Role,
+		Active:       true,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	user.ShopIDs = []int{}
+	if len(req.ShopIDs) > 0 {
+		if err := s.userRepo.SetShops(ctx, user.ID, req.ShopIDs); err != nil {
+			return nil, fmt.Errorf("failed to set user shops: %w", err)
+		}
+		user.ShopIDs = req.ShopIDs
+	}
+
+	return user, nil
+}
+
+// GetUsers retrieves all staff accounts
+func (s *authService) GetUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	users, err := s.userRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	for i := range users {
+		if users[i].ShopIDs, err = s.userRepo.GetShopIDs(ctx, users[i].ID); err != nil {
+			return nil, fmt.Errorf("failed to get user shops: %w", err)
+		}
+	}
+	return users, nil
+}
+
+// SetUserShops replaces the shops a user works at. It takes effect on the
+// user's next request, since the scope is loaded with every session.
+func (s *authService) SetUserShops(ctx context.Context, id int, shopIDs []int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := s.userRepo.SetShops(ctx, id, shopIDs); err != nil {
+		return fmt.Errorf("failed to set user shops: %w", err)
+	}
+	return nil
+}
+
+// SetUserActive enables or disables an account. Disabling also ends all of
+// the user's sessions.
+func (s *authService) SetUserActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := s.userRepo.SetActive(ctx, id, active); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if !active {
+		if err := s.userRepo.RevokeUserSessions(ctx, id, s.now().UTC()); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+	return nil
+}
+
+// EnsureAdmin creates the first (owner) account when there are no users yet,
+// so a fresh deployment can log in. It reports whether a user was created.
+func (s *authService) EnsureAdmin(ctx context.Context, username, password string) (bool, error) {
+	count, err := s.userRepo.Count(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to count users: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	_, err = s.CreateUser(ctx, &models.CreateUserRequest{
+		Username:    username,
+		DisplayName: "Administrator",
+		Password:    password,
+		Role:        models.RoleOwner,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// dummyPasswordHash is compared against when the username doesn't exist
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), passwordHashCost)
+	})
+	return dummyHash
+}
+
+// UserKey is the context key holding the authenticated *models.User
+type UserKey struct{}
+
+// WithUser returns a context carrying the authenticated user, whose role
+// applies and who is recorded as the actor of any changes
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	ctx = context.WithValue(ctx, UserKey{}, user)
+	ctx = WithRole(ctx, user.Role)
+	return WithActor(ctx, user.Username)
+}
+
+// UserFromContext returns the authenticated user, if any
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(UserKey{}).(*models.User)
+	return user, ok && user != nil
+}
+
+// RoleKey is the context key holding the caller's models.Role. It is set for
+// session users and for the legacy shared passwords, which have no user.
+type RoleKey struct{}
+
+// WithRole returns a context whose caller has the given role
+func WithRole(ctx context.Context, role models.Role) context.Context {
+	return context.WithValue(ctx, RoleKey{}, role)
+}
+
+// RoleFromContext returns the caller's role, if authenticated
+func RoleFromContext(ctx context.Context) (models.Role, bool) {
+	role, ok := ctx.Value(RoleKey{}).(models.Role)
+	return role, ok && role != ""
+}
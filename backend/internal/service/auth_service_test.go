@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+)
+
+func init() {
+	// Keep password hashing fast in tests
+	passwordHashCost = bcrypt.MinCost
+}
+
+func newTestAuthService(t *testing.T, repo *mocks.MockUserRepository) *authService {
+	t.Helper()
+	signer, err := utils.NewSessionSigner("0123456789abcdef0123456789abcdef")
+	assert.NoError(t, err)
+
+	svc := NewAuthService(repo, signer, time.Hour).(*authService)
+	svc.now = func() time.Time { return testNow }
+	return svc
+}
+
+func testUser(t *testing.T, password string) *models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	assert.NoError(t, err)
+	return &models.User{ID: 7, Username: "cashier1", PasswordHash: string(hash), Role: models.RoleCashier, Active: true}
+}
+
+func TestAuthService_Login(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		setupMock func(*mocks.MockUserRepository, *models.User)
+		wantErr   error
+	}{
+		{
+			name:     "Successful login",
+			password: "correct-horse",
+			setupMock: func(repo *mocks.MockUserRepository, user *models.User) {
+				repo.On("GetByUsername", mock.Anything, "cashier1").Return(user, nil)
+				repo.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).Return(nil)
+			},
+		},
+		{
+			name:     "Wrong password",
+			password: "wrong-password",
+			setupMock: func(repo *mocks.MockUserRepository, user *models.User) {
+				repo.On("GetByUsername", mock.Anything, "cashier1").Return(user, nil)
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:     "Unknown user",
+			password: "correct-horse",
+			setupMock: func(repo *mocks.MockUserRepository, user *models.User) {
+				repo.On("GetByUsername", mock.Anything, "cashier1").Return(nil, ErrUserNotFound)
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:     "Disabled user",
+			password: "correct-horse",
+			setupMock: func(repo *mocks.MockUserRepository, user *models.User) {
+				user.Active = false
+				repo.On("GetByUsername", mock.Anything, "cashier1").Return(user, nil)
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.MockUserRepository)
+			tt.setupMock(repo, testUser(t, "correct-horse"))
+
+			svc := newTestAuthService(t, repo)
+			resp, err := svc.Login(context.Background(), &models.LoginRequest{Username: "cashier1", Password: tt.password})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, resp)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, resp.Token)
+				assert.Equal(t, testNow.Add(time.Hour).UTC(), resp.ExpiresAt)
+				assert.Equal(t, "cashier1", resp.User.Username)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthService_Authenticate(t *testing.T) {
+	repo := new(mocks.MockUserRepository)
+	svc := newTestAuthService(t, repo)
+	user := testUser(t, "correct-horse")
+
+	repo.On("GetByUsername", mock.Anything, "cashier1").Return(user, nil)
+	var session *models.Session
+	repo.On("CreateSession", mock.Anything, mock.AnythingOfType("*models.Session")).
+		Run(func(args mock.Arguments) {
+			session = args.Get(1).(*models.Session)
+		}).
+		Return(nil)
+
+	resp, err := svc.Login(context.Background(), &models.LoginRequest{Username: "cashier1", Password: "correct-horse"})
+	assert.NoError(t, err)
+
+	t.Run("Valid session", func(t *testing.T) {
+		repo.On("GetSession", mock.Anything, session.ID).Return(session, nil).Once()
+		repo.On("GetByID", mock.Anything, 7).Return(user, nil).Once()
+		repo.On("GetShopIDs", mock.Anything, 7).Return([]int{2}, nil).Once()
+
+		got, err := svc.Authenticate(context.Background(), resp.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, "cashier1", got.Username)
+		assert.Equal(t, []int{2}, got.ShopIDs)
+	})
+
+	t.Run("Revoked session", func(t *testing.T) {
+		revoked := *session
+		revokedAt := testNow
+		revoked.RevokedAt = &revokedAt
+		repo.On("GetSession", mock.Anything, session.ID).Return(&revoked, nil).Once()
+
+		_, err := svc.Authenticate(context.Background(), resp.Token)
+		assert.ErrorIs(t, err, ErrSessionExpired)
+	})
+
+	t.Run("Disabled user", func(t *testing.T) {
+		disabled := *user
+		disabled.Active = false
+		repo.On("GetSession", mock.Anything, session.ID).Return(session, nil).Once()
+		repo.On("GetByID", mock.Anything, 7).Return(&disabled, nil).Once()
+
+		_, err := svc.Authenticate(context.Background(), resp.Token)
+		assert.ErrorIs(t, err, ErrSessionExpired)
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		expired := newTestAuthService(t, repo)
+		expired.now = func() time.Time { return testNow.Add(2 * time.Hour) }
+
+		_, err := expired.Authenticate(context.Background(), resp.Token)
+		assert.ErrorIs(t, err, ErrSessionExpired)
+	})
+
+	t.Run("Garbage token", func(t *testing.T) {
+		_, err := svc.Authenticate(context.Background(), "staff_password")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.NotErrorIs(t, err, ErrSessionExpired)
+	})
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	repo := new(mocks.MockUserRepository)
+	svc := newTestAuthService(t, repo)
+
+	token := svc.signer.Sign(utils.SessionClaims{SessionID: "s1", UserID: 7, ExpiresAt: testNow.Add(time.Hour)})
+	repo.On("RevokeSession", mock.Anything, "s1", testNow.UTC()).Return(nil)
+
+	assert.NoError(t, svc.Logout(context.Background(), token))
+	assert.ErrorIs(t, svc.Logout(context.Background(), "bogus"), ErrUnauthorized)
+	repo.AssertExpectations(t)
+}
+
+func TestAuthService_CreateUser(t *testing.T) {
+	t.Run("Hashes the password", func(t *testing.T) {
+		repo := new(mocks.MockUserRepository)
+		repo.On("Create", mock.Anything, mock.AnythingOfType("*models.User")).Return(nil)
+
+		svc := newTestAuthService(t, repo)
+		user, err := svc.CreateUser(context.Background(), &models.CreateUserRequest{
+			Username: " cashier2 ",
+			Password: "long-enough",
+			Role:     models.RoleCashier,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "cashier2", user.Username)
+		assert.True(t, user.Active)
+		assert.NotEqual(t, "long-enough", user.PasswordHash)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("long-enough")))
+		repo.AssertNotCalled(t, "SetShops", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Assigns shops", func(t *testing.T) {
+		repo := new(mocks.MockUserRepository)
+		repo.On("Create", mock.Anything, mock.AnythingOfType("*models.User")).
+			Run(func(args mock.Arguments) { args.Get(1).(*models.User).ID = 9 }).
+			Return(nil)
+		repo.On("SetShops", mock.Anything, 9, []int{1, 3}).Return(nil)
+
+		svc := newTestAuthService(t, repo)
+		user, err := svc.CreateUser(context.Background(), &models.CreateUserRequest{
+			Username: "kitchen1",
+			Password: "long-enough",
+			Role:     models.RoleKitchen,
+			ShopIDs:  []int{1, 3},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 3}, user.ShopIDs)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("Reports invalid fields", func(t *testing.T) {
+		svc := newTestAuthService(t, new(mocks.MockUserRepository))
+		_, err := svc.CreateUser(context.Background(), &models.CreateUserRequest{
+			Username: "x",
+			Password: "short",
+			Role:     "superuser",
+		})
+
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Len(t, validationErr.Fields, 3)
+	})
+}
+
+func TestAuthService_SetUserActive(t *testing.T) {
+	repo := new(mocks.MockUserRepository)
+	repo.On("SetActive", mock.Anything, 7, false).Return(nil)
+	repo.On("RevokeUserSessions", mock.Anything, 7, testNow.UTC()).Return(nil)
+
+	svc := newTestAuthService(t, repo)
+	assert.NoError(t, svc.SetUserActive(context.Background(), 7, false))
+	repo.AssertExpectations(t)
+}
+
+func TestAuthService_EnsureAdmin(t *testing.T) {
+	t.Run("Creates admin when there are no users", func(t *testing.T) {
+		repo := new(mocks.MockUserRepository)
+		repo.On("Count", mock.Anything).Return(0, nil)
+		repo.On("Create", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+			return u.Username == "admin" && u.Role == models.RoleOwner
+		})).Return(nil)
+
+		created, err := newTestAuthService(t, repo).EnsureAdmin(context.Background(), "admin", "admin-password")
+		assert.NoError(t, err)
+		assert.True(t, created)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("Leaves existing users alone", func(t *testing.T) {
+		repo := new(mocks.MockUserRepository)
+		repo.On("Count", mock.Anything).Return(3, nil)
+
+		created, err := newTestAuthService(t, repo).EnsureAdmin(context.Background(), "admin", "admin-password")
+		assert.NoError(t, err)
+		assert.False(t, created)
+	})
+}
+
+func TestWithUser(t *testing.T) {
+	ctx := WithUser(context.Background(), &models.User{Username: "cashier1"})
+
+	user, ok := UserFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "cashier1", user.Username)
+	assert.Equal(t, "cashier1", ActorFromContext(ctx))
+
+	_, ok = UserFromContext(context.Background())
+	assert.False(t, ok)
+}
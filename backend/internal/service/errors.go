@@ -0,0 +1,37 @@
+package service
+
+import "github.com/tanasatit/barvidva-kasetfair/internal/models"
+
+// Errors returned by the services. They are declared in models so the
+// repositories (which the services import) can wrap them too; match them
+// with errors.Is / errors.As. ErrInvalidTransition lives in order_state.go.
+var (
+	ErrOrderNotFound    = models.ErrOrderNotFound
+	ErrMenuItemNotFound = models.ErrMenuItemNotFound
+	ErrShopNotFound     = models.ErrShopNotFound
+	ErrUserNotFound     = models.ErrUserNotFound
+	ErrSessionNotFound  = models.ErrSessionNotFound
+	ErrValidation       = models.ErrValidation
+	ErrDuplicate        = models.ErrDuplicate
+	ErrConflict         = models.ErrConflict
+	ErrForbidden        = models.ErrForbidden
+
+	ErrPromptPayNotConfigured = models.ErrPromptPayNotConfigured
+	ErrPaymentNotVerified     = models.ErrPaymentNotVerified
+
+	ErrIngredientNotFound = models.ErrIngredientNotFound
+
+	ErrIdempotencyKeyReused = models.ErrIdempotencyKeyReused
+	ErrRequestInProgress    = models.ErrRequestInProgress
+)
+
+// ValidationError lists the invalid fields of a request
+type ValidationError = models.ValidationError
+
+// FieldError describes one invalid field
+type FieldError = models.FieldError
+
+// NewValidationError creates a validation error for a single field
+func NewValidationError(field, message string) *ValidationError {
+	return models.NewValidationError(field, message)
+}
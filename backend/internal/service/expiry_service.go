@@ -6,6 +6,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
 )
 
 // ExpiryService handles automatic order expiration
@@ -13,14 +14,18 @@ type ExpiryService struct {
 	orderRepo     repository.OrderRepository
 	expiryMinutes int
 	checkInterval time.Duration
+	clock         *utils.BusinessClock
+	events        OrderEventPublisher
 }
 
 // NewExpiryService creates a new expiry service with configurable timeouts
-func NewExpiryService(orderRepo repository.OrderRepository, expiryMinutes int, checkInterval time.Duration) *ExpiryService {
+func NewExpiryService(orderRepo repository.OrderRepository, expiryMinutes int, checkInterval time.Duration, clock *utils.BusinessClock, events OrderEventPublisher) *ExpiryService {
 	return &ExpiryService{
 		orderRepo:     orderRepo,
 		expiryMinutes: expiryMinutes,
 		checkInterval: checkInterval,
+		clock:         clock,
+		events:        events,
 	}
 }
 
@@ -50,26 +55,33 @@ func (s *ExpiryService) Start(ctx context.Context) {
 }
 
 // expireOldOrders cancels all orders that have been in PENDING_PAYMENT status
-// for longer than the configured expiry time.
+// for longer than the configured expiry time, and any unpaid order left over
+// from a previous business day.
 func (s *ExpiryService) expireOldOrders(ctx context.Context) {
 	// Set a timeout for this operation
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	cutoff := time.Now().UTC().Add(-time.Duration(s.expiryMinutes) * time.Minute)
+	cutoff := s.clock.Now().UTC().Add(-time.Duration(s.expiryMinutes) * time.Minute)
+	today := s.clock.Today()
 
-	count, err := s.orderRepo.ExpireOldOrders(ctx, cutoff)
+	expired, err := s.orderRepo.ExpireOldOrders(ctx, cutoff, today)
 	if err != nil {
 		log.Error().
 			Err(err).
 			Time("cutoff", cutoff).
+			Time("business_date", today).
 			Msg("Failed to expire old orders")
 		return
 	}
 
-	if count > 0 {
+	for i := range expired {
+		s.events.Publish(OrderEventExpired, &expired[i])
+	}
+
+	if len(expired) > 0 {
 		log.Info().
-			Int64("expired_count", count).
+			Int("expired_count", len(expired)).
 			Int("expiry_minutes", s.expiryMinutes).
 			Time("cutoff", cutoff).
 			Msg("Expired old unpaid orders")
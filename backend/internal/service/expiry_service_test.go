@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
 	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
 )
 
@@ -14,7 +15,7 @@ func TestExpiryService_ExpireOldOrders(t *testing.T) {
 	tests := []struct {
 		name          string
 		expiryMinutes int
-		expiredCount  int64
+		expiredCount  int
 		expectError   bool
 	}{
 		{
@@ -43,11 +44,11 @@ func TestExpiryService_ExpireOldOrders(t *testing.T) {
 			orderRepo := new(mocks.MockOrderRepository)
 
 			// Setup expectations - the cutoff time will be approximately now - expiryMinutes
-			orderRepo.On("ExpireOldOrders", mock.Anything, mock.AnythingOfType("time.Time")).
-				Return(tt.expiredCount, nil).Once()
+			orderRepo.On("ExpireOldOrders", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+				Return(make([]models.Order, tt.expiredCount), nil).Once()
 
 			// Create service
-			service := NewExpiryService(orderRepo, tt.expiryMinutes, 1*time.Minute)
+			service := NewExpiryService(orderRepo, tt.expiryMinutes, 1*time.Minute, newTestClock(t, time.Now()), NewNoOpOrderEventPublisher())
 
 			// Test internal expiry method by starting and stopping quickly
 			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
@@ -60,7 +61,7 @@ func TestExpiryService_ExpireOldOrders(t *testing.T) {
 			<-ctx.Done()
 
 			// Verify mock was called (it runs once immediately on start)
-			orderRepo.AssertCalled(t, "ExpireOldOrders", mock.Anything, mock.AnythingOfType("time.Time"))
+			orderRepo.AssertCalled(t, "ExpireOldOrders", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"))
 		})
 	}
 }
@@ -68,7 +69,7 @@ func TestExpiryService_ExpireOldOrders(t *testing.T) {
 func TestExpiryService_NewExpiryService(t *testing.T) {
 	orderRepo := new(mocks.MockOrderRepository)
 
-	service := NewExpiryService(orderRepo, 60, 1*time.Minute)
+	service := NewExpiryService(orderRepo, 60, 1*time.Minute, newTestClock(t, time.Now()), NewNoOpOrderEventPublisher())
 
 	assert.NotNil(t, service)
 	assert.Equal(t, 60, service.expiryMinutes)
@@ -79,15 +80,16 @@ func TestExpiryService_CutoffCalculation(t *testing.T) {
 	orderRepo := new(mocks.MockOrderRepository)
 
 	// Capture the cutoff time passed to ExpireOldOrders
-	var capturedCutoff time.Time
-	orderRepo.On("ExpireOldOrders", mock.Anything, mock.AnythingOfType("time.Time")).
+	var capturedCutoff, capturedBusinessDate time.Time
+	orderRepo.On("ExpireOldOrders", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
 		Run(func(args mock.Arguments) {
 			capturedCutoff = args.Get(1).(time.Time)
+			capturedBusinessDate = args.Get(2).(time.Time)
 		}).
-		Return(int64(0), nil)
+		Return([]models.Order{}, nil)
 
 	// Create service with 60 minute expiry
-	service := NewExpiryService(orderRepo, 60, 1*time.Hour)
+	service := NewExpiryService(orderRepo, 60, 1*time.Hour, newTestClock(t, testNow), NewNoOpOrderEventPublisher())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
@@ -95,11 +97,31 @@ func TestExpiryService_CutoffCalculation(t *testing.T) {
 	go service.Start(ctx)
 	<-ctx.Done()
 
-	// Verify cutoff is approximately 60 minutes ago
-	expectedCutoff := time.Now().UTC().Add(-60 * time.Minute)
-	diff := expectedCutoff.Sub(capturedCutoff)
+	// Cutoff is 60 minutes before the clock's now, in UTC
+	assert.Equal(t, testNow.UTC().Add(-60*time.Minute), capturedCutoff)
 
-	// Allow 1 second tolerance for test execution time
-	assert.True(t, diff > -1*time.Second && diff < 1*time.Second,
-		"Cutoff should be approximately 60 minutes ago, diff: %v", diff)
+	// Orders from earlier business days expire regardless of age
+	assert.Equal(t, time.Date(2026, time.January, 14, 0, 0, 0, 0, time.UTC), capturedBusinessDate)
+}
+
+func TestExpiryService_PublishesExpiredEvents(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	orderRepo.On("ExpireOldOrders", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+		Return([]models.Order{
+			{ID: "1401001", Status: models.OrderStatusCancelled},
+			{ID: "1401002", Status: models.OrderStatusCancelled},
+		}, nil)
+
+	broker := NewOrderEventBroker(10)
+	sub, _, _ := broker.Subscribe("", 0)
+	defer sub.Unsubscribe()
+
+	service := NewExpiryService(orderRepo, 60, 1*time.Hour, newTestClock(t, testNow), broker)
+	service.expireOldOrders(context.Background())
+
+	for _, id := range []string{"1401001", "1401002"} {
+		event := <-sub.Events
+		assert.Equal(t, OrderEventExpired, event.Type)
+		assert.Equal(t, id, event.Order.ID)
+	}
 }
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+)
+
+// DefaultIdempotencyWindow is how long a key is remembered by default
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// idempotencyInProgressTimeout is how long a key stays reserved by a request
+// that never finished (the server crashed before completing or releasing
+// it); after that a retry runs again. Requests themselves time out far sooner.
+const idempotencyInProgressTimeout = 2 * time.Minute
+
+// maxIdempotencyKeyLength matches the idempotency_keys.key column
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyService remembers requests made with an Idempotency-Key header
+// so a retried request returns the first response instead of running again
+type IdempotencyService interface {
+	// Begin claims key for a request with the given fingerprint. It returns
+	// nil when the request should run (then Complete or Release the key), or
+	// the stored response of an earlier request with the same key and
+	// fingerprint. A different fingerprint is ErrIdempotencyKeyReused; an
+	// earlier request that has not finished yet is ErrRequestInProgress.
+	Begin(ctx context.Context, key, fingerprint string) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, statusCode int, response []byte) error
+	Release(ctx context.Context, key string) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type idempotencyService struct {
+	repo   repository.IdempotencyRepository
+	clock  *utils.BusinessClock
+	window time.Duration
+}
+
+// NewIdempotencyService creates a service that remembers keys for window
+func NewIdempotencyService(repo repository.IdempotencyRepository, clock *utils.BusinessClock, window time.Duration) IdempotencyService {
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	return &idempotencyService{repo: repo, clock: clock, window: window}
+}
+
+func (s *idempotencyService) Begin(ctx context.Context, key, fingerprint string) (*models.IdempotencyRecord, error) {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return nil, NewValidationError("Idempotency-Key", fmt.Sprintf("Idempotency-Key must be 1-%d characters", maxIdempotencyKeyLength))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := s.clock.Now().UTC()
+	record, reserved, err := s.repo.Reserve(ctx, key, fingerprint, now, now.Add(s.window), now.Add(-idempotencyInProgressTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check idempotency key: %w", err)
+	}
+	if reserved {
+		return nil, nil
+	}
+
+	if record.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !record.Completed() {
+		return nil, ErrRequestInProgress
+	}
+	return record, nil
+}
+
+func (s *idempotencyService) Complete(ctx context.Context, key string, statusCode int, response []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return s.repo.Complete(ctx, key, statusCode, response)
+}
+
+func (s *idempotencyService) Release(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return s.repo.Release(ctx, key)
+}
+
+// PurgeExpired deletes keys past their window
+func (s *idempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return s.repo.DeleteExpired(ctx, s.clock.Now().UTC())
+}
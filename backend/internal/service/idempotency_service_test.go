@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
+)
+
+func TestIdempotencyService_Begin(t *testing.T) {
+	now := time.Date(2026, 2, 12, 5, 0, 0, 0, time.UTC)
+	status := 201
+	completed := &models.IdempotencyRecord{Key: "k1", Fingerprint: "fp", StatusCode: &status, Response: []byte(`{"id":"1202001"}`)}
+	running := &models.IdempotencyRecord{Key: "k1", Fingerprint: "fp"}
+
+	tests := []struct {
+		name        string
+		record      *models.IdempotencyRecord
+		reserved    bool
+		fingerprint string
+		wantRecord  *models.IdempotencyRecord
+		wantErr     error
+	}{
+		{name: "New key runs the request", record: &models.IdempotencyRecord{Key: "k1", Fingerprint: "fp"}, reserved: true, fingerprint: "fp"},
+		{name: "Retry replays the response", record: completed, fingerprint: "fp", wantRecord: completed},
+		{name: "Different request with the same key", record: completed, fingerprint: "other", wantErr: ErrIdempotencyKeyReused},
+		{name: "Retry while the first is running", record: running, fingerprint: "fp", wantErr: ErrRequestInProgress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.MockIdempotencyRepository)
+			repo.On("Reserve", mock.Anything, "k1", tt.fingerprint, now, now.Add(time.Hour), now.Add(-idempotencyInProgressTimeout)).Return(tt.record, tt.reserved, nil)
+
+			svc := NewIdempotencyService(repo, newTestClock(t, now), time.Hour)
+			record, err := svc.Begin(context.Background(), "k1", tt.fingerprint)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRecord, record)
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestIdempotencyService_Begin_InvalidKey(t *testing.T) {
+	svc := NewIdempotencyService(new(mocks.MockIdempotencyRepository), newTestClock(t, time.Now()), 0)
+
+	for _, key := range []string{"", string(make([]byte, 256))} {
+		_, err := svc.Begin(context.Background(), key, "fp")
+		assert.ErrorIs(t, err, ErrValidation)
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+)
+
+type InventoryService interface {
+	GetInventory(ctx context.Context, lowStockOnly bool) (*models.Inventory, error)
+	SetItemStock(ctx context.Context, menuItemID int, req *models.ItemStockRequest) (*models.ItemStock, error)
+	CreateIngredient(ctx context.Context, ingredient *models.Ingredient) (*models.Ingredient, error)
+	UpdateIngredient(ctx context.Context, ingredient *models.Ingredient) (*models.Ingredient, error)
+}
+
+type inventoryService struct {
+	inventoryRepo repository.InventoryRepository
+	menuRepo      repository.MenuRepository
+}
+
+func NewInventoryService(inventoryRepo repository.InventoryRepository, menuRepo repository.MenuRepository) InventoryService {
+	return &inventoryService{
+		inventoryRepo: inventoryRepo,
+		menuRepo:      menuRepo,
+	}
+}
+
+// GetInventory lists the stock of the tracked menu items and the
+// ingredients of the caller's shops, or only what is running low
+func (s *inventoryService) GetInventory(ctx context.Context, lowStockOnly bool) (*models.Inventory, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	inventory, err := s.inventoryRepo.GetInventory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory: %w", err)
+	}
+
+	scope := ShopScopeFromContext(ctx)
+	inventory.Items = slices.DeleteFunc(inventory.Items, func(item models.ItemStock) bool {
+		return !scope.Contains(item.ShopID) || (lowStockOnly && !item.LowStock)
+	})
+	inventory.Ingredients = slices.DeleteFunc(inventory.Ingredients, func(ingredient models.IngredientStock) bool {
+		return !scope.Contains(ingredient.ShopID) || (lowStockOnly && !ingredient.LowStock)
+	})
+	return inventory, nil
+}
+
+// SetItemStock sets how many of a menu item are in stock (or stops tracking
+// it), its low-stock threshold and, when given, its recipe. An item out of
+// stock is made unavailable; one that was sold out becomes available again
+// once restocked.
+func (s *inventoryService) SetItemStock(ctx context.Context, menuItemID int, req *models.ItemStockRequest) (*models.ItemStock, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	verr := &ValidationError{}
+	if req.Stock != nil && *req.Stock < 0 {
+		verr.Add("stock", "stock cannot be negative")
+	}
+	if req.LowStockThreshold != nil && *req.LowStockThreshold < 0 {
+		verr.Add("low_stock_threshold", "low stock threshold cannot be negative")
+	}
+	for i, item := range req.Recipe {
+		field := fmt.Sprintf("recipe[%d]", i)
+		if item.Quantity <= 0 {
+			verr.Add(field+".quantity", fmt.Sprintf("recipe item %d: quantity must be positive", i))
+		}
+		if slices.ContainsFunc(req.Recipe[:i], func(other models.RecipeItem) bool { return other.IngredientID == item.IngredientID }) {
+			verr.Add(field+".ingredient_id", fmt.Sprintf("recipe item %d: ingredient %d is listed twice", i, item.IngredientID))
+		}
+	}
+	if verr.HasErrors() {
+		return nil, verr
+	}
+
+	scope := ShopScopeFromContext(ctx)
+	menuItem, err := s.menuRepo.GetByID(ctx, menuItemID)
+	if err == nil && !scope.Contains(menuItem.ShopID) {
+		err = fmt.Errorf("%w: %d", ErrMenuItemNotFound, menuItemID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get menu item: %w", err)
+	}
+
+	for i, item := range req.Recipe {
+		if _, err := s.getScopedIngredient(ctx, item.IngredientID); err != nil {
+			if errors.Is(err, ErrIngredientNotFound) {
+				verr.Add(fmt.Sprintf("recipe[%d].ingredient_id", i), fmt.Sprintf("recipe item %d: ingredient %d does not exist", i, item.IngredientID))
+				continue
+			}
+			return nil, fmt.Errorf("failed to get ingredient: %w", err)
+		}
+	}
+	if verr.HasErrors() {
+		return nil, verr
+	}
+
+	if err := s.inventoryRepo.SetItemStock(ctx, menuItemID, req); err != nil {
+		return nil, fmt.Errorf("failed to set item stock: %w", err)
+	}
+
+	stock, err := s.inventoryRepo.GetItemStock(ctx, menuItemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item stock: %w", err)
+	}
+	return stock, nil
+}
+
+// CreateIngredient adds an ingredient to the inventory
+func (s *inventoryService) CreateIngredient(ctx context.Context, ingredient *models.Ingredient) (*models.Ingredient, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := validateIngredient(ingredient); err != nil {
+		return nil, err
+	}
+	if err := resolveIngredientShop(ctx, ingredient); err != nil {
+		return nil, err
+	}
+
+	if err := s.inventoryRepo.CreateIngredient(ctx, ingredient); err != nil {
+		return nil, fmt.Errorf("failed to create ingredient: %w", err)
+	}
+	return ingredient, nil
+}
+
+// UpdateIngredient changes an ingredient, e.g. its stock after a delivery or
+// a count. Items using it are made unavailable when it runs out and
+// available again once it is restocked.
+func (s *inventoryService) UpdateIngredient(ctx context.Context, ingredient *models.Ingredient) (*models.Ingredient, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	existing, err := s.getScopedIngredient(ctx, ingredient.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingredient: %w", err)
+	}
+
+	if err := validateIngredient(ingredient); err != nil {
+		return nil, err
+	}
+	if ingredient.ShopID == nil {
+		ingredient.ShopID = existing.ShopID
+	}
+	if err := resolveIngredientShop(ctx, ingredient); err != nil {
+		return nil, err
+	}
+
+	if err := s.inventoryRepo.UpdateIngredient(ctx, ingredient); err != nil {
+		return nil, fmt.Errorf("failed to update ingredient: %w", err)
+	}
+	return ingredient, nil
+}
+
+// getScopedIngredient loads an ingredient, treating ingredients of shops
+// outside the caller's scope as not found
+func (s *inventoryService) getScopedIngredient(ctx context.Context, id int) (*models.Ingredient, error) {
+	ingredient, err := s.inventoryRepo.GetIngredient(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ShopScopeFromContext(ctx).Contains(ingredient.ShopID) {
+		return nil, fmt.Errorf("%w: %d", ErrIngredientNotFound, id)
+	}
+	return ingredient, nil
+}
+
+// validateIngredient validates ingredient fields
+func validateIngredient(ingredient *models.Ingredient) error {
+	verr := &ValidationError{}
+	if len(ingredient.Name) < 2 || len(ingredient.Name) > 100 {
+		verr.Add("name", "name must be 2-100 characters")
+	}
+	if len(ingredient.Unit) > 20 {
+		verr.Add("unit", "unit must be at most 20 characters")
+	}
+	if ingredient.Stock < 0 {
+		verr.Add("stock", "stock cannot be negative")
+	}
+	if ingredient.LowStockThreshold != nil && *ingredient.LowStockThreshold < 0 {
+		verr.Add("low_stock_threshold", "low stock threshold cannot be negative")
+	}
+	if verr.HasErrors() {
+		return verr
+	}
+	return nil
+}
+
+// resolveIngredientShop binds an ingredient to the caller's shop when they
+// have only one, and checks they may manage the shop it belongs to.
+// Ingredients without a shop are shared and managed by owners.
+func resolveIngredientShop(ctx context.Context, ingredient *models.Ingredient) error {
+	scope := ShopScopeFromContext(ctx)
+	if ingredient.ShopID == nil {
+		if shopIDs := scope.ShopIDs(); !scope.All() && len(shopIDs) == 1 {
+			ingredient.ShopID = &shopIDs[0]
+		}
+	}
+	if !scope.Contains(ingredient.ShopID) {
+		return fmt.Errorf("%w: ingredient belongs to another shop", ErrForbidden)
+	}
+	return nil
+}
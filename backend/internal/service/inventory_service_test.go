@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
+)
+
+func TestInventoryService_SetItemStock(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	stock := func(n int) *int { return &n }
+
+	setup := func() (InventoryService, *mocks.MockInventoryRepository, *mocks.MockMenuRepository) {
+		inventoryRepo := new(mocks.MockInventoryRepository)
+		menuRepo := new(mocks.MockMenuRepository)
+		menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{ID: 1, Name: "French Fries S", ShopID: &friesShop}, nil)
+		inventoryRepo.On("GetIngredient", mock.Anything, 1).Return(&models.Ingredient{ID: 1, Name: "Potatoes", ShopID: &friesShop}, nil)
+		inventoryRepo.On("GetIngredient", mock.Anything, 2).Return(&models.Ingredient{ID: 2, Name: "Cups", ShopID: &drinksShop}, nil)
+		return NewInventoryService(inventoryRepo, menuRepo), inventoryRepo, menuRepo
+	}
+	friesStaff := WithShopScope(context.Background(), OnlyShops(friesShop))
+
+	t.Run("Sets stock and recipe", func(t *testing.T) {
+		svc, inventoryRepo, _ := setup()
+		req := &models.ItemStockRequest{Stock: stock(40), LowStockThreshold: stock(10), Recipe: []models.RecipeItem{{IngredientID: 1, Quantity: 0.2}}}
+		inventoryRepo.On("SetItemStock", mock.Anything, 1, req).Return(nil)
+		inventoryRepo.On("GetItemStock", mock.Anything, 1).Return(&models.ItemStock{MenuItemID: 1, Stock: stock(40)}, nil)
+
+		got, err := svc.SetItemStock(friesStaff, 1, req)
+		require.NoError(t, err)
+		assert.Equal(t, 40, *got.Stock)
+		inventoryRepo.AssertCalled(t, "SetItemStock", mock.Anything, 1, req)
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		svc, inventoryRepo, menuRepo := setup()
+
+		_, err := svc.SetItemStock(friesStaff, 1, &models.ItemStockRequest{
+			Stock:  stock(-1),
+			Recipe: []models.RecipeItem{{IngredientID: 1, Quantity: 0}, {IngredientID: 1, Quantity: 1}},
+		})
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Len(t, verr.Fields, 3)
+		menuRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+		inventoryRepo.AssertNotCalled(t, "SetItemStock", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Ingredients of other shops cannot be used", func(t *testing.T) {
+		svc, inventoryRepo, _ := setup()
+
+		_, err := svc.SetItemStock(friesStaff, 1, &models.ItemStockRequest{Recipe: []models.RecipeItem{{IngredientID: 2, Quantity: 1}}})
+		assert.ErrorIs(t, err, ErrValidation)
+		assert.ErrorContains(t, err, "ingredient 2 does not exist")
+		inventoryRepo.AssertNotCalled(t, "SetItemStock", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Items of other shops are not found", func(t *testing.T) {
+		svc, _, _ := setup()
+
+		_, err := svc.SetItemStock(WithShopScope(context.Background(), OnlyShops(drinksShop)), 1, &models.ItemStockRequest{Stock: stock(5)})
+		assert.ErrorIs(t, err, ErrMenuItemNotFound)
+	})
+}
+
+func TestInventoryService_GetInventory(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	inventoryRepo := new(mocks.MockInventoryRepository)
+	inventory := func() *models.Inventory {
+		return &models.Inventory{
+			Items: []models.ItemStock{
+				{MenuItemID: 1, ShopID: &friesShop, LowStock: true},
+				{MenuItemID: 2, ShopID: &friesShop},
+				{MenuItemID: 7, ShopID: &drinksShop, LowStock: true},
+			},
+			Ingredients: []models.IngredientStock{
+				{Ingredient: models.Ingredient{ID: 1, ShopID: &friesShop}},
+				{Ingredient: models.Ingredient{ID: 2, ShopID: &drinksShop}, LowStock: true},
+			},
+		}
+	}
+	inventoryRepo.On("GetInventory", mock.Anything).Return(inventory(), nil).Once()
+	inventoryRepo.On("GetInventory", mock.Anything).Return(inventory(), nil).Once()
+	svc := NewInventoryService(inventoryRepo, new(mocks.MockMenuRepository))
+
+	// Staff see their own shops' stock
+	got, err := svc.GetInventory(WithShopScope(context.Background(), OnlyShops(friesShop)), false)
+	require.NoError(t, err)
+	assert.Len(t, got.Items, 2)
+	assert.Len(t, got.Ingredients, 1)
+
+	got, err = svc.GetInventory(context.Background(), true)
+	require.NoError(t, err)
+	require.Len(t, got.Items, 2)
+	assert.Equal(t, 7, got.Items[1].MenuItemID)
+	require.Len(t, got.Ingredients, 1)
+	assert.Equal(t, 2, got.Ingredients[0].ID)
+}
+
+func TestInventoryService_Ingredients(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	friesStaff := WithShopScope(context.Background(), OnlyShops(friesShop))
+
+	t.Run("Staff of one shop create ingredients for it", func(t *testing.T) {
+		inventoryRepo := new(mocks.MockInventoryRepository)
+		inventoryRepo.On("CreateIngredient", mock.Anything, mock.AnythingOfType("*models.Ingredient")).Return(nil)
+		svc := NewInventoryService(inventoryRepo, new(mocks.MockMenuRepository))
+
+		created, err := svc.CreateIngredient(friesStaff, &models.Ingredient{Name: "Potatoes", Unit: "kg", Stock: 20})
+		require.NoError(t, err)
+		assert.Equal(t, &friesShop, created.ShopID)
+
+		_, err = svc.CreateIngredient(friesStaff, &models.Ingredient{Name: "Cups", ShopID: &drinksShop})
+		assert.ErrorIs(t, err, ErrForbidden)
+
+		_, err = svc.CreateIngredient(friesStaff, &models.Ingredient{Name: "X", Stock: -1})
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Len(t, verr.Fields, 2)
+	})
+
+	t.Run("Update keeps the shop", func(t *testing.T) {
+		inventoryRepo := new(mocks.MockInventoryRepository)
+		inventoryRepo.On("GetIngredient", mock.Anything, 1).Return(&models.Ingredient{ID: 1, Name: "Potatoes", ShopID: &friesShop}, nil)
+		inventoryRepo.On("GetIngredient", mock.Anything, 2).Return(&models.Ingredient{ID: 2, Name: "Cups", ShopID: &drinksShop}, nil)
+		inventoryRepo.On("UpdateIngredient", mock.Anything, mock.AnythingOfType("*models.Ingredient")).Return(nil)
+		svc := NewInventoryService(inventoryRepo, new(mocks.MockMenuRepository))
+
+		updated, err := svc.UpdateIngredient(friesStaff, &models.Ingredient{ID: 1, Name: "Potatoes", Unit: "kg", Stock: 35})
+		require.NoError(t, err)
+		assert.Equal(t, &friesShop, updated.ShopID)
+		assert.Equal(t, 35.0, updated.Stock)
+
+		_, err = svc.UpdateIngredient(friesStaff, &models.Ingredient{ID: 2, Name: "Cups", Stock: 100})
+		assert.ErrorIs(t, err, ErrIngredientNotFound)
+	})
+}
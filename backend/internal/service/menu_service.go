@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -21,11 +22,13 @@ type MenuService interface {
 
 type menuService struct {
 	menuRepo repository.MenuRepository
+	shopRepo repository.ShopRepository
 }
 
-func NewMenuService(menuRepo repository.MenuRepository) MenuService {
+func NewMenuService(menuRepo repository.MenuRepository, shopRepo repository.ShopRepository) MenuService {
 	return &menuService{
 		menuRepo: menuRepo,
+		shopRepo: shopRepo,
 	}
 }
 
@@ -35,7 +38,7 @@ func (s *menuService) GetAll(ctx context.Context) ([]models.MenuItem, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all menu items: %w", err)
 	}
-	return items, nil
+	return ShopScopeFromContext(ctx).FilterMenuItems(items), nil
 }
 
 // GetAvailable retrieves only available menu items
@@ -44,7 +47,7 @@ func (s *menuService) GetAvailable(ctx context.Context) ([]models.MenuItem, erro
 	if err != nil {
 		return nil, fmt.Errorf("failed to get available menu items: %w", err)
 	}
-	return items, nil
+	return ShopScopeFromContext(ctx).FilterMenuItems(items), nil
 }
 
 // GetByID retrieves a menu item by ID
@@ -52,7 +55,7 @@ func (s *menuService) GetByID(ctx context.Context, id int) (*models.MenuItem, er
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	item, err := s.menuRepo.GetByID(ctx, id)
+	item, err := s.getScopedItem(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get menu item: %w", err)
 	}
@@ -68,6 +71,12 @@ func (s *menuService) Create(ctx context.Context, item *models.MenuItem) (*model
 	if err := s.validateMenuItem(item); err != nil {
 		return nil, err
 	}
+	if err := s.resolveShop(ctx, item); err != nil {
+		return nil, err
+	}
+	if err := s.checkBundleOptions(ctx, item); err != nil {
+		return nil, err
+	}
 
 	// Check for duplicate name
 	exists, err := s.menuRepo.CheckDuplicateName(ctx, item.Name, 0)
@@ -75,12 +84,24 @@ func (s *menuService) Create(ctx context.Context, item *models.MenuItem) (*model
 		return nil, fmt.Errorf("failed to check duplicate name: %w", err)
 	}
 	if exists {
-		return nil, fmt.Errorf("menu item with name '%s' already exists", item.Name)
+		return nil, fmt.Errorf("menu item with name '%s' %w", item.Name, ErrDuplicate)
 	}
 
+	// Stock is set through the inventory once the item exists
+	item.Stock, item.LowStockThreshold, item.SoldOutAt = nil, nil, nil
 	if err := s.menuRepo.Create(ctx, item); err != nil {
 		return nil, fmt.Errorf("failed to create menu item: %w", err)
 	}
+	if item.ModifierGroups != nil {
+		if err := s.menuRepo.SetModifierGroups(ctx, item.ID, item.ModifierGroups); err != nil {
+			return nil, fmt.Errorf("failed to set modifier groups: %w", err)
+		}
+	}
+	if item.BundleSlots != nil {
+		if err := s.menuRepo.SetBundleSlots(ctx, item.ID, item.BundleSlots); err != nil {
+			return nil, fmt.Errorf("failed to set bundle slots: %w", err)
+		}
+	}
 
 	return item, nil
 }
@@ -91,14 +112,21 @@ func (s *menuService) Update(ctx context.Context, item *models.MenuItem) (*model
 	defer cancel()
 
 	// Check if item exists
-	if _, err := s.menuRepo.GetByID(ctx, item.ID); err != nil {
-		return nil, fmt.Errorf("menu item not found: %w", err)
+	existing, err := s.getScopedItem(ctx, item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get menu item: %w", err)
 	}
 
 	// Validate
 	if err := s.validateMenuItem(item); err != nil {
 		return nil, err
 	}
+	if err := s.resolveShop(ctx, item); err != nil {
+		return nil, err
+	}
+	if err := s.checkBundleOptions(ctx, item); err != nil {
+		return nil, err
+	}
 
 	// Check for duplicate name (excluding current item)
 	exists, err := s.menuRepo.CheckDuplicateName(ctx, item.Name, item.ID)
@@ -106,12 +134,23 @@ func (s *menuService) Update(ctx context.Context, item *models.MenuItem) (*model
 		return nil, fmt.Errorf("failed to check duplicate name: %w", err)
 	}
 	if exists {
-		return nil, fmt.Errorf("menu item with name '%s' already exists", item.Name)
+		return nil, fmt.Errorf("menu item with name '%s' %w", item.Name, ErrDuplicate)
 	}
 
 	if err := s.menuRepo.Update(ctx, item); err != nil {
 		return nil, fmt.Errorf("failed to update menu item: %w", err)
 	}
+	item.Stock, item.LowStockThreshold, item.SoldOutAt = existing.Stock, existing.LowStockThreshold, existing.SoldOutAt
+	if item.ModifierGroups == nil {
+		item.ModifierGroups = existing.ModifierGroups
+	} else if err := s.menuRepo.SetModifierGroups(ctx, item.ID, item.ModifierGroups); err != nil {
+		return nil, fmt.Errorf("failed to set modifier groups: %w", err)
+	}
+	if item.BundleSlots == nil {
+		item.BundleSlots = existing.BundleSlots
+	} else if err := s.menuRepo.SetBundleSlots(ctx, item.ID, item.BundleSlots); err != nil {
+		return nil, fmt.Errorf("failed to set bundle slots: %w", err)
+	}
 
 	return item, nil
 }
@@ -121,6 +160,10 @@ func (s *menuService) Delete(ctx context.Context, id int) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	if _, err := s.getScopedItem(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete menu item: %w", err)
+	}
+
 	if err := s.menuRepo.Delete(ctx, id); err != nil {
 		return fmt.Errorf("failed to delete menu item: %w", err)
 	}
@@ -128,13 +171,195 @@ func (s *menuService) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
+// getScopedItem loads a menu item, treating items of shops outside the
+// caller's scope as not found
+func (s *menuService) getScopedItem(ctx context.Context, id int) (*models.MenuItem, error) {
+	item, err := s.menuRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ShopScopeFromContext(ctx).Contains(item.ShopID) {
+		return nil, fmt.Errorf("%w: %d", ErrMenuItemNotFound, id)
+	}
+	return item, nil
+}
+
+// resolveShop binds the item to a shop and keeps its category equal to the
+// shop code. The shop is given by shop_id or, as before shops existed, by
+// category; staff of a single shop may leave both out.
+func (s *menuService) resolveShop(ctx context.Context, item *models.MenuItem) error {
+	scope := ShopScopeFromContext(ctx)
+	if item.ShopID == nil && (item.Category == nil || *item.Category == "") {
+		if shopIDs := scope.ShopIDs(); !scope.All() && len(shopIDs) == 1 {
+			item.ShopID = &shopIDs[0]
+		}
+	}
+
+	switch {
+	case item.ShopID != nil:
+		shop, err := s.shopRepo.GetByID(ctx, *item.ShopID)
+		if err != nil {
+			if errors.Is(err, ErrShopNotFound) {
+				return NewValidationError("shop_id", "shop does not exist")
+			}
+			return fmt.Errorf("failed to get shop: %w", err)
+		}
+		item.Category = &shop.Code
+	case item.Category != nil && *item.Category != "":
+		shop, err := s.shopRepo.GetByCode(ctx, *item.Category)
+		if err == nil {
+			item.ShopID = &shop.ID
+		} else if !errors.Is(err, ErrShopNotFound) {
+			return fmt.Errorf("failed to get shop: %w", err)
+		}
+	}
+
+	if !scope.Contains(item.ShopID) {
+		return fmt.Errorf("%w: menu item belongs to another shop", ErrForbidden)
+	}
+	return nil
+}
+
 // validateMenuItem validates menu item fields
 func (s *menuService) validateMenuItem(item *models.MenuItem) error {
+	verr := &ValidationError{}
 	if len(item.Name) < 2 || len(item.Name) > 100 {
-		return fmt.Errorf("name must be 2-100 characters")
+		verr.Add("name", "name must be 2-100 characters")
 	}
 	if item.Price <= 0 || item.Price > 10000 {
-		return fmt.Errorf("price must be between 0.01 and 10000")
+		verr.Add("price", "price must be between 0.01 and 10000")
+	}
+	validateModifierGroups(item.ModifierGroups, verr)
+	validateBundleSlots(item.BundleSlots, verr)
+	if verr.HasErrors() {
+		return verr
+	}
+	return nil
+}
+
+// validateModifierGroups checks the modifier groups of a menu item. A
+// required group must have at least one modifier picked and a group with a
+// minimum is required, so either may be given; the maximum defaults to one.
+func validateModifierGroups(groups []models.ModifierGroup, verr *ValidationError) {
+	groupNames := make(map[string]bool)
+	for i := range groups {
+		group := &groups[i]
+		field := fmt.Sprintf("modifier_groups[%d]", i)
+
+		if len(group.Name) < 1 || len(group.Name) > 50 {
+			verr.Add(field+".name", "name must be 1-50 characters")
+		} else if groupNames[group.Name] {
+			verr.Add(field+".name", fmt.Sprintf("modifier group '%s' is listed twice", group.Name))
+		}
+		groupNames[group.Name] = true
+
+		if group.Required && group.MinSelect == 0 {
+			group.MinSelect = 1
+		}
+		group.Required = group.MinSelect > 0
+		if group.MaxSelect == 0 {
+			group.MaxSelect = max(group.MinSelect, 1)
+		}
+		switch {
+		case group.MinSelect < 0:
+			verr.Add(field+".min_select", "min_select cannot be negative")
+		case group.MaxSelect < group.MinSelect:
+			verr.Add(field+".max_select", "max_select cannot be less than min_select")
+		case group.MinSelect > len(group.Modifiers):
+			verr.Add(field+".min_select", "min_select cannot be more than the number of modifiers")
+		}
+
+		if len(group.Modifiers) == 0 {
+			verr.Add(field+".modifiers", "modifier group must have at least one modifier")
+		}
+		names := make(map[string]bool)
+		for j, modifier := range group.Modifiers {
+			modifierField := fmt.Sprintf("%s.modifiers[%d]", field, j)
+			if len(modifier.Name) < 1 || len(modifier.Name) > 50 {
+				verr.Add(modifierField+".name", "name must be 1-50 characters")
+			} else if names[modifier.Name] {
+				verr.Add(modifierField+".name", fmt.Sprintf("modifier '%s' is listed twice", modifier.Name))
+			}
+			names[modifier.Name] = true
+			if modifier.PriceDelta < -10000 || modifier.PriceDelta > 10000 {
+				verr.Add(modifierField+".price_delta", "price_delta must be between -10000 and 10000")
+			}
+		}
+	}
+}
+
+// validateBundleSlots checks the slots of a bundle; a slot is filled once
+// unless a quantity is given
+func validateBundleSlots(slots []models.BundleSlot, verr *ValidationError) {
+	names := make(map[string]bool)
+	for i := range slots {
+		slot := &slots[i]
+		field := fmt.Sprintf("bundle_slots[%d]", i)
+
+		if len(slot.Name) < 1 || len(slot.Name) > 50 {
+			verr.Add(field+".name", "name must be 1-50 characters")
+		} else if names[slot.Name] {
+			verr.Add(field+".name", fmt.Sprintf("bundle slot '%s' is listed twice", slot.Name))
+		}
+		names[slot.Name] = true
+
+		if slot.Quantity == 0 {
+			slot.Quantity = 1
+		}
+		if slot.Quantity < 1 || slot.Quantity > 10 {
+			verr.Add(field+".quantity", "quantity must be 1-10")
+		}
+
+		if len(slot.Options) == 0 {
+			verr.Add(field+".options", "bundle slot must have at least one option")
+		}
+		seen := make(map[int]bool)
+		for j, option := range slot.Options {
+			optionField := fmt.Sprintf("%s.options[%d]", field, j)
+			if seen[option.MenuItemID] {
+				verr.Add(optionField+".menu_item_id", fmt.Sprintf("menu item %d is listed twice", option.MenuItemID))
+			}
+			seen[option.MenuItemID] = true
+			if option.PriceDelta < 0 || option.PriceDelta > 10000 {
+				verr.Add(optionField+".price_delta", "price_delta must be between 0 and 10000")
+			}
+		}
+	}
+}
+
+// checkBundleOptions checks that the options of a bundle are menu items
+// that are not bundles themselves
+func (s *menuService) checkBundleOptions(ctx context.Context, item *models.MenuItem) error {
+	verr := &ValidationError{}
+	for i := range item.BundleSlots {
+		slot := &item.BundleSlots[i]
+		for j := range slot.Options {
+			option := &slot.Options[j]
+			field := fmt.Sprintf("bundle_slots[%d].options[%d].menu_item_id", i, j)
+			if item.ID != 0 && option.MenuItemID == item.ID {
+				verr.Add(field, "a bundle cannot contain itself")
+				continue
+			}
+			component, err := s.menuRepo.GetByID(ctx, option.MenuItemID)
+			if err != nil {
+				if errors.Is(err, ErrMenuItemNotFound) {
+					verr.Add(field, fmt.Sprintf("menu item %d does not exist", option.MenuItemID))
+					continue
+				}
+				return fmt.Errorf("failed to get menu item: %w", err)
+			}
+			if component.IsBundle() {
+				verr.Add(field, fmt.Sprintf("%s is a bundle itself", component.Name))
+				continue
+			}
+			option.Name = component.Name
+			option.Available = component.Available
+			option.ShopID = component.ShopID
+			option.Category = component.Category
+		}
+	}
+	if verr.HasErrors() {
+		return verr
 	}
 	return nil
 }
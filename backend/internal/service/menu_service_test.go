@@ -3,10 +3,12 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/tanasatit/barvidva-kasetfair/internal/models"
 	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
 )
@@ -22,7 +24,7 @@ func TestMenuService_GetAll(t *testing.T) {
 
 	menuRepo.On("GetAll", mock.Anything).Return(expectedItems, nil)
 
-	svc := NewMenuService(menuRepo)
+	svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
 	items, err := svc.GetAll(context.Background())
 
 	assert.NoError(t, err)
@@ -41,7 +43,7 @@ func TestMenuService_GetAvailable(t *testing.T) {
 
 	menuRepo.On("GetAvailable", mock.Anything).Return(expectedItems, nil)
 
-	svc := NewMenuService(menuRepo)
+	svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
 	items, err := svc.GetAvailable(context.Background())
 
 	assert.NoError(t, err)
@@ -81,7 +83,7 @@ func TestMenuService_GetByID(t *testing.T) {
 			menuRepo := new(mocks.MockMenuRepository)
 			tt.setupMock(menuRepo)
 
-			svc := NewMenuService(menuRepo)
+			svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
 			item, err := svc.GetByID(context.Background(), tt.id)
 
 			if tt.wantErr {
@@ -172,7 +174,7 @@ func TestMenuService_Create(t *testing.T) {
 			menuRepo := new(mocks.MockMenuRepository)
 			tt.setupMock(menuRepo)
 
-			svc := NewMenuService(menuRepo)
+			svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
 			item, err := svc.Create(context.Background(), tt.item)
 
 			if tt.wantErr {
@@ -252,7 +254,7 @@ func TestMenuService_Update(t *testing.T) {
 			menuRepo := new(mocks.MockMenuRepository)
 			tt.setupMock(menuRepo)
 
-			svc := NewMenuService(menuRepo)
+			svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
 			item, err := svc.Update(context.Background(), tt.item)
 
 			if tt.wantErr {
@@ -279,6 +281,7 @@ func TestMenuService_Delete(t *testing.T) {
 			name: "Successful deletion",
 			id:   1,
 			setupMock: func(repo *mocks.MockMenuRepository) {
+				repo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{ID: 1, Name: "French Fries S"}, nil)
 				repo.On("Delete", mock.Anything, 1).Return(nil)
 			},
 			wantErr: false,
@@ -287,7 +290,7 @@ func TestMenuService_Delete(t *testing.T) {
 			name: "Item not found",
 			id:   999,
 			setupMock: func(repo *mocks.MockMenuRepository) {
-				repo.On("Delete", mock.Anything, 999).Return(errors.New("menu item not found"))
+				repo.On("GetByID", mock.Anything, 999).Return(nil, fmt.Errorf("%w: 999", ErrMenuItemNotFound))
 			},
 			wantErr: true,
 		},
@@ -298,7 +301,7 @@ func TestMenuService_Delete(t *testing.T) {
 			menuRepo := new(mocks.MockMenuRepository)
 			tt.setupMock(menuRepo)
 
-			svc := NewMenuService(menuRepo)
+			svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
 			err := svc.Delete(context.Background(), tt.id)
 
 			if tt.wantErr {
@@ -311,3 +314,190 @@ func TestMenuService_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestMenuService_ShopScope(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	fries := models.MenuItem{ID: 1, Name: "French Fries S", Price: 40, Category: strPtr("fries"), ShopID: &friesShop}
+	cola := models.MenuItem{ID: 2, Name: "Cola", Price: 25, Category: strPtr("drinks"), ShopID: &drinksShop}
+
+	menuRepo := new(mocks.MockMenuRepository)
+	menuRepo.On("GetAll", mock.Anything).Return([]models.MenuItem{fries, cola}, nil)
+	menuRepo.On("GetByID", mock.Anything, 2).Return(&cola, nil)
+	menuRepo.On("CheckDuplicateName", mock.Anything, mock.Anything, 0).Return(false, nil)
+	menuRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.MenuItem")).Return(nil)
+
+	shopRepo := new(mocks.MockShopRepository)
+	shopRepo.On("GetByID", mock.Anything, friesShop).Return(&models.Shop{ID: friesShop, Code: "fries"}, nil)
+	shopRepo.On("GetByCode", mock.Anything, "drinks").Return(&models.Shop{ID: drinksShop, Code: "drinks"}, nil)
+
+	svc := NewMenuService(menuRepo, shopRepo)
+	ctx := WithShopScope(context.Background(), OnlyShops(friesShop))
+
+	// Only the caller's shop is listed
+	items, err := svc.GetAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.MenuItem{fries}, items)
+
+	// Other shops' items look missing
+	_, err = svc.GetByID(ctx, 2)
+	assert.ErrorIs(t, err, ErrMenuItemNotFound)
+	assert.ErrorIs(t, svc.Delete(ctx, 2), ErrMenuItemNotFound)
+
+	// New items default to the caller's only shop, with its code as category
+	created, err := svc.Create(ctx, &models.MenuItem{Name: "Cheese Fries", Price: 70})
+	assert.NoError(t, err)
+	assert.Equal(t, &friesShop, created.ShopID)
+	assert.Equal(t, "fries", *created.Category)
+
+	// Or are refused for another shop
+	_, err = svc.Create(ctx, &models.MenuItem{Name: "Lemonade", Price: 30, Category: strPtr("drinks")})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Unscoped callers see everything
+	items, err = svc.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+}
+
+func TestMenuService_ModifierGroups(t *testing.T) {
+	size := models.ModifierGroup{
+		Name:     "Size",
+		Required: true,
+		Modifiers: []models.Modifier{
+			{Name: "Regular", Available: true},
+			{Name: "Large", PriceDelta: 15, Available: true},
+		},
+	}
+
+	t.Run("Created with the item", func(t *testing.T) {
+		menuRepo := new(mocks.MockMenuRepository)
+		menuRepo.On("CheckDuplicateName", mock.Anything, "Iced Latte", 0).Return(false, nil)
+		menuRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.MenuItem")).Return(nil)
+		menuRepo.On("SetModifierGroups", mock.Anything, 0, mock.Anything).Return(nil)
+
+		svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
+		item, err := svc.Create(context.Background(), &models.MenuItem{
+			Name:           "Iced Latte",
+			Price:          55,
+			Available:      true,
+			ModifierGroups: []models.ModifierGroup{size, {Name: "Toppings", MaxSelect: 2, Modifiers: []models.Modifier{{Name: "Pearls", PriceDelta: 10}}}},
+		})
+		assert.NoError(t, err)
+
+		// A required group needs one pick and an optional one none
+		groups := menuRepo.Calls[2].Arguments.Get(2).([]models.ModifierGroup)
+		assert.Equal(t, 1, groups[0].MinSelect)
+		assert.Equal(t, 1, groups[0].MaxSelect)
+		assert.False(t, groups[1].Required)
+		assert.Equal(t, 0, groups[1].MinSelect)
+		assert.Equal(t, item.ModifierGroups, groups)
+	})
+
+	t.Run("Invalid groups", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			group  models.ModifierGroup
+			errMsg string
+		}{
+			{"No modifiers", models.ModifierGroup{Name: "Size"}, "must have at least one modifier"},
+			{"Max below min", models.ModifierGroup{Name: "Size", MinSelect: 2, MaxSelect: 1, Modifiers: size.Modifiers}, "max_select cannot be less than min_select"},
+			{"Min above modifiers", models.ModifierGroup{Name: "Size", MinSelect: 3, MaxSelect: 3, Modifiers: size.Modifiers}, "min_select cannot be more than the number of modifiers"},
+			{"Duplicate modifier", models.ModifierGroup{Name: "Size", Modifiers: []models.Modifier{{Name: "Large"}, {Name: "Large"}}}, "listed twice"},
+			{"Missing name", models.ModifierGroup{Modifiers: size.Modifiers}, "name must be 1-50 characters"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				menuRepo := new(mocks.MockMenuRepository)
+				svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
+
+				_, err := svc.Create(context.Background(), &models.MenuItem{
+					Name:           "Iced Latte",
+					Price:          55,
+					ModifierGroups: []models.ModifierGroup{tt.group},
+				})
+				assert.ErrorIs(t, err, ErrValidation)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				menuRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+			})
+		}
+	})
+
+	t.Run("Update without groups keeps them", func(t *testing.T) {
+		existing := &models.MenuItem{ID: 1, Name: "Iced Latte", Price: 55, Available: true, ModifierGroups: []models.ModifierGroup{size}}
+
+		menuRepo := new(mocks.MockMenuRepository)
+		menuRepo.On("GetByID", mock.Anything, 1).Return(existing, nil)
+		menuRepo.On("CheckDuplicateName", mock.Anything, "Iced Latte", 1).Return(false, nil)
+		menuRepo.On("Update", mock.Anything, mock.AnythingOfType("*models.MenuItem")).Return(nil)
+
+		svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
+		item, err := svc.Update(context.Background(), &models.MenuItem{ID: 1, Name: "Iced Latte", Price: 60, Available: false})
+		assert.NoError(t, err)
+		assert.Equal(t, existing.ModifierGroups, item.ModifierGroups)
+		menuRepo.AssertNotCalled(t, "SetModifierGroups", mock.Anything, mock.Anything, mock.Anything)
+
+		// An empty list removes them
+		menuRepo.On("SetModifierGroups", mock.Anything, 1, []models.ModifierGroup{}).Return(nil)
+		_, err = svc.Update(context.Background(), &models.MenuItem{ID: 1, Name: "Iced Latte", Price: 60, ModifierGroups: []models.ModifierGroup{}})
+		assert.NoError(t, err)
+		menuRepo.AssertExpectations(t)
+	})
+}
+
+func TestMenuService_BundleSlots(t *testing.T) {
+	friesShop := 1
+	menuRepo := new(mocks.MockMenuRepository)
+	menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{ID: 1, Name: "French Fries M", Price: 60, Available: true, ShopID: &friesShop}, nil)
+	menuRepo.On("GetByID", mock.Anything, 4).Return(&models.MenuItem{ID: 4, Name: "Cola", Price: 25, Available: true}, nil)
+	menuRepo.On("GetByID", mock.Anything, 5).Return(&models.MenuItem{ID: 5, Name: "Iced Tea", Price: 30, Available: false}, nil)
+	menuRepo.On("GetByID", mock.Anything, 7).Return(&models.MenuItem{ID: 7, Name: "Party Set", Price: 150, Available: true, BundleSlots: []models.BundleSlot{{ID: 1, Name: "Main"}}}, nil)
+	menuRepo.On("GetByID", mock.Anything, 9).Return(nil, fmt.Errorf("%w: 9", ErrMenuItemNotFound))
+	menuRepo.On("CheckDuplicateName", mock.Anything, "Fries Set", 0).Return(false, nil)
+	menuRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.MenuItem")).Return(nil)
+	menuRepo.On("SetBundleSlots", mock.Anything, 0, mock.Anything).Return(nil)
+
+	svc := NewMenuService(menuRepo, new(mocks.MockShopRepository))
+
+	t.Run("Options are filled in from their menu items", func(t *testing.T) {
+		item, err := svc.Create(context.Background(), &models.MenuItem{
+			Name:      "Fries Set",
+			Price:     75,
+			Available: true,
+			BundleSlots: []models.BundleSlot{
+				{Name: "Main", Options: []models.BundleOption{{MenuItemID: 1}}},
+				{Name: "Drink", Options: []models.BundleOption{{MenuItemID: 4}, {MenuItemID: 5, PriceDelta: 5}}},
+			},
+		})
+		require.NoError(t, err)
+
+		main, drink := item.BundleSlots[0], item.BundleSlots[1]
+		assert.Equal(t, 1, main.Quantity)
+		assert.Equal(t, "French Fries M", main.Options[0].Name)
+		assert.Equal(t, &friesShop, main.Options[0].ShopID)
+		assert.False(t, drink.Options[1].Available)
+	})
+
+	tests := []struct {
+		name   string
+		slot   models.BundleSlot
+		errMsg string
+	}{
+		{"No options", models.BundleSlot{Name: "Main"}, "bundle slot must have at least one option"},
+		{"Duplicate option", models.BundleSlot{Name: "Drink", Options: []models.BundleOption{{MenuItemID: 4}, {MenuItemID: 4}}}, "menu item 4 is listed twice"},
+		{"Too many per bundle", models.BundleSlot{Name: "Main", Quantity: 11, Options: []models.BundleOption{{MenuItemID: 1}}}, "quantity must be 1-10"},
+		{"Discounted option", models.BundleSlot{Name: "Drink", Options: []models.BundleOption{{MenuItemID: 4, PriceDelta: -5}}}, "price_delta must be between 0 and 10000"},
+		{"Unknown menu item", models.BundleSlot{Name: "Drink", Options: []models.BundleOption{{MenuItemID: 9}}}, "menu item 9 does not exist"},
+		{"Bundle in a bundle", models.BundleSlot{Name: "Main", Options: []models.BundleOption{{MenuItemID: 7}}}, "Party Set is a bundle itself"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Create(context.Background(), &models.MenuItem{
+				Name:        "Fries Set",
+				Price:       75,
+				BundleSlots: []models.BundleSlot{tt.slot},
+			})
+			assert.ErrorIs(t, err, ErrValidation)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
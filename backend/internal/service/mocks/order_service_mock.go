@@ -20,6 +20,14 @@ func (m *MockOrderService) CreateOrder(ctx context.Context, req *models.CreateOr
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
+func (m *MockOrderService) SyncOrders(ctx context.Context, req *models.SyncOrdersRequest) (*models.SyncOrdersResponse, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.SyncOrdersResponse), args.Error(1)
+}
+
 func (m *MockOrderService) ValidateOrder(ctx context.Context, req *models.CreateOrderRequest) error {
 	args := m.Called(ctx, req)
 	return args.Error(0)
@@ -49,6 +57,14 @@ func (m *MockOrderService) GetQueue(ctx context.Context) ([]models.Order, error)
 	return args.Get(0).([]models.Order), args.Error(1)
 }
 
+func (m *MockOrderService) GetReady(ctx context.Context) ([]models.Order, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Order), args.Error(1)
+}
+
 func (m *MockOrderService) VerifyPayment(ctx context.Context, id string, paymentMethod *models.PaymentMethod) (*models.Order, error) {
 	args := m.Called(ctx, id, paymentMethod)
 	if args.Get(0) == nil {
@@ -57,6 +73,22 @@ func (m *MockOrderService) VerifyPayment(ctx context.Context, id string, payment
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
+func (m *MockOrderService) RecordPayment(ctx context.Context, id string, req *models.PaymentRequest) (*models.Order, error) {
+	args := m.Called(ctx, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *MockOrderService) MarkReady(ctx context.Context, id string) (*models.Order, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
 func (m *MockOrderService) CompleteOrder(ctx context.Context, id string) (*models.Order, error) {
 	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
@@ -65,11 +97,35 @@ func (m *MockOrderService) CompleteOrder(ctx context.Context, id string) (*model
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
+func (m *MockOrderService) GetOrderHistory(ctx context.Context, id string) ([]models.OrderStatusHistory, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OrderStatusHistory), args.Error(1)
+}
+
+func (m *MockOrderService) UpdateOrderItems(ctx context.Context, id string, req *models.UpdateOrderItemsRequest) (*models.Order, error) {
+	args := m.Called(ctx, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
 func (m *MockOrderService) CancelOrder(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockOrderService) RefundOrder(ctx context.Context, id string, req *models.RefundRequest) (*models.Order, error) {
+	args := m.Called(ctx, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
 func (m *MockOrderService) GetCompleted(ctx context.Context) ([]models.Order, error) {
 	args := m.Called(ctx)
 	if args.Get(0) != nil {
@@ -94,6 +150,14 @@ func (m *MockOrderService) GetQueueByCategory(ctx context.Context, category stri
 	return nil, args.Error(1)
 }
 
+func (m *MockOrderService) GetReadyByCategory(ctx context.Context, category string) ([]models.Order, error) {
+	args := m.Called(ctx, category)
+	if args.Get(0) != nil {
+		return args.Get(0).([]models.Order), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockOrderService) GetCompletedByCategory(ctx context.Context, category string) ([]models.Order, error) {
 	args := m.Called(ctx, category)
 	if args.Get(0) != nil {
@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// MockPaymentWebhookService is a mock implementation of PaymentWebhookService
+type MockPaymentWebhookService struct {
+	mock.Mock
+}
+
+func (m *MockPaymentWebhookService) HandleNotification(ctx context.Context, body []byte, signature string) (*models.PaymentMatch, error) {
+	args := m.Called(ctx, body, signature)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentMatch), args.Error(1)
+}
@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// MockPromptPayService is a mock implementation of PromptPayService
+type MockPromptPayService struct {
+	mock.Mock
+}
+
+func (m *MockPromptPayService) GetQR(ctx context.Context, orderID string) (*models.PromptPayQR, error) {
+	args := m.Called(ctx, orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PromptPayQR), args.Error(1)
+}
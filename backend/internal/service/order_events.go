@@ -0,0 +1,218 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// OrderEventType identifies what happened to an order
+type OrderEventType string
+
+const (
+	OrderEventCreated         OrderEventType = "order.created"
+	OrderEventUpdated         OrderEventType = "order.updated"          // items changed before payment
+	OrderEventPaymentReceived OrderEventType = "order.payment_received" // part paid, balance still open
+	OrderEventPaid            OrderEventType = "order.paid"
+	OrderEventReady           OrderEventType = "order.ready"
+	OrderEventCompleted       OrderEventType = "order.completed"
+	OrderEventCancelled       OrderEventType = "order.cancelled"
+	OrderEventExpired         OrderEventType = "order.expired"
+	OrderEventRefunded        OrderEventType = "order.refunded" // in full, or some of its items
+)
+
+// DefaultOrderEventHistory is how many recent events the broker keeps for
+// Last-Event-ID resume. A busy day at the booth is well under this per hour.
+const DefaultOrderEventHistory = 1000
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is disconnected (it can reconnect with Last-Event-ID and catch up)
+const subscriberBuffer = 64
+
+// OrderEvent is a single change to an order, published after it is committed
+type OrderEvent struct {
+	ID        uint64         `json:"id"`
+	Type      OrderEventType `json:"type"`
+	Order     models.Order   `json:"order"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// OrderEventPublisher receives order changes from the services
+type OrderEventPublisher interface {
+	Publish(eventType OrderEventType, order *models.Order)
+}
+
+// OrderEventBroker fans order events out to live subscribers (SSE streams,
+// kitchen displays) and keeps a bounded history so reconnecting clients can
+// resume from the last event they saw.
+//
+// Event IDs are assigned in publish order and only mean something within one
+// server process; after a restart clients are told to resync.
+type OrderEventBroker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []OrderEvent
+	historySize int
+	subscribers map[*OrderEventSubscription]struct{}
+	closed      bool
+}
+
+// OrderEventSubscription is a live feed of events, optionally limited to one category
+type OrderEventSubscription struct {
+	// Events delivers new events. It is closed when the subscriber falls too
+	// far behind, unsubscribes, or the broker shuts down.
+	Events <-chan OrderEvent
+
+	events   chan OrderEvent
+	category string
+	broker   *OrderEventBroker
+}
+
+// NewOrderEventBroker creates a broker that remembers the last historySize events
+func NewOrderEventBroker(historySize int) *OrderEventBroker {
+	if historySize < 1 {
+		historySize = DefaultOrderEventHistory
+	}
+	return &OrderEventBroker{
+		historySize: historySize,
+		history:     make([]OrderEvent, 0, historySize),
+		subscribers: make(map[*OrderEventSubscription]struct{}),
+	}
+}
+
+// Publish records an event for the order and delivers it to matching subscribers
+func (b *OrderEventBroker) Publish(eventType OrderEventType, order *models.Order) {
+	if order == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.lastID++
+	event := OrderEvent{
+		ID:        b.lastID,
+		Type:      eventType,
+		Order:     *order,
+		Timestamp: time.Now().UTC(),
+	}
+
+	if len(b.history) == b.historySize {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:len(b.history)-1]
+	}
+	b.history = append(b.history, event)
+
+	for sub := range b.subscribers {
+		if !sub.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// Never block publishers on a slow client
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. Events after lastEventID that are
+// still in the history are returned for replay; pass 0 for live events only.
+// resync is true when events the client asked for are no longer available
+// (history overflowed or the server restarted) and it should refetch its lists.
+func (b *OrderEventBroker) Subscribe(category string, lastEventID uint64) (sub *OrderEventSubscription, replay []OrderEvent, resync bool) {
+	events := make(chan OrderEvent, subscriberBuffer)
+	sub = &OrderEventSubscription{
+		Events:   events,
+		events:   events,
+		category: category,
+		broker:   b,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastEventID > 0 {
+		switch {
+		case lastEventID > b.lastID:
+			resync = true
+		case len(b.history) > 0 && lastEventID < b.history[0].ID-1:
+			resync = true
+		}
+
+		for _, event := range b.history {
+			if event.ID > lastEventID && sub.matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	if b.closed {
+		close(events)
+		return sub, replay, resync
+	}
+
+	b.subscribers[sub] = struct{}{}
+	return sub, replay, resync
+}
+
+// Close disconnects all subscribers. Used on shutdown so open streams end.
+func (b *OrderEventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.removeLocked(sub)
+	}
+}
+
+// removeLocked drops a subscriber and closes its channel. Caller holds b.mu.
+func (b *OrderEventBroker) removeLocked(sub *OrderEventSubscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+// Unsubscribe stops delivery to this subscriber
+func (s *OrderEventSubscription) Unsubscribe() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.removeLocked(s)
+}
+
+// matches reports whether the event passes the subscriber's category filter,
+// using the same exact match as GetByStatusAndCategory: the order's category
+// or, for a split order, the category of one of its tickets
+func (s *OrderEventSubscription) matches(event OrderEvent) bool {
+	if s.category == "" {
+		return true
+	}
+	if event.Order.Category != nil && *event.Order.Category == s.category {
+		return true
+	}
+	for _, ticket := range event.Order.Tickets {
+		if ticket.Category != nil && *ticket.Category == s.category {
+			return true
+		}
+	}
+	return false
+}
+
+// noOpOrderEventPublisher discards events
+type noOpOrderEventPublisher struct{}
+
+// NewNoOpOrderEventPublisher returns a publisher that discards all events
+func NewNoOpOrderEventPublisher() OrderEventPublisher {
+	return noOpOrderEventPublisher{}
+}
+
+func (noOpOrderEventPublisher) Publish(OrderEventType, *models.Order) {}
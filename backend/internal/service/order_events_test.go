@@ -0,0 +1,110 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestOrderEventBroker_PublishAndSubscribe(t *testing.T) {
+	broker := NewOrderEventBroker(10)
+
+	all, _, _ := broker.Subscribe("", 0)
+	drinks, _, _ := broker.Subscribe("drinks", 0)
+	defer all.Unsubscribe()
+	defer drinks.Unsubscribe()
+
+	broker.Publish(OrderEventCreated, &models.Order{ID: "1401001", Category: strPtr("fries")})
+	broker.Publish(OrderEventCreated, &models.Order{ID: "1401002", Category: strPtr("drinks")})
+	broker.Publish(OrderEventPaid, &models.Order{ID: "1401003"})
+	broker.Publish(OrderEventPaid, &models.Order{ID: "1401004", Tickets: []models.OrderTicket{
+		{ShopID: 1, Category: strPtr("fries")},
+		{ShopID: 2, Category: strPtr("drinks")},
+	}})
+
+	// Unfiltered subscriber sees everything, in order
+	for i, id := range []string{"1401001", "1401002", "1401003", "1401004"} {
+		event := <-all.Events
+		assert.Equal(t, uint64(i+1), event.ID)
+		assert.Equal(t, id, event.Order.ID)
+	}
+
+	// Category subscriber only sees matching orders, including split orders
+	// with a ticket of that category
+	event := <-drinks.Events
+	assert.Equal(t, "1401002", event.Order.ID)
+	event = <-drinks.Events
+	assert.Equal(t, "1401004", event.Order.ID)
+	assert.Len(t, drinks.Events, 0)
+}
+
+func TestOrderEventBroker_Resume(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastEventID uint64
+		wantReplay  []uint64
+		wantResync  bool
+	}{
+		{name: "Live only", lastEventID: 0, wantReplay: nil, wantResync: false},
+		{name: "Caught up", lastEventID: 5, wantReplay: nil, wantResync: false},
+		{name: "Missed recent events", lastEventID: 3, wantReplay: []uint64{4, 5}, wantResync: false},
+		{name: "Oldest retained boundary", lastEventID: 2, wantReplay: []uint64{3, 4, 5}, wantResync: false},
+		{name: "Fell out of history", lastEventID: 1, wantReplay: []uint64{3, 4, 5}, wantResync: true},
+		{name: "ID from before a restart", lastEventID: 42, wantReplay: nil, wantResync: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// History keeps events 3-5
+			broker := NewOrderEventBroker(3)
+			for i := 0; i < 5; i++ {
+				broker.Publish(OrderEventCreated, &models.Order{ID: "1401001"})
+			}
+
+			sub, replay, resync := broker.Subscribe("", tt.lastEventID)
+			defer sub.Unsubscribe()
+
+			var ids []uint64
+			for _, event := range replay {
+				ids = append(ids, event.ID)
+			}
+			assert.Equal(t, tt.wantReplay, ids)
+			assert.Equal(t, tt.wantResync, resync)
+		})
+	}
+}
+
+func TestOrderEventBroker_SlowSubscriberIsDropped(t *testing.T) {
+	broker := NewOrderEventBroker(10)
+	sub, _, _ := broker.Subscribe("", 0)
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		broker.Publish(OrderEventCreated, &models.Order{ID: "1401001"})
+	}
+
+	// Buffered events drain, then the channel is closed
+	count := 0
+	for range sub.Events {
+		count++
+	}
+	assert.Equal(t, subscriberBuffer, count)
+}
+
+func TestOrderEventBroker_Close(t *testing.T) {
+	broker := NewOrderEventBroker(10)
+	sub, _, _ := broker.Subscribe("", 0)
+
+	broker.Close()
+
+	_, ok := <-sub.Events
+	assert.False(t, ok)
+
+	// Publishing after close is ignored, late subscribers get a closed feed
+	broker.Publish(OrderEventCreated, &models.Order{ID: "1401001"})
+	late, _, _ := broker.Subscribe("", 0)
+	_, ok = <-late.Events
+	assert.False(t, ok)
+}
@@ -2,10 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
-	"golang.org/x/sync/errgroup"
+	"github.com/rs/zerolog/log"
 
 	"github.com/tanasatit/barvidva-kasetfair/internal/models"
 	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
@@ -14,34 +17,48 @@ import (
 
 type OrderService interface {
 	CreateOrder(ctx context.Context, req *models.CreateOrderRequest) (*models.Order, error)
+	SyncOrders(ctx context.Context, req *models.SyncOrdersRequest) (*models.SyncOrdersResponse, error)
 	ValidateOrder(ctx context.Context, req *models.CreateOrderRequest) error
 	GetOrder(ctx context.Context, id string) (*models.Order, error)
 	GetPendingPayment(ctx context.Context) ([]models.Order, error)
 	GetPendingPaymentByCategory(ctx context.Context, category string) ([]models.Order, error)
 	GetQueue(ctx context.Context) ([]models.Order, error)
 	GetQueueByCategory(ctx context.Context, category string) ([]models.Order, error)
+	GetReady(ctx context.Context) ([]models.Order, error)
+	GetReadyByCategory(ctx context.Context, category string) ([]models.Order, error)
 	GetCompleted(ctx context.Context) ([]models.Order, error)
 	GetCompletedByCategory(ctx context.Context, category string) ([]models.Order, error)
 	VerifyPayment(ctx context.Context, id string, paymentMethod *models.PaymentMethod) (*models.Order, error)
+	RecordPayment(ctx context.Context, id string, req *models.PaymentRequest) (*models.Order, error)
+	MarkReady(ctx context.Context, id string) (*models.Order, error)
 	CompleteOrder(ctx context.Context, id string) (*models.Order, error)
+	UpdateOrderItems(ctx context.Context, id string, req *models.UpdateOrderItemsRequest) (*models.Order, error)
 	CancelOrder(ctx context.Context, id string) error
+	RefundOrder(ctx context.Context, id string, req *models.RefundRequest) (*models.Order, error)
+	GetOrderHistory(ctx context.Context, id string) ([]models.OrderStatusHistory, error)
 }
 
 type orderService struct {
 	orderRepo repository.OrderRepository
 	menuRepo  repository.MenuRepository
 	cache     utils.Cache
+	clock     *utils.BusinessClock
+	events    OrderEventPublisher
 }
 
 func NewOrderService(
 	orderRepo repository.OrderRepository,
 	menuRepo repository.MenuRepository,
 	cache utils.Cache,
+	clock *utils.BusinessClock,
+	events OrderEventPublisher,
 ) OrderService {
 	return &orderService{
 		orderRepo: orderRepo,
 		menuRepo:  menuRepo,
 		cache:     cache,
+		clock:     clock,
+		events:    events,
 	}
 }
 
@@ -52,23 +69,33 @@ func (s *orderService) CreateOrder(ctx context.Context, req *models.CreateOrderR
 	defer cancel()
 
 	// Validate order (basic validation, ID will be generated server-side)
-	if err := s.ValidateOrder(ctx, req); err != nil {
-		return nil, fmt.Errorf("validation failed: %w", err)
+	menuItems, err := s.validateOrder(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get next sequential order number for this date
-	sequence, err := s.orderRepo.GetNextSequence(ctx, req.DateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get sequence: %w", err)
+	// The server owns the business day. A client date key (set from the
+	// tablet's own clock) is only a hint and is overridden when it disagrees,
+	// e.g. a tablet that already rolled over at midnight while the booth is
+	// still serving the previous business day.
+	order := s.newOrder(req, menuItems, s.clock.Now())
+	if req.DateKey != 0 && req.DateKey != order.DateKey {
+		log.Warn().
+			Int("client_date_key", req.DateKey).
+			Int("server_date_key", order.DateKey).
+			Msg("Overriding client date key with server business day")
 	}
 
-	// Generate order ID server-side (DDMMXXX format with sequential number)
-	dayOfMonth := req.DateKey / 100
-	month := req.DateKey % 100
-	orderID, err := utils.GenerateOrderID(dayOfMonth, month, sequence)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate order ID: %w", err)
+	if err := s.saveOrder(ctx, order); err != nil {
+		return nil, err
 	}
+	return order, nil
+}
+
+// newOrder builds a pending order taken at the given time from a validated
+// request and the menu item of each line
+func (s *orderService) newOrder(req *models.CreateOrderRequest, menuItems []*models.MenuItem, takenAt time.Time) *models.Order {
+	businessDate := s.clock.BusinessDate(takenAt)
 
 	// Calculate total amount (server-side verification)
 	totalAmount := 0.0
@@ -76,95 +103,319 @@ func (s *orderService) CreateOrder(ctx context.Context, req *models.CreateOrderR
 		totalAmount += item.Price * float64(item.Quantity)
 	}
 
-	// Determine category from request or from first item's menu item
+	// Each line is prepared by the shop of its menu item, and each component
+	// of a bundle by the shop of its own. An order from a single shop belongs
+	// to it, with the category from the request or the first item; an order
+	// from several shops is split into one ticket per shop, paid for together.
+	var tickets []models.OrderTicket
+	addToTicket := func(item models.OrderItem, category *string) {
+		if item.ShopID == nil {
+			return
+		}
+		j := slices.IndexFunc(tickets, func(t models.OrderTicket) bool { return t.ShopID == *item.ShopID })
+		if j < 0 {
+			tickets = append(tickets, models.OrderTicket{ShopID: *item.ShopID, Category: category})
+			j = len(tickets) - 1
+		}
+		tickets[j].Items = append(tickets[j].Items, item)
+	}
+	for i := range req.Items {
+		menuItem := menuItems[i]
+		req.Items[i].ShopID = menuItem.ShopID
+		if !menuItem.IsBundle() {
+			addToTicket(req.Items[i], menuItem.Category)
+			continue
+		}
+		for _, component := range req.Items[i].Components {
+			addToTicket(component, menuItem.FindOption(component.MenuItemID).Category)
+		}
+	}
+
 	var category *string
-	if req.Category != "" {
-		category = &req.Category
-	} else if len(req.Items) > 0 {
-		// Get category from first item's menu item
-		menuItem, err := s.menuRepo.GetByID(ctx, req.Items[0].MenuItemID)
-		if err == nil && menuItem.Category != nil {
-			category = menuItem.Category
+	var shopID *int
+	switch len(tickets) {
+	case 0:
+		category = menuItems[0].Category
+		shopID = menuItems[0].ShopID
+	case 1:
+		category = tickets[0].Category
+		shopID = &tickets[0].ShopID
+	}
+	if len(tickets) <= 1 {
+		tickets = nil
+		if req.Category != "" {
+			category = &req.Category
 		}
 	}
 
-	// Create order object with server-generated sequential ID
-	order := &models.Order{
-		ID:           orderID,
+	// The sequential ID is allocated by the repository inside the insert
+	// transaction (DDMMXXX, widening to DDMMXXXX after 999)
+	return &models.Order{
 		CustomerName: req.CustomerName,
 		Items:        req.Items,
 		TotalAmount:  totalAmount,
 		Status:       models.OrderStatusPendingPayment,
-		DateKey:      req.DateKey,
+		DateKey:      utils.GetDateKey(businessDate),
+		BusinessDate: businessDate,
 		Category:     category,
-		CreatedAt:    time.Now().UTC(),
+		ShopID:       shopID,
+		CreatedAt:    takenAt.UTC(),
+		Tickets:      tickets,
 	}
+}
 
-	// Use errgroup for concurrent operations
-	g, gCtx := errgroup.WithContext(ctx)
+// saveOrder checks the caller may take the order, then stores and announces it
+func (s *orderService) saveOrder(ctx context.Context, order *models.Order) error {
+	// Staff taking orders at the counter can only do so for their own shops
+	// (for a split order, at least one of them)
+	if !ShopScopeFromContext(ctx).ContainsOrder(order) {
+		return fmt.Errorf("%w: cannot take orders for another shop", ErrForbidden)
+	}
 
 	// Save to database
-	g.Go(func() error {
-		return s.orderRepo.Create(gCtx, order)
-	})
+	if err := s.orderRepo.Create(ctx, order); err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
 
 	// Cache order for quick retrieval
-	g.Go(func() error {
-		return s.cache.SetOrder(gCtx, order)
-	})
-
-	if err := g.Wait(); err != nil {
-		return nil, fmt.Errorf("failed to create order: %w", err)
+	if err := s.cache.SetOrder(ctx, order); err != nil {
+		return fmt.Errorf("failed to cache order: %w", err)
 	}
 
-	return order, nil
+	s.events.Publish(OrderEventCreated, order)
+
+	return nil
 }
 
-// ValidateOrder validates the order request
+// ValidateOrder validates the order request. Invalid fields are collected in
+// a *ValidationError; menu items are only looked up once the request itself
+// is well-formed, and stock is checked once the items are valid. Stock can
+// still run out before the order is created, which checks it again.
 func (s *orderService) ValidateOrder(ctx context.Context, req *models.CreateOrderRequest) error {
-	// Validate customer name
-	if len(req.CustomerName) < 2 || len(req.CustomerName) > 50 {
-		return fmt.Errorf("customer name must be 2-50 characters")
+	if _, err := s.validateOrder(ctx, req); err != nil {
+		return err
 	}
 
-	// Validate date key (DDMM format: 101-3112)
-	if req.DateKey < 101 || req.DateKey > 3112 {
-		return fmt.Errorf("date_key must be in DDMM format (101-3112)")
-	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	// Note: Order ID is generated server-side, no need to validate client ID
+	// Validating filled in the components of bundle lines, which use stock too
+	if err := s.orderRepo.CheckStock(ctx, req.Items); err != nil {
+		var stockErr *models.StockError
+		if errors.As(err, &stockErr) {
+			return err
+		}
+		return fmt.Errorf("failed to check stock: %w", err)
+	}
+	return nil
+}
 
-	// Validate items
-	if len(req.Items) == 0 {
-		return fmt.Errorf("order must contain at least one item")
+// validateOrder validates the request and returns the menu item of each line
+func (s *orderService) validateOrder(ctx context.Context, req *models.CreateOrderRequest) ([]*models.MenuItem, error) {
+	// Report malformed requests before looking anything up
+	if verr := validateOrderRequest(req); verr.HasErrors() {
+		return nil, verr
 	}
 
+	return s.validateItems(ctx, req.Items)
+}
+
+// validateItems checks that the menu item of each line exists, is available
+// and has the price charged, and that its modifiers and bundle choices can
+// be picked, and returns them
+func (s *orderService) validateItems(ctx context.Context, items []models.OrderItem) ([]*models.MenuItem, error) {
+	verr := &ValidationError{}
+
 	// Validate each item exists and is available
-	for i, item := range req.Items {
-		// Check quantity
-		if item.Quantity < 1 || item.Quantity > 100 {
-			return fmt.Errorf("item %d: quantity must be 1-100", i)
-		}
+	menuItems := make([]*models.MenuItem, len(items))
+	for i, item := range items {
+		field := fmt.Sprintf("items[%d]", i)
 
 		// Verify menu item exists and is available
 		menuItem, err := s.menuRepo.GetByID(ctx, item.MenuItemID)
 		if err != nil {
-			return fmt.Errorf("item %d: menu item not found", i)
+			if errors.Is(err, ErrMenuItemNotFound) {
+				verr.Add(field+".menu_item_id", fmt.Sprintf("item %d: menu item not found", i))
+				continue
+			}
+			return nil, fmt.Errorf("failed to get menu item: %w", err)
 		}
+		menuItems[i] = menuItem
 
 		if !menuItem.Available {
-			return fmt.Errorf("item %d: menu item not available", i)
+			verr.Add(field+".menu_item_id", fmt.Sprintf("item %d: menu item not available", i))
 		}
 
-		// Verify price matches (prevent client-side price manipulation)
-		if item.Price != menuItem.Price {
-			return fmt.Errorf("item %d: price mismatch", i)
+		if err := pickModifiers(menuItem, &items[i]); err != nil {
+			verr.Add(field+".modifiers", fmt.Sprintf("item %d: %v", i, err))
+			continue
+		}
+		upcharge, err := pickComponents(menuItem, &items[i])
+		if err != nil {
+			verr.Add(field+".choices", fmt.Sprintf("item %d: %v", i, err))
+			continue
+		}
+
+		// Verify price matches (prevent client-side price manipulation).
+		// The line's price includes its modifiers and bundle options at
+		// their current prices.
+		if models.ToCents(item.Price) != models.ToCents(linePrice(menuItem, items[i], upcharge)) {
+			verr.Add(field+".price", fmt.Sprintf("item %d: price mismatch", i))
 		}
 	}
 
+	if verr.HasErrors() {
+		return nil, verr
+	}
+	return menuItems, nil
+}
+
+// pickModifiers checks the modifiers picked on an order line against the
+// item's modifier groups and fills in their group, name and current price
+func pickModifiers(menuItem *models.MenuItem, item *models.OrderItem) error {
+	picked := make(map[int]int) // modifiers picked per group
+	seen := make(map[int]bool)
+	for j := range item.Modifiers {
+		choice := &item.Modifiers[j]
+		group, modifier := menuItem.FindModifier(choice.ModifierID)
+		switch {
+		case modifier == nil:
+			return fmt.Errorf("modifier %d is not offered with %s", choice.ModifierID, menuItem.Name)
+		case !modifier.Available:
+			return fmt.Errorf("%s is not available", modifier.Name)
+		case seen[modifier.ID]:
+			return fmt.Errorf("%s is picked twice", modifier.Name)
+		}
+		seen[modifier.ID] = true
+		picked[group.ID]++
+
+		choice.Group = group.Name
+		choice.Name = modifier.Name
+		choice.PriceDelta = modifier.PriceDelta
+	}
+
+	for _, group := range menuItem.ModifierGroups {
+		switch n := picked[group.ID]; {
+		case n < group.MinSelect && group.MinSelect == 1:
+			return fmt.Errorf("%s must be chosen", group.Name)
+		case n < group.MinSelect:
+			return fmt.Errorf("at least %d of %s must be chosen", group.MinSelect, group.Name)
+		case n > group.MaxSelect:
+			return fmt.Errorf("at most %d of %s can be chosen", group.MaxSelect, group.Name)
+		}
+	}
 	return nil
 }
 
+// pickComponents fills in the component lines of a bundle line from the
+// choices made for its slots and returns what the options chosen add to the
+// bundle price. A slot with one option needs no choice, and a line without
+// choices (such as one sent back from a saved order) keeps the components
+// it has. Lines of other items have no components.
+func pickComponents(menuItem *models.MenuItem, item *models.OrderItem) (float64, error) {
+	if !menuItem.IsBundle() {
+		item.Choices, item.Components = nil, nil
+		return 0, nil
+	}
+
+	chosen := make(map[int]int) // menu item chosen per slot
+	for _, choice := range item.Choices {
+		if !slices.ContainsFunc(menuItem.BundleSlots, func(slot models.BundleSlot) bool { return slot.ID == choice.SlotID }) {
+			return 0, fmt.Errorf("slot %d is not part of %s", choice.SlotID, menuItem.Name)
+		}
+		if _, ok := chosen[choice.SlotID]; ok {
+			return 0, fmt.Errorf("slot %d is chosen twice", choice.SlotID)
+		}
+		chosen[choice.SlotID] = choice.MenuItemID
+	}
+	kept := slices.Clone(item.Components)
+
+	var upcharge int64
+	components := make([]models.OrderItem, 0, len(menuItem.BundleSlots))
+	for _, slot := range menuItem.BundleSlots {
+		menuItemID, ok := chosen[slot.ID]
+		if !ok && len(slot.Options) == 1 {
+			menuItemID, ok = slot.Options[0].MenuItemID, true
+		}
+		if !ok {
+			for j, component := range kept {
+				if slices.ContainsFunc(slot.Options, func(o models.BundleOption) bool { return o.MenuItemID == component.MenuItemID }) {
+					menuItemID, ok = component.MenuItemID, true
+					kept = slices.Delete(kept, j, j+1)
+					break
+				}
+			}
+		}
+		if !ok {
+			return 0, fmt.Errorf("%s must be chosen", slot.Name)
+		}
+
+		i := slices.IndexFunc(slot.Options, func(o models.BundleOption) bool { return o.MenuItemID == menuItemID })
+		if i < 0 {
+			return 0, fmt.Errorf("menu item %d is not an option for %s", menuItemID, slot.Name)
+		}
+		option := slot.Options[i]
+		if !option.Available {
+			return 0, fmt.Errorf("%s is not available", option.Name)
+		}
+		if item.Quantity*slot.Quantity > 100 {
+			return 0, fmt.Errorf("at most %d of %s fit in one line", 100/slot.Quantity, menuItem.Name)
+		}
+
+		upcharge += models.ToCents(option.PriceDelta)
+		components = append(components, models.OrderItem{
+			MenuItemID: option.MenuItemID,
+			Name:       option.Name,
+			Quantity:   item.Quantity * slot.Quantity,
+			ShopID:     option.ShopID,
+		})
+	}
+	item.Components = components
+	return float64(upcharge) / 100, nil
+}
+
+// linePrice is the unit price of an order line with its modifiers and the
+// upcharge of the bundle options chosen
+func linePrice(menuItem *models.MenuItem, item models.OrderItem, upcharge float64) float64 {
+	return float64(models.ToCents(menuItem.PriceWith(item.Modifiers))+models.ToCents(upcharge)) / 100
+}
+
+// validateOrderRequest checks the fields of an order request that need no
+// lookups
+func validateOrderRequest(req *models.CreateOrderRequest) *ValidationError {
+	verr := &ValidationError{}
+
+	// Validate customer name
+	if len(req.CustomerName) < 2 || len(req.CustomerName) > 50 {
+		verr.Add("customer_name", "customer name must be 2-50 characters")
+	}
+
+	// Validate date key if the client sent one (DDMM format: 101-3112).
+	// It is optional: the business day is determined server-side.
+	if req.DateKey != 0 && (req.DateKey < 101 || req.DateKey > 3112) {
+		verr.Add("date_key", "date_key must be in DDMM format (101-3112)")
+	}
+
+	// Note: Order ID is generated server-side, no need to validate client ID
+
+	validateOrderItems(req.Items, verr)
+
+	return verr
+}
+
+// validateOrderItems checks the number of lines and their quantities
+func validateOrderItems(items []models.OrderItem, verr *ValidationError) {
+	if len(items) == 0 {
+		verr.Add("items", "order must contain at least one item")
+	}
+
+	for i, item := range items {
+		if item.Quantity < 1 || item.Quantity > 100 {
+			verr.Add(fmt.Sprintf("items[%d].quantity", i), fmt.Sprintf("item %d: quantity must be 1-100", i))
+		}
+	}
+}
+
 // GetOrder retrieves an order by ID
 func (s *orderService) GetOrder(ctx context.Context, id string) (*models.Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -188,10 +439,11 @@ func (s *orderService) GetPendingPayment(ctx context.Context) ([]models.Order, e
 		return nil, fmt.Errorf("failed to get pending payment orders: %w", err)
 	}
 
-	return orders, nil
+	return ShopScopeFromContext(ctx).FilterOrders(orders), nil
 }
 
-// GetQueue retrieves all orders in the active queue (paid but not completed)
+// GetQueue retrieves all orders being prepared (paid but not yet ready).
+// Orders split into tickets are listed once per ticket.
 func (s *orderService) GetQueue(ctx context.Context) ([]models.Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -201,7 +453,20 @@ func (s *orderService) GetQueue(ctx context.Context) ([]models.Order, error) {
 		return nil, fmt.Errorf("failed to get queue: %w", err)
 	}
 
-	return orders, nil
+	return ShopScopeFromContext(ctx).FilterTickets(orders, models.OrderStatusPaid, ""), nil
+}
+
+// GetReady retrieves all orders waiting for pickup, split orders once per ticket
+func (s *orderService) GetReady(ctx context.Context) ([]models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	orders, err := s.orderRepo.GetByStatus(ctx, models.OrderStatusReady)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ready orders: %w", err)
+	}
+
+	return ShopScopeFromContext(ctx).FilterTickets(orders, models.OrderStatusReady, ""), nil
 }
 
 // GetCompleted retrieves all completed orders (today only for performance)
@@ -214,97 +479,495 @@ func (s *orderService) GetCompleted(ctx context.Context) ([]models.Order, error)
 		return nil, fmt.Errorf("failed to get completed orders: %w", err)
 	}
 
-	return orders, nil
+	return ShopScopeFromContext(ctx).FilterTickets(orders, models.OrderStatusCompleted, ""), nil
 }
 
-// VerifyPayment marks an order as paid and assigns a queue number
+// VerifyPayment records a payment of the order's outstanding balance, which
+// marks it as paid and assigns a queue number
 func (s *orderService) VerifyPayment(ctx context.Context, id string, paymentMethod *models.PaymentMethod) (*models.Order, error) {
+	return s.RecordPayment(ctx, id, &models.PaymentRequest{Method: paymentMethod})
+}
+
+// RecordPayment adds a payment to an unpaid order's ledger. Once the
+// payments cover the total, the order is marked as paid and gets a queue
+// number; the payment, queue allocation and status change happen in one
+// repository transaction. Amount defaults to the outstanding balance and may
+// not exceed it; cash handed over beyond the amount is given back as change.
+func (s *orderService) RecordPayment(ctx context.Context, id string, req *models.PaymentRequest) (*models.Order, error) {
+	if verr := validatePaymentRequest(req); verr.HasErrors() {
+		return nil, verr
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	// Get the order to find its day
-	order, err := s.orderRepo.GetByID(ctx, id)
+	payment := &models.Payment{Method: req.Method}
+	if req.Reference != "" {
+		payment.Reference = &req.Reference
+	}
+	if req.VerifiedBy != "" {
+		payment.VerifiedBy = &req.VerifiedBy
+	}
+
+	scope := ShopScopeFromContext(ctx)
+	order, err := s.orderRepo.TransitionStatus(ctx, id, repository.StatusChange{
+		To: models.OrderStatusPaid,
+		Check: func(current *models.Order) error {
+			if err := checkTransition(scope, current, models.OrderStatusPaid); err != nil {
+				return err
+			}
+			return settlePayment(current, req, payment)
+		},
+		Payment: payment,
+		Actor:   ActorFromContext(ctx),
+		Reason:  "payment verified",
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order: %w", err)
+		return nil, fmt.Errorf("failed to verify payment: %w", err)
 	}
 
-	// Check if order is in pending payment status
-	if order.Status != models.OrderStatusPendingPayment {
-		return nil, fmt.Errorf("order is not in pending payment status")
+	if order.Status == models.OrderStatusPaid {
+		s.events.Publish(OrderEventPaid, order)
+	} else {
+		s.events.Publish(OrderEventPaymentReceived, order)
 	}
 
-	// Get next queue number for the date
-	queueNumber, err := s.orderRepo.GetNextQueueNumber(ctx, order.DateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get queue number: %w", err)
+	return order, nil
+}
+
+// validatePaymentRequest checks the fields of a payment that don't depend on
+// the order
+func validatePaymentRequest(req *models.PaymentRequest) *ValidationError {
+	verr := &ValidationError{}
+
+	if pm := req.Method; pm != nil && *pm != models.PaymentMethodPromptPay && *pm != models.PaymentMethodCash {
+		verr.Add("payment_method", "payment method must be PROMPTPAY or CASH")
+	}
+	if req.Amount < 0 {
+		verr.Add("amount", "amount cannot be negative")
+	}
+	if req.Received < 0 {
+		verr.Add("received", "received cannot be negative")
+	}
+	if len(req.Reference) > 100 {
+		verr.Add("reference", "reference must be at most 100 characters")
 	}
 
-	// Verify payment and assign queue number
-	if err := s.orderRepo.VerifyPayment(ctx, id, queueNumber, paymentMethod); err != nil {
-		return nil, fmt.Errorf("failed to verify payment: %w", err)
+	return verr
+}
+
+// settlePayment fills in the amounts of a payment towards the locked order:
+// the amount (the balance unless given), what was received and the change
+func settlePayment(order *models.Order, req *models.PaymentRequest, payment *models.Payment) error {
+	balance := models.ToCents(order.Balance())
+	amount := models.ToCents(req.Amount)
+	if amount == 0 {
+		amount = balance
+	}
+	if amount <= 0 {
+		return NewValidationError("amount", fmt.Sprintf("order %s has nothing left to pay", order.ID))
+	}
+	if amount > balance {
+		return NewValidationError("amount", fmt.Sprintf("amount exceeds the outstanding balance of %.2f", float64(balance)/100))
 	}
 
-	// Get updated order
-	updatedOrder, err := s.orderRepo.GetByID(ctx, id)
+	received := models.ToCents(req.Received)
+	if received == 0 {
+		received = amount
+	}
+	if received < amount {
+		return NewValidationError("received", "received must cover the amount")
+	}
+	isCash := req.Method != nil && *req.Method == models.PaymentMethodCash
+	if received > amount && !isCash {
+		return NewValidationError("received", "change can only be given for cash payments")
+	}
+
+	payment.Amount = float64(amount) / 100
+	payment.Received = float64(received) / 100
+	payment.Change = float64(received-amount) / 100
+	return nil
+}
+
+// MarkReady marks a paid order as ready for pickup
+func (s *orderService) MarkReady(ctx context.Context, id string) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	order, err := s.transition(ctx, id, models.OrderStatusReady, "ready for pickup")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get updated order: %w", err)
+		return nil, fmt.Errorf("failed to mark order ready: %w", err)
 	}
 
-	return updatedOrder, nil
+	s.events.Publish(OrderEventReady, order)
+
+	return order, nil
 }
 
-// CompleteOrder marks an order as completed
+// CompleteOrder marks a paid or ready order as completed
 func (s *orderService) CompleteOrder(ctx context.Context, id string) (*models.Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	// Check if order exists and is in paid status
-	order, err := s.orderRepo.GetByID(ctx, id)
+	order, err := s.transition(ctx, id, models.OrderStatusCompleted, "picked up")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order: %w", err)
+		return nil, fmt.Errorf("failed to complete order: %w", err)
 	}
 
-	if order.Status != models.OrderStatusPaid {
-		return nil, fmt.Errorf("order is not in paid status")
+	s.events.Publish(OrderEventCompleted, order)
+
+	return order, nil
+}
+
+// UpdateOrderItems replaces the items of an unpaid order, e.g. to add a
+// drink the customer asked for after ordering, keeping its code. The items
+// get the same checks as a new order and the total is recalculated; an
+// order that now spans several shops is split into tickets (or no longer
+// is). Part payments already made must still be covered by the new total.
+// The change is recorded in the order history.
+func (s *orderService) UpdateOrderItems(ctx context.Context, id string, req *models.UpdateOrderItemsRequest) (*models.Order, error) {
+	verr := &ValidationError{}
+	validateOrderItems(req.Items, verr)
+	if verr.HasErrors() {
+		return nil, verr
 	}
 
-	// Complete the order
-	if err := s.orderRepo.CompleteOrder(ctx, id); err != nil {
-		return nil, fmt.Errorf("failed to complete order: %w", err)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	menuItems, err := s.validateItems(ctx, req.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	edited := s.newOrder(&models.CreateOrderRequest{Items: req.Items}, menuItems, s.clock.Now())
+	scope := ShopScopeFromContext(ctx)
+	if !scope.ContainsOrder(edited) {
+		return nil, fmt.Errorf("%w: cannot take orders for another shop", ErrForbidden)
 	}
 
-	// Get updated order
-	updatedOrder, err := s.orderRepo.GetByID(ctx, id)
+	order, err := s.orderRepo.UpdateItems(ctx, id, repository.ItemsEdit{
+		Check: func(current *models.Order) error {
+			if !scope.ContainsOrder(current) {
+				return fmt.Errorf("%w: %s", ErrOrderNotFound, current.ID)
+			}
+			if current.Status != models.OrderStatusPendingPayment {
+				return fmt.Errorf("%w: order %s is %s, only unpaid orders can be changed", ErrInvalidTransition, current.ID, current.Status)
+			}
+			if paid := current.AmountPaid(); models.ToCents(edited.TotalAmount) < models.ToCents(paid) {
+				return NewValidationError("items", fmt.Sprintf("order total cannot be less than the %.2f already paid", paid))
+			}
+			// Staying with the same shop keeps the category it was taken under
+			if edited.ShopID != nil && current.ShopID != nil && *edited.ShopID == *current.ShopID {
+				edited.Category = current.Category
+			}
+			return nil
+		},
+		Order: edited,
+		Actor: ActorFromContext(ctx),
+		Describe: func(current *models.Order) string {
+			return "items changed: " + describeItemChanges(current.Items, edited.Items)
+		},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get updated order: %w", err)
+		return nil, fmt.Errorf("failed to update order items: %w", err)
+	}
+
+	if err := s.cache.SetOrder(ctx, order); err != nil {
+		log.Warn().Err(err).Str("order_id", order.ID).Msg("Failed to cache updated order")
+	}
+
+	s.events.Publish(OrderEventUpdated, order)
+
+	return order, nil
+}
+
+// describeItemChanges summarises how the quantity of each menu item
+// changed, e.g. "Coke 0 -> 1, French Fries S 2 -> 1"
+func describeItemChanges(before, after []models.OrderItem) string {
+	type line struct {
+		menuItemID    int
+		name          string
+		before, after int
+	}
+	var lines []*line
+	find := func(item models.OrderItem) *line {
+		for _, l := range lines {
+			if l.menuItemID == item.MenuItemID {
+				return l
+			}
+		}
+		l := &line{menuItemID: item.MenuItemID, name: item.Name}
+		lines = append(lines, l)
+		return l
+	}
+	for _, item := range before {
+		find(item).before += item.Quantity
+	}
+	for _, item := range after {
+		find(item).after += item.Quantity
 	}
 
-	return updatedOrder, nil
+	var changes []string
+	for _, l := range lines {
+		if l.before != l.after {
+			changes = append(changes, fmt.Sprintf("%s %d -> %d", l.name, l.before, l.after))
+		}
+	}
+	if len(changes) == 0 {
+		return "no change"
+	}
+	return strings.Join(changes, ", ")
 }
 
-// CancelOrder marks an order as cancelled
+// CancelOrder marks an unpaid order as cancelled. Orders with part of their
+// total paid cannot be cancelled.
 func (s *orderService) CancelOrder(ctx context.Context, id string) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	// Check if order exists
-	order, err := s.orderRepo.GetByID(ctx, id)
+	order, err := s.transition(ctx, id, models.OrderStatusCancelled, "cancelled by staff")
 	if err != nil {
-		return fmt.Errorf("failed to get order: %w", err)
+		return fmt.Errorf("failed to cancel order: %w", err)
 	}
 
-	// Only allow cancellation of pending payment orders
-	if order.Status != models.OrderStatusPendingPayment {
-		return fmt.Errorf("can only cancel orders with pending payment status")
+	s.events.Publish(OrderEventCancelled, order)
+
+	return nil
+}
+
+// RefundOrder gives back money for a paid or ready order, for the items
+// requested or everything not refunded yet. A partially refunded order keeps
+// its status; it becomes REFUNDED, along with its tickets, once every item
+// is. Refunds never add up to more than was paid. The method defaults to
+// the one the order was mostly paid with.
+func (s *orderService) RefundOrder(ctx context.Context, id string, req *models.RefundRequest) (*models.Order, error) {
+	if verr := validateRefundRequest(req); verr.HasErrors() {
+		return nil, verr
 	}
 
-	if err := s.orderRepo.UpdateStatus(ctx, id, models.OrderStatusCancelled); err != nil {
-		return fmt.Errorf("failed to cancel order: %w", err)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	reason := strings.TrimSpace(req.Reason)
+	refund := &models.Refund{Method: req.Method, Reason: reason}
+
+	scope := ShopScopeFromContext(ctx)
+	order, err := s.orderRepo.TransitionStatus(ctx, id, repository.StatusChange{
+		To: models.OrderStatusRefunded,
+		Check: func(current *models.Order) error {
+			if err := checkTransition(scope, current, models.OrderStatusRefunded); err != nil {
+				return err
+			}
+			return settleRefund(current, req, refund)
+		},
+		Refund: refund,
+		Actor:  ActorFromContext(ctx),
+		Reason: "refunded: " + reason,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund order: %w", err)
+	}
+
+	s.events.Publish(OrderEventRefunded, order)
+
+	return order, nil
+}
+
+// validateRefundRequest checks the fields of a refund that don't depend on
+// the order
+func validateRefundRequest(req *models.RefundRequest) *ValidationError {
+	verr := &ValidationError{}
+
+	if reason := strings.TrimSpace(req.Reason); reason == "" || len(reason) > 200 {
+		verr.Add("reason", "reason must be 1-200 characters")
+	}
+	if pm := req.Method; pm != nil && *pm != models.PaymentMethodPromptPay && *pm != models.PaymentMethodCash {
+		verr.Add("payment_method", "payment method must be PROMPTPAY or CASH")
+	}
+	seen := make(map[int]bool)
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		switch {
+		case item.OrderItemID <= 0:
+			verr.Add(field, "order_item_id is required")
+		case seen[item.OrderItemID]:
+			verr.Add(field, fmt.Sprintf("order item %d is listed twice", item.OrderItemID))
+		case item.Quantity < 0:
+			verr.Add(field, "quantity cannot be negative")
+		}
+		seen[item.OrderItemID] = true
 	}
 
+	return verr
+}
+
+// settleRefund fills in the items and amount of a refund of the locked
+// order. Each item is refunded at the price it was sold for; the refund
+// that leaves nothing unrefunded gives back whatever remains of what was
+// paid, so the refunds always add up to the payments.
+func settleRefund(order *models.Order, req *models.RefundRequest, refund *models.Refund) error {
+	requested := req.Items
+	if len(requested) == 0 {
+		for _, item := range order.Items {
+			requested = append(requested, models.RefundItemRequest{OrderItemID: item.ID})
+		}
+	}
+
+	verr := &ValidationError{}
+	refund.Items = nil
+	var cents int64
+	for i, r := range requested {
+		field := fmt.Sprintf("items[%d]", i)
+		item := findOrderItem(order, r.OrderItemID)
+		if item == nil {
+			verr.Add(field, fmt.Sprintf("order %s has no item %d", order.ID, r.OrderItemID))
+			continue
+		}
+		left := item.Quantity - order.RefundedQuantity(item.ID)
+		quantity := r.Quantity
+		if quantity == 0 {
+			quantity = left
+		}
+		if quantity == 0 && len(req.Items) == 0 {
+			continue // already refunded, nothing to do for a full refund
+		}
+		if quantity == 0 || quantity > left {
+			verr.Add(field, fmt.Sprintf("only %d of %s left to refund", left, item.Name))
+			continue
+		}
+		amount := models.ToCents(item.Price) * int64(quantity)
+		refund.Items = append(refund.Items, models.RefundItem{
+			OrderItemID: item.ID,
+			Quantity:    quantity,
+			Amount:      float64(amount) / 100,
+		})
+		cents += amount
+	}
+	if verr.HasErrors() {
+		return verr
+	}
+
+	remaining := models.ToCents(order.AmountPaid()) - models.ToCents(order.RefundedAmount())
+	after := *order
+	after.Refunds = append(slices.Clone(order.Refunds), *refund)
+	if after.FullyRefunded() || cents > remaining {
+		cents = remaining
+	}
+	if len(refund.Items) == 0 || cents <= 0 {
+		return NewValidationError("items", fmt.Sprintf("order %s has nothing left to refund", order.ID))
+	}
+
+	refund.Amount = float64(cents) / 100
+	if refund.Method == nil {
+		refund.Method = order.MainPaymentMethod()
+	}
 	return nil
 }
 
+// findOrderItem returns the order's item with the given ID, or nil
+func findOrderItem(order *models.Order, orderItemID int) *models.OrderItem {
+	for i := range order.Items {
+		if order.Items[i].ID == orderItemID {
+			return &order.Items[i]
+		}
+	}
+	return nil
+}
+
+// GetOrderHistory retrieves the recorded status transitions of an order
+func (s *orderService) GetOrderHistory(ctx context.Context, id string) ([]models.OrderStatusHistory, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := s.getScopedOrder(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+
+	history, err := s.orderRepo.GetStatusHistory(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+
+	return history, nil
+}
+
+// getScopedOrder loads an order, treating orders of shops outside the
+// caller's scope as not found
+func (s *orderService) getScopedOrder(ctx context.Context, id string) (*models.Order, error) {
+	order, err := s.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ShopScopeFromContext(ctx).ContainsOrder(order) {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
+	}
+	return order, nil
+}
+
+// transition applies a status change checked by the order state machine.
+// The check runs against the locked row inside the repository transaction,
+// so two staff acting on the same order cannot both succeed.
+// For an order split into tickets, READY and COMPLETED apply to the tickets
+// of the caller's shops that can make the move; the order follows once all
+// of its tickets have.
+func (s *orderService) transition(ctx context.Context, id string, to models.OrderStatus, reason string) (*models.Order, error) {
+	scope := ShopScopeFromContext(ctx)
+	return s.orderRepo.TransitionStatus(ctx, id, repository.StatusChange{
+		To: to,
+		Check: func(current *models.Order) error {
+			return checkTransition(scope, current, to)
+		},
+		Tickets: func(current *models.Order) ([]int, error) {
+			return ticketsToMove(scope, current, to)
+		},
+		Actor:  ActorFromContext(ctx),
+		Reason: reason,
+	})
+}
+
+// checkTransition checks a status change against the locked order
+func checkTransition(scope ShopScope, current *models.Order, to models.OrderStatus) error {
+	// Orders of other shops are reported as missing rather than forbidden
+	if !scope.ContainsOrder(current) {
+		return fmt.Errorf("%w: %s", ErrOrderNotFound, current.ID)
+	}
+	if current.HasTickets() && (to == models.OrderStatusReady || to == models.OrderStatusCompleted) {
+		return nil // checked per ticket
+	}
+	// Cancelling would strand what was paid so far; the order has to be paid
+	// off and refunded instead
+	if to == models.OrderStatusCancelled && current.AmountPaid() > 0 {
+		return fmt.Errorf("%w: order %s already has %.2f paid, pay it off and refund it instead", ErrInvalidTransition, current.ID, current.AmountPaid())
+	}
+	return ValidateTransition(current, to)
+}
+
+// ticketsToMove picks the tickets of a split order that the caller's shops
+// move to the given status. Tickets that already moved on are skipped; it is
+// an invalid transition only when none of the caller's tickets can move.
+func ticketsToMove(scope ShopScope, order *models.Order, to models.OrderStatus) ([]int, error) {
+	var shopIDs []int
+	var invalid error
+	for _, ticket := range order.Tickets {
+		if !scope.Contains(&ticket.ShopID) {
+			continue
+		}
+		if !CanTransition(ticket.Status, to) {
+			invalid = &InvalidTransitionError{OrderID: order.ID, From: ticket.Status, To: to}
+			continue
+		}
+		shopIDs = append(shopIDs, ticket.ShopID)
+	}
+	if len(shopIDs) == 0 {
+		if invalid != nil {
+			return nil, invalid
+		}
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, order.ID)
+	}
+	return shopIDs, nil
+}
+
 // GetPendingPaymentByCategory retrieves orders waiting for payment filtered by category
 func (s *orderService) GetPendingPaymentByCategory(ctx context.Context, category string) ([]models.Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -315,7 +978,7 @@ func (s *orderService) GetPendingPaymentByCategory(ctx context.Context, category
 		return nil, fmt.Errorf("failed to get pending payment orders by category: %w", err)
 	}
 
-	return orders, nil
+	return ShopScopeFromContext(ctx).FilterOrders(orders), nil
 }
 
 // GetQueueByCategory retrieves orders in the queue filtered by category
@@ -328,7 +991,20 @@ func (s *orderService) GetQueueByCategory(ctx context.Context, category string)
 		return nil, fmt.Errorf("failed to get queue by category: %w", err)
 	}
 
-	return orders, nil
+	return ShopScopeFromContext(ctx).FilterTickets(orders, models.OrderStatusPaid, category), nil
+}
+
+// GetReadyByCategory retrieves orders waiting for pickup filtered by category
+func (s *orderService) GetReadyByCategory(ctx context.Context, category string) ([]models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	orders, err := s.orderRepo.GetByStatusAndCategory(ctx, models.OrderStatusReady, category)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ready orders by category: %w", err)
+	}
+
+	return ShopScopeFromContext(ctx).FilterTickets(orders, models.OrderStatusReady, category), nil
 }
 
 // GetCompletedByCategory retrieves completed orders filtered by category
@@ -341,5 +1017,5 @@ func (s *orderService) GetCompletedByCategory(ctx context.Context, category stri
 		return nil, fmt.Errorf("failed to get completed orders by category: %w", err)
 	}
 
-	return orders, nil
+	return ShopScopeFromContext(ctx).FilterTickets(orders, models.OrderStatusCompleted, category), nil
 }
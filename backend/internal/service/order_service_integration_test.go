@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+	"github.com/tanasatit/barvidva-kasetfair/internal/testutil"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+)
+
+func TestOrderService_CreateOrder_Concurrent(t *testing.T) {
+	db := testutil.NewPostgres(t)
+
+	now := testNow
+	clock := newTestClock(t, testNow).WithNow(func() time.Time { return now })
+	svc := NewOrderService(repository.NewOrderRepository(db, utils.DefaultOrderIDScheme), repository.NewMenuRepository(db), utils.NewNoOpCache(), clock, NewNoOpOrderEventPublisher())
+
+	const workers = 300
+	ids := make([]string, workers)
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			order, err := svc.CreateOrder(context.Background(), &models.CreateOrderRequest{
+				CustomerName: fmt.Sprintf("Customer %d", i),
+				DateKey:      1401,
+				Items: []models.OrderItem{
+					// Seeded by migration 001
+					{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1},
+				},
+			})
+			errs[i] = err
+			if order != nil {
+				ids[i] = order.ID
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	seen := make(map[string]bool, workers)
+	for i := 0; i < workers; i++ {
+		require.NoError(t, errs[i], "create %d failed", i)
+		assert.False(t, seen[ids[i]], "duplicate order ID %s", ids[i])
+		seen[ids[i]] = true
+	}
+
+	// Sequences must be gap-free: 1401001 .. 1401300
+	for seq := 1; seq <= workers; seq++ {
+		id := fmt.Sprintf("1401%03d", seq)
+		assert.True(t, seen[id], "missing order ID %s", id)
+	}
+
+	// A different day has its own counter
+	now = testNow.Add(24 * time.Hour)
+	order, err := svc.CreateOrder(context.Background(), &models.CreateOrderRequest{
+		CustomerName: "Next Day",
+		DateKey:      1501,
+		Items:        []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1501001", order.ID)
+}
+
+func TestOrderService_VerifyPayment_Concurrent(t *testing.T) {
+	db := testutil.NewPostgres(t)
+
+	svc := NewOrderService(repository.NewOrderRepository(db, utils.DefaultOrderIDScheme), repository.NewMenuRepository(db), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+	const orders = 100
+	ids := make([]string, orders)
+	for i := range ids {
+		order, err := svc.CreateOrder(context.Background(), &models.CreateOrderRequest{
+			CustomerName: fmt.Sprintf("Customer %d", i),
+			DateKey:      1401,
+			Items:        []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1}},
+		})
+		require.NoError(t, err)
+		ids[i] = order.ID
+	}
+
+	// Two cashiers race on every order: exactly one must win each, and
+	// every paid order must get its own queue number
+	cash := models.PaymentMethodCash
+	queueNumbers := make(chan int, orders*2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	wins := make(map[string]int)
+	for _, id := range ids {
+		for cashier := 0; cashier < 2; cashier++ {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				order, err := svc.VerifyPayment(context.Background(), id, &cash)
+				if err != nil {
+					assert.ErrorIs(t, err, ErrInvalidTransition)
+					return
+				}
+				mu.Lock()
+				wins[id]++
+				mu.Unlock()
+				queueNumbers <- *order.QueueNumber
+			}(id)
+		}
+	}
+	wg.Wait()
+	close(queueNumbers)
+
+	for _, id := range ids {
+		assert.Equal(t, 1, wins[id], "order %s paid %d times", id, wins[id])
+	}
+
+	seen := make(map[int]bool, orders)
+	for q := range queueNumbers {
+		assert.False(t, seen[q], "duplicate queue number %d", q)
+		seen[q] = true
+	}
+	assert.Len(t, seen, orders)
+	for q := 1; q <= orders; q++ {
+		assert.True(t, seen[q], "missing queue number %d", q)
+	}
+}
+
+func TestOrderService_SplitOrder_Lifecycle(t *testing.T) {
+	db := testutil.NewPostgres(t)
+	ctx := context.Background()
+
+	// "Fries" is seeded by migrations 001 and 015; add a second shop
+	shopRepo := repository.NewShopRepository(db)
+	menuRepo := repository.NewMenuRepository(db)
+	friesShop, err := shopRepo.GetByCode(ctx, "Fries")
+	require.NoError(t, err)
+	drinksShop := &models.Shop{Code: "Drinks", Name: "Drinks", Active: true}
+	require.NoError(t, shopRepo.Create(ctx, drinksShop))
+	cola := &models.MenuItem{Name: "Cola", Price: 25, Category: &drinksShop.Code, ShopID: &drinksShop.ID, Available: true}
+	require.NoError(t, menuRepo.Create(ctx, cola))
+
+	svc := NewOrderService(repository.NewOrderRepository(db, utils.DefaultOrderIDScheme), menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+	friesCtx := WithShopScope(ctx, OnlyShops(friesShop.ID))
+	drinksCtx := WithShopScope(ctx, OnlyShops(drinksShop.ID))
+
+	order, err := svc.CreateOrder(drinksCtx, &models.CreateOrderRequest{
+		CustomerName: "Somchai",
+		Items: []models.OrderItem{
+			{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1},
+			{MenuItemID: cola.ID, Name: "Cola", Price: 25, Quantity: 2},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, order.Tickets, 2)
+
+	// One payment pays both tickets, each with its own queue number
+	cash := models.PaymentMethodCash
+	order, err = svc.VerifyPayment(drinksCtx, order.ID, &cash)
+	require.NoError(t, err)
+	assert.Nil(t, order.QueueNumber)
+	require.Len(t, order.Tickets, 2)
+	assert.Equal(t, models.OrderStatusPaid, order.Tickets[0].Status)
+	assert.Equal(t, models.OrderStatusPaid, order.Tickets[1].Status)
+	assert.NotEqual(t, *order.Tickets[0].QueueNumber, *order.Tickets[1].QueueNumber)
+
+	// Each shop's queue only has its own ticket
+	queue, err := svc.GetQueue(friesCtx)
+	require.NoError(t, err)
+	require.Len(t, queue, 1)
+	assert.Equal(t, 40.0, queue[0].TotalAmount)
+	queue, err = svc.GetQueue(drinksCtx)
+	require.NoError(t, err)
+	require.Len(t, queue, 1)
+	assert.Equal(t, 50.0, queue[0].TotalAmount)
+
+	// Fries is done first; the order waits for the drinks
+	order, err = svc.CompleteOrder(friesCtx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPaid, order.Status)
+
+	ready, err := svc.GetReady(drinksCtx)
+	require.NoError(t, err)
+	assert.Empty(t, ready)
+
+	order, err = svc.MarkReady(drinksCtx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusReady, order.Status)
+
+	order, err = svc.CompleteOrder(drinksCtx, order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCompleted, order.Status)
+	require.NotNil(t, order.CompletedAt)
+
+	history, err := svc.GetOrderHistory(ctx, order.ID)
+	require.NoError(t, err)
+	var ticketChanges int
+	for _, h := range history {
+		if h.ShopID != nil {
+			ticketChanges++
+		}
+	}
+	assert.Equal(t, 3, ticketChanges)
+}
@@ -3,16 +3,31 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/tanasatit/barvidva-kasetfair/internal/models"
 	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
 	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
 )
 
+// testNow is the fixed "current time" used by service tests: 14 Jan 2026, 12:00 in Bangkok
+var testNow = time.Date(2026, time.January, 14, 12, 0, 0, 0, time.FixedZone("ICT", 7*60*60))
+
+// newTestClock returns a Bangkok business clock (04:00 rollover) pinned to now
+func newTestClock(t *testing.T, now time.Time) *utils.BusinessClock {
+	t.Helper()
+	clock, err := utils.NewBusinessClock("Asia/Bangkok", 4)
+	if err != nil {
+		t.Fatalf("failed to create business clock: %v", err)
+	}
+	return clock.WithNow(func() time.Time { return now })
+}
+
 func TestOrderService_CreateOrder(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -34,8 +49,32 @@ func TestOrderService_CreateOrder(t *testing.T) {
 				menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{
 					ID: 1, Name: "French Fries S", Price: 40, Available: true,
 				}, nil)
-				orderRepo.On("GetNextSequence", mock.Anything, 1401).Return(1, nil)
-				orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).Return(nil)
+				orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).
+					Run(func(args mock.Arguments) {
+						args.Get(1).(*models.Order).ID = "1401001"
+					}).
+					Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "Stale client date_key is replaced by server business day",
+			req: &models.CreateOrderRequest{
+				CustomerName: "John Doe",
+				DateKey:      1301,
+				Items: []models.OrderItem{
+					{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1},
+				},
+			},
+			setupMock: func(orderRepo *mocks.MockOrderRepository, menuRepo *mocks.MockMenuRepository) {
+				menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{
+					ID: 1, Name: "French Fries S", Price: 40, Available: true,
+				}, nil)
+				orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).
+					Run(func(args mock.Arguments) {
+						args.Get(1).(*models.Order).ID = "1401001"
+					}).
+					Return(nil)
 			},
 			wantErr: false,
 		},
@@ -133,7 +172,7 @@ func TestOrderService_CreateOrder(t *testing.T) {
 
 			tt.setupMock(orderRepo, menuRepo)
 
-			svc := NewOrderService(orderRepo, menuRepo, cache)
+			svc := NewOrderService(orderRepo, menuRepo, cache, newTestClock(t, testNow), NewNoOpOrderEventPublisher())
 			order, err := svc.CreateOrder(context.Background(), tt.req)
 
 			if tt.wantErr {
@@ -147,6 +186,9 @@ func TestOrderService_CreateOrder(t *testing.T) {
 				assert.Len(t, order.ID, 7)
 				assert.Equal(t, tt.req.CustomerName, order.CustomerName)
 				assert.Equal(t, models.OrderStatusPendingPayment, order.Status)
+				// Business date comes from the server clock, not the client
+				assert.Equal(t, time.Date(2026, time.January, 14, 0, 0, 0, 0, time.UTC), order.BusinessDate)
+				assert.Equal(t, 1401, order.DateKey)
 			}
 
 			orderRepo.AssertExpectations(t)
@@ -155,6 +197,30 @@ func TestOrderService_CreateOrder(t *testing.T) {
 	}
 }
 
+func TestOrderService_CreateOrder_BeforeRollover(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	menuRepo := new(mocks.MockMenuRepository)
+
+	menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{
+		ID: 1, Name: "French Fries S", Price: 40, Available: true,
+	}, nil)
+	orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).Return(nil)
+
+	// 02:30 on 15 Jan in Bangkok is still the 14 Jan business day
+	now := time.Date(2026, time.January, 15, 2, 30, 0, 0, time.FixedZone("ICT", 7*60*60))
+	svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, now), NewNoOpOrderEventPublisher())
+
+	order, err := svc.CreateOrder(context.Background(), &models.CreateOrderRequest{
+		CustomerName: "Night Owl",
+		Items:        []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1401, order.DateKey)
+	assert.Equal(t, time.Date(2026, time.January, 14, 0, 0, 0, 0, time.UTC), order.BusinessDate)
+	assert.Equal(t, now.UTC(), order.CreatedAt)
+}
+
 func TestOrderService_GetOrder(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -192,7 +258,7 @@ func TestOrderService_GetOrder(t *testing.T) {
 
 			tt.setupMock(orderRepo)
 
-			svc := NewOrderService(orderRepo, menuRepo, cache)
+			svc := NewOrderService(orderRepo, menuRepo, cache, newTestClock(t, testNow), NewNoOpOrderEventPublisher())
 			order, err := svc.GetOrder(context.Background(), tt.orderID)
 
 			if tt.wantErr {
@@ -214,51 +280,38 @@ func TestOrderService_VerifyPayment(t *testing.T) {
 		name      string
 		orderID   string
 		setupMock func(*mocks.MockOrderRepository)
-		wantErr   bool
+		wantErr   error
 		errMsg    string
 	}{
 		{
 			name:    "Successful payment verification",
 			orderID: "1401001",
 			setupMock: func(repo *mocks.MockOrderRepository) {
-				repo.On("GetByID", mock.Anything, "1401001").Return(&models.Order{
-					ID:      "1401001",
-					DateKey: 1401,
-					Status:  models.OrderStatusPendingPayment,
-				}, nil).Once()
-				repo.On("GetNextQueueNumber", mock.Anything, 1401).Return(1, nil)
-				repo.On("VerifyPayment", mock.Anything, "1401001", 1, mock.Anything).Return(nil)
-				queueNum := 1
-				repo.On("GetByID", mock.Anything, "1401001").Return(&models.Order{
+				repo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).Return(&models.Order{
 					ID:          "1401001",
 					DateKey:     1401,
-					Status:      models.OrderStatusPaid,
-					QueueNumber: &queueNum,
+					TotalAmount: 80,
+					Status:      models.OrderStatusPendingPayment,
 				}, nil).Once()
 			},
-			wantErr: false,
 		},
 		{
 			name:    "Order not in pending payment status",
 			orderID: "1401001",
 			setupMock: func(repo *mocks.MockOrderRepository) {
-				repo.On("GetByID", mock.Anything, "1401001").Return(&models.Order{
-					ID:      "1401001",
-					DateKey: 1401,
-					Status:  models.OrderStatusPaid,
-				}, nil)
+				repo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).
+					Return(&models.Order{ID: "1401001", Status: models.OrderStatusPaid}, nil)
 			},
-			wantErr: true,
-			errMsg:  "not in pending payment status",
+			wantErr: ErrInvalidTransition,
+			errMsg:  "cannot change order 1401001 from PAID to PAID",
 		},
 		{
 			name:    "Order not found",
 			orderID: "9999999",
 			setupMock: func(repo *mocks.MockOrderRepository) {
-				repo.On("GetByID", mock.Anything, "9999999").Return(nil, errors.New("order not found"))
+				repo.On("TransitionStatus", mock.Anything, "9999999", models.OrderStatusPaid).Return(nil, errors.New("order not found: 9999999"))
 			},
-			wantErr: true,
-			errMsg:  "order not found",
+			errMsg: "order not found",
 		},
 	}
 
@@ -270,81 +323,268 @@ func TestOrderService_VerifyPayment(t *testing.T) {
 
 			tt.setupMock(orderRepo)
 
-			svc := NewOrderService(orderRepo, menuRepo, cache)
-			order, err := svc.VerifyPayment(context.Background(), tt.orderID, nil)
+			svc := NewOrderService(orderRepo, menuRepo, cache, newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			cash := models.PaymentMethodCash
+			order, err := svc.VerifyPayment(context.Background(), tt.orderID, &cash)
 
-			if tt.wantErr {
+			if tt.errMsg != "" {
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), tt.errMsg)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
 			} else {
 				assert.NoError(t, err)
 				assert.NotNil(t, order)
 				assert.Equal(t, models.OrderStatusPaid, order.Status)
-				assert.NotNil(t, order.QueueNumber)
+				require.NotNil(t, orderRepo.StatusChanges[0].Payment)
+				assert.Equal(t, models.PaymentMethodCash, *orderRepo.StatusChanges[0].Payment.Method)
 			}
 
 			orderRepo.AssertExpectations(t)
 		})
 	}
 }
+func TestOrderService_RecordPayment(t *testing.T) {
+	cash, promptPay := models.PaymentMethodCash, models.PaymentMethodPromptPay
+	pending := func(payments ...models.Payment) *models.Order {
+		return &models.Order{
+			ID:          "1401001",
+			TotalAmount: 80,
+			Status:      models.OrderStatusPendingPayment,
+			Payments:    payments,
+		}
+	}
 
-func TestOrderService_CompleteOrder(t *testing.T) {
 	tests := []struct {
-		name      string
-		orderID   string
-		setupMock func(*mocks.MockOrderRepository)
-		wantErr   bool
-		errMsg    string
+		name       string
+		current    *models.Order
+		req        models.PaymentRequest
+		wantAmount float64
+		wantChange float64
+		errMsg     string
 	}{
 		{
-			name:    "Successful order completion",
-			orderID: "1401001",
-			setupMock: func(repo *mocks.MockOrderRepository) {
-				queueNum := 1
-				repo.On("GetByID", mock.Anything, "1401001").Return(&models.Order{
-					ID:          "1401001",
-					Status:      models.OrderStatusPaid,
-					QueueNumber: &queueNum,
-				}, nil).Once()
-				repo.On("CompleteOrder", mock.Anything, "1401001").Return(nil)
-				completedAt := time.Now()
-				repo.On("GetByID", mock.Anything, "1401001").Return(&models.Order{
-					ID:          "1401001",
-					Status:      models.OrderStatusCompleted,
-					QueueNumber: &queueNum,
-					CompletedAt: &completedAt,
-				}, nil).Once()
-			},
-			wantErr: false,
+			name:       "Partial payment",
+			current:    pending(),
+			req:        models.PaymentRequest{Method: &promptPay, Amount: 30, Reference: "TX123"},
+			wantAmount: 30,
 		},
 		{
-			name:    "Order not in paid status",
-			orderID: "1401001",
-			setupMock: func(repo *mocks.MockOrderRepository) {
-				repo.On("GetByID", mock.Anything, "1401001").Return(&models.Order{
-					ID:     "1401001",
-					Status: models.OrderStatusPendingPayment,
-				}, nil)
+			name:       "Final payment with change pays off the balance",
+			current:    pending(models.Payment{Amount: 30, Method: &promptPay, Received: 30}),
+			req:        models.PaymentRequest{Method: &cash, Received: 100},
+			wantAmount: 50,
+			wantChange: 50,
+		},
+		{
+			name:    "Amount over the balance",
+			current: pending(models.Payment{Amount: 30, Method: &cash, Received: 30}),
+			req:     models.PaymentRequest{Method: &cash, Amount: 60},
+			errMsg:  "amount exceeds the outstanding balance of 50.00",
+		},
+		{
+			name:    "Received below the amount",
+			current: pending(),
+			req:     models.PaymentRequest{Method: &cash, Amount: 80, Received: 50},
+			errMsg:  "received must cover the amount",
+		},
+		{
+			name:    "No change for PromptPay",
+			current: pending(),
+			req:     models.PaymentRequest{Method: &promptPay, Received: 100},
+			errMsg:  "change can only be given for cash payments",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepository)
+			orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).Return(tt.current, nil)
+
+			svc := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			order, err := svc.RecordPayment(context.Background(), "1401001", &tt.req)
+
+			if tt.errMsg != "" {
+				assert.ErrorIs(t, err, ErrValidation)
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, order)
+
+			// Whether the payment covers the total is up to the repository
+			payment := orderRepo.StatusChanges[0].Payment
+			require.NotNil(t, payment)
+			assert.Equal(t, tt.wantAmount, payment.Amount)
+			assert.Equal(t, tt.wantChange, payment.Change)
+			assert.Equal(t, payment.Amount+payment.Change, payment.Received)
+			assert.Equal(t, *tt.req.Method, *payment.Method)
+		})
+	}
+
+	t.Run("Invalid request never reaches the repository", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		svc := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+		card := models.PaymentMethod("CARD")
+		_, err := svc.RecordPayment(context.Background(), "1401001", &models.PaymentRequest{Method: &card, Amount: -5})
+
+		assert.ErrorIs(t, err, ErrValidation)
+		orderRepo.AssertNotCalled(t, "TransitionStatus", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestOrderService_RefundOrder(t *testing.T) {
+	cash, promptPay := models.PaymentMethodCash, models.PaymentMethodPromptPay
+	// 2 fries at 40 and a coke at 20, paid 70 by PromptPay and 30 in cash
+	paid := func(status models.OrderStatus, refunds ...models.Refund) *models.Order {
+		return &models.Order{
+			ID:          "1401001",
+			TotalAmount: 100,
+			Status:      status,
+			Items: []models.OrderItem{
+				{ID: 1, Name: "French Fries S", Price: 40, Quantity: 2},
+				{ID: 2, Name: "Coke", Price: 20, Quantity: 1},
 			},
-			wantErr: true,
-			errMsg:  "not in paid status",
+			Payments: []models.Payment{
+				{Amount: 70, Method: &promptPay},
+				{Amount: 30, Method: &cash},
+			},
+			Refunds: refunds,
+		}
+	}
+	friesRefunded := models.Refund{Amount: 40, Method: &cash, Items: []models.RefundItem{{OrderItemID: 1, Quantity: 1, Amount: 40}}}
+
+	tests := []struct {
+		name       string
+		current    *models.Order
+		req        models.RefundRequest
+		wantAmount float64
+		wantMethod models.PaymentMethod
+		wantErr    error
+		errMsg     string
+	}{
+		{
+			name:       "Full refund of a paid order",
+			current:    paid(models.OrderStatusPaid),
+			req:        models.RefundRequest{Reason: "customer changed their mind"},
+			wantAmount: 100,
+			wantMethod: models.PaymentMethodPromptPay,
+		},
+		{
+			name:       "Partial refund of a ready order",
+			current:    paid(models.OrderStatusReady),
+			req:        models.RefundRequest{Reason: "out of fries", Method: &cash, Items: []models.RefundItemRequest{{OrderItemID: 1, Quantity: 1}}},
+			wantAmount: 40,
+			wantMethod: models.PaymentMethodCash,
+		},
+		{
+			name:       "Refunding the rest gives back what is left",
+			current:    paid(models.OrderStatusPaid, friesRefunded),
+			req:        models.RefundRequest{Reason: "customer left"},
+			wantAmount: 60,
+			wantMethod: models.PaymentMethodPromptPay,
+		},
+		{
+			name:    "More than is left of an item",
+			current: paid(models.OrderStatusPaid, friesRefunded),
+			req:     models.RefundRequest{Reason: "out of fries", Items: []models.RefundItemRequest{{OrderItemID: 1, Quantity: 2}}},
+			wantErr: ErrValidation,
+			errMsg:  "only 1 of French Fries S left to refund",
+		},
+		{
+			name:    "Unknown item",
+			current: paid(models.OrderStatusPaid),
+			req:     models.RefundRequest{Reason: "out of fries", Items: []models.RefundItemRequest{{OrderItemID: 9}}},
+			wantErr: ErrValidation,
+			errMsg:  "order 1401001 has no item 9",
+		},
+		{
+			name:    "Unpaid order",
+			current: &models.Order{ID: "1401001", Status: models.OrderStatusPendingPayment},
+			req:     models.RefundRequest{Reason: "customer left"},
+			wantErr: ErrInvalidTransition,
+		},
+		{
+			name:    "Picked up order",
+			current: paid(models.OrderStatusCompleted),
+			req:     models.RefundRequest{Reason: "customer left"},
+			wantErr: ErrInvalidTransition,
 		},
 	}
 
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepository)
+			orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusRefunded).Return(tt.current, nil)
+
+			svc := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			order, err := svc.RefundOrder(context.Background(), "1401001", &tt.req)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, order)
+
+			// Whether every item is now refunded is up to the repository
+			refund := orderRepo.StatusChanges[0].Refund
+			require.NotNil(t, refund)
+			assert.Equal(t, tt.wantAmount, refund.Amount)
+			assert.Equal(t, tt.wantMethod, *refund.Method)
+			assert.Equal(t, tt.req.Reason, refund.Reason)
+			assert.Equal(t, "refunded: "+tt.req.Reason, orderRepo.StatusChanges[0].Reason)
+			assert.LessOrEqual(t, tt.current.RefundedAmount()+refund.Amount, tt.current.AmountPaid())
+		})
+	}
+
+	t.Run("Invalid request never reaches the repository", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		svc := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+		_, err := svc.RefundOrder(context.Background(), "1401001", &models.RefundRequest{
+			Reason: "  ",
+			Items:  []models.RefundItemRequest{{OrderItemID: 1}, {OrderItemID: 1}},
+		})
+
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Len(t, verr.Fields, 2)
+		orderRepo.AssertNotCalled(t, "TransitionStatus", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestOrderService_CompleteOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		current models.OrderStatus
+		wantErr bool
+	}{
+		{name: "Complete paid order", current: models.OrderStatusPaid},
+		{name: "Complete ready order", current: models.OrderStatusReady},
+		{name: "Cannot complete unpaid order", current: models.OrderStatusPendingPayment, wantErr: true},
+		{name: "Cannot complete twice", current: models.OrderStatusCompleted, wantErr: true},
+		{name: "Cannot complete cancelled order", current: models.OrderStatusCancelled, wantErr: true},
+	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			orderRepo := new(mocks.MockOrderRepository)
 			menuRepo := new(mocks.MockMenuRepository)
 			cache := utils.NewNoOpCache()
 
-			tt.setupMock(orderRepo)
+			orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusCompleted).
+				Return(&models.Order{ID: "1401001", Status: tt.current}, nil)
 
-			svc := NewOrderService(orderRepo, menuRepo, cache)
-			order, err := svc.CompleteOrder(context.Background(), tt.orderID)
+			svc := NewOrderService(orderRepo, menuRepo, cache, newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			order, err := svc.CompleteOrder(context.Background(), "1401001")
 
 			if tt.wantErr {
-				assert.Error(t, err)
-				assert.Contains(t, err.Error(), tt.errMsg)
+				assert.ErrorIs(t, err, ErrInvalidTransition)
+				assert.Nil(t, order)
 			} else {
 				assert.NoError(t, err)
 				assert.NotNil(t, order)
@@ -356,6 +596,47 @@ func TestOrderService_CompleteOrder(t *testing.T) {
 	}
 }
 
+func TestOrderService_MarkReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		current models.OrderStatus
+		wantErr bool
+	}{
+		{name: "Successful mark ready", current: models.OrderStatusPaid},
+		{name: "Order not paid yet", current: models.OrderStatusPendingPayment, wantErr: true},
+		{name: "Order already ready", current: models.OrderStatusReady, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepository)
+			menuRepo := new(mocks.MockMenuRepository)
+
+			orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusReady).
+				Return(&models.Order{ID: "1401001", Status: tt.current}, nil)
+
+			broker := NewOrderEventBroker(10)
+			sub, _, _ := broker.Subscribe("", 0)
+			defer sub.Unsubscribe()
+
+			svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), broker)
+			order, err := svc.MarkReady(context.Background(), "1401001")
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidTransition)
+				assert.Len(t, sub.Events, 0)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, models.OrderStatusReady, order.Status)
+				event := <-sub.Events
+				assert.Equal(t, OrderEventReady, event.Type)
+			}
+
+			orderRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestOrderService_CancelOrder(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -368,11 +649,10 @@ func TestOrderService_CancelOrder(t *testing.T) {
 			name:    "Successful order cancellation",
 			orderID: "1401001",
 			setupMock: func(repo *mocks.MockOrderRepository) {
-				repo.On("GetByID", mock.Anything, "1401001").Return(&models.Order{
+				repo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusCancelled).Return(&models.Order{
 					ID:     "1401001",
 					Status: models.OrderStatusPendingPayment,
 				}, nil)
-				repo.On("UpdateStatus", mock.Anything, "1401001", models.OrderStatusCancelled).Return(nil)
 			},
 			wantErr: false,
 		},
@@ -380,13 +660,27 @@ func TestOrderService_CancelOrder(t *testing.T) {
 			name:    "Cannot cancel paid order",
 			orderID: "1401001",
 			setupMock: func(repo *mocks.MockOrderRepository) {
-				repo.On("GetByID", mock.Anything, "1401001").Return(&models.Order{
+				repo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusCancelled).Return(&models.Order{
 					ID:     "1401001",
 					Status: models.OrderStatusPaid,
 				}, nil)
 			},
 			wantErr: true,
-			errMsg:  "can only cancel orders with pending payment status",
+			errMsg:  "cannot change order 1401001 from PAID to CANCELLED",
+		},
+		{
+			name:    "Cannot cancel partly paid order",
+			orderID: "1401001",
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusCancelled).Return(&models.Order{
+					ID:          "1401001",
+					Status:      models.OrderStatusPendingPayment,
+					TotalAmount: 40,
+					Payments:    []models.Payment{{Amount: 15}},
+				}, nil)
+			},
+			wantErr: true,
+			errMsg:  "order 1401001 already has 15.00 paid",
 		},
 	}
 
@@ -398,7 +692,7 @@ func TestOrderService_CancelOrder(t *testing.T) {
 
 			tt.setupMock(orderRepo)
 
-			svc := NewOrderService(orderRepo, menuRepo, cache)
+			svc := NewOrderService(orderRepo, menuRepo, cache, newTestClock(t, testNow), NewNoOpOrderEventPublisher())
 			err := svc.CancelOrder(context.Background(), tt.orderID)
 
 			if tt.wantErr {
@@ -413,6 +707,317 @@ func TestOrderService_CancelOrder(t *testing.T) {
 	}
 }
 
+func TestOrderService_UpdateOrderItems(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	fries := "Fries"
+	cash := models.PaymentMethodCash
+	pending := func(payments ...models.Payment) *models.Order {
+		return &models.Order{
+			ID:          "1401001",
+			TotalAmount: 80,
+			Status:      models.OrderStatusPendingPayment,
+			Category:    &fries,
+			ShopID:      &friesShop,
+			Items:       []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 2, ShopID: &friesShop}},
+			Payments:    payments,
+		}
+	}
+	setupMenu := func(menuRepo *mocks.MockMenuRepository) {
+		menuRepo.On("GetByID", mock.Anything, 1).
+			Return(&models.MenuItem{ID: 1, Name: "French Fries S", Price: 40, Available: true, Category: &fries, ShopID: &friesShop}, nil)
+		menuRepo.On("GetByID", mock.Anything, 7).
+			Return(&models.MenuItem{ID: 7, Name: "Cola", Price: 25, Available: true, ShopID: &drinksShop}, nil)
+		menuRepo.On("GetByID", mock.Anything, 8).
+			Return(&models.MenuItem{ID: 8, Name: "Fries L", Price: 60, Available: false, ShopID: &friesShop}, nil)
+	}
+
+	tests := []struct {
+		name        string
+		current     *models.Order
+		items       []models.OrderItem
+		wantTotal   float64
+		wantTickets int
+		wantReason  string
+		wantErr     error
+		errMsg      string
+	}{
+		{
+			name:       "Change a quantity",
+			current:    pending(),
+			items:      []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1}},
+			wantTotal:  40,
+			wantReason: "items changed: French Fries S 2 -> 1",
+		},
+		{
+			name:    "Add a drink from another shop",
+			current: pending(),
+			items: []models.OrderItem{
+				{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 2},
+				{MenuItemID: 7, Name: "Cola", Price: 25, Quantity: 1},
+			},
+			wantTotal:   105,
+			wantTickets: 2,
+			wantReason:  "items changed: Cola 0 -> 1",
+		},
+		{
+			name:       "Replace an item",
+			current:    pending(),
+			items:      []models.OrderItem{{MenuItemID: 7, Name: "Cola", Price: 25, Quantity: 2}},
+			wantTotal:  50,
+			wantReason: "items changed: French Fries S 2 -> 0, Cola 0 -> 2",
+		},
+		{
+			name:    "Same checks as a new order",
+			current: pending(),
+			items: []models.OrderItem{
+				{MenuItemID: 1, Name: "French Fries S", Price: 1, Quantity: 1},
+				{MenuItemID: 8, Name: "Fries L", Price: 60, Quantity: 1},
+			},
+			wantErr: ErrValidation,
+			errMsg:  "item 0: price mismatch",
+		},
+		{
+			name:    "Less than already paid",
+			current: pending(models.Payment{Amount: 60, Method: &cash}),
+			items:   []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1}},
+			wantErr: ErrValidation,
+			errMsg:  "order total cannot be less than the 60.00 already paid",
+		},
+		{
+			name:    "Paid order",
+			current: &models.Order{ID: "1401001", Status: models.OrderStatusPaid},
+			items:   []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 3}},
+			wantErr: ErrInvalidTransition,
+			errMsg:  "only unpaid orders can be changed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepository)
+			menuRepo := new(mocks.MockMenuRepository)
+			setupMenu(menuRepo)
+			orderRepo.On("UpdateItems", mock.Anything, "1401001").Return(tt.current, nil).Maybe()
+
+			svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			order, err := svc.UpdateOrderItems(context.Background(), "1401001", &models.UpdateOrderItemsRequest{Items: tt.items})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "1401001", order.ID)
+			assert.Equal(t, models.OrderStatusPendingPayment, order.Status)
+			assert.Equal(t, tt.wantTotal, order.TotalAmount)
+			assert.Len(t, order.Tickets, tt.wantTickets)
+			assert.Equal(t, tt.wantReason, orderRepo.ItemsEdits[0].Describe(tt.current))
+		})
+	}
+
+	t.Run("Invalid quantities never reach the menu", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		menuRepo := new(mocks.MockMenuRepository)
+		svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+		_, err := svc.UpdateOrderItems(context.Background(), "1401001", &models.UpdateOrderItemsRequest{
+			Items: []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 0}},
+		})
+
+		assert.ErrorIs(t, err, ErrValidation)
+		menuRepo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+		orderRepo.AssertNotCalled(t, "UpdateItems", mock.Anything, mock.Anything)
+	})
+}
+
+func TestOrderService_RecordsActor(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	menuRepo := new(mocks.MockMenuRepository)
+
+	orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).
+		Return(&models.Order{ID: "1401001", TotalAmount: 80, Status: models.OrderStatusPendingPayment}, nil)
+
+	svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+	_, err := svc.VerifyPayment(WithActor(context.Background(), "cashier-1"), "1401001", nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, orderRepo.StatusChanges, 1)
+	assert.Equal(t, "cashier-1", orderRepo.StatusChanges[0].Actor)
+	assert.Equal(t, "payment verified", orderRepo.StatusChanges[0].Reason)
+}
+
+func TestOrderService_ShopScope(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	orderRepo := new(mocks.MockOrderRepository)
+	menuRepo := new(mocks.MockMenuRepository)
+
+	orderRepo.On("GetByStatus", mock.Anything, models.OrderStatusPaid).Return([]models.Order{
+		{ID: "1401001", Status: models.OrderStatusPaid, ShopID: &friesShop},
+		{ID: "1401002", Status: models.OrderStatusPaid, ShopID: &drinksShop},
+		{ID: "1401003", Status: models.OrderStatusPaid},
+	}, nil)
+	orderRepo.On("TransitionStatus", mock.Anything, "1401002", models.OrderStatusReady).
+		Return(&models.Order{ID: "1401002", Status: models.OrderStatusPaid, ShopID: &drinksShop}, nil)
+	orderRepo.On("GetByID", mock.Anything, "1401002").
+		Return(&models.Order{ID: "1401002", Status: models.OrderStatusPaid, ShopID: &drinksShop}, nil)
+	menuRepo.On("GetByID", mock.Anything, 7).
+		Return(&models.MenuItem{ID: 7, Name: "Cola", Price: 25, Available: true, ShopID: &drinksShop}, nil)
+
+	svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+	ctx := WithShopScope(context.Background(), OnlyShops(friesShop))
+
+	queue, err := svc.GetQueue(ctx)
+	assert.NoError(t, err)
+	require.Len(t, queue, 1)
+	assert.Equal(t, "1401001", queue[0].ID)
+
+	// Another shop's order can't be touched or inspected
+	_, err = svc.MarkReady(ctx, "1401002")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+
+	_, err = svc.GetOrderHistory(ctx, "1401002")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+
+	// Nor can orders be taken for it
+	_, err = svc.CreateOrder(ctx, &models.CreateOrderRequest{
+		CustomerName: "Somchai",
+		Items:        []models.OrderItem{{MenuItemID: 7, Name: "Cola", Price: 25, Quantity: 1}},
+	})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Unscoped callers see every order
+	queue, err = svc.GetQueue(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, queue, 3)
+}
+
+func TestOrderService_SplitOrder(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	fries, drinks := "Fries", "Drinks"
+
+	t.Run("Items from several shops become tickets", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		menuRepo := new(mocks.MockMenuRepository)
+		menuRepo.On("GetByID", mock.Anything, 1).
+			Return(&models.MenuItem{ID: 1, Name: "French Fries S", Price: 40, Available: true, Category: &fries, ShopID: &friesShop}, nil)
+		menuRepo.On("GetByID", mock.Anything, 7).
+			Return(&models.MenuItem{ID: 7, Name: "Cola", Price: 25, Available: true, Category: &drinks, ShopID: &drinksShop}, nil)
+		orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).Return(nil)
+
+		svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+		order, err := svc.CreateOrder(context.Background(), &models.CreateOrderRequest{
+			CustomerName: "Somchai",
+			Items: []models.OrderItem{
+				{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 2},
+				{MenuItemID: 7, Name: "Cola", Price: 25, Quantity: 1},
+				{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1},
+			},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, 145.0, order.TotalAmount)
+		assert.Nil(t, order.ShopID)
+		assert.Nil(t, order.Category)
+		require.Len(t, order.Tickets, 2)
+		assert.Equal(t, friesShop, order.Tickets[0].ShopID)
+		assert.Equal(t, &fries, order.Tickets[0].Category)
+		assert.Len(t, order.Tickets[0].Items, 2)
+		assert.Equal(t, drinksShop, order.Tickets[1].ShopID)
+		assert.Len(t, order.Tickets[1].Items, 1)
+		assert.Equal(t, &drinksShop, order.Items[1].ShopID)
+
+		// A cashier of either shop may take the combined order
+		_, err = svc.CreateOrder(WithShopScope(context.Background(), OnlyShops(drinksShop)), &models.CreateOrderRequest{
+			CustomerName: "Somchai",
+			Items: []models.OrderItem{
+				{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 1},
+				{MenuItemID: 7, Name: "Cola", Price: 25, Quantity: 1},
+			},
+		})
+		assert.NoError(t, err)
+	})
+
+	one, two := 1, 2
+	paid := models.Order{
+		ID:     "1401005",
+		Status: models.OrderStatusPaid,
+		Items: []models.OrderItem{
+			{MenuItemID: 1, Price: 40, Quantity: 2, ShopID: &friesShop},
+			{MenuItemID: 7, Price: 25, Quantity: 1, ShopID: &drinksShop},
+		},
+		TotalAmount: 105,
+		Tickets: []models.OrderTicket{
+			{ShopID: friesShop, Category: &fries, Status: models.OrderStatusPaid, QueueNumber: &one,
+				Items: []models.OrderItem{{MenuItemID: 1, Price: 40, Quantity: 2, ShopID: &friesShop}}},
+			{ShopID: drinksShop, Category: &drinks, Status: models.OrderStatusPaid, QueueNumber: &two,
+				Items: []models.OrderItem{{MenuItemID: 7, Price: 25, Quantity: 1, ShopID: &drinksShop}}},
+		},
+	}
+
+	t.Run("Queues show each shop its own ticket", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		orderRepo.On("GetByStatus", mock.Anything, models.OrderStatusPaid).Return([]models.Order{paid}, nil)
+		orderRepo.On("GetByStatusAndCategory", mock.Anything, models.OrderStatusPaid, "Drinks").Return([]models.Order{paid}, nil)
+
+		svc := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+		queue, err := svc.GetQueue(WithShopScope(context.Background(), OnlyShops(drinksShop)))
+		require.NoError(t, err)
+		require.Len(t, queue, 1)
+		assert.Equal(t, "1401005", queue[0].ID)
+		assert.Equal(t, &two, queue[0].QueueNumber)
+		assert.Equal(t, &drinksShop, queue[0].ShopID)
+		assert.Equal(t, 25.0, queue[0].TotalAmount)
+		assert.Len(t, queue[0].Items, 1)
+		assert.Empty(t, queue[0].Tickets)
+
+		// Unscoped callers see one entry per ticket
+		queue, err = svc.GetQueue(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, queue, 2)
+
+		queue, err = svc.GetQueueByCategory(context.Background(), "Drinks")
+		require.NoError(t, err)
+		require.Len(t, queue, 1)
+		assert.Equal(t, &two, queue[0].QueueNumber)
+	})
+
+	t.Run("Each shop marks its own ticket ready", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		orderRepo.On("TransitionStatus", mock.Anything, "1401005", models.OrderStatusReady).Return(&paid, nil)
+
+		svc := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+		_, err := svc.MarkReady(WithShopScope(context.Background(), OnlyShops(friesShop)), "1401005")
+		require.NoError(t, err)
+		shopIDs, err := orderRepo.StatusChanges[0].Tickets(&paid)
+		require.NoError(t, err)
+		assert.Equal(t, []int{friesShop}, shopIDs)
+
+		// The owner's scope covers both tickets
+		_, err = svc.MarkReady(context.Background(), "1401005")
+		require.NoError(t, err)
+		shopIDs, err = orderRepo.StatusChanges[1].Tickets(&paid)
+		require.NoError(t, err)
+		assert.Equal(t, []int{friesShop, drinksShop}, shopIDs)
+	})
+
+	t.Run("Ticket that already moved on", func(t *testing.T) {
+		ready := paid
+		ready.Tickets = []models.OrderTicket{paid.Tickets[0], paid.Tickets[1]}
+		ready.Tickets[0].Status = models.OrderStatusReady
+
+		orderRepo := new(mocks.MockOrderRepository)
+		orderRepo.On("TransitionStatus", mock.Anything, "1401005", models.OrderStatusReady).Return(&ready, nil)
+
+		svc := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+		_, err := svc.MarkReady(WithShopScope(context.Background(), OnlyShops(friesShop)), "1401005")
+		assert.ErrorIs(t, err, ErrInvalidTransition)
+	})
+}
+
 func TestOrderService_GetPendingPayment(t *testing.T) {
 	orderRepo := new(mocks.MockOrderRepository)
 	menuRepo := new(mocks.MockMenuRepository)
@@ -425,7 +1030,7 @@ func TestOrderService_GetPendingPayment(t *testing.T) {
 
 	orderRepo.On("GetByStatus", mock.Anything, models.OrderStatusPendingPayment).Return(expectedOrders, nil)
 
-	svc := NewOrderService(orderRepo, menuRepo, cache)
+	svc := NewOrderService(orderRepo, menuRepo, cache, newTestClock(t, testNow), NewNoOpOrderEventPublisher())
 	orders, err := svc.GetPendingPayment(context.Background())
 
 	assert.NoError(t, err)
@@ -446,10 +1051,292 @@ func TestOrderService_GetQueue(t *testing.T) {
 
 	orderRepo.On("GetByStatus", mock.Anything, models.OrderStatusPaid).Return(expectedOrders, nil)
 
-	svc := NewOrderService(orderRepo, menuRepo, cache)
+	svc := NewOrderService(orderRepo, menuRepo, cache, newTestClock(t, testNow), NewNoOpOrderEventPublisher())
 	orders, err := svc.GetQueue(context.Background())
 
 	assert.NoError(t, err)
 	assert.Len(t, orders, 2)
 	orderRepo.AssertExpectations(t)
 }
+
+func TestOrderService_PublishesEvents(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	menuRepo := new(mocks.MockMenuRepository)
+
+	orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).
+		Return(&models.Order{ID: "1401001", TotalAmount: 80, Status: models.OrderStatusPendingPayment}, nil)
+	orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusCompleted).
+		Return(&models.Order{ID: "1401001", Status: models.OrderStatusPaid}, nil)
+	orderRepo.On("TransitionStatus", mock.Anything, "1401002", models.OrderStatusCancelled).
+		Return(&models.Order{ID: "1401002", Status: models.OrderStatusPendingPayment}, nil)
+	orderRepo.On("TransitionStatus", mock.Anything, "1401003", models.OrderStatusCompleted).
+		Return(&models.Order{ID: "1401003", Status: models.OrderStatusPendingPayment}, nil)
+
+	broker := NewOrderEventBroker(10)
+	sub, _, _ := broker.Subscribe("", 0)
+	defer sub.Unsubscribe()
+
+	svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), broker)
+	_, _ = svc.VerifyPayment(context.Background(), "1401001", nil)
+	_, _ = svc.CompleteOrder(context.Background(), "1401001")
+	_ = svc.CancelOrder(context.Background(), "1401002")
+	// Failed transitions publish nothing
+	_, _ = svc.CompleteOrder(context.Background(), "1401003")
+
+	want := []struct {
+		eventType OrderEventType
+		orderID   string
+		status    models.OrderStatus
+	}{
+		{OrderEventPaid, "1401001", models.OrderStatusPaid},
+		{OrderEventCompleted, "1401001", models.OrderStatusCompleted},
+		{OrderEventCancelled, "1401002", models.OrderStatusCancelled},
+	}
+	for _, w := range want {
+		event := <-sub.Events
+		assert.Equal(t, w.eventType, event.Type)
+		assert.Equal(t, w.orderID, event.Order.ID)
+		assert.Equal(t, w.status, event.Order.Status)
+	}
+	assert.Len(t, sub.Events, 0)
+}
+
+func TestOrderService_ValidateOrder_ReportsFields(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	menuRepo := new(mocks.MockMenuRepository)
+
+	menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{ID: 1, Price: 40, Available: false}, nil)
+	menuRepo.On("GetByID", mock.Anything, 2).Return(nil, fmt.Errorf("%w: 2", ErrMenuItemNotFound))
+
+	svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+	err := svc.ValidateOrder(context.Background(), &models.CreateOrderRequest{
+		CustomerName: "John Doe",
+		Items: []models.OrderItem{
+			{MenuItemID: 1, Price: 50, Quantity: 1},
+			{MenuItemID: 2, Price: 40, Quantity: 1},
+		},
+	})
+
+	assert.ErrorIs(t, err, ErrValidation)
+
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []FieldError{
+		{Field: "items[0].menu_item_id", Message: "item 0: menu item not available"},
+		{Field: "items[0].price", Message: "item 0: price mismatch"},
+		{Field: "items[1].menu_item_id", Message: "item 1: menu item not found"},
+	}, validationErr.Fields)
+}
+
+func TestOrderService_ValidateOrder_Stock(t *testing.T) {
+	friesS := &models.MenuItem{ID: 1, Name: "French Fries S", Price: 40, Available: true}
+	req := &models.CreateOrderRequest{
+		CustomerName: "Somchai",
+		Items:        []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 3}},
+	}
+	stockErr := &models.StockError{
+		ValidationError: NewValidationError("items[0].quantity", "item 0: only 2 of French Fries S left"),
+		Shortages:       []models.StockShortage{{ItemIndex: 0, MenuItemID: 1}},
+	}
+
+	tests := []struct {
+		name     string
+		stockErr error
+		wantErr  error
+	}{
+		{name: "Orders within the stock left are valid"},
+		{name: "Orders for more are refused", stockErr: stockErr, wantErr: ErrValidation},
+		{name: "Stock can't be read", stockErr: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepository)
+			menuRepo := new(mocks.MockMenuRepository)
+			menuRepo.On("GetByID", mock.Anything, 1).Return(friesS, nil)
+			orderRepo.On("CheckStock", mock.Anything, req.Items).Return(tt.stockErr)
+
+			svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			err := svc.ValidateOrder(context.Background(), req)
+
+			switch {
+			case tt.stockErr == nil:
+				assert.NoError(t, err)
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.ErrorContains(t, err, "only 2 of French Fries S left")
+			default:
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrValidation)
+			}
+			orderRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderService_Modifiers(t *testing.T) {
+	latte := &models.MenuItem{ID: 1, Name: "Iced Latte", Price: 55, Available: true, ModifierGroups: []models.ModifierGroup{
+		{ID: 1, Name: "Size", Required: true, MinSelect: 1, MaxSelect: 1, Modifiers: []models.Modifier{
+			{ID: 11, GroupID: 1, Name: "Regular", Available: true},
+			{ID: 12, GroupID: 1, Name: "Large", PriceDelta: 15, Available: true},
+		}},
+		{ID: 2, Name: "Toppings", MaxSelect: 2, Modifiers: []models.Modifier{
+			{ID: 21, GroupID: 2, Name: "Pearls", PriceDelta: 10, Available: true},
+			{ID: 22, GroupID: 2, Name: "Jelly", PriceDelta: 10, Available: true},
+			{ID: 23, GroupID: 2, Name: "Pudding", PriceDelta: 12.5, Available: false},
+		}},
+	}}
+	picks := func(ids ...int) []models.OrderItemModifier {
+		modifiers := make([]models.OrderItemModifier, len(ids))
+		for i, id := range ids {
+			modifiers[i] = models.OrderItemModifier{ModifierID: id}
+		}
+		return modifiers
+	}
+
+	t.Run("Price includes the modifiers picked", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		menuRepo := new(mocks.MockMenuRepository)
+		menuRepo.On("GetByID", mock.Anything, 1).Return(latte, nil)
+		orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).Return(nil)
+
+		svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+		order, err := svc.CreateOrder(context.Background(), &models.CreateOrderRequest{
+			CustomerName: "John Doe",
+			Items: []models.OrderItem{
+				{MenuItemID: 1, Name: "Iced Latte", Price: 80, Quantity: 2, Modifiers: picks(12, 21)},
+				{MenuItemID: 1, Name: "Iced Latte", Price: 55, Quantity: 1, Modifiers: picks(11)},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 215.0, order.TotalAmount)
+
+		// The group, name and price are taken from the menu
+		assert.Equal(t, []models.OrderItemModifier{
+			{ModifierID: 12, Group: "Size", Name: "Large", PriceDelta: 15},
+			{ModifierID: 21, Group: "Toppings", Name: "Pearls", PriceDelta: 10},
+		}, order.Items[0].Modifiers)
+	})
+
+	tests := []struct {
+		name    string
+		price   float64
+		picked  []models.OrderItemModifier
+		field   string
+		message string
+	}{
+		{"Required group left out", 65, picks(21), "items[0].modifiers", "item 0: Size must be chosen"},
+		{"Picked twice", 85, picks(11, 21, 22, 21), "items[0].modifiers", "item 0: Pearls is picked twice"},
+		{"Over the group maximum", 70, picks(11, 12), "items[0].modifiers", "item 0: at most 1 of Size can be chosen"},
+		{"Unavailable modifier", 67.5, picks(11, 23), "items[0].modifiers", "item 0: Pudding is not available"},
+		{"Modifier of another item", 55, picks(11, 99), "items[0].modifiers", "item 0: modifier 99 is not offered with Iced Latte"},
+		{"Price without the modifiers", 55, picks(12), "items[0].price", "item 0: price mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			menuRepo := new(mocks.MockMenuRepository)
+			menuRepo.On("GetByID", mock.Anything, 1).Return(latte, nil)
+
+			svc := NewOrderService(new(mocks.MockOrderRepository), menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			err := svc.ValidateOrder(context.Background(), &models.CreateOrderRequest{
+				CustomerName: "John Doe",
+				Items:        []models.OrderItem{{MenuItemID: 1, Price: tt.price, Quantity: 1, Modifiers: tt.picked}},
+			})
+
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, []FieldError{{Field: tt.field, Message: tt.message}}, validationErr.Fields)
+		})
+	}
+}
+
+func TestOrderService_Bundles(t *testing.T) {
+	friesShop, drinksShop := 1, 2
+	fries, drinks := "Fries", "Drinks"
+	set := &models.MenuItem{ID: 20, Name: "Fries Set", Price: 75, Available: true, Category: &fries, ShopID: &friesShop, BundleSlots: []models.BundleSlot{
+		{ID: 1, Name: "Main", Quantity: 1, Options: []models.BundleOption{
+			{MenuItemID: 2, Name: "French Fries M", Available: true, Category: &fries, ShopID: &friesShop},
+		}},
+		{ID: 2, Name: "Drink", Quantity: 1, Options: []models.BundleOption{
+			{MenuItemID: 7, Name: "Cola", Available: true, Category: &drinks, ShopID: &drinksShop},
+			{MenuItemID: 8, Name: "Thai Tea", PriceDelta: 10, Available: true, Category: &drinks, ShopID: &drinksShop},
+			{MenuItemID: 9, Name: "Iced Tea", Available: false, Category: &drinks, ShopID: &drinksShop},
+		}},
+	}}
+
+	t.Run("Bundle lines are expanded into their components", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		menuRepo := new(mocks.MockMenuRepository)
+		menuRepo.On("GetByID", mock.Anything, 20).Return(set, nil)
+		orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).Return(nil)
+
+		svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+		order, err := svc.CreateOrder(context.Background(), &models.CreateOrderRequest{
+			CustomerName: "Somchai",
+			Items: []models.OrderItem{
+				{MenuItemID: 20, Name: "Fries Set", Price: 85, Quantity: 2, Choices: []models.BundleChoice{{SlotID: 2, MenuItemID: 8}}},
+			},
+		})
+		require.NoError(t, err)
+
+		// The total is the bundle price; the components cost nothing extra
+		assert.Equal(t, 170.0, order.TotalAmount)
+		assert.Equal(t, []models.OrderItem{
+			{MenuItemID: 2, Name: "French Fries M", Quantity: 2, ShopID: &friesShop},
+			{MenuItemID: 8, Name: "Thai Tea", Quantity: 2, ShopID: &drinksShop},
+		}, order.Items[0].Components)
+
+		// Each component goes to the kitchen of its shop
+		require.Len(t, order.Tickets, 2)
+		assert.Equal(t, "French Fries M", order.Tickets[0].Items[0].Name)
+		assert.Equal(t, &drinks, order.Tickets[1].Category)
+		assert.Equal(t, "Thai Tea", order.Tickets[1].Items[0].Name)
+	})
+
+	t.Run("Components sent back keep their choices", func(t *testing.T) {
+		menuRepo := new(mocks.MockMenuRepository)
+		menuRepo.On("GetByID", mock.Anything, 20).Return(set, nil)
+		orderRepo := new(mocks.MockOrderRepository)
+		orderRepo.On("CheckStock", mock.Anything, mock.Anything).Return(nil)
+
+		svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+		err := svc.ValidateOrder(context.Background(), &models.CreateOrderRequest{
+			CustomerName: "Somchai",
+			Items: []models.OrderItem{{MenuItemID: 20, Price: 75, Quantity: 1, Components: []models.OrderItem{
+				{MenuItemID: 2, Quantity: 1},
+				{MenuItemID: 7, Quantity: 1},
+			}}},
+		})
+		assert.NoError(t, err)
+	})
+
+	tests := []struct {
+		name    string
+		price   float64
+		choices []models.BundleChoice
+		field   string
+		message string
+	}{
+		{"Choice left out", 75, nil, "items[0].choices", "item 0: Drink must be chosen"},
+		{"Not an option", 75, []models.BundleChoice{{SlotID: 2, MenuItemID: 2}}, "items[0].choices", "item 0: menu item 2 is not an option for Drink"},
+		{"Unavailable option", 75, []models.BundleChoice{{SlotID: 2, MenuItemID: 9}}, "items[0].choices", "item 0: Iced Tea is not available"},
+		{"Unknown slot", 75, []models.BundleChoice{{SlotID: 5, MenuItemID: 7}}, "items[0].choices", "item 0: slot 5 is not part of Fries Set"},
+		{"Price without the upcharge", 75, []models.BundleChoice{{SlotID: 2, MenuItemID: 8}}, "items[0].price", "item 0: price mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			menuRepo := new(mocks.MockMenuRepository)
+			menuRepo.On("GetByID", mock.Anything, 20).Return(set, nil)
+
+			svc := NewOrderService(new(mocks.MockOrderRepository), menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			err := svc.ValidateOrder(context.Background(), &models.CreateOrderRequest{
+				CustomerName: "Somchai",
+				Items:        []models.OrderItem{{MenuItemID: 20, Price: tt.price, Quantity: 1, Choices: tt.choices}},
+			})
+
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, []FieldError{{Field: tt.field, Message: tt.message}}, validationErr.Fields)
+		})
+	}
+}
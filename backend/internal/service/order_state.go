@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// ErrInvalidTransition is matched (errors.Is) by every InvalidTransitionError
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// orderTransitions is the order state machine: for each status, the statuses
+// it may move to. Statuses with no entry are final.
+//
+//	PENDING_PAYMENT -> PAID -> READY -> COMPLETED
+//	       |             \_____________/^
+//	       v
+//	   CANCELLED
+//
+// PAID and READY orders may also move to REFUNDED, once every item has been
+// refunded (see OrderService.RefundOrder).
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPendingPayment: {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:           {models.OrderStatusReady, models.OrderStatusCompleted, models.OrderStatusRefunded},
+	models.OrderStatusReady:          {models.OrderStatusCompleted, models.OrderStatusRefunded},
+}
+
+// InvalidTransitionError is returned when an order cannot move from its
+// current status to the requested one
+type InvalidTransitionError struct {
+	OrderID string
+	From    models.OrderStatus
+	To      models.OrderStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot change order %s from %s to %s", e.OrderID, e.From, e.To)
+}
+
+func (e *InvalidTransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// CanTransition reports whether the state machine allows from -> to
+func CanTransition(from, to models.OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition checks that the order may move to the given status
+func ValidateTransition(order *models.Order, to models.OrderStatus) error {
+	if !CanTransition(order.Status, to) {
+		return &InvalidTransitionError{OrderID: order.ID, From: order.Status, To: to}
+	}
+	return nil
+}
+
+// DefaultActor is recorded for transitions made without an authenticated
+// caller, such as the expiry job
+const DefaultActor = "system"
+
+// ActorKey is the context key holding who is making a change. Middleware sets
+// it with c.Locals(service.ActorKey{}, name); Fiber locals are visible through
+// the request context that handlers pass to the services.
+type ActorKey struct{}
+
+// WithActor returns a context that records actor as the author of changes
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, ActorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set on the context, or DefaultActor
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(ActorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return DefaultActor
+}
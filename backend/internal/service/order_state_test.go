@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	statuses := []models.OrderStatus{
+		models.OrderStatusPendingPayment,
+		models.OrderStatusPaid,
+		models.OrderStatusReady,
+		models.OrderStatusCompleted,
+		models.OrderStatusCancelled,
+		models.OrderStatusRefunded,
+	}
+
+	allowed := map[[2]models.OrderStatus]bool{
+		{models.OrderStatusPendingPayment, models.OrderStatusPaid}:      true,
+		{models.OrderStatusPendingPayment, models.OrderStatusCancelled}: true,
+		{models.OrderStatusPaid, models.OrderStatusReady}:               true,
+		{models.OrderStatusPaid, models.OrderStatusCompleted}:           true,
+		{models.OrderStatusPaid, models.OrderStatusRefunded}:            true,
+		{models.OrderStatusReady, models.OrderStatusCompleted}:          true,
+		{models.OrderStatusReady, models.OrderStatusRefunded}:           true,
+	}
+
+	// Every pair not listed above must be rejected
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]models.OrderStatus{from, to}]
+			assert.Equal(t, want, CanTransition(from, to), "%s -> %s", from, to)
+		}
+	}
+}
+
+func TestValidateTransition(t *testing.T) {
+	order := &models.Order{ID: "1401001", Status: models.OrderStatusCompleted}
+
+	err := ValidateTransition(order, models.OrderStatusCancelled)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+
+	var transitionErr *InvalidTransitionError
+	assert.ErrorAs(t, err, &transitionErr)
+	assert.Equal(t, models.OrderStatusCompleted, transitionErr.From)
+	assert.Equal(t, models.OrderStatusCancelled, transitionErr.To)
+
+	assert.NoError(t, ValidateTransition(&models.Order{Status: models.OrderStatusPaid}, models.OrderStatusReady))
+}
+
+func TestActorFromContext(t *testing.T) {
+	assert.Equal(t, DefaultActor, ActorFromContext(context.Background()))
+	assert.Equal(t, "cashier-1", ActorFromContext(WithActor(context.Background(), "cashier-1")))
+	assert.Equal(t, DefaultActor, ActorFromContext(WithActor(context.Background(), "")))
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// maxClientIDLength matches the orders.client_id column
+const maxClientIDLength = 64
+
+// SyncOrders creates the orders a POS tablet took while it was offline.
+//
+// Orders are created in the order they were taken (ties broken by client
+// ID), so the order IDs and queue numbers they get don't depend on how the
+// tablet batched them. An order whose client ID was synced before is not
+// created again; its result points at the existing order. Orders whose lines
+// no longer match the menu (item gone, unavailable or repriced) or need more
+// than is left in stock are reported as conflicts for the cashier to resolve
+// and re-send, and malformed orders as invalid; the rest of the batch is
+// still synced.
+//
+// Orders sent with a payment method were paid at the counter and are marked
+// paid right away. An order that was created but could not be marked paid
+// (e.g. stock ran out in the meantime) is reported as a conflict with its
+// order ID; re-sending it retries the payment. Unpaid orders expire like any
+// other once they are older than the expiry window.
+func (s *orderService) SyncOrders(ctx context.Context, req *models.SyncOrdersRequest) (*models.SyncOrdersResponse, error) {
+	if verr := validateSyncRequest(req); verr.HasErrors() {
+		return nil, verr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	byTakenAt := make([]int, len(req.Orders))
+	for i := range byTakenAt {
+		byTakenAt[i] = i
+	}
+	slices.SortStableFunc(byTakenAt, func(a, b int) int {
+		oa, ob := &req.Orders[a], &req.Orders[b]
+		return cmp.Or(oa.CreatedAt.Compare(ob.CreatedAt), strings.Compare(oa.ClientID, ob.ClientID))
+	})
+
+	results := make([]models.SyncResult, len(req.Orders))
+	menu := make(map[int]*models.MenuItem) // menu lookups shared by the batch
+	now := s.clock.Now()
+	for _, i := range byTakenAt {
+		result, err := s.syncOrder(ctx, &req.Orders[i], menu, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sync order %s: %w", req.Orders[i].ClientID, err)
+		}
+		results[i] = *result
+	}
+
+	return &models.SyncOrdersResponse{Results: results}, nil
+}
+
+// validateSyncRequest checks the batch itself: its size and that every
+// order has a client ID, used only once in the batch
+func validateSyncRequest(req *models.SyncOrdersRequest) *ValidationError {
+	verr := &ValidationError{}
+
+	if len(req.Orders) == 0 {
+		verr.Add("orders", "sync must contain at least one order")
+	}
+	if len(req.Orders) > models.MaxSyncOrders {
+		verr.Add("orders", fmt.Sprintf("sync can contain at most %d orders", models.MaxSyncOrders))
+	}
+
+	seen := make(map[string]bool, len(req.Orders))
+	for i, o := range req.Orders {
+		field := fmt.Sprintf("orders[%d].client_id", i)
+		switch {
+		case o.ClientID == "" || len(o.ClientID) > maxClientIDLength:
+			verr.Add(field, fmt.Sprintf("order %d: client_id must be 1-%d characters", i, maxClientIDLength))
+		case seen[o.ClientID]:
+			verr.Add(field, fmt.Sprintf("order %d: client_id %s appears more than once", i, o.ClientID))
+		}
+		seen[o.ClientID] = true
+	}
+
+	return verr
+}
+
+// syncOrder creates one offline order, or reports why it was not
+func (s *orderService) syncOrder(ctx context.Context, o *models.SyncOrder, menu map[int]*models.MenuItem, now time.Time) (*models.SyncResult, error) {
+	existing, err := s.orderRepo.GetByClientID(ctx, o.ClientID)
+	if err == nil {
+		return s.syncedBefore(ctx, o, existing)
+	}
+	if !errors.Is(err, ErrOrderNotFound) {
+		return nil, err
+	}
+
+	result := &models.SyncResult{ClientID: o.ClientID}
+	req := &models.CreateOrderRequest{
+		CustomerName: o.CustomerName,
+		Items:        o.Items,
+		Category:     o.Category,
+	}
+
+	if verr := validateOrderRequest(req); verr.HasErrors() {
+		result.Status = models.SyncStatusInvalid
+		result.Error = verr.Error()
+		return result, nil
+	}
+	if pm := o.PaymentMethod; pm != nil && *pm != models.PaymentMethodPromptPay && *pm != models.PaymentMethodCash {
+		result.Status = models.SyncStatusInvalid
+		result.Error = "payment_method must be PROMPTPAY or CASH"
+		return result, nil
+	}
+
+	menuItems, conflicts, err := s.syncConflicts(ctx, req, menu)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		result.Status = models.SyncStatusConflict
+		result.Conflicts = conflicts
+		return result, nil
+	}
+
+	// The order belongs to the business day it was taken on. Tablet clocks
+	// can run ahead, so a time in the future is taken as now.
+	takenAt := o.CreatedAt
+	if takenAt.IsZero() || takenAt.After(now) {
+		takenAt = now
+	}
+	order := s.newOrder(req, menuItems, takenAt)
+	order.ClientID = &o.ClientID
+
+	if err := s.saveOrder(ctx, order); err != nil {
+		var stockErr *models.StockError
+		switch {
+		case errors.As(err, &stockErr):
+			result.Status = models.SyncStatusConflict
+			result.Conflicts = stockConflicts(stockErr)
+			return result, nil
+		case errors.Is(err, ErrForbidden):
+			result.Status = models.SyncStatusInvalid
+			result.Error = err.Error()
+			return result, nil
+		case errors.Is(err, ErrDuplicate):
+			// Synced by a concurrent upload of the same batch
+			if existing, getErr := s.orderRepo.GetByClientID(ctx, o.ClientID); getErr == nil {
+				return s.syncedBefore(ctx, o, existing)
+			}
+		}
+		return nil, err
+	}
+
+	if o.PaymentMethod != nil {
+		paid, err := s.VerifyPayment(ctx, order.ID, o.PaymentMethod)
+		if err != nil {
+			return paymentConflict(result, order, err), nil
+		}
+		order = paid
+	}
+
+	log.Info().
+		Str("client_id", o.ClientID).
+		Str("order_id", order.ID).
+		Time("taken_at", takenAt).
+		Msg("Synced offline order")
+
+	result.Status = models.SyncStatusCreated
+	setSyncedOrder(result, order)
+	return result, nil
+}
+
+// syncedBefore reports an order whose client ID was already synced. If the
+// earlier upload created it but never got to marking it paid, that is done
+// now.
+func (s *orderService) syncedBefore(ctx context.Context, o *models.SyncOrder, order *models.Order) (*models.SyncResult, error) {
+	result := &models.SyncResult{ClientID: o.ClientID}
+	if !ShopScopeFromContext(ctx).ContainsOrder(order) {
+		result.Status = models.SyncStatusInvalid
+		result.Error = fmt.Sprintf("client_id %s is already used by another shop's order", o.ClientID)
+		return result, nil
+	}
+
+	if o.PaymentMethod != nil && order.Status == models.OrderStatusPendingPayment {
+		paid, err := s.VerifyPayment(ctx, order.ID, o.PaymentMethod)
+		if err != nil {
+			return paymentConflict(result, order, err), nil
+		}
+		order = paid
+	}
+
+	result.Status = models.SyncStatusDuplicate
+	setSyncedOrder(result, order)
+	return result, nil
+}
+
+// syncConflicts looks up the menu item of each line, caching them in menu,
+// and lists the lines that no longer match the menu
+func (s *orderService) syncConflicts(ctx context.Context, req *models.CreateOrderRequest, menu map[int]*models.MenuItem) ([]*models.MenuItem, []models.SyncConflict, error) {
+	var conflicts []models.SyncConflict
+	menuItems := make([]*models.MenuItem, len(req.Items))
+	for i, item := range req.Items {
+		menuItem, ok := menu[item.MenuItemID]
+		if !ok {
+			var err error
+			menuItem, err = s.menuRepo.GetByID(ctx, item.MenuItemID)
+			if err != nil && !errors.Is(err, ErrMenuItemNotFound) {
+				return nil, nil, fmt.Errorf("failed to get menu item: %w", err)
+			}
+			menu[item.MenuItemID] = menuItem // nil when not found
+		}
+		menuItems[i] = menuItem
+
+		var upcharge float64
+		var bundleErr error
+		if menuItem != nil {
+			upcharge, bundleErr = pickComponents(menuItem, &req.Items[i])
+		}
+
+		conflict := models.SyncConflict{ItemIndex: i, MenuItemID: item.MenuItemID}
+		switch {
+		case menuItem == nil:
+			conflict.Reason = models.SyncConflictItemNotFound
+		case !menuItem.Available:
+			conflict.Reason = models.SyncConflictItemUnavailable
+		case pickModifiers(menuItem, &req.Items[i]) != nil:
+			conflict.Reason = models.SyncConflictModifiersChanged
+		case bundleErr != nil:
+			conflict.Reason = models.SyncConflictBundleChanged
+		case models.ToCents(item.Price) != models.ToCents(linePrice(menuItem, req.Items[i], upcharge)):
+			conflict.Reason = models.SyncConflictPriceChanged
+			conflict.ClientPrice = item.Price
+			conflict.CurrentPrice = linePrice(menuItem, req.Items[i], upcharge)
+		default:
+			continue
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return menuItems, conflicts, nil
+}
+
+// paymentConflict reports an order that was created but could not be marked
+// paid. The rest of the batch is still synced; re-sending the order retries
+// the payment.
+func paymentConflict(result *models.SyncResult, order *models.Order, err error) *models.SyncResult {
+	log.Warn().Err(err).
+		Str("client_id", result.ClientID).
+		Str("order_id", order.ID).
+		Msg("Failed to mark synced order paid")
+
+	result.Status = models.SyncStatusConflict
+	var stockErr *models.StockError
+	if errors.As(err, &stockErr) {
+		result.Conflicts = stockConflicts(stockErr)
+	} else {
+		result.Error = "order was created but could not be marked paid; send it again to retry"
+	}
+	setSyncedOrder(result, order)
+	return result
+}
+
+// stockConflicts lists the lines of an order that need more than is left
+func stockConflicts(stockErr *models.StockError) []models.SyncConflict {
+	conflicts := make([]models.SyncConflict, 0, len(stockErr.Shortages))
+	for _, shortage := range stockErr.Shortages {
+		conflicts = append(conflicts, models.SyncConflict{
+			ItemIndex:  shortage.ItemIndex,
+			MenuItemID: shortage.MenuItemID,
+			Reason:     models.SyncConflictOutOfStock,
+		})
+	}
+	return conflicts
+}
+
+// setSyncedOrder fills in the server order a client order maps to
+func setSyncedOrder(result *models.SyncResult, order *models.Order) {
+	result.OrderID = order.ID
+	result.QueueNumber = order.QueueNumber
+	result.Order = order
+}
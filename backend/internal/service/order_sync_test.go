@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+)
+
+func TestOrderService_SyncOrders(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	menuRepo := new(mocks.MockMenuRepository)
+	menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{ID: 1, Name: "French Fries S", Price: 40, Available: true}, nil)
+	menuRepo.On("GetByID", mock.Anything, 2).Return(&models.MenuItem{ID: 2, Name: "Cheese Fries", Price: 55, Available: false}, nil)
+	menuRepo.On("GetByID", mock.Anything, 3).Return(&models.MenuItem{ID: 3, Name: "Nuggets", Price: 60, Available: true}, nil)
+	menuRepo.On("GetByID", mock.Anything, 9).Return(nil, ErrMenuItemNotFound)
+
+	existing := &models.Order{ID: "1401001", Status: models.OrderStatusPaid}
+	orderRepo.On("GetByClientID", mock.Anything, "dup").Return(existing, nil)
+	orderRepo.On("GetByClientID", mock.Anything, mock.Anything).Return(nil, ErrOrderNotFound)
+
+	// IDs are handed out in the order Create is called, after the existing 1401001
+	var created []*models.Order
+	orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).Run(func(args mock.Arguments) {
+		order := args.Get(1).(*models.Order)
+		created = append(created, order)
+		order.ID = fmt.Sprintf("%04d%03d", order.DateKey, len(created)+1)
+	}).Return(nil)
+	orderRepo.On("TransitionStatus", mock.Anything, "1401004", models.OrderStatusPaid).
+		Return(&models.Order{ID: "1401004", TotalAmount: 80, Status: models.OrderStatusPendingPayment}, nil)
+
+	fries := []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 2}}
+	cash := models.PaymentMethodCash
+	svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+	resp, err := svc.SyncOrders(context.Background(), &models.SyncOrdersRequest{Orders: []models.SyncOrder{
+		{ClientID: "late", CustomerName: "Ann", Items: fries, CreatedAt: testNow.Add(-10 * time.Minute), PaymentMethod: &cash},
+		{ClientID: "early", CustomerName: "Bob", Items: fries, CreatedAt: testNow.Add(-30 * time.Minute)},
+		{ClientID: "dup", CustomerName: "Cat", Items: fries, CreatedAt: testNow.Add(-40 * time.Minute)},
+		{ClientID: "conflict", CustomerName: "Dan", CreatedAt: testNow.Add(-20 * time.Minute), Items: []models.OrderItem{
+			{MenuItemID: 1, Price: 40, Quantity: 1},
+			{MenuItemID: 2, Price: 55, Quantity: 1},
+			{MenuItemID: 3, Price: 50, Quantity: 1},
+			{MenuItemID: 9, Price: 10, Quantity: 1},
+		}},
+		{ClientID: "invalid", CustomerName: "E", Items: fries, CreatedAt: testNow.Add(-15 * time.Minute)},
+		// Taken at 03:30, before the 04:00 rollover: still the previous business day
+		{ClientID: "overnight", CustomerName: "Fay", Items: fries, CreatedAt: time.Date(2026, time.January, 14, 3, 30, 0, 0, testNow.Location())},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 6)
+
+	// Results come back in request order, IDs are handed out by time taken
+	byClient := make(map[string]models.SyncResult)
+	for i, result := range resp.Results {
+		byClient[result.ClientID] = result
+		assert.Equal(t, []string{"late", "early", "dup", "conflict", "invalid", "overnight"}[i], result.ClientID)
+	}
+
+	overnight := byClient["overnight"]
+	assert.Equal(t, models.SyncStatusCreated, overnight.Status)
+	assert.Equal(t, "1301002", overnight.OrderID)
+
+	early := byClient["early"]
+	assert.Equal(t, models.SyncStatusCreated, early.Status)
+	assert.Equal(t, "1401003", early.OrderID)
+	assert.Equal(t, models.OrderStatusPendingPayment, early.Order.Status)
+	assert.Equal(t, testNow.Add(-30*time.Minute).UTC(), early.Order.CreatedAt)
+	assert.Equal(t, "early", *early.Order.ClientID)
+
+	late := byClient["late"]
+	assert.Equal(t, models.SyncStatusCreated, late.Status)
+	assert.Equal(t, "1401004", late.OrderID)
+	assert.Equal(t, models.OrderStatusPaid, late.Order.Status)
+
+	dup := byClient["dup"]
+	assert.Equal(t, models.SyncStatusDuplicate, dup.Status)
+	assert.Equal(t, "1401001", dup.OrderID)
+
+	conflict := byClient["conflict"]
+	assert.Equal(t, models.SyncStatusConflict, conflict.Status)
+	assert.Empty(t, conflict.OrderID)
+	assert.Equal(t, []models.SyncConflict{
+		{ItemIndex: 1, MenuItemID: 2, Reason: models.SyncConflictItemUnavailable},
+		{ItemIndex: 2, MenuItemID: 3, Reason: models.SyncConflictPriceChanged, ClientPrice: 50, CurrentPrice: 60},
+		{ItemIndex: 3, MenuItemID: 9, Reason: models.SyncConflictItemNotFound},
+	}, conflict.Conflicts)
+
+	invalid := byClient["invalid"]
+	assert.Equal(t, models.SyncStatusInvalid, invalid.Status)
+	assert.Contains(t, invalid.Error, "customer name")
+
+	assert.Len(t, created, 3)
+	menuRepo.AssertNumberOfCalls(t, "GetByID", 4) // looked up once per batch
+}
+
+func TestOrderService_SyncOrders_PaysDuplicateLeftUnpaid(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	orderRepo.On("GetByClientID", mock.Anything, "c1").
+		Return(&models.Order{ID: "1401001", TotalAmount: 80, Status: models.OrderStatusPendingPayment}, nil)
+	orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).
+		Return(&models.Order{ID: "1401001", TotalAmount: 80, Status: models.OrderStatusPendingPayment}, nil)
+
+	svc := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+	promptPay := models.PaymentMethodPromptPay
+	resp, err := svc.SyncOrders(context.Background(), &models.SyncOrdersRequest{Orders: []models.SyncOrder{
+		{ClientID: "c1", CustomerName: "Ann", PaymentMethod: &promptPay},
+	}})
+
+	require.NoError(t, err)
+	assert.Equal(t, models.SyncStatusDuplicate, resp.Results[0].Status)
+	assert.Equal(t, models.OrderStatusPaid, resp.Results[0].Order.Status)
+	orderRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestOrderService_SyncOrders_OutOfStock(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	menuRepo := new(mocks.MockMenuRepository)
+	menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{ID: 1, Name: "French Fries S", Price: 40, Available: true}, nil)
+	orderRepo.On("GetByClientID", mock.Anything, "c1").Return(nil, ErrOrderNotFound)
+	stockErr := &models.StockError{
+		ValidationError: NewValidationError("items[0].quantity", "item 0: only 1 of French Fries S left"),
+		Shortages:       []models.StockShortage{{ItemIndex: 0, MenuItemID: 1}},
+	}
+	orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).Return(stockErr)
+
+	svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+	resp, err := svc.SyncOrders(context.Background(), &models.SyncOrdersRequest{Orders: []models.SyncOrder{
+		{ClientID: "c1", CustomerName: "Ann", CreatedAt: testNow, Items: []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 2}}},
+	}})
+
+	// The rest of the batch would still be synced; this order is left for
+	// the cashier to change
+	require.NoError(t, err)
+	assert.Equal(t, models.SyncStatusConflict, resp.Results[0].Status)
+	assert.Equal(t, []models.SyncConflict{{ItemIndex: 0, MenuItemID: 1, Reason: models.SyncConflictOutOfStock}}, resp.Results[0].Conflicts)
+}
+
+func TestOrderService_SyncOrders_PaymentFails(t *testing.T) {
+	orderRepo := new(mocks.MockOrderRepository)
+	menuRepo := new(mocks.MockMenuRepository)
+	menuRepo.On("GetByID", mock.Anything, 1).Return(&models.MenuItem{ID: 1, Name: "French Fries S", Price: 40, Available: true}, nil)
+	orderRepo.On("GetByClientID", mock.Anything, mock.Anything).Return(nil, ErrOrderNotFound)
+
+	var created int
+	orderRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Order")).Run(func(args mock.Arguments) {
+		created++
+		order := args.Get(1).(*models.Order)
+		order.ID = fmt.Sprintf("%04d%03d", order.DateKey, created)
+	}).Return(nil)
+	// Stock is taken when the order is paid
+	stockErr := &models.StockError{
+		ValidationError: NewValidationError("items[0].quantity", "item 0: only 1 of French Fries S left"),
+		Shortages:       []models.StockShortage{{ItemIndex: 0, MenuItemID: 1}},
+	}
+	orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).Return(nil, stockErr)
+	orderRepo.On("TransitionStatus", mock.Anything, "1401002", models.OrderStatusPaid).Return(nil, fmt.Errorf("connection reset"))
+
+	fries := []models.OrderItem{{MenuItemID: 1, Name: "French Fries S", Price: 40, Quantity: 2}}
+	cash := models.PaymentMethodCash
+	svc := NewOrderService(orderRepo, menuRepo, utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+	resp, err := svc.SyncOrders(context.Background(), &models.SyncOrdersRequest{Orders: []models.SyncOrder{
+		{ClientID: "c1", CustomerName: "Ann", Items: fries, CreatedAt: testNow.Add(-30 * time.Minute), PaymentMethod: &cash},
+		{ClientID: "c2", CustomerName: "Bob", Items: fries, CreatedAt: testNow.Add(-20 * time.Minute), PaymentMethod: &cash},
+		{ClientID: "c3", CustomerName: "Cat", Items: fries, CreatedAt: testNow.Add(-10 * time.Minute)},
+	}})
+
+	// Each order that couldn't be paid is reported on its own; the rest of
+	// the batch is still synced
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 3)
+
+	outOfStock := resp.Results[0]
+	assert.Equal(t, models.SyncStatusConflict, outOfStock.Status)
+	assert.Equal(t, "1401001", outOfStock.OrderID)
+	assert.Equal(t, models.OrderStatusPendingPayment, outOfStock.Order.Status)
+	assert.Equal(t, []models.SyncConflict{{ItemIndex: 0, MenuItemID: 1, Reason: models.SyncConflictOutOfStock}}, outOfStock.Conflicts)
+
+	failed := resp.Results[1]
+	assert.Equal(t, models.SyncStatusConflict, failed.Status)
+	assert.Equal(t, "1401002", failed.OrderID)
+	assert.NotEmpty(t, failed.Error)
+	assert.NotContains(t, failed.Error, "connection reset")
+
+	assert.Equal(t, models.SyncStatusCreated, resp.Results[2].Status)
+	assert.Equal(t, "1401003", resp.Results[2].OrderID)
+}
+
+func TestOrderService_SyncOrders_InvalidBatch(t *testing.T) {
+	svc := NewOrderService(new(mocks.MockOrderRepository), new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+
+	_, err := svc.SyncOrders(context.Background(), &models.SyncOrdersRequest{})
+	assert.ErrorIs(t, err, ErrValidation)
+
+	_, err = svc.SyncOrders(context.Background(), &models.SyncOrdersRequest{Orders: []models.SyncOrder{
+		{ClientID: "c1"}, {ClientID: ""}, {ClientID: "c1"},
+	}})
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Len(t, verr.Fields, 2)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+	"github.com/tanasatit/barvidva-kasetfair/pkg/promptpay"
+)
+
+// verifiedOrderService checks PromptPay payments with a payment provider
+// before they are recorded
+type verifiedOrderService struct {
+	OrderService
+	verifier PaymentVerifier
+}
+
+// WithPaymentVerification wraps orders so that a PromptPay payment recorded
+// with a transaction reference must be confirmed by the verifier. The
+// amount defaults to what the provider reports and must match it when
+// given. Payments without a reference are taken on the cashier's word.
+func WithPaymentVerification(orders OrderService, verifier PaymentVerifier) OrderService {
+	return &verifiedOrderService{OrderService: orders, verifier: verifier}
+}
+
+// RecordPayment verifies the payment's reference, then records it
+func (s *verifiedOrderService) RecordPayment(ctx context.Context, id string, req *models.PaymentRequest) (*models.Order, error) {
+	isPromptPay := req.Method != nil && *req.Method == models.PaymentMethodPromptPay
+	if !isPromptPay || req.Reference == "" || req.VerifiedBy != "" {
+		return s.OrderService.RecordPayment(ctx, id, req)
+	}
+
+	notification, err := s.verifier.Lookup(ctx, req.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify payment: %w", err)
+	}
+
+	verified := *req
+	switch {
+	case models.ToCents(verified.Amount) == 0:
+		verified.Amount = notification.Amount
+	case models.ToCents(verified.Amount) != models.ToCents(notification.Amount):
+		return nil, NewValidationError("amount", fmt.Sprintf("amount does not match the verified payment of %.2f", notification.Amount))
+	}
+	verified.VerifiedBy = s.verifier.Name()
+
+	return s.OrderService.RecordPayment(ctx, id, &verified)
+}
+
+type PaymentWebhookService interface {
+	HandleNotification(ctx context.Context, body []byte, signature string) (*models.PaymentMatch, error)
+}
+
+type paymentWebhookService struct {
+	orders         OrderService
+	orderRepo      repository.OrderRepository
+	shopRepo       repository.ShopRepository
+	verifier       PaymentVerifier
+	defaultAccount string
+}
+
+// NewPaymentWebhookService creates the service that turns payment
+// notifications from the verifier's provider into payments. Like the
+// PromptPay QR codes, orders are paid to their shop's account or else to
+// defaultAccount.
+func NewPaymentWebhookService(orders OrderService, orderRepo repository.OrderRepository, shopRepo repository.ShopRepository, verifier PaymentVerifier, defaultAccount string) PaymentWebhookService {
+	return &paymentWebhookService{
+		orders:         orders,
+		orderRepo:      orderRepo,
+		shopRepo:       shopRepo,
+		verifier:       verifier,
+		defaultAccount: defaultAccount,
+	}
+}
+
+// HandleNotification authenticates a payment notification and records it
+// on the unpaid order it belongs to: the order named by its bill reference,
+// or else the only unpaid order paid to the receiving account whose
+// outstanding balance is exactly the amount paid. The order becomes PAID as
+// with any other payment.
+// Notifications that match no order, or several, are left for a cashier;
+// redelivered ones are reported as DUPLICATE.
+func (s *paymentWebhookService) HandleNotification(ctx context.Context, body []byte, signature string) (*models.PaymentMatch, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	notification, err := s.verifier.ParseNotification(ctx, body, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	match := &models.PaymentMatch{Reference: notification.Reference}
+
+	existing, err := s.orderRepo.GetByPaymentReference(ctx, s.verifier.Name(), notification.Reference)
+	switch {
+	case err == nil:
+		match.Status = models.PaymentMatchDuplicate
+		match.OrderID = existing.ID
+		return match, nil
+	case !errors.Is(err, ErrOrderNotFound):
+		return nil, fmt.Errorf("failed to check payment reference: %w", err)
+	}
+
+	candidates, err := s.candidates(ctx, notification)
+	if err != nil {
+		return nil, err
+	}
+	switch len(candidates) {
+	case 0:
+		match.Status = models.PaymentMatchUnmatched
+		return match, nil
+	case 1:
+	default:
+		match.Status = models.PaymentMatchAmbiguous
+		return match, nil
+	}
+
+	promptPay := models.PaymentMethodPromptPay
+	order, err := s.orders.RecordPayment(WithActor(ctx, "webhook:"+s.verifier.Name()), candidates[0].ID, &models.PaymentRequest{
+		Method:     &promptPay,
+		Amount:     notification.Amount,
+		Reference:  notification.Reference,
+		VerifiedBy: s.verifier.Name(),
+	})
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		// Delivered twice at once; the other delivery recorded it
+		match.Status = models.PaymentMatchDuplicate
+		match.OrderID = candidates[0].ID
+		return match, nil
+	case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrValidation):
+		// Paid or cancelled in the meantime
+		match.Status = models.PaymentMatchUnmatched
+		return match, nil
+	case err != nil:
+		return nil, err
+	}
+
+	match.Status = models.PaymentMatchMatched
+	match.OrderID = order.ID
+	match.Order = order
+	return match, nil
+}
+
+// candidates finds the unpaid orders the notification could pay. Without
+// a bill reference only orders paid to the account that received the money
+// count, so a payment to one shop can never pay another shop's order; a
+// notification that doesn't name its account then matches nothing.
+func (s *paymentWebhookService) candidates(ctx context.Context, notification *models.PaymentNotification) ([]models.Order, error) {
+	var orders []models.Order
+	if notification.OrderID != "" {
+		order, err := s.orderRepo.GetByID(ctx, notification.OrderID)
+		if errors.Is(err, ErrOrderNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order: %w", err)
+		}
+		orders = []models.Order{*order}
+	} else {
+		pending, err := s.orderRepo.GetByStatus(ctx, models.OrderStatusPendingPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pending payment orders: %w", err)
+		}
+		orders = pending
+	}
+
+	amount := models.ToCents(notification.Amount)
+	var candidates []models.Order
+	for _, order := range orders {
+		if order.Status != models.OrderStatusPendingPayment || models.ToCents(order.Balance()) != amount {
+			continue
+		}
+		if notification.OrderID == "" || notification.Account != "" {
+			paidTo, err := promptPayAccount(ctx, s.shopRepo, s.defaultAccount, &order)
+			if errors.Is(err, ErrPromptPayNotConfigured) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !promptpay.SameAccount(paidTo, notification.Account) {
+				continue
+			}
+		}
+		candidates = append(candidates, order)
+	}
+	return candidates, nil
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
+	"github.com/tanasatit/barvidva-kasetfair/internal/testutil"
+	"github.com/tanasatit/barvidva-kasetfair/internal/utils"
+)
+
+const testPaymentSecret = "test-webhook-secret"
+
+func pendingOrder(id string, total float64) *models.Order {
+	return &models.Order{ID: id, TotalAmount: total, Status: models.OrderStatusPendingPayment}
+}
+
+// newTestVerifier creates a signed verifier whose stored notifications are
+// mocked; saving always succeeds
+func newTestVerifier() (PaymentVerifier, *mocks.MockPaymentNotificationRepository) {
+	notifications := new(mocks.MockPaymentNotificationRepository)
+	notifications.On("Save", mock.Anything, "bank", mock.Anything).Return(nil)
+	return NewSignedPaymentVerifier("bank", testPaymentSecret, notifications), notifications
+}
+
+func TestSignedPaymentVerifier_ParseNotification(t *testing.T) {
+	provider := testutil.FakePaymentProvider{Secret: testPaymentSecret}
+	verifier, notifications := newTestVerifier()
+
+	body, signature := provider.Notify(t, "TX1", 80, "1401001")
+	notification, err := verifier.ParseNotification(context.Background(), body, signature)
+	require.NoError(t, err)
+	assert.Equal(t, "TX1", notification.Reference)
+	assert.Equal(t, 80.0, notification.Amount)
+	assert.Equal(t, "1401001", notification.OrderID)
+
+	// Received notifications are stored, so any instance can look them up
+	// by reference, also after a restart
+	notifications.AssertCalled(t, "Save", mock.Anything, "bank", notification)
+	notifications.On("GetByReference", mock.Anything, "bank", "TX1").Return(notification, nil)
+	found, err := verifier.Lookup(context.Background(), "TX1")
+	require.NoError(t, err)
+	assert.Equal(t, 80.0, found.Amount)
+
+	// Signed with another secret, or tampered with
+	forged, forgedSignature := testutil.FakePaymentProvider{Secret: "wrong"}.Notify(t, "TX3", 80, "")
+	_, err = verifier.ParseNotification(context.Background(), forged, forgedSignature)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	_, err = verifier.ParseNotification(context.Background(), []byte(`{"reference":"TX1","amount":8000}`), signature)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// Correctly signed but incomplete
+	empty, emptySignature := provider.Notify(t, "", 0, "")
+	_, err = verifier.ParseNotification(context.Background(), empty, emptySignature)
+	assert.ErrorIs(t, err, ErrValidation)
+
+	notifications.AssertNumberOfCalls(t, "Save", 1)
+}
+
+func TestOrderService_PaymentVerification(t *testing.T) {
+	promptPay, cash := models.PaymentMethodPromptPay, models.PaymentMethodCash
+
+	setup := func(t *testing.T) (OrderService, *mocks.MockOrderRepository) {
+		verifier, notifications := newTestVerifier()
+		notifications.On("GetByReference", mock.Anything, "bank", "TX1").Return(&models.PaymentNotification{Reference: "TX1", Amount: 80}, nil)
+		notifications.On("GetByReference", mock.Anything, "bank", mock.Anything).Return(nil, ErrPaymentNotVerified)
+
+		orderRepo := new(mocks.MockOrderRepository)
+		orders := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+		return WithPaymentVerification(orders, verifier), orderRepo
+	}
+
+	t.Run("Verified reference pays the reported amount", func(t *testing.T) {
+		svc, orderRepo := setup(t)
+		orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).Return(pendingOrder("1401001", 80), nil)
+
+		order, err := svc.RecordPayment(context.Background(), "1401001", &models.PaymentRequest{Method: &promptPay, Reference: "TX1"})
+		require.NoError(t, err)
+		assert.Equal(t, models.OrderStatusPaid, order.Status)
+
+		payment := orderRepo.StatusChanges[0].Payment
+		assert.Equal(t, 80.0, payment.Amount)
+		assert.Equal(t, "bank", *payment.VerifiedBy)
+	})
+
+	t.Run("Unknown reference", func(t *testing.T) {
+		svc, orderRepo := setup(t)
+
+		_, err := svc.RecordPayment(context.Background(), "1401001", &models.PaymentRequest{Method: &promptPay, Reference: "TX9"})
+		assert.ErrorIs(t, err, ErrPaymentNotVerified)
+		orderRepo.AssertNotCalled(t, "TransitionStatus", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Amount differs from the verified payment", func(t *testing.T) {
+		svc, _ := setup(t)
+
+		_, err := svc.RecordPayment(context.Background(), "1401001", &models.PaymentRequest{Method: &promptPay, Reference: "TX1", Amount: 50})
+		assert.ErrorIs(t, err, ErrValidation)
+	})
+
+	t.Run("Cash and payments without a reference are not checked", func(t *testing.T) {
+		svc, orderRepo := setup(t)
+		orderRepo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).Return(pendingOrder("1401001", 80), nil)
+
+		_, err := svc.RecordPayment(context.Background(), "1401001", &models.PaymentRequest{Method: &cash, Reference: "TILL-2"})
+		require.NoError(t, err)
+		_, err = svc.VerifyPayment(context.Background(), "1401001", &promptPay)
+		require.NoError(t, err)
+
+		for _, change := range orderRepo.StatusChanges {
+			assert.Nil(t, change.Payment.VerifiedBy)
+		}
+	})
+}
+
+func TestPaymentWebhookService_HandleNotification(t *testing.T) {
+	const boothAccount, drinksAccount = "0812345678", "0899999999"
+	provider := testutil.FakePaymentProvider{Secret: testPaymentSecret, Account: boothAccount}
+	drinksShop := 2
+	drinksOrder := func(id string, total float64) *models.Order {
+		order := pendingOrder(id, total)
+		order.ShopID = &drinksShop
+		return order
+	}
+
+	tests := []struct {
+		name        string
+		orderID     string // bill reference in the notification
+		account     string // account paid into; default boothAccount
+		amount      float64
+		setupMock   func(*mocks.MockOrderRepository)
+		wantStatus  models.PaymentMatchStatus
+		wantOrderID string
+	}{
+		{
+			name:    "Matched by bill reference",
+			orderID: "1401002",
+			amount:  120,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByID", mock.Anything, "1401002").Return(pendingOrder("1401002", 120), nil)
+				repo.On("TransitionStatus", mock.Anything, "1401002", models.OrderStatusPaid).Return(pendingOrder("1401002", 120), nil)
+			},
+			wantStatus:  models.PaymentMatchMatched,
+			wantOrderID: "1401002",
+		},
+		{
+			name:    "Bill reference with the wrong amount",
+			orderID: "1401002",
+			amount:  100,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByID", mock.Anything, "1401002").Return(pendingOrder("1401002", 120), nil)
+			},
+			wantStatus: models.PaymentMatchUnmatched,
+		},
+		{
+			name:   "Matched by the only order with that balance",
+			amount: 80,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByStatus", mock.Anything, models.OrderStatusPendingPayment).Return([]models.Order{
+					*pendingOrder("1401001", 80),
+					*pendingOrder("1401002", 120),
+				}, nil)
+				repo.On("TransitionStatus", mock.Anything, "1401001", models.OrderStatusPaid).Return(pendingOrder("1401001", 80), nil)
+			},
+			wantStatus:  models.PaymentMatchMatched,
+			wantOrderID: "1401001",
+		},
+		{
+			name:   "Several orders with that balance",
+			amount: 80,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByStatus", mock.Anything, models.OrderStatusPendingPayment).Return([]models.Order{
+					*pendingOrder("1401001", 80),
+					*pendingOrder("1401003", 80),
+				}, nil)
+			},
+			wantStatus: models.PaymentMatchAmbiguous,
+		},
+		{
+			name:    "Only orders paid to the receiving account",
+			account: "089-999-9999",
+			amount:  80,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByStatus", mock.Anything, models.OrderStatusPendingPayment).Return([]models.Order{
+					*pendingOrder("1401001", 80),
+					*drinksOrder("1401003", 80),
+				}, nil)
+				repo.On("TransitionStatus", mock.Anything, "1401003", models.OrderStatusPaid).Return(drinksOrder("1401003", 80), nil)
+			},
+			wantStatus:  models.PaymentMatchMatched,
+			wantOrderID: "1401003",
+		},
+		{
+			name:   "Payment to the booth doesn't pay another shop's order",
+			amount: 80,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByStatus", mock.Anything, models.OrderStatusPendingPayment).Return([]models.Order{*drinksOrder("1401003", 80)}, nil)
+			},
+			wantStatus: models.PaymentMatchUnmatched,
+		},
+		{
+			name:    "Bill reference paid to another shop's account",
+			orderID: "1401003",
+			amount:  80,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByID", mock.Anything, "1401003").Return(drinksOrder("1401003", 80), nil)
+			},
+			wantStatus: models.PaymentMatchUnmatched,
+		},
+		{
+			name:    "No account named",
+			account: "-",
+			amount:  80,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByStatus", mock.Anything, models.OrderStatusPendingPayment).Return([]models.Order{*pendingOrder("1401001", 80)}, nil)
+			},
+			wantStatus: models.PaymentMatchUnmatched,
+		},
+		{
+			name:   "No order with that balance",
+			amount: 55,
+			setupMock: func(repo *mocks.MockOrderRepository) {
+				repo.On("GetByStatus", mock.Anything, models.OrderStatusPendingPayment).Return([]models.Order{*pendingOrder("1401001", 80)}, nil)
+			},
+			wantStatus: models.PaymentMatchUnmatched,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepository)
+			orderRepo.On("GetByPaymentReference", mock.Anything, "bank", "TX1").Return(nil, ErrOrderNotFound)
+			tt.setupMock(orderRepo)
+
+			shopRepo := new(mocks.MockShopRepository)
+			account := drinksAccount
+			shopRepo.On("GetByID", mock.Anything, drinksShop).Return(&models.Shop{ID: drinksShop, PromptPayID: &account}, nil)
+
+			verifier, _ := newTestVerifier()
+			orders := NewOrderService(orderRepo, new(mocks.MockMenuRepository), utils.NewNoOpCache(), newTestClock(t, testNow), NewNoOpOrderEventPublisher())
+			svc := NewPaymentWebhookService(WithPaymentVerification(orders, verifier), orderRepo, shopRepo, verifier, boothAccount)
+
+			notifier := provider
+			switch tt.account {
+			case "":
+			case "-":
+				notifier.Account = ""
+			default:
+				notifier.Account = tt.account
+			}
+			body, signature := notifier.Notify(t, "TX1", tt.amount, tt.orderID)
+			match, err := svc.HandleNotification(context.Background(), body, signature)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, match.Status)
+			assert.Equal(t, tt.wantOrderID, match.OrderID)
+
+			if tt.wantStatus == models.PaymentMatchMatched {
+				assert.Equal(t, models.OrderStatusPaid, match.Order.Status)
+				change := orderRepo.StatusChanges[0]
+				assert.Equal(t, "webhook:bank", change.Actor)
+				assert.Equal(t, "TX1", *change.Payment.Reference)
+				assert.Equal(t, "bank", *change.Payment.VerifiedBy)
+			}
+			orderRepo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Redelivered notification", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		orderRepo.On("GetByPaymentReference", mock.Anything, "bank", "TX1").Return(&models.Order{ID: "1401001", Status: models.OrderStatusPaid}, nil)
+
+		verifier, _ := newTestVerifier()
+		svc := NewPaymentWebhookService(nil, orderRepo, new(mocks.MockShopRepository), verifier, boothAccount)
+
+		body, signature := provider.Notify(t, "TX1", 80, "")
+		match, err := svc.HandleNotification(context.Background(), body, signature)
+		require.NoError(t, err)
+		assert.Equal(t, models.PaymentMatchDuplicate, match.Status)
+		assert.Equal(t, "1401001", match.OrderID)
+	})
+
+	t.Run("Bad signature", func(t *testing.T) {
+		orderRepo := new(mocks.MockOrderRepository)
+		verifier, notifications := newTestVerifier()
+		svc := NewPaymentWebhookService(nil, orderRepo, new(mocks.MockShopRepository), verifier, boothAccount)
+
+		body, _ := provider.Notify(t, "TX1", 80, "")
+		_, err := svc.HandleNotification(context.Background(), body, "deadbeef")
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		orderRepo.AssertNotCalled(t, "GetByPaymentReference", mock.Anything, mock.Anything, mock.Anything)
+		notifications.AssertNotCalled(t, "Save", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+	"github.com/tanasatit/barvidva-kasetfair/pkg/promptpay"
+)
+
+type PromptPayService interface {
+	GetQR(ctx context.Context, orderID string) (*models.PromptPayQR, error)
+}
+
+type promptPayService struct {
+	orderRepo      repository.OrderRepository
+	shopRepo       repository.ShopRepository
+	defaultAccount string
+}
+
+// NewPromptPayService creates the service generating PromptPay QR codes.
+// defaultAccount receives payments for orders whose shop has no account of
+// its own and for orders spanning several shops; empty means none.
+func NewPromptPayService(orderRepo repository.OrderRepository, shopRepo repository.ShopRepository, defaultAccount string) PromptPayService {
+	return &promptPayService{
+		orderRepo:      orderRepo,
+		shopRepo:       shopRepo,
+		defaultAccount: defaultAccount,
+	}
+}
+
+// GetQR builds a PromptPay QR code for what is left to pay of an unpaid
+// order. The amount comes from the stored order, never from the client.
+func (s *promptPayService) GetQR(ctx context.Context, orderID string) (*models.PromptPayQR, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if err := checkTransition(ShopScopeFromContext(ctx), order, models.OrderStatusPaid); err != nil {
+		return nil, err
+	}
+
+	account, err := s.account(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	target, err := promptpay.ParseTarget(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build PromptPay QR for order %s: %w", order.ID, err)
+	}
+
+	amount := order.Balance()
+	payload, err := target.Payload(amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build PromptPay QR for order %s: %w", order.ID, err)
+	}
+	png, err := promptpay.QRCode(payload, promptpay.DefaultQRSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PromptPayQR{
+		OrderID: order.ID,
+		Amount:  amount,
+		Account: target.ID,
+		Payload: payload,
+		PNG:     png,
+	}, nil
+}
+
+// account picks the PromptPay account paid for the order: its shop's, or
+// the default one
+func (s *promptPayService) account(ctx context.Context, order *models.Order) (string, error) {
+	return promptPayAccount(ctx, s.shopRepo, s.defaultAccount, order)
+}
+
+// promptPayAccount is the account an order's PromptPay payments go to: its
+// shop's, or defaultAccount for shops without one and orders spanning
+// several shops
+func promptPayAccount(ctx context.Context, shopRepo repository.ShopRepository, defaultAccount string, order *models.Order) (string, error) {
+	if order.ShopID != nil && !order.HasTickets() {
+		shop, err := shopRepo.GetByID(ctx, *order.ShopID)
+		if err != nil && !errors.Is(err, ErrShopNotFound) {
+			return "", fmt.Errorf("failed to get shop: %w", err)
+		}
+		if shop != nil && shop.PromptPayID != nil {
+			return *shop.PromptPayID, nil
+		}
+	}
+
+	if defaultAccount == "" {
+		return "", fmt.Errorf("%w for order %s", ErrPromptPayNotConfigured, order.ID)
+	}
+	return defaultAccount, nil
+}
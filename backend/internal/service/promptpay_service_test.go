@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
+	"github.com/tanasatit/barvidva-kasetfair/pkg/promptpay"
+)
+
+func TestPromptPayService_GetQR(t *testing.T) {
+	shopID := 1
+	shopAccount := "0899999999"
+	cash := models.PaymentMethodCash
+
+	tests := []struct {
+		name           string
+		order          *models.Order
+		shop           *models.Shop
+		defaultAccount string
+		wantAccount    string
+		wantAmount     float64
+		wantErr        error
+	}{
+		{
+			name:           "Shop account",
+			order:          &models.Order{ID: "1401001", ShopID: &shopID, TotalAmount: 80, Status: models.OrderStatusPendingPayment},
+			shop:           &models.Shop{ID: shopID, PromptPayID: &shopAccount},
+			defaultAccount: "0812345678",
+			wantAccount:    "0899999999",
+			wantAmount:     80,
+		},
+		{
+			name:           "Shop without an account uses the default",
+			order:          &models.Order{ID: "1401001", ShopID: &shopID, TotalAmount: 80, Status: models.OrderStatusPendingPayment},
+			shop:           &models.Shop{ID: shopID},
+			defaultAccount: "0812345678",
+			wantAccount:    "0812345678",
+			wantAmount:     80,
+		},
+		{
+			name: "Asks for the outstanding balance",
+			order: &models.Order{
+				ID: "1401001", TotalAmount: 80, Status: models.OrderStatusPendingPayment,
+				Payments: []models.Payment{{Amount: 30, Method: &cash}},
+			},
+			defaultAccount: "1111111111111",
+			wantAccount:    "1111111111111",
+			wantAmount:     50,
+		},
+		{
+			name:    "No account configured",
+			order:   &models.Order{ID: "1401001", TotalAmount: 80, Status: models.OrderStatusPendingPayment},
+			wantErr: ErrPromptPayNotConfigured,
+		},
+		{
+			name:           "Already paid",
+			order:          &models.Order{ID: "1401001", TotalAmount: 80, Status: models.OrderStatusPaid},
+			defaultAccount: "0812345678",
+			wantErr:        ErrInvalidTransition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := new(mocks.MockOrderRepository)
+			orderRepo.On("GetByID", mock.Anything, "1401001").Return(tt.order, nil)
+			shopRepo := new(mocks.MockShopRepository)
+			if tt.shop != nil {
+				shopRepo.On("GetByID", mock.Anything, shopID).Return(tt.shop, nil)
+			}
+
+			svc := NewPromptPayService(orderRepo, shopRepo, tt.defaultAccount)
+			qr, err := svc.GetQR(context.Background(), "1401001")
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAccount, qr.Account)
+			assert.Equal(t, tt.wantAmount, qr.Amount)
+
+			want, err := promptpay.Payload(tt.wantAccount, tt.wantAmount)
+			require.NoError(t, err)
+			assert.Equal(t, want, qr.Payload)
+			assert.NotEmpty(t, qr.PNG)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// ShopScope is the set of shops a caller may see and act on. Services apply
+// the scope from the request context to every order and menu operation, so
+// a ?category= filter can only narrow it further.
+type ShopScope struct {
+	all     bool
+	shopIDs []int
+}
+
+// AllShops is the scope of owners, the legacy shared passwords and public
+// routes (customers, queue board)
+func AllShops() ShopScope {
+	return ShopScope{all: true}
+}
+
+// OnlyShops limits the scope to the given shops (none when empty)
+func OnlyShops(shopIDs ...int) ShopScope {
+	return ShopScope{shopIDs: append([]int(nil), shopIDs...)}
+}
+
+// ScopeForUser is the scope of a logged-in user: owners see every shop,
+// everyone else the shops they are assigned to
+func ScopeForUser(user *models.User) ShopScope {
+	if user.Role == models.RoleOwner {
+		return AllShops()
+	}
+	return OnlyShops(user.ShopIDs...)
+}
+
+// All reports whether the scope is unrestricted
+func (s ShopScope) All() bool {
+	return s.all
+}
+
+// ShopIDs returns the shops in a restricted scope
+func (s ShopScope) ShopIDs() []int {
+	return append([]int(nil), s.shopIDs...)
+}
+
+// Equal reports whether both scopes cover the same shops
+func (s ShopScope) Equal(other ShopScope) bool {
+	if s.all || other.all {
+		return s.all == other.all
+	}
+	a, b := slices.Clone(s.shopIDs), slices.Clone(other.shopIDs)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// Contains reports whether something bound to shopID is in scope. Items and
+// orders without a shop are only visible to unrestricted callers.
+func (s ShopScope) Contains(shopID *int) bool {
+	if s.all {
+		return true
+	}
+	return shopID != nil && slices.Contains(s.shopIDs, *shopID)
+}
+
+// ContainsOrder reports whether an order is in scope: its shop is, or, for
+// an order split into tickets, the shop of one of its tickets
+func (s ShopScope) ContainsOrder(order *models.Order) bool {
+	if s.Contains(order.ShopID) {
+		return true
+	}
+	for _, ticket := range order.Tickets {
+		if s.Contains(&ticket.ShopID) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterOrders keeps the orders in scope
+func (s ShopScope) FilterOrders(orders []models.Order) []models.Order {
+	if s.all {
+		return orders
+	}
+	filtered := make([]models.Order, 0, len(orders))
+	for _, order := range orders {
+		if s.ContainsOrder(&order) {
+			filtered = append(filtered, order)
+		}
+	}
+	return filtered
+}
+
+// FilterTickets turns orders into the entries of a kitchen or pickup list
+// for the given status. Single-shop orders in scope are kept as they are; an
+// order split into tickets becomes one entry per ticket in scope with that
+// status (and category, when given), so each shop only sees its own part.
+func (s ShopScope) FilterTickets(orders []models.Order, status models.OrderStatus, category string) []models.Order {
+	filtered := make([]models.Order, 0, len(orders))
+	for _, order := range orders {
+		if !order.HasTickets() {
+			if s.Contains(order.ShopID) {
+				filtered = append(filtered, order)
+			}
+			continue
+		}
+		for _, ticket := range order.Tickets {
+			if ticket.Status != status || !s.Contains(&ticket.ShopID) {
+				continue
+			}
+			if category != "" && (ticket.Category == nil || *ticket.Category != category) {
+				continue
+			}
+			filtered = append(filtered, order.TicketView(ticket))
+		}
+	}
+	return filtered
+}
+
+// FilterMenuItems keeps the menu items in scope
+func (s ShopScope) FilterMenuItems(items []models.MenuItem) []models.MenuItem {
+	if s.all {
+		return items
+	}
+	filtered := make([]models.MenuItem, 0, len(items))
+	for _, item := range items {
+		if s.Contains(item.ShopID) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// ShopScopeKey is the context key holding the caller's ShopScope. Middleware
+// sets it with c.Locals(service.ShopScopeKey{}, scope) for session users.
+type ShopScopeKey struct{}
+
+// WithShopScope returns a context limited to scope
+func WithShopScope(ctx context.Context, scope ShopScope) context.Context {
+	return context.WithValue(ctx, ShopScopeKey{}, scope)
+}
+
+// ShopScopeFromContext returns the caller's scope, or AllShops when none was
+// set (public routes and the legacy shared passwords)
+func ShopScopeFromContext(ctx context.Context) ShopScope {
+	if scope, ok := ctx.Value(ShopScopeKey{}).(ShopScope); ok {
+		return scope
+	}
+	return AllShops()
+}
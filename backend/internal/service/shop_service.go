@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository"
+	"github.com/tanasatit/barvidva-kasetfair/pkg/promptpay"
+)
+
+type ShopService interface {
+	GetAll(ctx context.Context) ([]models.Shop, error)
+	GetActive(ctx context.Context) ([]models.Shop, error)
+	Create(ctx context.Context, shop *models.Shop) (*models.Shop, error)
+	Update(ctx context.Context, shop *models.Shop) (*models.Shop, error)
+}
+
+type shopService struct {
+	shopRepo repository.ShopRepository
+}
+
+func NewShopService(shopRepo repository.ShopRepository) ShopService {
+	return &shopService{shopRepo: shopRepo}
+}
+
+// GetAll retrieves every shop, including closed ones
+func (s *shopService) GetAll(ctx context.Context) ([]models.Shop, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	shops, err := s.shopRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shops: %w", err)
+	}
+	return shops, nil
+}
+
+// GetActive retrieves the shops that are open, for customers and displays
+func (s *shopService) GetActive(ctx context.Context) ([]models.Shop, error) {
+	shops, err := s.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]models.Shop, 0, len(shops))
+	for _, shop := range shops {
+		if shop.Active {
+			active = append(active, shop)
+		}
+	}
+	return active, nil
+}
+
+// Create adds a shop. The code becomes the category of its menu items.
+func (s *shopService) Create(ctx context.Context, shop *models.Shop) (*models.Shop, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	shop.Code = strings.TrimSpace(shop.Code)
+	shop.Name = strings.TrimSpace(shop.Name)
+
+	verr := &ValidationError{}
+	if shop.Code == "" || len(shop.Code) > 50 {
+		verr.Add("code", "code must be 1-50 characters")
+	}
+	if shop.Name == "" || len(shop.Name) > 100 {
+		verr.Add("name", "name must be 1-100 characters")
+	}
+	normalizePromptPayID(shop, verr)
+	if verr.HasErrors() {
+		return nil, verr
+	}
+
+	if err := s.shopRepo.Create(ctx, shop); err != nil {
+		return nil, fmt.Errorf("failed to create shop: %w", err)
+	}
+	return shop, nil
+}
+
+// Update renames a shop, changes its PromptPay account or opens/closes it
+func (s *shopService) Update(ctx context.Context, shop *models.Shop) (*models.Shop, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	shop.Name = strings.TrimSpace(shop.Name)
+
+	verr := &ValidationError{}
+	if shop.Name == "" || len(shop.Name) > 100 {
+		verr.Add("name", "name must be 1-100 characters")
+	}
+	normalizePromptPayID(shop, verr)
+	if verr.HasErrors() {
+		return nil, verr
+	}
+
+	if err := s.shopRepo.Update(ctx, shop); err != nil {
+		return nil, fmt.Errorf("failed to update shop: %w", err)
+	}
+	return shop, nil
+}
+
+// normalizePromptPayID checks the shop's PromptPay account and stores it as
+// digits only; a blank account is cleared
+func normalizePromptPayID(shop *models.Shop, verr *ValidationError) {
+	if shop.PromptPayID == nil || strings.TrimSpace(*shop.PromptPayID) == "" {
+		shop.PromptPayID = nil
+		return
+	}
+	target, err := promptpay.ParseTarget(*shop.PromptPayID)
+	if err != nil {
+		verr.Add("promptpay_id", "promptpay_id must be a phone number, 13-digit national ID or 15-digit e-wallet ID")
+		return
+	}
+	shop.PromptPayID = &target.ID
+}
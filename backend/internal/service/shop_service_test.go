@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+	"github.com/tanasatit/barvidva-kasetfair/internal/repository/mocks"
+)
+
+func TestShopService_GetActive(t *testing.T) {
+	shopRepo := new(mocks.MockShopRepository)
+	shopRepo.On("GetAll", mock.Anything).Return([]models.Shop{
+		{ID: 1, Code: "Bar", Name: "Bar", Active: true},
+		{ID: 2, Code: "Vidva", Name: "Vidva", Active: false},
+	}, nil)
+
+	svc := NewShopService(shopRepo)
+	shops, err := svc.GetActive(context.Background())
+
+	assert.NoError(t, err)
+	assert.Len(t, shops, 1)
+	assert.Equal(t, "Bar", shops[0].Code)
+}
+
+func TestShopService_Create(t *testing.T) {
+	t.Run("Trims and creates", func(t *testing.T) {
+		shopRepo := new(mocks.MockShopRepository)
+		shopRepo.On("Create", mock.Anything, mock.MatchedBy(func(s *models.Shop) bool {
+			return s.Code == "Drinks" && s.Name == "Drinks Corner"
+		})).Return(nil)
+
+		svc := NewShopService(shopRepo)
+		shop, err := svc.Create(context.Background(), &models.Shop{Code: " Drinks ", Name: "Drinks Corner ", Active: true})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Drinks", shop.Code)
+		shopRepo.AssertExpectations(t)
+	})
+
+	t.Run("Reports invalid fields", func(t *testing.T) {
+		svc := NewShopService(new(mocks.MockShopRepository))
+		_, err := svc.Create(context.Background(), &models.Shop{Code: " ", Name: ""})
+
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Len(t, validationErr.Fields, 2)
+	})
+
+	t.Run("Normalizes the PromptPay account", func(t *testing.T) {
+		shopRepo := new(mocks.MockShopRepository)
+		shopRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		svc := NewShopService(shopRepo)
+		account := "081-234-5678"
+		shop, err := svc.Create(context.Background(), &models.Shop{Code: "Bar", Name: "Bar", PromptPayID: &account})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "0812345678", *shop.PromptPayID)
+	})
+
+	t.Run("Rejects an invalid PromptPay account", func(t *testing.T) {
+		svc := NewShopService(new(mocks.MockShopRepository))
+		account := "12345"
+		_, err := svc.Create(context.Background(), &models.Shop{Code: "Bar", Name: "Bar", PromptPayID: &account})
+
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "promptpay_id", validationErr.Fields[0].Field)
+	})
+
+	t.Run("Duplicate code", func(t *testing.T) {
+		shopRepo := new(mocks.MockShopRepository)
+		shopRepo.On("Create", mock.Anything, mock.Anything).Return(ErrDuplicate)
+
+		svc := NewShopService(shopRepo)
+		_, err := svc.Create(context.Background(), &models.Shop{Code: "Bar", Name: "Bar"})
+
+		assert.ErrorIs(t, err, ErrDuplicate)
+	})
+}
+
+func TestShopService_Update(t *testing.T) {
+	shopRepo := new(mocks.MockShopRepository)
+	shopRepo.On("Update", mock.Anything, mock.Anything).Return(ErrShopNotFound)
+
+	svc := NewShopService(shopRepo)
+	_, err := svc.Update(context.Background(), &models.Shop{ID: 99, Name: "Closed"})
+	assert.ErrorIs(t, err, ErrShopNotFound)
+
+	_, err = svc.Update(context.Background(), &models.Shop{ID: 1, Name: " "})
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+}
@@ -0,0 +1,42 @@
+package testutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tanasatit/barvidva-kasetfair/internal/models"
+)
+
+// FakePaymentProvider stands in for a bank or slip-verification provider
+// that pushes signed payment notifications (the format the signed payment
+// verifier accepts), so tests can simulate incoming PromptPay payments.
+type FakePaymentProvider struct {
+	Secret string
+	// Account is the PromptPay account its notifications report as paid to
+	Account string
+}
+
+// Notify returns the body and signature of a notification that reference
+// paid amount baht into p.Account, optionally naming the order it pays
+func (p FakePaymentProvider) Notify(t *testing.T, reference string, amount float64, orderID string) (body []byte, signature string) {
+	t.Helper()
+
+	body, err := json.Marshal(models.PaymentNotification{
+		Reference: reference,
+		Amount:    amount,
+		OrderID:   orderID,
+		Account:   p.Account,
+		PaidAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("failed to encode payment notification: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.Secret))
+	mac.Write(body)
+	return body, hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// BusinessClock determines which business day "now" belongs to.
+//
+// The booth runs on local (Asia/Bangkok) time and keeps serving after
+// midnight, so an order placed at 01:30 still belongs to the previous
+// business day when the rollover hour is later than 01:00. Every part of the
+// server that needs "today" (order creation, expiry, stats) must ask the
+// clock instead of calling time.Now() directly.
+type BusinessClock struct {
+	location     *time.Location
+	rolloverHour int
+	now          func() time.Time
+}
+
+// NewBusinessClock creates a clock for the named IANA timezone. rolloverHour
+// (0-23) is the local hour at which a new business day starts.
+func NewBusinessClock(timezone string, rolloverHour int) (*BusinessClock, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid business timezone %q: %w", timezone, err)
+	}
+	if rolloverHour < 0 || rolloverHour > 23 {
+		return nil, fmt.Errorf("rollover hour must be 0-23, got %d", rolloverHour)
+	}
+
+	return &BusinessClock{location: location, rolloverHour: rolloverHour, now: time.Now}, nil
+}
+
+// WithNow returns a copy of the clock that reads the current time from now.
+// Used by tests to pin the clock.
+func (c *BusinessClock) WithNow(now func() time.Time) *BusinessClock {
+	clone := *c
+	clone.now = now
+	return &clone
+}
+
+// Location returns the business timezone
+func (c *BusinessClock) Location() *time.Location {
+	return c.location
+}
+
+// Now returns the current instant
+func (c *BusinessClock) Now() time.Time {
+	return c.now()
+}
+
+// BusinessDate returns the business date t belongs to as midnight UTC
+func (c *BusinessClock) BusinessDate(t time.Time) time.Time {
+	local := t.In(c.location).Add(-time.Duration(c.rolloverHour) * time.Hour)
+	return DateOnly(local)
+}
+
+// Today returns the current business date as midnight UTC
+func (c *BusinessClock) Today() time.Time {
+	return c.BusinessDate(c.now())
+}
+
+// DateKey returns the current business date as DDMM
+func (c *BusinessClock) DateKey() int {
+	return GetDateKey(c.Today())
+}
+
+// DateOnly truncates t to its calendar date (in t's own location) as midnight UTC
+func DateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBusinessClock(t *testing.T) {
+	bangkok, err := time.LoadLocation("Asia/Bangkok")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		rolloverHour int
+		now          time.Time
+		want         time.Time
+	}{
+		{
+			name:         "Afternoon is the same day",
+			rolloverHour: 4,
+			now:          time.Date(2026, 1, 14, 15, 0, 0, 0, bangkok),
+			want:         time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "After midnight before rollover belongs to previous day",
+			rolloverHour: 4,
+			now:          time.Date(2026, 1, 15, 1, 30, 0, 0, bangkok),
+			want:         time.Date(2026, 1, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "At rollover hour a new day starts",
+			rolloverHour: 4,
+			now:          time.Date(2026, 1, 15, 4, 0, 0, 0, bangkok),
+			want:         time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "UTC evening is already the next Bangkok day",
+			rolloverHour: 0,
+			now:          time.Date(2026, 1, 14, 18, 0, 0, 0, time.UTC), // 01:00 Bangkok on the 15th
+			want:         time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "Rollover across New Year",
+			rolloverHour: 3,
+			now:          time.Date(2027, 1, 1, 2, 0, 0, 0, bangkok),
+			want:         time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock, err := NewBusinessClock("Asia/Bangkok", tt.rolloverHour)
+			assert.NoError(t, err)
+			clock = clock.WithNow(func() time.Time { return tt.now })
+
+			assert.Equal(t, tt.want, clock.Today())
+			assert.Equal(t, GetDateKey(tt.want), clock.DateKey())
+		})
+	}
+}
+
+func TestNewBusinessClock_Invalid(t *testing.T) {
+	_, err := NewBusinessClock("Mars/Olympus_Mons", 0)
+	assert.Error(t, err)
+
+	_, err = NewBusinessClock("Asia/Bangkok", 24)
+	assert.Error(t, err)
+
+	_, err = NewBusinessClock("Asia/Bangkok", -1)
+	assert.Error(t, err)
+}
@@ -6,37 +6,95 @@ import (
 	"time"
 )
 
+const (
+	// MaxOrderSequence is the highest sequence number a single day can issue.
+	// Sequences above 999 use the extended DDMMXXXX format.
+	MaxOrderSequence = 9999
+
+	// MaxOrderIDPrefixLength is the longest shop prefix an order ID may carry
+	MaxOrderIDPrefixLength = 3
+
+	// MaxOrderIDLength is the longest possible order ID: prefix + DDMM + XXXX
+	MaxOrderIDLength = MaxOrderIDPrefixLength + 4 + 4
+)
+
+// OrderIDScheme describes how order IDs are laid out.
+//
+// The default scheme produces DDMMXXX IDs and automatically widens to
+// DDMMXXXX once a day passes order 999, so the booth never has to stop
+// taking orders. A shop prefix (e.g. "B" -> "B1401001") can be configured
+// when several booths share one database.
+type OrderIDScheme struct {
+	// Prefix is an optional 1-3 letter (A-Z) shop prefix placed before DDMM
+	Prefix string
+	// SequenceDigits is the minimum zero-padded width of the sequence (3 or 4)
+	SequenceDigits int
+}
+
+// DefaultOrderIDScheme is the original DDMMXXX layout without a prefix
+var DefaultOrderIDScheme = OrderIDScheme{SequenceDigits: 3}
+
+// NewOrderIDScheme validates and returns an order ID scheme
+func NewOrderIDScheme(prefix string, sequenceDigits int) (OrderIDScheme, error) {
+	if len(prefix) > MaxOrderIDPrefixLength {
+		return OrderIDScheme{}, fmt.Errorf("prefix must be at most %d letters, got %q", MaxOrderIDPrefixLength, prefix)
+	}
+	for _, r := range prefix {
+		if r < 'A' || r > 'Z' {
+			return OrderIDScheme{}, fmt.Errorf("prefix must contain only letters A-Z, got %q", prefix)
+		}
+	}
+	if sequenceDigits != 3 && sequenceDigits != 4 {
+		return OrderIDScheme{}, fmt.Errorf("sequence digits must be 3 or 4, got %d", sequenceDigits)
+	}
+
+	return OrderIDScheme{Prefix: prefix, SequenceDigits: sequenceDigits}, nil
+}
+
+// Generate creates an order ID for the given day, month and sequence using this scheme
+func (s OrderIDScheme) Generate(dayOfMonth, month, sequence int) (string, error) {
+	if dayOfMonth < 1 || dayOfMonth > 31 {
+		return "", fmt.Errorf("day must be 1-31, got %d", dayOfMonth)
+	}
+	if month < 1 || month > 12 {
+		return "", fmt.Errorf("month must be 1-12, got %d", month)
+	}
+	if sequence < 1 || sequence > MaxOrderSequence {
+		return "", fmt.Errorf("sequence must be 1-%d, got %d", MaxOrderSequence, sequence)
+	}
+
+	digits := s.SequenceDigits
+	if digits == 0 {
+		digits = DefaultOrderIDScheme.SequenceDigits
+	}
+
+	// %0*d widens past the configured digits on overflow (999 -> 1000)
+	return fmt.Sprintf("%s%02d%02d%0*d", s.Prefix, dayOfMonth, month, digits, sequence), nil
+}
+
 // GenerateOrderID creates an order ID in DDMMXXX format.
 //
 // Format explanation:
 // - First 2 digits: Day of month (01-31)
 // - Next 2 digits: Month (01-12)
 // - Last 3 digits: Sequential order number (001-999)
+// - Orders 1000-9999 of a day use 4 sequence digits (DDMMXXXX)
 //
-// Example: "1401001" = January 14, Order 1
-//          "0702999" = February 7, Order 999
+// Example: "1401001"  = January 14, Order 1
+//          "0702999"  = February 7, Order 999
+//          "07021000" = February 7, Order 1000
 //
 // We use this format because:
 // 1. Staff can read and call out these numbers quickly
 // 2. Works for any date (not limited to 9-day event)
-// 3. Max capacity: 999 orders per day (sufficient for this booth)
+// 3. Busy days overflow to 4 digits instead of refusing orders
 // 4. Easy to identify which date an order belongs to
 //
 // Thread-safety: This function is pure and can be called from multiple
 // goroutines safely. The actual sequence number management happens in
 // the database with atomic increments.
 func GenerateOrderID(dayOfMonth, month, sequence int) (string, error) {
-	if dayOfMonth < 1 || dayOfMonth > 31 {
-		return "", fmt.Errorf("day must be 1-31, got %d", dayOfMonth)
-	}
-	if month < 1 || month > 12 {
-		return "", fmt.Errorf("month must be 1-12, got %d", month)
-	}
-	if sequence < 1 || sequence > 999 {
-		return "", fmt.Errorf("sequence must be 1-999, got %d", sequence)
-	}
-
-	return fmt.Sprintf("%02d%02d%03d", dayOfMonth, month, sequence), nil
+	return DefaultOrderIDScheme.Generate(dayOfMonth, month, sequence)
 }
 
 // GenerateOrderIDFromTime creates an order ID using current date
@@ -55,65 +113,48 @@ func GetCurrentDateKey() int {
 	return GetDateKey(time.Now())
 }
 
-// ValidateOrderIDFormat validates the order ID format (DDMMXXX)
+// ValidateOrderIDFormat validates the order ID format ([PREFIX]DDMMXXX or [PREFIX]DDMMXXXX)
 // expectedDateKey is DDMM format (e.g., 1401 for January 14)
 func ValidateOrderIDFormat(id string, expectedDateKey int) bool {
-	if len(id) != 7 {
-		return false
-	}
-
-	// Extract DDMM from order ID
-	dateKey, err := strconv.Atoi(id[0:4])
-	if err != nil || dateKey != expectedDateKey {
-		return false
-	}
-
-	// Validate day (DD) - first 2 digits
-	day, err := strconv.Atoi(id[0:2])
-	if err != nil || day < 1 || day > 31 {
-		return false
-	}
-
-	// Validate month (MM) - next 2 digits
-	month, err := strconv.Atoi(id[2:4])
-	if err != nil || month < 1 || month > 12 {
-		return false
-	}
-
-	// Validate sequence (XXX) - last 3 digits
-	seq, err := strconv.Atoi(id[4:7])
-	if err != nil || seq < 1 || seq > 999 {
+	dayOfMonth, month, _, err := ParseOrderID(id)
+	if err != nil {
 		return false
 	}
 
-	return true
+	return dayOfMonth*100+month == expectedDateKey
 }
 
-// ParseOrderID extracts day, month, and sequence from order ID
+// ParseOrderID extracts day, month, and sequence from order ID.
+// Accepts the original DDMMXXX format, the extended DDMMXXXX format and
+// either of them behind a shop prefix of up to 3 letters.
 func ParseOrderID(id string) (dayOfMonth int, month int, sequence int, err error) {
-	if len(id) != 7 {
-		return 0, 0, 0, fmt.Errorf("invalid order ID length: expected 7, got %d", len(id))
+	_, digits, err := splitOrderID(id)
+	if err != nil {
+		return 0, 0, 0, err
 	}
 
-	dayOfMonth, err = strconv.Atoi(id[0:2])
+	dayOfMonth, err = strconv.Atoi(digits[0:2])
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("invalid day in order ID: %s", id[0:2])
+		return 0, 0, 0, fmt.Errorf("invalid day in order ID: %s", digits[0:2])
 	}
 	if dayOfMonth < 1 || dayOfMonth > 31 {
 		return 0, 0, 0, fmt.Errorf("day out of range: %d", dayOfMonth)
 	}
 
-	month, err = strconv.Atoi(id[2:4])
+	month, err = strconv.Atoi(digits[2:4])
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("invalid month in order ID: %s", id[2:4])
+		return 0, 0, 0, fmt.Errorf("invalid month in order ID: %s", digits[2:4])
 	}
 	if month < 1 || month > 12 {
 		return 0, 0, 0, fmt.Errorf("month out of range: %d", month)
 	}
 
-	sequence, err = strconv.Atoi(id[4:7])
+	sequence, err = strconv.Atoi(digits[4:])
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("invalid sequence in order ID: %s", id[4:7])
+		return 0, 0, 0, fmt.Errorf("invalid sequence in order ID: %s", digits[4:])
+	}
+	if sequence < 1 {
+		return 0, 0, 0, fmt.Errorf("sequence out of range: %d", sequence)
 	}
 
 	return dayOfMonth, month, sequence, nil
@@ -121,14 +162,47 @@ func ParseOrderID(id string) (dayOfMonth int, month int, sequence int, err error
 
 // GetDateKeyFromOrderID extracts DDMM from order ID as integer
 func GetDateKeyFromOrderID(id string) (int, error) {
-	if len(id) != 7 {
-		return 0, fmt.Errorf("invalid order ID length")
+	_, digits, err := splitOrderID(id)
+	if err != nil {
+		return 0, err
 	}
 
-	dateKey, err := strconv.Atoi(id[0:4])
+	dateKey, err := strconv.Atoi(digits[0:4])
 	if err != nil {
 		return 0, fmt.Errorf("invalid date in order ID")
 	}
 
 	return dateKey, nil
 }
+
+// splitOrderID separates the optional letter prefix from the numeric
+// DDMMXXX / DDMMXXXX part and checks the overall length
+func splitOrderID(id string) (prefix string, digits string, err error) {
+	i := 0
+	for i < len(id) && id[i] >= 'A' && id[i] <= 'Z' {
+		i++
+	}
+	if i > MaxOrderIDPrefixLength {
+		return "", "", fmt.Errorf("invalid order ID prefix: %s", id[:i])
+	}
+
+	prefix, digits = id[:i], id[i:]
+	if len(digits) != 7 && len(digits) != 8 {
+		return "", "", fmt.Errorf("invalid order ID length: expected 7 or 8 digits, got %d", len(digits))
+	}
+	if !isDigits(digits) {
+		return "", "", fmt.Errorf("invalid characters in order ID: %s", id)
+	}
+
+	return prefix, digits, nil
+}
+
+// isDigits reports whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
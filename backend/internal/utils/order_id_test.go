@@ -105,10 +105,26 @@ func TestGenerateOrderID(t *testing.T) {
 			wantErr:    true,
 		},
 		{
-			name:       "Invalid sequence 1000",
+			name:       "Order 1000 overflows to DDMMXXXX",
 			dayOfMonth: 1,
 			month:      1,
 			sequence:   1000,
+			want:       "01011000",
+			wantErr:    false,
+		},
+		{
+			name:       "Order 9999 is the daily maximum",
+			dayOfMonth: 14,
+			month:      1,
+			sequence:   9999,
+			want:       "14019999",
+			wantErr:    false,
+		},
+		{
+			name:       "Invalid sequence 10000",
+			dayOfMonth: 1,
+			month:      1,
+			sequence:   10000,
 			want:       "",
 			wantErr:    true,
 		},
@@ -212,6 +228,30 @@ func TestValidateOrderIDFormat(t *testing.T) {
 			expectedDateKey: 3112,
 			want:            true,
 		},
+		{
+			name:            "Valid extended ID",
+			id:              "14011000",
+			expectedDateKey: 1401,
+			want:            true,
+		},
+		{
+			name:            "Valid prefixed ID",
+			id:              "B1401001",
+			expectedDateKey: 1401,
+			want:            true,
+		},
+		{
+			name:            "Prefix too long",
+			id:              "ABCD1401001",
+			expectedDateKey: 1401,
+			want:            false,
+		},
+		{
+			name:            "Lowercase prefix",
+			id:              "b1401001",
+			expectedDateKey: 1401,
+			want:            false,
+		},
 		{
 			name:            "Valid ID February 7",
 			id:              "0702500",
@@ -232,7 +272,7 @@ func TestValidateOrderIDFormat(t *testing.T) {
 		},
 		{
 			name:            "Too long",
-			id:              "14010001",
+			id:              "140100001",
 			expectedDateKey: 1401,
 			want:            false,
 		},
@@ -313,6 +353,38 @@ func TestParseOrderID(t *testing.T) {
 			wantSequence: 1,
 			wantErr:      false,
 		},
+		{
+			name:         "Parse extended 14011000",
+			id:           "14011000",
+			wantDay:      14,
+			wantMonth:    1,
+			wantSequence: 1000,
+			wantErr:      false,
+		},
+		{
+			name:         "Parse 4-digit scheme 14010001",
+			id:           "14010001",
+			wantDay:      14,
+			wantMonth:    1,
+			wantSequence: 1,
+			wantErr:      false,
+		},
+		{
+			name:         "Parse prefixed KF1401042",
+			id:           "KF1401042",
+			wantDay:      14,
+			wantMonth:    1,
+			wantSequence: 42,
+			wantErr:      false,
+		},
+		{
+			name:         "Sign character rejected",
+			id:           "+101001",
+			wantDay:      0,
+			wantMonth:    0,
+			wantSequence: 0,
+			wantErr:      true,
+		},
 		{
 			name:         "Parse 3112999",
 			id:           "3112999",
@@ -339,7 +411,7 @@ func TestParseOrderID(t *testing.T) {
 		},
 		{
 			name:         "Too long",
-			id:           "14010001",
+			id:           "140100001",
 			wantDay:      0,
 			wantMonth:    0,
 			wantSequence: 0,
@@ -459,7 +531,7 @@ func TestGetDateKeyFromOrderID(t *testing.T) {
 		},
 		{
 			name:    "Too long",
-			id:      "14010001",
+			id:      "140100001",
 			want:    0,
 			wantErr: true,
 		},
@@ -483,3 +555,64 @@ func TestGetDateKeyFromOrderID(t *testing.T) {
 		})
 	}
 }
+
+func TestNewOrderIDScheme(t *testing.T) {
+	tests := []struct {
+		name           string
+		prefix         string
+		sequenceDigits int
+		wantErr        bool
+	}{
+		{name: "Default layout", prefix: "", sequenceDigits: 3, wantErr: false},
+		{name: "Prefix with 4 digits", prefix: "KF", sequenceDigits: 4, wantErr: false},
+		{name: "Prefix too long", prefix: "ABCD", sequenceDigits: 3, wantErr: true},
+		{name: "Prefix with digit", prefix: "A1", sequenceDigits: 3, wantErr: true},
+		{name: "Lowercase prefix", prefix: "kf", sequenceDigits: 3, wantErr: true},
+		{name: "Two digits not allowed", prefix: "", sequenceDigits: 2, wantErr: true},
+		{name: "Five digits not allowed", prefix: "", sequenceDigits: 5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, err := NewOrderIDScheme(tt.prefix, tt.sequenceDigits)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.prefix, scheme.Prefix)
+				assert.Equal(t, tt.sequenceDigits, scheme.SequenceDigits)
+			}
+		})
+	}
+}
+
+func TestOrderIDScheme_Generate(t *testing.T) {
+	tests := []struct {
+		name     string
+		scheme   OrderIDScheme
+		sequence int
+		want     string
+	}{
+		{name: "Default scheme", scheme: DefaultOrderIDScheme, sequence: 7, want: "1401007"},
+		{name: "Zero value uses default width", scheme: OrderIDScheme{}, sequence: 7, want: "1401007"},
+		{name: "Four digit scheme", scheme: OrderIDScheme{SequenceDigits: 4}, sequence: 7, want: "14010007"},
+		{name: "Prefixed scheme", scheme: OrderIDScheme{Prefix: "B", SequenceDigits: 3}, sequence: 7, want: "B1401007"},
+		{name: "Prefixed overflow", scheme: OrderIDScheme{Prefix: "KF", SequenceDigits: 3}, sequence: 1234, want: "KF14011234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.scheme.Generate(14, 1, tt.sequence)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.LessOrEqual(t, len(got), MaxOrderIDLength)
+
+			// Every generated ID must round-trip through the parser
+			day, month, seq, err := ParseOrderID(got)
+			assert.NoError(t, err)
+			assert.Equal(t, 14, day)
+			assert.Equal(t, 1, month)
+			assert.Equal(t, tt.sequence, seq)
+		})
+	}
+}
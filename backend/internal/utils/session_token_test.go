@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
+func TestSessionSigner(t *testing.T) {
+	signer, err := NewSessionSigner(testSessionSecret)
+	assert.NoError(t, err)
+
+	now := time.Date(2026, 1, 14, 12, 0, 0, 0, time.UTC)
+	claims := SessionClaims{SessionID: "abc123", UserID: 7, ExpiresAt: now.Add(time.Hour)}
+	token := signer.Sign(claims)
+
+	got, err := signer.Verify(token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, claims, got)
+
+	// Expired
+	_, err = signer.Verify(token, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	// Signed with another secret
+	other, err := NewSessionSigner(strings.Repeat("x", 32))
+	assert.NoError(t, err)
+	_, err = other.Verify(token, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Tampered payload: claim a different user with the original signature
+	forged := SessionClaims{SessionID: "abc123", UserID: 1, ExpiresAt: claims.ExpiresAt}
+	_, sig, _ := strings.Cut(token, ".")
+	payload, _, _ := strings.Cut(signer.Sign(forged), ".")
+	_, err = signer.Verify(payload+"."+sig, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	for _, bad := range []string{"", "not-a-token", "a.b", "staff_password"} {
+		_, err = signer.Verify(bad, now)
+		assert.ErrorIs(t, err, ErrInvalidToken, bad)
+	}
+}
+
+func TestNewSessionSigner_ShortSecret(t *testing.T) {
+	_, err := NewSessionSigner("too-short")
+	assert.Error(t, err)
+}
@@ -0,0 +1,19 @@
+-- Migration 007: Add per-day order sequence counter
+-- Created: 2026-02-02
+--
+-- Replaces the MAX(id)+1 lookup with a counter row per date_key that is
+-- incremented atomically inside the order insert transaction, so concurrent
+-- POS terminals can never be handed the same DDMMXXX order ID.
+
+CREATE TABLE IF NOT EXISTS order_sequences (
+    date_key INTEGER PRIMARY KEY CHECK (date_key >= 101 AND date_key <= 3112),
+    last_seq INTEGER NOT NULL DEFAULT 0 CHECK (last_seq >= 0)
+);
+
+-- Backfill counters from existing orders so new IDs continue after the
+-- highest sequence already issued for each day
+INSERT INTO order_sequences (date_key, last_seq)
+SELECT date_key, MAX(CAST(SUBSTRING(id, 5) AS INTEGER))
+FROM orders
+GROUP BY date_key
+ON CONFLICT (date_key) DO UPDATE SET last_seq = GREATEST(order_sequences.last_seq, EXCLUDED.last_seq);
@@ -0,0 +1,17 @@
+-- Migration 008: Track queue numbers in the per-day counter
+-- Created: 2026-02-02
+--
+-- Queue numbers were assigned with MAX(queue_number)+1 in a separate statement
+-- from the PAID update, so two cashiers could hand out the same number.
+-- The counter row is now incremented inside the payment transaction.
+
+ALTER TABLE order_sequences ADD COLUMN IF NOT EXISTS last_queue INTEGER NOT NULL DEFAULT 0 CHECK (last_queue >= 0);
+
+-- Backfill from queue numbers already handed out
+INSERT INTO order_sequences (date_key, last_queue)
+SELECT date_key, MAX(queue_number)
+FROM orders
+WHERE queue_number IS NOT NULL
+GROUP BY date_key
+ON CONFLICT (date_key) DO UPDATE SET last_queue = GREATEST(order_sequences.last_queue, EXCLUDED.last_queue);
+
@@ -0,0 +1,17 @@
+-- Migration 009: Allow extended and prefixed order IDs
+-- Created: 2026-02-03
+--
+-- Order IDs may now be DDMMXXXX (orders 1000-9999 of a day) and may carry
+-- a 1-3 letter shop prefix, so the longest ID is 11 characters.
+-- Existing DDMMXXX IDs are unchanged and remain valid.
+
+-- Step 1: Drop the foreign key so both columns can be widened
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_order_id_fkey;
+
+-- Step 2: Widen orders.id and order_items.order_id
+ALTER TABLE orders ALTER COLUMN id TYPE VARCHAR(11);
+ALTER TABLE order_items ALTER COLUMN order_id TYPE VARCHAR(11);
+
+-- Step 3: Re-add foreign key constraint
+ALTER TABLE order_items ADD CONSTRAINT order_items_order_id_fkey
+    FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE;
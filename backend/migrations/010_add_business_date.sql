@@ -0,0 +1,100 @@
+-- Migration 010: Key orders on a full business date (year included)
+-- Created: 2026-02-04
+--
+-- orders.id (DDMMXXX) repeats every year, so next year's fair would collide
+-- with this year's orders. Orders now carry business_date and are unique on
+-- (business_date, id); the DDMMXXX code stays as the human-readable number
+-- called out at the counter.
+--
+-- Changes:
+-- 1. Add and backfill orders.business_date / order_items.business_date
+-- 2. Replace the orders primary key with (business_date, id)
+-- 3. Re-point the order_items foreign key at (business_date, order_id)
+-- 4. Re-key order_sequences on business_date
+
+-- Step 1: Add business_date to orders and backfill it from date_key plus a
+-- year. The business day an order was created in is taken as Bangkok time
+-- (created_at is stored in UTC) less 4 hours, so an order taken at 02:00 on
+-- 1 January still belongs to 31 December. The timezone and the 4-hour
+-- rollover are fixed here, as they were when this migration was written.
+-- Like utils.BusinessDateForDateKey, the year is the one of the previous,
+-- same or next year that puts date_key nearest to that business day, so
+-- codes taken from the calendar date around midnight land on the right year.
+-- A date_key that exists in none of them (29 February with no leap year
+-- nearby) is kept on the last day of its month.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS business_date DATE;
+
+WITH local AS (
+    SELECT
+        id,
+        date_key / 100 AS day,
+        date_key % 100 AS month,
+        ((created_at AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Bangkok') - INTERVAL '4 hours')::date AS business_day
+    FROM orders
+    WHERE business_date IS NULL
+), resolved AS (
+    SELECT
+        l.id,
+        COALESCE(
+            (
+                SELECT make_date(y, l.month, LEAST(l.day, m.last_day))
+                FROM generate_series(EXTRACT(YEAR FROM l.business_day)::int - 1, EXTRACT(YEAR FROM l.business_day)::int + 1) AS y,
+                    LATERAL (SELECT EXTRACT(DAY FROM make_date(y, l.month, 1) + INTERVAL '1 month - 1 day')::int AS last_day) m
+                WHERE l.day <= m.last_day
+                ORDER BY abs(make_date(y, l.month, LEAST(l.day, m.last_day)) - l.business_day), y
+                LIMIT 1
+            ),
+            (make_date(EXTRACT(YEAR FROM l.business_day)::int, l.month, 1) + INTERVAL '1 month - 1 day')::date
+        ) AS business_date
+    FROM local l
+)
+UPDATE orders o
+SET business_date = r.business_date
+FROM resolved r
+WHERE o.id = r.id AND o.business_date IS NULL;
+
+ALTER TABLE orders ALTER COLUMN business_date SET NOT NULL;
+
+-- Step 2: Add business_date to order_items and backfill from the parent order
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS business_date DATE;
+
+UPDATE order_items oi
+SET business_date = o.business_date
+FROM orders o
+WHERE o.id = oi.order_id AND oi.business_date IS NULL;
+
+ALTER TABLE order_items ALTER COLUMN business_date SET NOT NULL;
+
+-- Step 3: Drop constraints that depend on orders.id alone
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_order_id_fkey;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_date_key_id_key;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_pkey;
+
+-- Step 4: New primary key and foreign key on (business_date, id)
+ALTER TABLE orders ADD CONSTRAINT orders_pkey PRIMARY KEY (business_date, id);
+ALTER TABLE order_items ADD CONSTRAINT order_items_order_fkey
+    FOREIGN KEY (business_date, order_id) REFERENCES orders(business_date, id) ON DELETE CASCADE;
+
+-- Lookups by order code alone resolve to the most recent business date
+CREATE INDEX IF NOT EXISTS idx_orders_id_business_date ON orders(id, business_date DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_business_date ON orders(business_date);
+DROP INDEX IF EXISTS idx_order_items_order_id;
+CREATE INDEX IF NOT EXISTS idx_order_items_order ON order_items(business_date, order_id);
+
+-- Step 5: Re-key the per-day counters on business_date, rebuilt from the
+-- orders that exist (sequence = digits after the optional prefix and DDMM)
+DROP TABLE IF EXISTS order_sequences;
+
+CREATE TABLE order_sequences (
+    business_date DATE PRIMARY KEY,
+    last_seq INTEGER NOT NULL DEFAULT 0 CHECK (last_seq >= 0),
+    last_queue INTEGER NOT NULL DEFAULT 0 CHECK (last_queue >= 0)
+);
+
+INSERT INTO order_sequences (business_date, last_seq, last_queue)
+SELECT
+    business_date,
+    MAX(CAST(SUBSTRING(REGEXP_REPLACE(id, '^[A-Z]*', '') FROM 5) AS INTEGER)),
+    COALESCE(MAX(queue_number), 0)
+FROM orders
+GROUP BY business_date;
@@ -0,0 +1,7 @@
+-- Migration 011: Track when an order is ready for pickup
+-- Created: 2026-02-05
+--
+-- Orders now move PAID -> READY -> COMPLETED. ready_at separates kitchen
+-- prep time (paid_at -> ready_at) from pickup wait (ready_at -> completed_at).
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ready_at TIMESTAMP;
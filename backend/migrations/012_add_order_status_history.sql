@@ -0,0 +1,20 @@
+-- Migration 012: Audit every order status change
+-- Created: 2026-02-06
+--
+-- Each transition made by the order state machine (paid, ready, completed,
+-- cancelled, expired) is recorded with who made it and why.
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id VARCHAR(11) NOT NULL,
+    business_date DATE NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+    CONSTRAINT order_status_history_order_fkey
+        FOREIGN KEY (business_date, order_id) REFERENCES orders(business_date, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history(business_date, order_id, id);
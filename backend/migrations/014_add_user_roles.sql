@@ -0,0 +1,13 @@
+-- Migration 014: Role-based permissions
+-- Created: 2026-02-09
+--
+-- The two account types (staff, admin) become roles with their own
+-- permission sets: cashier, kitchen, shop-manager and owner. Existing
+-- accounts keep what they could do before.
+
+UPDATE users SET role = 'cashier' WHERE role = 'staff';
+UPDATE users SET role = 'owner' WHERE role = 'admin';
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('cashier', 'kitchen', 'shop-manager', 'owner'));
@@ -0,0 +1,47 @@
+-- Migration 015: Shops as first-class tenants
+-- Created: 2026-02-10
+--
+-- Until now a "shop" was only the category string on menu items and orders.
+-- Shops get their own table (code = the category used so far), menu items
+-- and orders are bound to one, and staff accounts are bound to the shops they
+-- work at so the API can scope everything to the caller's shops.
+
+CREATE TABLE IF NOT EXISTS shops (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+    updated_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+-- One shop per category in use
+INSERT INTO shops (code, name)
+SELECT DISTINCT category, category
+FROM (
+    SELECT category FROM menu_items
+    UNION
+    SELECT category FROM orders
+) c
+WHERE category IS NOT NULL AND category != ''
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS shop_id INTEGER REFERENCES shops(id);
+UPDATE menu_items m SET shop_id = s.id FROM shops s WHERE m.shop_id IS NULL AND s.code = m.category;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shop_id INTEGER REFERENCES shops(id);
+UPDATE orders o SET shop_id = s.id FROM shops s WHERE o.shop_id IS NULL AND s.code = o.category;
+
+CREATE INDEX IF NOT EXISTS idx_menu_items_shop ON menu_items(shop_id);
+CREATE INDEX IF NOT EXISTS idx_orders_shop_status ON orders(shop_id, status);
+
+CREATE TABLE IF NOT EXISTS user_shops (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    shop_id INTEGER NOT NULL REFERENCES shops(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, shop_id)
+);
+
+-- Existing accounts keep access to every shop
+INSERT INTO user_shops (user_id, shop_id)
+SELECT u.id, s.id FROM users u CROSS JOIN shops s
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,43 @@
+-- Migration 016: Per-shop tickets for orders spanning several shops
+-- Created: 2026-02-11
+--
+-- A customer buying fries and a drink pays once, but each shop prepares and
+-- hands over its own part. Such an order gets one ticket per shop, each with
+-- its own queue number and READY/COMPLETED lifecycle; the order follows its
+-- tickets (READY once all are ready, COMPLETED once all are picked up).
+-- Orders from a single shop have no tickets and work as before.
+--
+-- Changes:
+-- 1. order_items.shop_id records which shop prepares each line
+-- 2. order_tickets holds the per-shop status and queue number
+-- 3. order_status_history.shop_id marks transitions of a single ticket
+
+-- Step 1: Shop of each order line, backfilled from the menu
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS shop_id INTEGER REFERENCES shops(id);
+
+UPDATE order_items oi
+SET shop_id = m.shop_id
+FROM menu_items m
+WHERE oi.shop_id IS NULL AND m.id = oi.menu_item_id;
+
+-- Step 2: Tickets
+CREATE TABLE IF NOT EXISTS order_tickets (
+    order_id VARCHAR(11) NOT NULL,
+    business_date DATE NOT NULL,
+    shop_id INTEGER NOT NULL REFERENCES shops(id),
+    category VARCHAR(50),
+    status VARCHAR(20) NOT NULL
+        CHECK (status IN ('PENDING_PAYMENT', 'PAID', 'READY', 'COMPLETED', 'CANCELLED')),
+    queue_number INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+    ready_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    PRIMARY KEY (business_date, order_id, shop_id),
+    CONSTRAINT order_tickets_order_fkey
+        FOREIGN KEY (business_date, order_id) REFERENCES orders(business_date, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_tickets_status ON order_tickets(status, shop_id);
+
+-- Step 3: Ticket transitions in the order history (NULL = the whole order)
+ALTER TABLE order_status_history ADD COLUMN IF NOT EXISTS shop_id INTEGER REFERENCES shops(id);
@@ -0,0 +1,22 @@
+-- Migration 017: Idempotency keys for retried POS requests
+-- Created: 2026-02-12
+--
+-- Tablets on the fair Wi-Fi retry requests whose response got lost, which
+-- created duplicate orders. Clients may send an Idempotency-Key header on
+-- order creation and status changes; the first request with a key stores a
+-- fingerprint of the request and, once it succeeds, the response. Retries
+-- with the same key get the stored response instead of running again.
+--
+-- status_code/response stay NULL while the first request is still running.
+-- Rows past expires_at may be reused and are purged periodically.
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    fingerprint CHAR(64) NOT NULL,
+    status_code INTEGER,
+    response BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
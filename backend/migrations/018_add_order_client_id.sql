@@ -0,0 +1,12 @@
+-- Migration 018: Client IDs for orders synced from offline tablets
+-- Created: 2026-02-13
+--
+-- A POS tablet that loses its connection keeps taking orders and uploads
+-- them in a batch once it is back online. Each order carries a UUID chosen
+-- by the tablet; storing it lets the server recognise a batch that is sent
+-- again (e.g. the response to the first upload got lost) instead of
+-- creating the orders twice. Orders taken online have no client ID.
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS client_id VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_client_id ON orders(client_id) WHERE client_id IS NOT NULL;
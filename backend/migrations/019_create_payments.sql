@@ -0,0 +1,41 @@
+-- Migration 019: Payments ledger
+-- Created: 2026-02-14
+--
+-- Until now paying an order only set orders.payment_method. Every payment is
+-- now a row in payments: how much of the order it covers, how it was paid,
+-- what the customer handed over and the change given back, an optional
+-- reference (e.g. the PromptPay transaction) and who took it. An order can
+-- be paid in several parts, e.g. partly in cash and partly by PromptPay; it
+-- becomes PAID once its payments cover total_amount. Revenue in the stats is
+-- read from this ledger.
+--
+-- orders.payment_method is kept for existing clients: the method of the
+-- largest payment.
+
+CREATE TABLE IF NOT EXISTS payments (
+    id BIGSERIAL PRIMARY KEY,
+    order_id VARCHAR(11) NOT NULL,
+    business_date DATE NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    method VARCHAR(20) CHECK (method IN ('PROMPTPAY', 'CASH')),
+    received DECIMAL(10,2) NOT NULL,
+    change_given DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (change_given >= 0),
+    reference VARCHAR(100),
+    actor VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+    CONSTRAINT payments_order_fkey
+        FOREIGN KEY (business_date, order_id) REFERENCES orders(business_date, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(business_date, order_id);
+
+-- Orders paid so far get one payment for their full amount. Orders paid
+-- before payment methods were recorded keep a NULL method.
+INSERT INTO payments (order_id, business_date, amount, method, received, actor, created_at)
+SELECT o.id, o.business_date, o.total_amount, o.payment_method, o.total_amount, 'migration', COALESCE(o.paid_at, o.created_at)
+FROM orders o
+WHERE o.status IN ('PAID', 'READY', 'COMPLETED')
+    AND o.total_amount > 0
+    AND NOT EXISTS (
+        SELECT 1 FROM payments p WHERE p.order_id = o.id AND p.business_date = o.business_date
+    );
@@ -0,0 +1,9 @@
+-- Migration 020: PromptPay account per shop
+-- Created: 2026-02-15
+--
+-- PromptPay QR codes are now generated by the server for the amount it
+-- computed, paid to the shop's own account: a phone number, 13-digit
+-- national/tax ID or 15-digit e-wallet ID (digits only). Shops without one,
+-- and orders spanning several shops, use the PROMPTPAY_ID account.
+
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS promptpay_id VARCHAR(15);
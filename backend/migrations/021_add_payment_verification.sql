@@ -0,0 +1,14 @@
+-- Migration 021: Payments confirmed by a payment provider
+-- Created: 2026-02-16
+--
+-- Payments can now be confirmed by a bank or slip-verification provider,
+-- either through a signed payment notification (webhook) or by looking up
+-- the transaction reference a cashier entered. verified_by names the
+-- provider. A provider's transaction can only be recorded once, so a
+-- redelivered notification or a reused slip doesn't pay a second order.
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS verified_by VARCHAR(50);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_verified_reference
+    ON payments(verified_by, reference)
+    WHERE verified_by IS NOT NULL;
@@ -0,0 +1,39 @@
+-- Migration 022: Refunds
+-- Created: 2026-02-17
+--
+-- A paid order can be refunded when the customer changes their mind or the
+-- kitchen runs out: either entirely or some of its items. Each refund is a
+-- row in refunds with the amount given back, how it was given back and why;
+-- refund_items lists the order items (and how many of each) it covered.
+-- An order stays PAID or READY while only part of it is refunded and becomes
+-- REFUNDED, along with its tickets, once everything is. Revenue in the stats
+-- is net of refunds.
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP;
+
+ALTER TABLE order_tickets DROP CONSTRAINT IF EXISTS order_tickets_status_check;
+ALTER TABLE order_tickets ADD CONSTRAINT order_tickets_status_check
+    CHECK (status IN ('PENDING_PAYMENT', 'PAID', 'READY', 'COMPLETED', 'CANCELLED', 'REFUNDED'));
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id BIGSERIAL PRIMARY KEY,
+    order_id VARCHAR(11) NOT NULL,
+    business_date DATE NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    method VARCHAR(20) CHECK (method IN ('PROMPTPAY', 'CASH')),
+    reason TEXT NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+    CONSTRAINT refunds_order_fkey
+        FOREIGN KEY (business_date, order_id) REFERENCES orders(business_date, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_order ON refunds(business_date, order_id);
+
+CREATE TABLE IF NOT EXISTS refund_items (
+    refund_id BIGINT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    amount DECIMAL(10,2) NOT NULL,
+    PRIMARY KEY (refund_id, order_item_id)
+);
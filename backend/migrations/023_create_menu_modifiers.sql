@@ -0,0 +1,46 @@
+-- Migration 023: Modifier groups on menu items
+-- Created: 2026-02-18
+--
+-- A menu item can offer choices such as size, sweetness or extra toppings.
+-- Each choice is a modifier in a modifier group; a group is required or
+-- optional and limits how many of its modifiers may be picked. A modifier
+-- adds (or takes off) its price_delta to the item's price.
+-- The modifiers picked on an order line are stored in order_item_modifiers
+-- with their group, name and price at the time, so editing the menu later
+-- does not change past orders. order_items.price stays the unit price
+-- including the modifiers.
+
+CREATE TABLE IF NOT EXISTS modifier_groups (
+    id SERIAL PRIMARY KEY,
+    menu_item_id INTEGER NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT false,
+    min_select INTEGER NOT NULL DEFAULT 0 CHECK (min_select >= 0),
+    max_select INTEGER NOT NULL DEFAULT 1 CHECK (max_select >= 1),
+    position INTEGER NOT NULL DEFAULT 0,
+    CHECK (min_select <= max_select)
+);
+
+CREATE INDEX IF NOT EXISTS idx_modifier_groups_menu_item ON modifier_groups(menu_item_id);
+
+CREATE TABLE IF NOT EXISTS modifiers (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES modifier_groups(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    price_delta DECIMAL(10,2) NOT NULL DEFAULT 0,
+    available BOOLEAN NOT NULL DEFAULT true,
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_modifiers_group ON modifiers(group_id);
+
+-- modifier_id has no foreign key: modifiers can be removed from the menu
+-- while orders that picked them are kept
+CREATE TABLE IF NOT EXISTS order_item_modifiers (
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    modifier_id INTEGER NOT NULL,
+    group_name VARCHAR(50) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    price_delta DECIMAL(10,2) NOT NULL,
+    PRIMARY KEY (order_item_id, modifier_id)
+);
@@ -0,0 +1,33 @@
+-- Migration 024: Bundles (set meals)
+-- Created: 2026-02-19
+--
+-- A bundle is a menu item sold at its own price that is made up of other
+-- menu items, e.g. a "fries + drink" set. Its bundle_slots are the parts of
+-- the set (Main, Drink); each slot offers one or more component items in
+-- bundle_options, where an option may cost extra (price_delta). A slot with
+-- a single option is a fixed part of the set.
+-- On an order, a bundle line keeps the bundle price and is followed by one
+-- line per component (price 0) pointing back at it through bundle_item_id,
+-- so kitchens see the items they make and per-item counts include sets.
+
+CREATE TABLE IF NOT EXISTS bundle_slots (
+    id SERIAL PRIMARY KEY,
+    bundle_id INTEGER NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity >= 1 AND quantity <= 10),
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_bundle_slots_bundle ON bundle_slots(bundle_id);
+
+CREATE TABLE IF NOT EXISTS bundle_options (
+    slot_id INTEGER NOT NULL REFERENCES bundle_slots(id) ON DELETE CASCADE,
+    menu_item_id INTEGER NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    price_delta DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (price_delta >= 0),
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (slot_id, menu_item_id)
+);
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS bundle_item_id INTEGER REFERENCES order_items(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_order_items_bundle_item ON order_items(bundle_item_id);
@@ -0,0 +1,35 @@
+-- Migration 025: Inventory
+-- Created: 2026-02-20
+--
+-- Stock can be counted per menu item (menu_items.stock, NULL when the item
+-- isn't tracked) or per ingredient, with recipe_items saying how much of
+-- each ingredient one of the item uses. Unpaid orders hold stock; it is
+-- taken off when an order is paid, so orders that are cancelled or expire
+-- before payment give back what they held. An item whose stock, or one of
+-- whose ingredients, runs out is made unavailable and sold_out_at is set;
+-- it becomes available again once restocked. low_stock_threshold flags
+-- stock running low in the inventory listing.
+
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS stock INTEGER CHECK (stock >= 0);
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS low_stock_threshold INTEGER CHECK (low_stock_threshold >= 0);
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS sold_out_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS ingredients (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    unit VARCHAR(20) NOT NULL DEFAULT '',
+    shop_id INTEGER REFERENCES shops(id),
+    stock DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    low_stock_threshold DECIMAL(10,2) CHECK (low_stock_threshold >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+    updated_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+CREATE TABLE IF NOT EXISTS recipe_items (
+    menu_item_id INTEGER NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    ingredient_id INTEGER NOT NULL REFERENCES ingredients(id) ON DELETE CASCADE,
+    quantity DECIMAL(10,2) NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (menu_item_id, ingredient_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recipe_items_ingredient ON recipe_items(ingredient_id);
@@ -0,0 +1,20 @@
+-- Migration 026: Payment notifications
+-- Created: 2026-02-21
+--
+-- A cashier can record a PromptPay payment with the transaction reference
+-- from the customer's slip; it must match a notification from the payment
+-- provider. The signed-notification provider has no API to look payments
+-- up, so every notification it pushes is kept here, where all instances can
+-- find it, including after a restart. A redelivered notification keeps the
+-- first copy.
+
+CREATE TABLE IF NOT EXISTS payment_notifications (
+    provider VARCHAR(50) NOT NULL,
+    reference VARCHAR(100) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    order_id VARCHAR(100),
+    account VARCHAR(100),
+    paid_at TIMESTAMP,
+    received_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+    PRIMARY KEY (provider, reference)
+);
@@ -0,0 +1,176 @@
+// Package promptpay builds Thai PromptPay QR payloads following the EMVCo
+// merchant-presented QR specification, as scanned by Thai banking apps.
+package promptpay
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TargetType is the kind of PromptPay account money is sent to
+type TargetType string
+
+const (
+	TargetPhone      TargetType = "PHONE"       // mobile number, e.g. 0812345678
+	TargetNationalID TargetType = "NATIONAL_ID" // 13-digit national ID or tax ID
+	TargetEWallet    TargetType = "EWALLET"     // 15-digit e-wallet ID
+)
+
+// ErrInvalidTarget is returned for account IDs that are not a phone number,
+// national ID or e-wallet ID
+var ErrInvalidTarget = errors.New("invalid PromptPay account")
+
+// EMVCo tags used in a PromptPay payload
+const (
+	tagPayloadFormat    = "00"
+	tagInitiationMethod = "01"
+	tagMerchantAccount  = "29"
+	tagCurrency         = "53"
+	tagAmount           = "54"
+	tagCountry          = "58"
+	tagCRC              = "63"
+
+	// Sub-tags of the merchant account (29)
+	subTagAID        = "00"
+	subTagPhone      = "01"
+	subTagNationalID = "02"
+	subTagEWallet    = "03"
+
+	payloadFormat = "01"
+	staticQR      = "11" // reusable, the payer types the amount
+	dynamicQR     = "12" // carries the amount
+	promptPayAID  = "A000000677010111"
+	currencyTHB   = "764"
+	countryTH     = "TH"
+)
+
+// Target is a PromptPay account
+type Target struct {
+	Type TargetType
+	ID   string // digits only
+}
+
+// ParseTarget reads an account ID, ignoring spaces, dashes and other
+// separators. The kind is told by its length: 15 digits is an e-wallet, 13 a
+// national ID, and 10 (starting with 0) or 11 (starting with 66) a phone
+// number.
+func ParseTarget(account string) (Target, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, account)
+
+	switch {
+	case len(digits) == 15:
+		return Target{Type: TargetEWallet, ID: digits}, nil
+	case len(digits) == 13:
+		return Target{Type: TargetNationalID, ID: digits}, nil
+	case len(digits) == 10 && digits[0] == '0',
+		len(digits) == 11 && strings.HasPrefix(digits, "66"):
+		return Target{Type: TargetPhone, ID: digits}, nil
+	default:
+		return Target{}, fmt.Errorf("%w: %q", ErrInvalidTarget, account)
+	}
+}
+
+// SameAccount reports whether two account IDs are the same PromptPay
+// account, however they are written (e.g. 081-234-5678 and 66812345678).
+// Invalid IDs match nothing.
+func SameAccount(a, b string) bool {
+	ta, err := ParseTarget(a)
+	if err != nil {
+		return false
+	}
+	tb, err := ParseTarget(b)
+	if err != nil {
+		return false
+	}
+	return ta.Type == tb.Type && ta.encodedID() == tb.encodedID()
+}
+
+// encodedID formats the ID for the merchant account field. Phone numbers
+// are sent as 13 digits in international form: 0812345678 -> 0066812345678.
+func (t Target) encodedID() string {
+	if t.Type != TargetPhone {
+		return t.ID
+	}
+	phone := t.ID
+	if strings.HasPrefix(phone, "0") {
+		phone = "66" + phone[1:]
+	}
+	return strings.Repeat("0", 13-len(phone)) + phone
+}
+
+func (t Target) subTag() string {
+	switch t.Type {
+	case TargetNationalID:
+		return subTagNationalID
+	case TargetEWallet:
+		return subTagEWallet
+	default:
+		return subTagPhone
+	}
+}
+
+// Payload builds the QR payload paying amount (in baht) to the account. An
+// amount of 0 gives a static QR where the payer enters the amount.
+func Payload(account string, amount float64) (string, error) {
+	target, err := ParseTarget(account)
+	if err != nil {
+		return "", err
+	}
+	return target.Payload(amount)
+}
+
+// Payload builds the QR payload paying amount (in baht) to the target. An
+// amount of 0 gives a static QR where the payer enters the amount.
+func (t Target) Payload(amount float64) (string, error) {
+	if amount < 0 {
+		return "", fmt.Errorf("amount cannot be negative: %.2f", amount)
+	}
+
+	method := staticQR
+	if amount > 0 {
+		method = dynamicQR
+	}
+
+	var b strings.Builder
+	b.WriteString(field(tagPayloadFormat, payloadFormat))
+	b.WriteString(field(tagInitiationMethod, method))
+	b.WriteString(field(tagMerchantAccount, field(subTagAID, promptPayAID)+field(t.subTag(), t.encodedID())))
+	b.WriteString(field(tagCountry, countryTH))
+	b.WriteString(field(tagCurrency, currencyTHB))
+	if amount > 0 {
+		b.WriteString(field(tagAmount, fmt.Sprintf("%.2f", amount)))
+	}
+
+	// The checksum covers everything before it, including its own tag and length
+	b.WriteString(tagCRC + "04")
+	fmt.Fprintf(&b, "%04X", CRC16([]byte(b.String())))
+	return b.String(), nil
+}
+
+// field encodes one EMVCo data object: tag, two-digit length, value
+func field(tag, value string) string {
+	return fmt.Sprintf("%s%02d%s", tag, len(value), value)
+}
+
+// CRC16 is the CRC-16/CCITT-FALSE checksum (polynomial 0x1021, initial
+// value 0xFFFF) that ends every EMVCo payload
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, c := range data {
+		crc ^= uint16(c) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
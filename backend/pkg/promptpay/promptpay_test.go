@@ -0,0 +1,108 @@
+package promptpay
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		account  string
+		wantType TargetType
+		wantID   string
+		wantErr  bool
+	}{
+		{account: "081-234-5678", wantType: TargetPhone, wantID: "0812345678"},
+		{account: "66812345678", wantType: TargetPhone, wantID: "66812345678"},
+		{account: "1 1111 11111 11 1", wantType: TargetNationalID, wantID: "1111111111111"},
+		{account: "012345678901234", wantType: TargetEWallet, wantID: "012345678901234"},
+		{account: "812345678", wantErr: true},
+		{account: "1812345678", wantErr: true},
+		{account: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.account, func(t *testing.T) {
+			target, err := ParseTarget(tt.account)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidTarget)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, target.Type)
+			assert.Equal(t, tt.wantID, target.ID)
+		})
+	}
+}
+
+func TestSameAccount(t *testing.T) {
+	assert.True(t, SameAccount("081-234-5678", "66812345678"))
+	assert.True(t, SameAccount("1 1111 11111 11 1", "1111111111111"))
+	assert.False(t, SameAccount("0812345678", "0899999999"))
+	assert.False(t, SameAccount("0812345678", ""))
+	assert.False(t, SameAccount("", ""))
+}
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		amount  float64
+		want    string
+	}{
+		{
+			name:    "Phone, static",
+			account: "0899999999",
+			want:    "00020101021129370016A000000677010111011300668999999995802TH53037646304FE29",
+		},
+		{
+			name:    "Phone, with amount",
+			account: "080-123-4567",
+			amount:  4.22,
+			want:    "00020101021229370016A000000677010111011300668012345675802TH530376454044.22630444FE",
+		},
+		{
+			name:    "National ID",
+			account: "1111111111111",
+			want:    "00020101021129370016A000000677010111021311111111111115802TH530376463047B5A",
+		},
+		{
+			name:    "E-wallet",
+			account: "012345678901234",
+			amount:  80,
+			want:    "00020101021229390016A00000067701011103150123456789012345802TH5303764540580.006304D10E",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := Payload(tt.account, tt.amount)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, payload)
+		})
+	}
+
+	_, err := Payload("0801234567", -1)
+	assert.Error(t, err)
+}
+
+func TestCRC16(t *testing.T) {
+	// Standard check value of CRC-16/CCITT-FALSE
+	assert.Equal(t, uint16(0x29B1), CRC16([]byte("123456789")))
+}
+
+func TestQRCode(t *testing.T) {
+	payload, err := Payload("0801234567", 80)
+	require.NoError(t, err)
+
+	data, err := QRCode(payload, 256)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 256, img.Bounds().Dx())
+}
@@ -0,0 +1,22 @@
+package promptpay
+
+import (
+	"fmt"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// DefaultQRSize is the width and height of generated QR images in pixels
+const DefaultQRSize = 512
+
+// QRCode renders a payload as a PNG image of size x size pixels
+func QRCode(payload string, size int) ([]byte, error) {
+	if size <= 0 {
+		size = DefaultQRSize
+	}
+	png, err := qrcode.Encode(payload, qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render QR code: %w", err)
+	}
+	return png, nil
+}
@@ -1497,6 +1497,7 @@ function OrderStatusBadge({ status }: { status: string }) {
     PAID: { label: 'กำลังทำ', variant: 'default' },
     COMPLETED: { label: 'เสร็จสิ้น', variant: 'secondary' },
     CANCELLED: { label: 'ยกเลิก', variant: 'destructive' },
+    REFUNDED: { label: 'คืนเงินแล้ว', variant: 'destructive' },
   };
 
   const { label, variant } = config[status] || { label: status, variant: 'outline' as const };
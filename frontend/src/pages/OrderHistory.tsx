@@ -256,6 +256,12 @@ export function OrderHistory() {
             Cancelled
           </Badge>
         );
+      case "REFUNDED":
+        return (
+          <Badge variant="outline" className="bg-orange-50 text-orange-700 border-orange-200">
+            Refunded
+          </Badge>
+        );
       default:
         return <Badge variant="secondary">{status}</Badge>;
     }
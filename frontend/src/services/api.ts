@@ -2,6 +2,8 @@ import axios, { AxiosError } from 'axios';
 import type {
   MenuItem,
   Order,
+  OrderItem,
+  QueueResponse,
   CreateOrderRequest,
   ApiError,
   DashboardStats,
@@ -12,6 +14,19 @@ import type {
   CreateMenuItemRequest,
   UpdateMenuItemRequest,
   PaymentMethod,
+  OrderStatusHistory,
+  LoginResponse,
+  User,
+  Shop,
+  PromptPayQR,
+  RefundRequest,
+  SyncOrder,
+  SyncResult,
+  Inventory,
+  ItemStock,
+  ItemStockRequest,
+  Ingredient,
+  IngredientRequest,
 } from '@/types/api';
 
 const api = axios.create({
@@ -22,6 +37,17 @@ const api = axios.create({
   },
 });
 
+// POS routes need a staff credential; send the one saved at login, if any
+const STAFF_STORAGE_KEY = 'barvidva_staff_auth';
+
+api.interceptors.request.use((config) => {
+  const token = sessionStorage.getItem(STAFF_STORAGE_KEY);
+  if (token && config.url?.startsWith('/pos/')) {
+    config.headers.Authorization = `Bearer ${token}`;
+  }
+  return config;
+});
+
 // Response interceptor for error handling
 api.interceptors.response.use(
   (response) => response,
@@ -49,6 +75,11 @@ export const menuApi = {
     const { data } = await api.get<string[]>('/categories');
     return data;
   },
+
+  getShops: async (): Promise<Shop[]> => {
+    const { data } = await api.get<Shop[]>('/shops');
+    return data;
+  },
 };
 
 // Order API
@@ -63,15 +94,21 @@ export const orderApi = {
     return data;
   },
 
+  getPromptPay: async (id: string): Promise<PromptPayQR> => {
+    const { data } = await api.get<PromptPayQR>(`/orders/${id}/promptpay`);
+    return data;
+  },
+
+  // Returns preparing orders followed by orders ready for pickup
   getQueue: async (category?: string): Promise<Order[]> => {
-    const { data } = await api.get<Order[]>('/queue', {
+    const { data } = await api.get<QueueResponse>('/queue', {
       params: category ? { category } : undefined,
     });
-    return data;
+    return [...(data.preparing ?? []), ...(data.ready ?? [])];
   },
 };
 
-// POS API (public routes for staff-only POS system)
+// POS API (staff credential required unless the server sets POS_PUBLIC)
 export const posApi = {
   getPendingOrders: async (category?: string): Promise<Order[]> => {
     const { data } = await api.get<Order[]>('/pos/orders/pending', {
@@ -87,17 +124,40 @@ export const posApi = {
     return data;
   },
 
-  markPaid: async (orderId: string, paymentMethod?: PaymentMethod): Promise<Order> => {
+  // Replaces the items of an unpaid order; the server recalculates the total
+  updateItems: async (orderId: string, items: OrderItem[]): Promise<Order> => {
+    const { data } = await api.put<Order>(`/pos/orders/${orderId}/items`, { items });
+    return data;
+  },
+
+  // amount defaults to the outstanding balance; received is the cash handed over
+  markPaid: async (
+    orderId: string,
+    paymentMethod?: PaymentMethod,
+    payment?: { amount?: number; received?: number; reference?: string }
+  ): Promise<Order> => {
     const { data } = await api.put<Order>(`/pos/orders/${orderId}/mark-paid`, {
       payment_method: paymentMethod,
+      ...payment,
     });
     return data;
   },
 
+  markReady: async (orderId: string): Promise<Order> => {
+    const { data } = await api.put<Order>(`/pos/orders/${orderId}/ready`);
+    return data;
+  },
+
   completeOrder: async (orderId: string): Promise<Order> => {
     const { data } = await api.put<Order>(`/pos/orders/${orderId}/complete`);
     return data;
   },
+
+  // Uploads orders taken offline; one result per order, in the same order
+  syncOrders: async (orders: SyncOrder[]): Promise<SyncResult[]> => {
+    const { data } = await api.post<{ results: SyncResult[] }>('/pos/orders/sync', { orders });
+    return data.results;
+  },
 };
 
 // Create authenticated axios instance
@@ -142,6 +202,12 @@ export const staffApi = {
     return data;
   },
 
+  markReady: async (password: string, orderId: string): Promise<Order> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.put<Order>(`/staff/orders/${orderId}/ready`);
+    return data;
+  },
+
   completeOrder: async (password: string, orderId: string): Promise<Order> => {
     const authApi = createAuthApi(password);
     const { data } = await authApi.put<Order>(`/staff/orders/${orderId}/complete`);
@@ -244,6 +310,33 @@ export const adminApi = {
     await authApi.delete(`/admin/menu/${id}`);
   },
 
+  // Inventory: stock of menu items and ingredients
+  getInventory: async (password: string, lowStockOnly = false): Promise<Inventory> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.get<Inventory>('/admin/inventory', {
+      params: lowStockOnly ? { low_stock: true } : undefined,
+    });
+    return data;
+  },
+
+  setItemStock: async (password: string, id: number, stock: ItemStockRequest): Promise<ItemStock> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.put<ItemStock>(`/admin/inventory/items/${id}`, stock);
+    return data;
+  },
+
+  createIngredient: async (password: string, ingredient: IngredientRequest): Promise<Ingredient> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.post<Ingredient>('/admin/inventory/ingredients', ingredient);
+    return data;
+  },
+
+  updateIngredient: async (password: string, id: number, ingredient: IngredientRequest): Promise<Ingredient> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.put<Ingredient>(`/admin/inventory/ingredients/${id}`, ingredient);
+    return data;
+  },
+
   // Orders (admin can see all orders)
   getAllOrders: async (password: string): Promise<Order[]> => {
     const authApi = createAuthApi(password);
@@ -251,6 +344,19 @@ export const adminApi = {
     return data;
   },
 
+  getOrderHistory: async (password: string, id: string): Promise<OrderStatusHistory[]> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.get<OrderStatusHistory[]>(`/admin/orders/${id}/history`);
+    return data;
+  },
+
+  // Refund a paid order, entirely or some of its items (owner only)
+  refundOrder: async (password: string, id: string, refund: RefundRequest): Promise<Order> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.post<Order>(`/admin/orders/${id}/refund`, refund);
+    return data;
+  },
+
   // Delete orders
   deleteOrders: async (password: string, orderIds: string[]): Promise<{ deleted_count: number }> => {
     const authApi = createAuthApi(password);
@@ -265,6 +371,44 @@ export const adminApi = {
     const { data } = await authApi.delete<{ deleted_count: number }>('/admin/orders?all=true');
     return data;
   },
+
+  // Shops (owner only)
+  getShops: async (password: string): Promise<Shop[]> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.get<Shop[]>('/admin/shops');
+    return data;
+  },
+
+  createShop: async (password: string, shop: Pick<Shop, 'code' | 'name' | 'promptpay_id'> & { active?: boolean }): Promise<Shop> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.post<Shop>('/admin/shops', shop);
+    return data;
+  },
+
+  updateShop: async (password: string, id: number, shop: Pick<Shop, 'name' | 'active' | 'promptpay_id'>): Promise<Shop> => {
+    const authApi = createAuthApi(password);
+    const { data } = await authApi.put<Shop>(`/admin/shops/${id}`, shop);
+    return data;
+  },
+};
+
+// Auth API (per-user accounts; the token is used wherever a password was passed)
+export const authApi = {
+  login: async (username: string, password: string): Promise<LoginResponse> => {
+    const { data } = await api.post<LoginResponse>('/auth/login', { username, password });
+    return data;
+  },
+
+  logout: async (token: string): Promise<void> => {
+    const authApi = createAuthApi(token);
+    await authApi.post('/auth/logout');
+  },
+
+  me: async (token: string): Promise<User> => {
+    const authApi = createAuthApi(token);
+    const { data } = await authApi.get<User>('/auth/me');
+    return data;
+  },
 };
 
 export default api;
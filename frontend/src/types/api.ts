@@ -5,28 +5,206 @@ export type OrderStatus =
   | 'PAID'
   | 'READY'
   | 'COMPLETED'
-  | 'CANCELLED';
+  | 'CANCELLED'
+  | 'REFUNDED'; // paid, then given back in full
+
+// A booth at the fair; its code is the category of its menu items
+export interface Shop {
+  id: number;
+  code: string;
+  name: string;
+  active: boolean;
+  created_at: string;
+  updated_at: string;
+  promptpay_id?: string | null; // account for this shop's PromptPay QR codes
+}
 
 export interface MenuItem {
   id: number;
   name: string;
   price: number;
   category?: string;
+  shop_id?: number | null;
   image_url?: string;
   available: boolean;
   created_at: string;
   updated_at: string;
+  modifier_groups?: ModifierGroup[]; // left out of an update, the item keeps its groups
+  bundle_slots?: BundleSlot[]; // makes the item a bundle (set meal); kept when left out of an update
+  stock?: number | null; // how many are left when tracked; set through the inventory
+  low_stock_threshold?: number | null;
+  sold_out_at?: string | null; // made unavailable by running out
+}
+
+// Stock shared by the menu items whose recipes use it
+export interface Ingredient {
+  id: number;
+  name: string;
+  unit: string;
+  shop_id?: number | null;
+  stock: number;
+  low_stock_threshold?: number | null;
+  created_at: string;
+  updated_at: string;
+}
+
+// How much of an ingredient one of a menu item uses
+export interface RecipeItem {
+  ingredient_id: number;
+  quantity: number;
+  name?: string; // of the ingredient; read-only
+  unit?: string; // of the ingredient; read-only
+}
+
+export interface ItemStock {
+  menu_item_id: number;
+  name: string;
+  shop_id?: number | null;
+  available: boolean;
+  stock: number | null; // null when only the recipe is tracked
+  low_stock_threshold?: number | null;
+  sold_out_at?: string | null;
+  reserved: number; // held by unpaid orders
+  remaining: number | null;
+  low_stock: boolean;
+  recipe?: RecipeItem[];
+}
+
+export interface IngredientStock extends Ingredient {
+  reserved: number; // held by unpaid orders
+  remaining: number;
+  low_stock: boolean;
+}
+
+export interface Inventory {
+  items: ItemStock[];
+  ingredients: IngredientStock[];
+}
+
+export interface ItemStockRequest {
+  stock: number | null; // null stops tracking the item's own stock
+  low_stock_threshold?: number | null;
+  recipe?: Pick<RecipeItem, 'ingredient_id' | 'quantity'>[]; // left out keeps the recipe, empty removes it
+}
+
+export type IngredientRequest = Pick<Ingredient, 'name' | 'unit' | 'stock'> &
+  Partial<Pick<Ingredient, 'shop_id' | 'low_stock_threshold'>>;
+
+// One part of a bundle, e.g. its drink; a slot with one option is fixed
+export interface BundleSlot {
+  id?: number; // left out for new slots
+  name: string;
+  quantity: number;
+  options: BundleOption[];
+}
+
+export interface BundleOption {
+  menu_item_id: number;
+  price_delta: number; // on top of the bundle price
+  name?: string; // of the menu item; read-only
+  available?: boolean; // of the menu item; read-only
+}
+
+// Picks the menu item for a slot of a bundle being ordered
+export interface BundleChoice {
+  slot_id: number;
+  menu_item_id: number;
+}
+
+// A choice offered with a menu item, such as size or toppings
+export interface ModifierGroup {
+  id?: number; // left out for new groups
+  name: string;
+  required: boolean;
+  min_select: number;
+  max_select: number;
+  modifiers: Modifier[];
+}
+
+export interface Modifier {
+  id?: number; // left out for new modifiers
+  name: string;
+  price_delta: number;
+  available: boolean;
+}
+
+// A modifier picked on an order line; only modifier_id is needed when ordering
+export interface OrderItemModifier {
+  modifier_id: number;
+  group?: string;
+  name?: string;
+  price_delta?: number;
 }
 
 export interface OrderItem {
+  id?: number; // set on saved orders; refunds refer to it
   menu_item_id: number;
   name: string;
-  price: number;
+  price: number; // unit price including the modifiers and bundle options
   quantity: number;
+  shop_id?: number | null;
+  modifiers?: OrderItemModifier[];
+  choices?: BundleChoice[]; // when ordering a bundle
+  components?: OrderItem[]; // the items in a bundle line, priced 0
+  bundle_item_id?: number;
+}
+
+// One shop's part of an order with items from several shops
+export interface OrderTicket {
+  order_id: string;
+  shop_id: number;
+  category?: string;
+  status: OrderStatus;
+  queue_number?: number;
+  created_at: string;
+  ready_at?: string;
+  completed_at?: string;
+  items: OrderItem[];
 }
 
 export type PaymentMethod = 'PROMPTPAY' | 'CASH';
 
+// Server-generated PromptPay QR for an order's outstanding balance
+export interface PromptPayQR {
+  order_id: string;
+  amount: number;
+  account: string;
+  payload: string; // EMVCo payload
+  png: string; // base64 PNG image
+}
+
+// One entry in an order's payments ledger
+export interface Payment {
+  id: number;
+  order_id: string;
+  amount: number;
+  method: PaymentMethod | null;
+  received: number; // handed over by the customer
+  change: number;
+  reference?: string;
+  verified_by?: string; // payment provider that confirmed the reference
+  actor: string;
+  created_at: string;
+}
+
+// Money given back for some or all of an order's items
+export interface Refund {
+  id: number;
+  order_id: string;
+  amount: number;
+  method: PaymentMethod | null; // how the money was given back
+  reason: string;
+  actor: string;
+  created_at: string;
+  items: { order_item_id: number; quantity: number; amount: number }[];
+}
+
+export interface RefundRequest {
+  items?: { order_item_id: number; quantity?: number }[]; // omit to refund everything not refunded yet
+  reason: string;
+  payment_method?: PaymentMethod; // defaults to how the order was mostly paid
+}
+
 export interface Order {
   id: string;
   customer_name: string;
@@ -35,11 +213,38 @@ export interface Order {
   status: OrderStatus;
   created_at: string;
   paid_at?: string;
+  ready_at?: string;
   completed_at?: string;
+  refunded_at?: string;
+  client_id?: string; // tablet UUID of an order synced after being taken offline
   queue_number?: number;
   date_key: number;
-  payment_method?: PaymentMethod | null;
+  business_date: string; // Full date incl. year; id repeats every year
+  payment_method?: PaymentMethod | null; // method of the largest payment
+  payments?: Payment[]; // the order stays PENDING_PAYMENT until these cover total_amount; staff routes only
+  refunds?: Refund[]; // partial refunds keep the status; REFUNDED once every item is; staff routes only
   category?: string;
+  shop_id?: number | null;
+  tickets?: OrderTicket[]; // per-shop tickets; queue lists show each ticket as its own order
+}
+
+// One recorded status change of an order (admin audit trail)
+export interface OrderStatusHistory {
+  id: number;
+  order_id: string;
+  business_date: string;
+  from_status: OrderStatus;
+  to_status: OrderStatus;
+  actor: string;
+  reason: string;
+  shop_id?: number; // set when only this shop's ticket changed
+  created_at: string;
+}
+
+// Public queue board: orders being prepared and orders waiting for pickup
+export interface QueueResponse {
+  preparing: Order[];
+  ready: Order[];
 }
 
 export interface CreateOrderRequest {
@@ -50,10 +255,66 @@ export interface CreateOrderRequest {
   category?: string;
 }
 
+// An order taken while the POS was offline, uploaded with POST /pos/orders/sync
+export interface SyncOrder {
+  client_id: string; // UUID chosen by the tablet; re-sending it never creates a second order
+  customer_name: string;
+  items: OrderItem[];
+  category?: string;
+  created_at: string; // when it was taken, on the tablet's clock
+  payment_method?: PaymentMethod; // set when already paid at the counter
+}
+
+export type SyncStatus = 'CREATED' | 'DUPLICATE' | 'CONFLICT' | 'INVALID';
+
+export interface SyncConflict {
+  item_index: number;
+  menu_item_id: number;
+  reason: 'ITEM_NOT_FOUND' | 'ITEM_UNAVAILABLE' | 'PRICE_CHANGED' | 'MODIFIERS_CHANGED' | 'BUNDLE_CHANGED' | 'OUT_OF_STOCK';
+  client_price?: number;
+  current_price?: number;
+}
+
+export interface SyncResult {
+  client_id: string;
+  status: SyncStatus;
+  order_id?: string;
+  queue_number?: number;
+  order?: Order;
+  conflicts?: SyncConflict[];
+  error?: string;
+}
+
+export type Role = 'cashier' | 'kitchen' | 'shop-manager' | 'owner';
+
+// Staff account (never includes the password hash)
+export interface User {
+  id: number;
+  username: string;
+  display_name: string;
+  role: Role;
+  active: boolean;
+  shop_ids: number[]; // shops the user works at; owners see every shop
+  created_at: string;
+  updated_at: string;
+}
+
+// Session token to send as "Authorization: Bearer <token>"
+export interface LoginResponse {
+  token: string;
+  expires_at: string;
+  user: User;
+}
+
+export interface FieldError {
+  field: string;
+  message: string;
+}
+
 export interface ApiError {
   error: string;
   code: string;
-  details?: Record<string, unknown>;
+  details?: FieldError[]; // set for VALIDATION_ERROR
 }
 
 // Cart state for customer ordering
@@ -73,13 +334,18 @@ export interface DashboardStats {
   total_revenue: number;
   pending_orders: number;
   queue_length: number;
+  ready_orders: number;
   completed_orders: number;
   cancelled_orders: number;
   avg_completion_time_mins: number;
+  avg_prep_time_mins: number; // paid -> ready
+  avg_pickup_wait_mins: number; // ready -> completed
   promptpay_revenue: number;
   cash_revenue: number;
   promptpay_count: number;
   cash_count: number;
+  refunded_orders: number;
+  refund_total: number; // revenue figures are already net of refunds
   start_date: string;
   end_date: string;
 }
@@ -95,6 +361,15 @@ export interface PopularItem {
   name: string;
   quantity_sold: number;
   revenue: number;
+  modifiers: PopularModifier[];
+}
+
+// How often a modifier was picked with a popular item
+export interface PopularModifier {
+  group: string;
+  name: string;
+  quantity_sold: number;
+  revenue: number; // from its price delta
 }
 
 export interface DailyBreakdown {
@@ -92,9 +92,27 @@ describe('orderUtils', () => {
       });
     });
 
+    it('parses extended order ID past 999 orders', () => {
+      const result = parseOrderId('14011000');
+      expect(result).toEqual({
+        dayOfMonth: 14,
+        month: 1,
+        sequence: 1000,
+      });
+    });
+
+    it('parses order ID with shop prefix', () => {
+      const result = parseOrderId('B1401001');
+      expect(result).toEqual({
+        dayOfMonth: 14,
+        month: 1,
+        sequence: 1,
+      });
+    });
+
     it('throws error for invalid length', () => {
       expect(() => parseOrderId('1401')).toThrow('Invalid order ID format');
-      expect(() => parseOrderId('14010001')).toThrow('Invalid order ID format');
+      expect(() => parseOrderId('140100001')).toThrow('Invalid order ID format');
     });
   });
 
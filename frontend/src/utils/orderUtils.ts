@@ -31,7 +31,8 @@ export function getCurrentDateKey(): number {
 
 /**
  * Parse order ID to extract date components
- * @param orderId Order ID in DDMMXXX format
+ * @param orderId Order ID in DDMMXXX or extended DDMMXXXX format, optionally
+ * behind a 1-3 letter shop prefix (e.g. "B1401001")
  * @returns { dayOfMonth, month, sequence }
  */
 export function parseOrderId(orderId: string): {
@@ -39,14 +40,15 @@ export function parseOrderId(orderId: string): {
   month: number;
   sequence: number;
 } {
-  if (orderId.length !== 7) {
+  const match = /^[A-Z]{0,3}(\d{2})(\d{2})(\d{3,4})$/.exec(orderId);
+  if (!match) {
     throw new Error('Invalid order ID format');
   }
 
   return {
-    dayOfMonth: parseInt(orderId.substring(0, 2), 10),
-    month: parseInt(orderId.substring(2, 4), 10),
-    sequence: parseInt(orderId.substring(4, 7), 10),
+    dayOfMonth: parseInt(match[1], 10),
+    month: parseInt(match[2], 10),
+    sequence: parseInt(match[3], 10),
   };
 }
 